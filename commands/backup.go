@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/backup"
+)
+
+func newBackupWalletCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backupwallet {pripassword} [destination]",
+		Short: "write an encrypted backup of the wallet database",
+		Example: `
+		backupwallet pripassword
+		backupwallet pripassword /mnt/usb/
+		backupwallet pripassword /mnt/usb/wallet.backup
+		`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			destination := ""
+			if len(args) > 1 {
+				destination = args[1]
+			}
+			_, err := backupWallet(args[0], destination)
+			return err
+		},
+	}
+}
+
+func newVerifyBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verifybackup {file} {pripassword}",
+		Short: "check the checksum of a wallet backup and decrypt it",
+		Example: `
+		verifybackup wallet-20260101T000000.000000000Z.backup pripassword
+		`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			helper = &JsonCmdHelper{
+				JsonCmd: &qitmeerjson.VerifyBackupCmd{
+					Path:       args[0],
+					Passphrase: args[1],
+				},
+				Run: func(cmd interface{}, _ *wallet.Wallet) (interface{}, error) {
+					return walletrpc.VerifyBackup(cmd)
+				},
+			}
+			_, err := helper.Call()
+			return err
+		},
+	}
+}
+
+func newRestoreBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restorebackup {file} {pripassword}",
+		Short: "restore the wallet database from a backup",
+		Example: `
+		restorebackup wallet-20260101T000000.000000000Z.backup pripassword
+		`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return restoreBackup(args[0], args[1])
+		},
+	}
+}
+
+func backupWallet(passphrase, destination string) (interface{}, error) {
+	cmd := &qitmeerjson.BackupWalletCmd{Passphrase: passphrase}
+	if destination != "" {
+		cmd.Destination = &destination
+	}
+	helper = &JsonCmdHelper{
+		JsonCmd: cmd,
+		Run: func(cmd interface{}, w *wallet.Wallet) (interface{}, error) {
+			return walletrpc.BackupWallet(cmd, w)
+		},
+	}
+	return helper.Call()
+}
+
+// restoreBackup restores the wallet database of the configured network and
+// dbtype from the backup path.  It runs offline, and refuses to overwrite an
+// existing wallet database, which must be moved away first.
+func restoreBackup(path, passphrase string) error {
+	netDir := networkDir(config.Cfg.AppDataDir, config.ActiveNet)
+	dbType := config.Cfg.WalletDbType()
+	dbPath, err := config.WalletDbPath(netDir, dbType)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restoring %s to %s...\n", path, dbPath)
+	if err := backup.Restore(path, []byte(passphrase), dbType, dbPath); err != nil {
+		return fmt.Errorf("restorebackup: %w", err)
+	}
+	fmt.Printf("The wallet has been restored to %s.\n", dbPath)
+	return nil
+}
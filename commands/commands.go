@@ -100,6 +100,17 @@ func bindFlags() error {
 	pf.StringP("logdir", "L", uc.LogDir, "log data path")
 	pf.Bool("create", uc.Create, "Create a new wallet")
 	pf.StringP("network", "N", uc.Network, "network")
+	pf.String("dbtype", uc.DbType, "wallet database driver {bdb, ldb}")
+	pf.String("backupdir", uc.BackupDir, "wallet backup directory, default appdatadir/backups/network")
+	pf.Uint32("backupinterval", uc.BackupInterval, "minutes between scheduled wallet backups of the web server, 0 disables them")
+	pf.Uint32("backupkeep", uc.BackupKeep, "number of scheduled wallet backups to keep")
+	pf.Uint32("prunedepth", uc.PruneDepth, "prune spent transactions mined more than prunedepth block orders ago, 0 disables pruning")
+	pf.Uint32("hdpurpose", uc.HDPurpose, "BIP0043 purpose of the key derivation path of new wallets")
+	pf.Uint32("hdcointype", uc.HDCoinType, "coin type of the key derivation path of new wallets, 813 is registered for Qitmeer")
+	pf.Uint32("keypoolsize", uc.KeyPoolSize, "number of unused addresses derived ahead on each branch of an account")
+	pf.Uint32("maxkeypoolsize", uc.MaxKeyPoolSize, "largest key pool size keypoolrefill accepts")
+	pf.String("kdf", uc.KDF, "key derivation function of the passphrases of new wallets {scrypt, argon2id}")
+	pf.Duration("kdf-target", uc.KDFTarget, "tune the kdf costs of new wallets to take about this long per derivation, e.g. 1s, 0 uses fixed defaults")
 
 	pf.Bool("ui", uc.UI, "Start Wallet with RPC and webUI interface")
 	pf.StringArray("listeners", uc.Listeners, "rpc listens")
@@ -112,6 +123,7 @@ func bindFlags() error {
 	pf.Bool("disabletls", uc.DisableTLS, "disable TLS for the RPC server")
 
 	pf.Uint32("confirmations", uc.Confirmations, "Number of block confirmations ")
+	pf.StringArray("coinconfirmations", uc.CoinConfirmations, "Number of block confirmations per coin, as coin=n, e.g. MEER=10")
 	pf.Int64("mintxfee", uc.MinTxFee, "The minimum transaction fee in QIT/kB default 20000 (aka. 0.0002 MEER/KB)")
 	pf.StringArray("apis", uc.APIs, "enabled APIs")
 
@@ -135,6 +147,17 @@ func bindFlags() error {
 	viper.SetDefault("LogDir", dc.LogDir)
 	viper.SetDefault("Create", dc.Create)
 	viper.SetDefault("Network", dc.Network)
+	viper.SetDefault("DbType", dc.DbType)
+	viper.SetDefault("BackupDir", dc.BackupDir)
+	viper.SetDefault("BackupInterval", dc.BackupInterval)
+	viper.SetDefault("BackupKeep", dc.BackupKeep)
+	viper.SetDefault("PruneDepth", dc.PruneDepth)
+	viper.SetDefault("HDPurpose", dc.HDPurpose)
+	viper.SetDefault("HDCoinType", dc.HDCoinType)
+	viper.SetDefault("KeyPoolSize", dc.KeyPoolSize)
+	viper.SetDefault("MaxKeyPoolSize", dc.MaxKeyPoolSize)
+	viper.SetDefault("KDF", dc.KDF)
+	viper.SetDefault("KDFTarget", dc.KDFTarget)
 	viper.SetDefault("UI", dc.UI)
 	viper.SetDefault("Listeners", dc.Listeners)
 	viper.SetDefault("RPCUser", dc.RPCUser)
@@ -144,6 +167,7 @@ func bindFlags() error {
 	viper.SetDefault("DisableRPC", dc.DisableRPC)
 	viper.SetDefault("DisableTLS", dc.DisableTLS)
 	viper.SetDefault("Confirmations", dc.Confirmations)
+	viper.SetDefault("CoinConfirmations", dc.CoinConfirmations)
 	viper.SetDefault("MinTxFee", dc.MinTxFee)
 	viper.SetDefault("APIs", dc.APIs)
 	viper.SetDefault("QServer", dc.QServer)
@@ -164,6 +188,17 @@ func bindFlags() error {
 	viper.BindPFlag("LogDir", pf.Lookup("logdir"))
 	viper.BindPFlag("Create", pf.Lookup("create"))
 	viper.BindPFlag("Network", pf.Lookup("network"))
+	viper.BindPFlag("DbType", pf.Lookup("dbtype"))
+	viper.BindPFlag("BackupDir", pf.Lookup("backupdir"))
+	viper.BindPFlag("BackupInterval", pf.Lookup("backupinterval"))
+	viper.BindPFlag("BackupKeep", pf.Lookup("backupkeep"))
+	viper.BindPFlag("PruneDepth", pf.Lookup("prunedepth"))
+	viper.BindPFlag("HDPurpose", pf.Lookup("hdpurpose"))
+	viper.BindPFlag("HDCoinType", pf.Lookup("hdcointype"))
+	viper.BindPFlag("KeyPoolSize", pf.Lookup("keypoolsize"))
+	viper.BindPFlag("MaxKeyPoolSize", pf.Lookup("maxkeypoolsize"))
+	viper.BindPFlag("KDF", pf.Lookup("kdf"))
+	viper.BindPFlag("KDFTarget", pf.Lookup("kdf-target"))
 
 	viper.BindPFlag("UI", pf.Lookup("ui"))
 	viper.BindPFlag("Listeners", pf.Lookup("listeners"))
@@ -176,6 +211,7 @@ func bindFlags() error {
 	viper.BindPFlag("DisableTLS", pf.Lookup("disabletls"))
 
 	viper.BindPFlag("Confirmations", pf.Lookup("confirmations"))
+	viper.BindPFlag("CoinConfirmations", pf.Lookup("coinconfirmations"))
 	viper.BindPFlag("MinTxFee", pf.Lookup("mintxfee"))
 	viper.BindPFlag("APIs", pf.Lookup("apis"))
 
@@ -210,6 +246,15 @@ func initConfig() {
 	cfg := config.NewDefaultConfig()
 	viper.Unmarshal(cfg)
 
+	// Validate the settings and parse the ones kept in parsed form, the
+	// wallet reads config.Cfg.
+	for _, c := range []*config.Config{cfg, config.Cfg} {
+		if err := c.Check(); err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid config:", err)
+			os.Exit(-1)
+		}
+	}
+
 	userConf = cfg
 
 	config.ActiveNet = utils.GetNetParams(userConf.Network)
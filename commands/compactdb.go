@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+func newCompactDBCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "compactdb",
+		Short: "rewrite the wallet database to reclaim the space of deleted and pruned records",
+		Example: `
+		compactdb
+		`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return compactDB()
+		},
+	}
+}
+
+// compactDB rewrites the wallet database of the configured dbtype into a new
+// database, verifies the copy and replaces the database with it.  bbolt never
+// shrinks its file, the copy only holds the live pages.  It runs offline, the
+// wallet must not be open.
+func compactDB() error {
+	dbType := config.Cfg.WalletDbType()
+	netDir := networkDir(config.Cfg.AppDataDir, config.ActiveNet)
+	dbPath, err := config.WalletDbPath(netDir, dbType)
+	if err != nil {
+		return err
+	}
+	tmpPath := dbPath + ".compact"
+	oldPath := dbPath + ".old"
+	for _, path := range []string{tmpPath, oldPath} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, remove it first", path)
+		}
+	}
+	before, err := diskSize(dbPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := walletdb.Open(dbType, dbPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", dbPath, err)
+	}
+	dst, err := walletdb.Create(dbType, tmpPath)
+	if err != nil {
+		src.Close()
+		return fmt.Errorf("create %s: %w", tmpPath, err)
+	}
+
+	fmt.Printf("Rewriting %s...\n", dbPath)
+	err = walletdb.CopyDB(dst, src)
+	if err == nil {
+		fmt.Println("Verifying the copy...")
+		err = walletdb.CompareDB(src, dst)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return fmt.Errorf("compactdb: %w", err)
+	}
+
+	// The database is only replaced once the copy was verified; the old
+	// one is kept if the replacement fails half way.
+	if err := os.Rename(dbPath, oldPath); err != nil {
+		os.RemoveAll(tmpPath)
+		return fmt.Errorf("compactdb: %w", err)
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return fmt.Errorf("compactdb: %w, the wallet database was moved to %s", err, oldPath)
+	}
+	if err := os.RemoveAll(oldPath); err != nil {
+		return fmt.Errorf("compactdb: remove %s: %w", oldPath, err)
+	}
+
+	after, err := diskSize(dbPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The wallet database has been compacted from %d to %d bytes.\n", before, after)
+	return nil
+}
+
+// diskSize returns the size of the file or directory at path.
+func diskSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
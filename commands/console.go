@@ -7,6 +7,7 @@ import (
 	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
 	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
 	"github.com/Qitmeer/qitmeer-wallet/util"
+	"github.com/Qitmeer/qitmeer-wallet/utils"
 	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
 	"github.com/Qitmeer/qitmeer-wallet/wallet"
 	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
@@ -15,7 +16,6 @@ import (
 	"github.com/Qitmeer/qng/crypto/ecc/secp256k1"
 	"github.com/Qitmeer/qng/qx"
 	"github.com/spf13/cobra"
-	"path/filepath"
 	"runtime"
 )
 
@@ -56,7 +56,8 @@ func AddConsoleCommand() {
 func CreatWallet(needMnemonic string) {
 	b := checkWalletIeExist(config.Cfg)
 	if b {
-		fmt.Println("db is exist", filepath.Join(networkDir(config.Cfg.AppDataDir, config.ActiveNet), config.WalletDbName))
+		dbPath, _ := config.WalletDbPath(networkDir(config.Cfg.AppDataDir, config.ActiveNet), config.Cfg.WalletDbType())
+		fmt.Println("db is exist", dbPath)
 		return
 	} else {
 		_, err := createWallet(needMnemonic)
@@ -125,14 +126,19 @@ func printHelp() {
 	fmt.Println("Usage:")
 	fmt.Println("\t<command> [arguments]")
 	fmt.Println("\tThe commands are:")
-	fmt.Println("\t<createNewAccount> : Create a new account. Parameter: [account]")
+	fmt.Println("\t<createNewAccount> : Create a new account. Parameter: [account] [addrtype:pkh,pk]")
+	fmt.Println("\t<renameAccount> : Rename an account. Parameter: [oldaccount] [newaccount]")
+	fmt.Println("\t<setAccountAddrType> : Set the type of the addresses handed out by an account. Parameter: [account] [addrtype:pkh,pk]")
 	fmt.Println("\t<getBalance> : Query the specified address balance. Parameter: [address]")
 	fmt.Println("\t<listAccountsBalance> : Obtain all account balances. Parameter: []")
 	fmt.Println("\t<getTx> : Gets transaction by ID. Parameter: [txID]")
 	fmt.Println("\t<getListTxByAddr> : Gets all transactions that affect specified address, one transaction could affect MULTIPLE addresses. Parameter: [address] [stype:in,out,all]")
 	fmt.Println("\t<getBillByAddr> : Gets all payments that affect specified address, one payment could affect only ONE address. Parameter: [address] [filter:in,out,all]")
 	fmt.Println("\t<getNewAddress> : Create a new address under the account. Parameter: [account]")
-	fmt.Println("\t<getAddressesByAccount> : Check all addresses under the account. Parameter: [account]")
+	fmt.Println("\t<getAddressesByAccount> : Check all addresses under the account with their usage and received totals. Parameter: [account]")
+	fmt.Println("\t<getUnusedAddress> : Get the first address under the account which has not received any output. Parameter: [account]")
+	fmt.Println("\t<keypoolrefill> : Derive the unused addresses of the key pool of every account. Parameter: [newsize]")
+	fmt.Println("\t<splitseed> : Split the wallet seed into Shamir shares, the wallet must be unlocked. Parameter: {groups, e.g. 3of5 or 2of3,3of5} [groupthreshold]")
 	fmt.Println("\t<getAccountByAddress> : Inquire about the account number of the address. Parameter: [address]")
 	fmt.Println("\t<importPrivKey> : Import private key. Parameter: [priKey]")
 	fmt.Println("\t<importWifPrivKey> : Import wif format private key. Parameter: [priKey]")
@@ -141,6 +147,15 @@ func printHelp() {
 	fmt.Println("\t<sendToAddress> : Transfer transaction. Parameter: [address] [coin] [num]")
 	fmt.Println("\t<updateblock> : Update Wallet Block. Parameter: []")
 	fmt.Println("\t<syncheight> : Current Synchronized Data Height. Parameter: []")
+	fmt.Println("\t<audit> : Check wallet utxos against the node. Parameter: [repair]")
+	fmt.Println("\t<rebuildbalances> : Rebuild the account balances from the wallet utxos. Parameter: []")
+	fmt.Println("\t<export> : Export the transaction history. Parameter: [csv|jsonl|ofx] [account] [file]")
+	fmt.Println("\t<backupwallet> : Write an encrypted backup of the wallet. Parameter: [password] [destination]")
+	fmt.Println("\t<walletpassphrasechange> : Change the wallet password. Parameter: [oldpassword] [newpassword] [public]")
+	fmt.Println("\t<upgradekdf> : Re-wrap the master keys under a stronger key derivation function, the wallet must be unlocked. Parameter: [pripassword] [scrypt|argon2id] [target, e.g. 1s]")
+	fmt.Println("\t<sweepmasterkey> : Move the funds of the master key address of older wallets to the default account, the key is imported and rescanned when missing, the wallet must be unlocked. Parameter: []")
+	fmt.Println("\t<showmnemonic> : Show the mnemonic the wallet was created from after confirmation, the wallet must be unlocked. Parameter: []")
+	fmt.Println("\t<verifymnemonic> : Check that a mnemonic, entered when prompted, recovers the wallet. Parameter: []")
 	fmt.Println("\t<unlock> : Unlock Wallet. Parameter: [password]")
 	fmt.Println("\t<help> : help")
 	fmt.Println("\t<exit> : Exit command mode")
@@ -153,7 +168,11 @@ func checkWalletIeExist(cfg *config.Config) bool {
 	if err != nil {
 		return false
 	}
-	dbPath := filepath.Join(netDir, config.WalletDbName)
+	dbPath, err := config.WalletDbPath(netDir, cfg.WalletDbType())
+	if err != nil {
+		fmt.Println("WalletDbPath ", "err", err.Error())
+		return false
+	}
 	if fi, err := util.FileExists(dbPath); err != nil {
 		fmt.Println("FileExists ", "err", err.Error())
 		return false
@@ -162,10 +181,13 @@ func checkWalletIeExist(cfg *config.Config) bool {
 	}
 }
 
-func createNewAccount(arg string) error {
+func createNewAccount(arg string, addrType string) error {
 	cmd := &qitmeerjson.CreateNewAccountCmd{
 		Account: arg,
 	}
+	if addrType != "" {
+		cmd.AddrType = &addrType
+	}
 	msg, err := walletrpc.CreateNewAccount(cmd, w)
 	if err != nil {
 		fmt.Println("createNewAccount", "err", err.Error())
@@ -174,6 +196,35 @@ func createNewAccount(arg string) error {
 	fmt.Printf("%s", msg)
 	return nil
 }
+
+func renameAccount(oldName, newName string) error {
+	cmd := &qitmeerjson.RenameAccountCmd{
+		OldAccount: oldName,
+		NewAccount: newName,
+	}
+	msg, err := walletrpc.RenameAccount(cmd, w)
+	if err != nil {
+		fmt.Println("renameAccount", "err", err.Error())
+		return err
+	}
+	fmt.Printf("%s\n", msg)
+	return nil
+}
+
+func setAccountAddrType(account, addrType string) error {
+	cmd := &qitmeerjson.SetAccountAddrTypeCmd{
+		Account:  account,
+		AddrType: addrType,
+	}
+	msg, err := walletrpc.SetAccountAddrType(cmd, w)
+	if err != nil {
+		fmt.Println("setAccountAddrType", "err", err.Error())
+		return err
+	}
+	fmt.Printf("%s\n", msg)
+	return nil
+}
+
 func getBalance(addr string) (map[types.CoinID]wallet.Balance, error) {
 	cmd := &qitmeerjson.GetBalanceByAddressCmd{
 		Address: addr,
@@ -207,13 +258,18 @@ func listAccountsBalance() (interface{}, error) {
 	return helper.Call()
 }
 
-func getListTxByAddr(addr string, filter int, pageNo int, pageSize int) (interface{}, error) {
+func getListTxByAddr(addr string, filter int, pageNo int, pageSize int, cursor string) (interface{}, error) {
+	var cursorArg *string
+	if cursor != "" {
+		cursorArg = &cursor
+	}
 	helper = &JsonCmdHelper{
 		JsonCmd: &qitmeerjson.GetListTxByAddrCmd{
 			Address:  addr,
 			Stype:    int32(filter),
 			Page:     int32(pageNo),
 			PageSize: int32(pageSize),
+			Cursor:   cursorArg,
 		},
 		Run: func(cmd interface{}, w *wallet.Wallet) (interface{}, error) {
 			return walletrpc.GetListTxByAddr(cmd, w)
@@ -222,13 +278,18 @@ func getListTxByAddr(addr string, filter int, pageNo int, pageSize int) (interfa
 	return helper.Call()
 }
 
-func getBillByAddr(addr string, filter int, pageNo int, pageSize int) (interface{}, error) {
+func getBillByAddr(addr string, filter int, pageNo int, pageSize int, cursor string) (interface{}, error) {
+	var cursorArg *string
+	if cursor != "" {
+		cursorArg = &cursor
+	}
 	helper = &JsonCmdHelper{
 		JsonCmd: &qitmeerjson.GetBillByAddrCmd{
 			Address:  addr,
 			Filter:   int32(filter),
 			PageNo:   int32(pageNo),
 			PageSize: int32(pageSize),
+			Cursor:   cursorArg,
 		},
 		Run: func(cmd interface{}, w *wallet.Wallet) (interface{}, error) {
 			return walletrpc.GetBillByAddr(cmd, w)
@@ -274,8 +335,28 @@ func getAddressesByAccount(account string) (interface{}, error) {
 		return nil, err
 	}
 	for _, addr := range msg {
-		fmt.Printf("%s\n", addr)
+		state := "unused"
+		if addr.Used {
+			state = "used"
+		}
+		fmt.Printf("%s\t%s\t%v\n", addr.Address, state, addr.Received)
+	}
+	return msg, nil
+}
+
+func getUnusedAddress(account string) (interface{}, error) {
+	if account == "" {
+		account = "default"
+	}
+	cmd := &qitmeerjson.GetUnusedAddressCmd{
+		Account: &account,
+	}
+	msg, err := walletrpc.GetUnusedAddress(cmd, w)
+	if err != nil {
+		fmt.Println("getUnusedAddress", "err", err.Error())
+		return nil, err
 	}
+	fmt.Printf("%s\n", msg)
 	return msg, nil
 }
 func getAccountByAddress(address string) (interface{}, error) {
@@ -302,6 +383,18 @@ func getTx(txID string) (interface{}, error) {
 	return helper.Call()
 }
 
+func audit(repair bool) (interface{}, error) {
+	helper = &JsonCmdHelper{
+		JsonCmd: &qitmeerjson.AuditCmd{
+			Repair: &repair,
+		},
+		Run: func(cmd interface{}, w *wallet.Wallet) (interface{}, error) {
+			return walletrpc.Audit(cmd, w)
+		},
+	}
+	return helper.Call()
+}
+
 func importPrivKey(priKey string) (interface{}, error) {
 	v := false
 	cmd := &qitmeerjson.ImportPrivKeyCmd{
@@ -424,22 +517,43 @@ func ClearTxData() error {
 	return nil
 }
 
-func mnemonicToSeed(mnemonic string) (string, error) {
-	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+func rebuildBalances() error {
+	err := walletrpc.RebuildBalances(w)
+	if err != nil {
+		fmt.Println("rebuildbalances:", "error", err.Error())
+		return err
+	}
+	return nil
+}
+
+func mnemonicToSeed(mnemonic string, passphrase string) (string, error) {
+	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
 	if err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%x", seedBuf[:]), nil
 }
 
-func mnemonicToAddr(mnemonic string, network string) (string, error) {
-	seed, err := mnemonicToSeed(mnemonic)
+func mnemonicToAddr(mnemonic string, passphrase string, network string) (string, error) {
+	seed, err := mnemonicToSeed(mnemonic, passphrase)
 	if err != nil {
 		return "", err
 	}
 	return seedToAddr(seed, network)
 }
 
+func mnemonicToFirstAddr(mnemonic string, passphrase string, network string) (string, error) {
+	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return "", err
+	}
+	addr, err := waddrmgr.FirstAddress(seedBuf, wallet.ConfigKeyScope(config.Cfg), utils.GetNetParams(network))
+	if err != nil {
+		return "", err
+	}
+	return addr.Encode(), nil
+}
+
 func seedToAddr(seed string, network string) (string, error) {
 	pri, err := qx.EcNew("secp256k1", seed)
 	if err != nil {
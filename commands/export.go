@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+)
+
+func newExportCmd() *cobra.Command {
+	var (
+		cmd       qitmeerjson.ExportHistoryCmd
+		account   string
+		address   string
+		fromOrder uint32
+		toOrder   uint32
+		from      string
+		to        string
+		output    string
+	)
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "export the transaction history as csv, jsonl or ofx",
+		Example: `
+		export
+		export --format ofx --account default --output 2026.ofx --from 2026-01-01 --to 2026-12-31
+		export --format jsonl --address TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5 --from-order 1000
+		`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if account != "" {
+				cmd.Account = &account
+			}
+			if address != "" {
+				cmd.Address = &address
+			}
+			if fromOrder != 0 {
+				cmd.FromOrder = &fromOrder
+			}
+			if toOrder != 0 {
+				cmd.ToOrder = &toOrder
+			}
+			if from != "" {
+				cmd.From = &from
+			}
+			if to != "" {
+				cmd.To = &to
+			}
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			return exportHistory(&cmd, output)
+		},
+	}
+
+	exportCmd.Flags().StringVar(
+		&cmd.Format, "format", "csv", "Export format, csv, jsonl or ofx.")
+	exportCmd.Flags().StringVar(
+		&account, "account", "", "Account to export, the whole wallet by default.")
+	exportCmd.Flags().StringVar(
+		&address, "address", "", "Address to export, the whole wallet by default.")
+	exportCmd.Flags().Uint32Var(
+		&fromOrder, "from-order", 0, "First block order to export.")
+	exportCmd.Flags().Uint32Var(
+		&toOrder, "to-order", 0, "Last block order to export, unmined transactions are exported without it.")
+	exportCmd.Flags().StringVar(
+		&from, "from", "", "First time to export, RFC 3339 or YYYY-MM-DD.")
+	exportCmd.Flags().StringVar(
+		&to, "to", "", "Last time to export, RFC 3339 or YYYY-MM-DD.")
+	exportCmd.Flags().StringVarP(
+		&output, "output", "o", "", "File to write, stdout by default.")
+
+	return exportCmd
+}
+
+// exportHistory writes the history selected by cmd to the file output, or to
+// stdout when output is empty.
+func exportHistory(cmd *qitmeerjson.ExportHistoryCmd, output string) error {
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	n, err := walletrpc.ExportHistory(cmd, w, out)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if output != "" {
+		fmt.Printf("Exported %d transactions to %s.\n", n, output)
+	}
+	return nil
+}
+
+// exportAccount writes the history of account, or of the whole wallet when
+// account is empty, in format to the file output.
+func exportAccount(format, account, output string) error {
+	cmd := &qitmeerjson.ExportHistoryCmd{Format: format}
+	if cmd.Format == "" {
+		cmd.Format = "csv"
+	}
+	if account != "" {
+		cmd.Account = &account
+	}
+	return exportHistory(cmd, output)
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+)
+
+func newKeyPoolRefillCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keypoolrefill [newsize]",
+		Short: "derive the unused addresses of the key pool of every account, works while locked",
+		Example: `
+		keypoolrefill
+		keypoolrefill 500
+		`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			newSize := ""
+			if len(args) > 0 {
+				newSize = args[0]
+			}
+			return keyPoolRefill(newSize)
+		},
+	}
+}
+
+// keyPoolRefill refills the key pools to newSize addresses per branch, or to
+// the configured size when newSize is empty.
+func keyPoolRefill(newSize string) error {
+	cmd := &qitmeerjson.KeyPoolRefillCmd{}
+	if newSize != "" {
+		size, err := strconv.ParseUint(newSize, 10, 32)
+		if err != nil {
+			return fmt.Errorf("keypoolrefill: invalid size %q", newSize)
+		}
+		n := uint(size)
+		cmd.NewSize = &n
+	}
+	helper = &JsonCmdHelper{
+		JsonCmd: cmd,
+		Run: func(cmd interface{}, w *wallet.Wallet) (interface{}, error) {
+			return walletrpc.KeyPoolRefill(cmd, w)
+		},
+	}
+	if _, err := helper.Call(); err != nil {
+		return fmt.Errorf("keypoolrefill: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+)
+
+func newSweepMasterKeyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sweepmasterkey {pripassword}",
+		Short: "move the funds of the master key address of older wallets to the default account, importing and rescanning the key when missing",
+		Example: `
+		sweepmasterkey pripassword
+		`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			if err := UnLock(args[0]); err != nil {
+				return err
+			}
+			return sweepMasterKey()
+		},
+	}
+}
+
+// sweepMasterKey sends the funds of the imported master key address of the
+// unlocked wallet to the default account and prints the sent transactions.
+func sweepMasterKey() error {
+	res, err := walletrpc.SweepMasterKey(&qitmeerjson.SweepMasterKeyCmd{}, w)
+	if err != nil {
+		return fmt.Errorf("sweepmasterkey: %w", err)
+	}
+	txIds := res.([]string)
+	if len(txIds) == 0 {
+		fmt.Println("The imported master key address holds no funds.")
+		return nil
+	}
+	for _, txId := range txIds {
+		fmt.Println(txId)
+	}
+	fmt.Println("Stop using the imported master key address, its funds are now in the default account.")
+	return nil
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+func newMigrateDBCmd() *cobra.Command {
+	var from, to string
+
+	migrateDBCmd := &cobra.Command{
+		Use:   "migratedb --to {dbtype}",
+		Short: "copy the wallet database to another dbtype and verify the copy",
+		Example: `
+		migratedb --to ldb
+		migratedb --from ldb --to bdb
+		`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrateDB(from, to)
+		},
+	}
+
+	migrateDBCmd.Flags().StringVar(
+		&from, "from", "", "Database driver the wallet is stored with, default dbtype.")
+	migrateDBCmd.Flags().StringVar(
+		&to, "to", "", "Database driver to copy the wallet to, bdb or ldb.")
+	migrateDBCmd.MarkFlagRequired("to")
+
+	return migrateDBCmd
+}
+
+// migrateDB copies the wallet database stored with the driver from into a
+// new database of the driver to and verifies the copy.  It runs offline, the
+// wallet must not be open.  The source database is kept, the wallet uses the
+// copy once dbtype is set to the new driver.
+func migrateDB(from, to string) error {
+	if from == "" {
+		from = config.Cfg.WalletDbType()
+	}
+	if from == to {
+		return fmt.Errorf("the wallet is already stored with dbtype %s", to)
+	}
+
+	netDir := networkDir(config.Cfg.AppDataDir, config.ActiveNet)
+	srcPath, err := config.WalletDbPath(netDir, from)
+	if err != nil {
+		return err
+	}
+	dstPath, err := config.WalletDbPath(netDir, to)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		return fmt.Errorf("%s already exists", dstPath)
+	}
+
+	src, err := walletdb.Open(from, srcPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", srcPath, err)
+	}
+	defer src.Close()
+
+	dst, err := walletdb.Create(to, dstPath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dstPath, err)
+	}
+
+	fmt.Printf("Copying %s to %s...\n", srcPath, dstPath)
+	err = walletdb.CopyDB(dst, src)
+	if err == nil {
+		fmt.Println("Verifying the copy...")
+		err = walletdb.CompareDB(src, dst)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(dstPath)
+		return fmt.Errorf("migratedb: %w", err)
+	}
+
+	fmt.Printf("The wallet has been copied to %s and verified.\n", dstPath)
+	fmt.Printf("Set dbtype=%s to use it, %s can be removed afterwards.\n", to, srcPath)
+	return nil
+}
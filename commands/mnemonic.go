@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+)
+
+func newShowMnemonicCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "showmnemonic {pripassword}",
+		Short: "show the mnemonic the wallet was created from, after confirmation",
+		Example: `
+		showmnemonic pripassword
+		`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			if err := UnLock(args[0]); err != nil {
+				return err
+			}
+			return showMnemonic()
+		},
+	}
+}
+
+func newVerifyMnemonicCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verifymnemonic",
+		Short: "check that a mnemonic, entered when prompted, recovers the wallet",
+		Example: `
+		verifymnemonic
+		`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			return verifyMnemonic()
+		},
+	}
+}
+
+// showMnemonic prints the mnemonic of the unlocked wallet once the user
+// confirms it.
+func showMnemonic() error {
+	fmt.Println("Anyone who sees the mnemonic can take the funds of the wallet.")
+	confirmed, err := Stdin.PromptConfirm("Show the mnemonic?")
+	if err != nil {
+		return fmt.Errorf("showmnemonic: %w", err)
+	}
+	if !confirmed {
+		return nil
+	}
+	res, err := walletrpc.ShowMnemonic(&qitmeerjson.ShowMnemonicCmd{Confirm: true}, w)
+	if err != nil {
+		return fmt.Errorf("showmnemonic: %w", err)
+	}
+	fmt.Println(res)
+	fmt.Println("The mnemonic passphrase, if one was used, is needed with it to recover the wallet.")
+	return nil
+}
+
+// verifyMnemonic prompts for a mnemonic and its passphrase without echoing
+// them and prints whether they recover the wallet.
+func verifyMnemonic() error {
+	mnemonic, err := Stdin.PromptPassword("Enter the mnemonic: ")
+	if err != nil {
+		return fmt.Errorf("verifymnemonic: %w", err)
+	}
+	passphrase, err := Stdin.PromptPassword("Enter the mnemonic passphrase, empty for none: ")
+	if err != nil {
+		return fmt.Errorf("verifymnemonic: %w", err)
+	}
+	res, err := walletrpc.VerifyMnemonic(&qitmeerjson.VerifyMnemonicCmd{
+		Mnemonic:   strings.Join(strings.Fields(mnemonic), " "),
+		Passphrase: &passphrase,
+	}, w)
+	if err != nil {
+		return fmt.Errorf("verifymnemonic: %w", err)
+	}
+	if res.(bool) {
+		fmt.Println("The mnemonic recovers this wallet.")
+	} else {
+		fmt.Println("The mnemonic does NOT recover this wallet.")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+)
+
+func newWalletPassphraseChangeCmd() *cobra.Command {
+	var public bool
+	passphraseCmd := &cobra.Command{
+		Use:   "walletpassphrasechange {oldpassword} {newpassword}",
+		Short: "change the private passphrase of the wallet, or the public one with --public",
+		Example: `
+		walletpassphrasechange oldpripassword newpripassword
+		walletpassphrasechange --public public newpubpassword
+		`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			return changePassphrase(args[0], args[1], public)
+		},
+	}
+	passphraseCmd.Flags().BoolVar(
+		&public, "public", false, "Change the public passphrase, used to open the wallet.")
+	return passphraseCmd
+}
+
+// changePassphrase changes the private passphrase of the wallet, or the
+// public one when public is set, from old to new.
+func changePassphrase(old, new string, public bool) error {
+	helper = &JsonCmdHelper{
+		JsonCmd: &qitmeerjson.WalletPassphraseChangeCmd{
+			OldPassphrase: old,
+			NewPassphrase: new,
+			Public:        &public,
+		},
+		Run: func(cmd interface{}, w *wallet.Wallet) (interface{}, error) {
+			return nil, walletrpc.WalletPassphraseChange(cmd, w)
+		},
+	}
+	if _, err := helper.Call(); err != nil {
+		return fmt.Errorf("walletpassphrasechange: %w", err)
+	}
+	if public {
+		fmt.Println("The public passphrase has been changed, set walletpass to it in the config.")
+	} else {
+		fmt.Println("The private passphrase has been changed.")
+	}
+	return nil
+}
+
+func newUpgradeKDFCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "upgradekdf {pripassword}",
+		Short: "re-wrap the master keys under the key derivation function and costs of --kdf and --kdf-target",
+		Example: `
+		upgradekdf pripassword --kdf=argon2id
+		upgradekdf pripassword --kdf=scrypt --kdf-target=1s
+		`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			if err := UnLock(args[0]); err != nil {
+				return err
+			}
+			return upgradeKDF(args[0], "", "")
+		},
+	}
+}
+
+// upgradeKDF re-wraps the master keys of the unlocked wallet under kdf, tuned
+// to take about target, which default to the kdf and kdf-target config.  The
+// public master key is upgraded with the passphrase the wallet was opened
+// with.
+func upgradeKDF(passphrase, kdf, target string) error {
+	if kdf == "" {
+		kdf = config.Cfg.KDF
+	}
+	if target == "" && config.Cfg.KDFTarget > 0 {
+		target = config.Cfg.KDFTarget.String()
+	}
+	pubPass := config.Cfg.WalletPass
+	res, err := walletrpc.UpgradeKDF(&qitmeerjson.UpgradeKDFCmd{
+		Passphrase:    passphrase,
+		KDF:           &kdf,
+		Target:        &target,
+		PubPassphrase: &pubPass,
+	}, w)
+	if err != nil {
+		return fmt.Errorf("upgradekdf: %w", err)
+	}
+	fmt.Printf("The master keys are now derived with %s.\n", res)
+	return nil
+}
@@ -21,7 +21,12 @@ func AddQcCommand() {
 	QcCmd.AddCommand(createWalletCmd)
 	QcCmd.AddCommand(setSyncedToNumCmd)
 	QcCmd.AddCommand(createNewAccountCmd)
+	QcCmd.AddCommand(newRenameAccountCmd())
+	QcCmd.AddCommand(newSetAccountAddrTypeCmd())
+	QcCmd.AddCommand(newKeyPoolRefillCmd())
+	QcCmd.AddCommand(newSplitSeedCmd())
 	QcCmd.AddCommand(getnewaddressCmd)
+	QcCmd.AddCommand(getUnusedAddressCmd)
 	QcCmd.AddCommand(getBalanceCmd)
 	QcCmd.AddCommand(newGetListTxByAddrCmd())
 	QcCmd.AddCommand(newGetBillByAddrCmd())
@@ -36,12 +41,25 @@ func AddQcCommand() {
 	QcCmd.AddCommand(newGetTxByTxIdCmd())
 	QcCmd.AddCommand(getTxSpendInfoCmd)
 	QcCmd.AddCommand(clearTxData)
+	QcCmd.AddCommand(newAuditCmd())
+	QcCmd.AddCommand(rebuildBalancesCmd)
+	QcCmd.AddCommand(newMigrateDBCmd())
+	QcCmd.AddCommand(newCompactDBCmd())
+	QcCmd.AddCommand(newBackupWalletCmd())
+	QcCmd.AddCommand(newVerifyBackupCmd())
+	QcCmd.AddCommand(newRestoreBackupCmd())
+	QcCmd.AddCommand(newExportCmd())
+	QcCmd.AddCommand(newWalletPassphraseChangeCmd())
+	QcCmd.AddCommand(newUpgradeKDFCmd())
+	QcCmd.AddCommand(newSweepMasterKeyCmd())
+	QcCmd.AddCommand(newShowMnemonicCmd())
+	QcCmd.AddCommand(newVerifyMnemonicCmd())
 }
 
 var createWalletCmd = &cobra.Command{
-	Use:     "create or create {mnemonic}",
-	Short:   "create wallet",
-	Example: "create or create mnemonic",
+	Use:     "create or create {mnemonic|shares}",
+	Short:   "create wallet, or recover it from Shamir seed shares",
+	Example: "create or create mnemonic or create shares",
 	Args:    cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		needMn := ""
@@ -53,10 +71,13 @@ var createWalletCmd = &cobra.Command{
 }
 
 var createNewAccountCmd = &cobra.Command{
-	Use:     "createnewaccount {account} {pripassword}",
-	Short:   "create new account",
-	Example: "createnewaccount test password",
-	Args:    cobra.MinimumNArgs(2),
+	Use:   "createnewaccount {account} {pripassword} [addrtype]",
+	Short: "create new account, handing out pkh (default) or pk addresses",
+	Example: `
+		createnewaccount test password
+		createnewaccount test password pk
+		`,
+	Args: cobra.RangeArgs(2, 3),
 	Run: func(cmd *cobra.Command, args []string) {
 		err := OpenWallet()
 		if err != nil {
@@ -68,9 +89,44 @@ var createNewAccountCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
-		_ = createNewAccount(args[0])
+		addrType := ""
+		if len(args) > 2 {
+			addrType = args[2]
+		}
+		_ = createNewAccount(args[0], addrType)
 	},
 }
+
+func newRenameAccountCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "renameaccount {oldaccount} {newaccount}",
+		Short:   "rename an account",
+		Example: "renameaccount test savings",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			return renameAccount(args[0], args[1])
+		},
+	}
+}
+
+func newSetAccountAddrTypeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "setaccountaddrtype {account} {pkh|pk}",
+		Short:   "set the type of the addresses handed out by an account",
+		Example: "setaccountaddrtype default pk",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			return setAccountAddrType(args[0], args[1])
+		},
+	}
+}
+
 var getnewaddressCmd = &cobra.Command{
 	Use:     "getnewaddress {account}",
 	Short:   "create new address by account",
@@ -86,6 +142,25 @@ var getnewaddressCmd = &cobra.Command{
 	},
 }
 
+var getUnusedAddressCmd = &cobra.Command{
+	Use:     "getunusedaddress [account]",
+	Short:   "get the first address of the account which has not received any output",
+	Example: "getunusedaddress default",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := OpenWallet()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		account := "default"
+		if len(args) > 0 {
+			account = args[0]
+		}
+		getUnusedAddress(account)
+	},
+}
+
 var getBalanceCmd = &cobra.Command{
 	Use:   "getbalance {address} {string ,company : i(int64),f(float),default i } {bool ,detail : true,false,default false }",
 	Short: "getbalance",
@@ -256,6 +331,47 @@ var clearTxData = &cobra.Command{
 	},
 }
 
+func newAuditCmd() *cobra.Command {
+	repairFlag := false
+
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "check wallet utxos against the node",
+		Example: `
+		audit
+		audit --repair
+		`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			_, err := audit(repairFlag)
+			return err
+		},
+	}
+
+	auditCmd.Flags().BoolVarP(
+		&repairFlag, "repair", "r", false, "Fix the inconsistencies found.")
+
+	return auditCmd
+}
+
+var rebuildBalancesCmd = &cobra.Command{
+	Use:   "rebuildbalances",
+	Short: "rebuild the account balances from the wallet utxos",
+	Example: `
+		rebuildbalances
+		`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := OpenWallet(); err != nil {
+			return err
+		}
+		return rebuildBalances()
+	},
+}
+
 var sendToAddressCmd = &cobra.Command{
 	Use:   "sendtoaddress {address} {amount} {pripassword} ",
 	Short: "send transaction ",
@@ -466,6 +582,7 @@ func newGetListTxByAddrCmd() *cobra.Command {
 	filterFlag := "all"
 	pageNoFlag := wallet.PageUseDefault
 	pageSizeFlag := wallet.PageDefaultSize
+	cursorFlag := ""
 
 	getListTxAddrCmd := &cobra.Command{
 		Use:   "getlisttxbyaddr {address}",
@@ -477,6 +594,7 @@ a transaction could affect MULTIPLE addresses`,
 		getlisttxbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 --filter=out 
 		getlisttxbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 
 		getlisttxbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 --page_no=1 --page_size=10
+		getlisttxbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 --page_size=10 --cursor=<next_cursor>
 		`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -491,7 +609,7 @@ a transaction could affect MULTIPLE addresses`,
 				filter = wallet.FilterOut
 			}
 
-			_, err := getListTxByAddr(args[0], filter, pageNoFlag, pageSizeFlag)
+			_, err := getListTxByAddr(args[0], filter, pageNoFlag, pageSizeFlag, cursorFlag)
 			return err
 		},
 	}
@@ -502,6 +620,8 @@ a transaction could affect MULTIPLE addresses`,
 		&pageNoFlag, "page_no", "i", wallet.PageUseDefault, "Page number.")
 	getListTxAddrCmd.Flags().IntVarP(
 		&pageSizeFlag, "page_size", "s", wallet.PageDefaultSize, "Page size.")
+	getListTxAddrCmd.Flags().StringVarP(
+		&cursorFlag, "cursor", "c", "", "Next cursor of the previous page, replaces page_no.")
 
 	return getListTxAddrCmd
 }
@@ -510,6 +630,7 @@ func newGetBillByAddrCmd() *cobra.Command {
 	filterFlag := "all"
 	pageNoFlag := wallet.PageUseDefault
 	pageSizeFlag := wallet.PageDefaultSize
+	cursorFlag := ""
 
 	getBillAddrCmd := &cobra.Command{
 		Use:   "getbillbyaddr {address}",
@@ -521,6 +642,7 @@ which are the effect that a transaction makes on a specific address`,
 		getbillbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 --filter=out 
 		getbillbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 
 		getbillbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 --page_no=1 --page_size=10
+		getbillbyaddr Tme9dVJ4GeWRninBygrA6oDwCAGYbBvNxY7 --page_size=10 --cursor=<next_cursor>
 		`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -535,7 +657,7 @@ which are the effect that a transaction makes on a specific address`,
 				filter = wallet.FilterOut
 			}
 
-			_, err := getBillByAddr(args[0], filter, pageNoFlag, pageSizeFlag)
+			_, err := getBillByAddr(args[0], filter, pageNoFlag, pageSizeFlag, cursorFlag)
 			return err
 		},
 	}
@@ -546,6 +668,8 @@ which are the effect that a transaction makes on a specific address`,
 		&pageNoFlag, "page_no", "i", wallet.PageUseDefault, "Page number.")
 	getBillAddrCmd.Flags().IntVarP(
 		&pageSizeFlag, "page_size", "s", wallet.PageMaxSize, "Page size.")
+	getBillAddrCmd.Flags().StringVarP(
+		&cursorFlag, "cursor", "c", "", "Next cursor of the previous page, replaces page_no.")
 
 	return getBillAddrCmd
 }
@@ -3,8 +3,12 @@ package commands
 import (
 	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/Qitmeer/qitmeer-wallet/config"
 	util "github.com/Qitmeer/qitmeer-wallet/utils"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
 	"github.com/Qitmeer/qng/qx"
 	"github.com/spf13/cobra"
 )
@@ -17,14 +21,17 @@ var QxCmd = &cobra.Command{
 
 func AddQxCommand() {
 	QxCmd.AddCommand(generatemnemonicCmd)
-	QxCmd.AddCommand(mnemonictoseedCmd)
+	QxCmd.AddCommand(newMnemonicToSeedCmd())
 	QxCmd.AddCommand(seedtopriCmd)
 	QxCmd.AddCommand(pritopubCmd)
-	QxCmd.AddCommand(mnemonictoaddrCmd)
+	QxCmd.AddCommand(newMnemonicToAddrCmd())
+	QxCmd.AddCommand(newMnemonicToFirstAddrCmd())
 	QxCmd.AddCommand(seedtoaddrCmd)
 	QxCmd.AddCommand(pritoaddrCmd)
 	QxCmd.AddCommand(pubtoaddrCmd)
 	QxCmd.AddCommand(newWifToPriCmd())
+	QxCmd.AddCommand(newQxSplitSeedCmd())
+	QxCmd.AddCommand(newCombineSharesCmd())
 }
 
 var generatemnemonicCmd = &cobra.Command{
@@ -44,17 +51,26 @@ var generatemnemonicCmd = &cobra.Command{
 		qx.MnemonicNew(msg)
 	},
 }
-var mnemonictoseedCmd = &cobra.Command{
-	Use:   "mnemonictoseed",
-	Short: "mnemonic to seed",
-	Example: `
+
+func newMnemonicToSeedCmd() *cobra.Command {
+	var passphrase string
+	var mnemonictoseedCmd = &cobra.Command{
+		Use:   "mnemonictoseed",
+		Short: "mnemonic to seed",
+		Example: `
 		mnemonictoseed "mnemonic"
+		mnemonictoseed "mnemonic" --passphrase="mnemonic passphrase"
 		`,
-	Args: cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		qx.MnemonicToSeed("", args[0])
-	},
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			qx.MnemonicToSeed(passphrase, args[0])
+		},
+	}
+	mnemonictoseedCmd.Flags().StringVar(
+		&passphrase, "passphrase", "", "BIP39 mnemonic passphrase")
+	return mnemonictoseedCmd
 }
+
 var seedtopriCmd = &cobra.Command{
 	Use:   "seedtopri",
 	Short: "Seed private key",
@@ -116,26 +132,116 @@ var pubtoaddrCmd = &cobra.Command{
 	},
 }
 
-var mnemonictoaddrCmd = &cobra.Command{
-	Use:   "mnemonictoaddr {mnemonic} {string,network value: mainnet,privnet,testnet,mixnet}",
-	Short: "mnemonic to address",
-	Example: `
+func newMnemonicToAddrCmd() *cobra.Command {
+	var passphrase string
+	var mnemonictoaddrCmd = &cobra.Command{
+		Use:   "mnemonictoaddr {mnemonic} {string,network value: mainnet,privnet,testnet,mixnet}",
+		Short: "mnemonic to address",
+		Example: `
 		mnemonictoaddr "mnemonic" "testnet"
+		mnemonictoaddr "mnemonic" "testnet" --passphrase="mnemonic passphrase"
 		`,
-	Args: cobra.MinimumNArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		if args[1] != "mainnet" && args[1] != "privnet" && args[1] != "testnet" && args[1] != "mixnet" {
-			fmt.Println("Wrong network type")
-			return
-		}
-		msg, err := mnemonicToAddr(args[0], args[1])
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
-		fmt.Println(msg)
-	},
+		Args: cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if args[1] != "mainnet" && args[1] != "privnet" && args[1] != "testnet" && args[1] != "mixnet" {
+				fmt.Println("Wrong network type")
+				return
+			}
+			msg, err := mnemonicToAddr(args[0], passphrase, args[1])
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+			fmt.Println(msg)
+		},
+	}
+	mnemonictoaddrCmd.Flags().StringVar(
+		&passphrase, "passphrase", "", "BIP39 mnemonic passphrase")
+	return mnemonictoaddrCmd
 }
+
+func newMnemonicToFirstAddrCmd() *cobra.Command {
+	var passphrase string
+	var mnemonicToFirstAddrCmd = &cobra.Command{
+		Use:   "mnemonictofirstaddr {mnemonic} {string,network value: mainnet,privnet,testnet,mixnet}",
+		Short: "first address of the wallet created or recovered from the mnemonic",
+		Example: `
+		mnemonictofirstaddr "mnemonic" "testnet"
+		mnemonictofirstaddr "mnemonic" "testnet" --passphrase="mnemonic passphrase"
+		`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[1] != "mainnet" && args[1] != "privnet" && args[1] != "testnet" && args[1] != "mixnet" {
+				return fmt.Errorf("Wrong network type")
+			}
+			msg, err := mnemonicToFirstAddr(args[0], passphrase, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Println(msg)
+			return nil
+		},
+	}
+	mnemonicToFirstAddrCmd.Flags().StringVar(
+		&passphrase, "passphrase", "", "BIP39 mnemonic passphrase")
+	return mnemonicToFirstAddrCmd
+}
+
+func newQxSplitSeedCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "splitseed {seed} {groups} [groupthreshold]",
+		Short: "split a seed into Shamir shares, groups are written as <threshold>of<count> and separated by commas",
+		Example: `
+		splitseed "seed" 3of5
+		splitseed "seed" 2of3,3of5 1
+		`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seed, err := hex.DecodeString(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid seed: %w", err)
+			}
+			groups, err := shamir.ParseGroups(strings.Split(args[1], ","))
+			if err != nil {
+				return err
+			}
+			groupThreshold := uint8(len(groups))
+			if len(args) > 2 {
+				n, err := strconv.ParseUint(args[2], 10, 8)
+				if err != nil {
+					return fmt.Errorf("invalid group threshold %q", args[2])
+				}
+				groupThreshold = uint8(n)
+			}
+			shares, err := shamir.SplitStrings(seed, groupThreshold, groups)
+			if err != nil {
+				return err
+			}
+			printSeedShares(groupThreshold, groups, shares)
+			return nil
+		},
+	}
+}
+
+func newCombineSharesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "combineshares {share}...",
+		Short: "recover a seed from its Shamir shares",
+		Example: `
+		combineshares "share1" "share2" "share3"
+		`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seed, err := shamir.CombineStrings(args)
+			if err != nil {
+				return err
+			}
+			fmt.Println(hex.EncodeToString(seed))
+			return nil
+		},
+	}
+}
+
 var seedtoaddrCmd = &cobra.Command{
 	Use:   "seedtoaddr {seed} {string,network value: mainnet,privnet,testnet,mixnet}",
 	Short: "seed to address",
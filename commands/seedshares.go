@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/walletrpc"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
+)
+
+func newSplitSeedCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "splitseed {pripassword} {groups} [groupthreshold]",
+		Short: "split the wallet seed into Shamir shares, groups are written as <threshold>of<count> and separated by commas",
+		Example: `
+		splitseed password 3of5
+		splitseed password 2of3,3of5 1
+		`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := OpenWallet(); err != nil {
+				return err
+			}
+			if err := UnLock(args[0]); err != nil {
+				return err
+			}
+			groupThreshold := ""
+			if len(args) > 2 {
+				groupThreshold = args[2]
+			}
+			return splitSeed(args[1], groupThreshold)
+		},
+	}
+}
+
+// splitSeed splits the seed of the unlocked wallet into shares of the comma
+// separated groups and prints them.  All groups are required when
+// groupThreshold is empty.
+func splitSeed(groups string, groupThreshold string) error {
+	cmd := &qitmeerjson.SplitSeedCmd{Groups: strings.Split(groups, ",")}
+	parsed, err := shamir.ParseGroups(cmd.Groups)
+	if err != nil {
+		return fmt.Errorf("splitseed: %w", err)
+	}
+	threshold := uint8(len(parsed))
+	if groupThreshold != "" {
+		n, err := strconv.ParseUint(groupThreshold, 10, 8)
+		if err != nil {
+			return fmt.Errorf("splitseed: invalid group threshold %q", groupThreshold)
+		}
+		threshold = uint8(n)
+		cmd.GroupThreshold = &threshold
+	}
+	shares, err := walletrpc.SplitSeed(cmd, w)
+	if err != nil {
+		return fmt.Errorf("splitseed: %w", err)
+	}
+	printSeedShares(threshold, parsed, shares.([][]string))
+	return nil
+}
+
+// printSeedShares prints the shares of each group under the thresholds which
+// recover the seed.
+func printSeedShares(groupThreshold uint8, groups []shamir.Group, shares [][]string) {
+	fmt.Printf("%d of the %d groups recover the seed\n", groupThreshold, len(groups))
+	for i, group := range groups {
+		fmt.Printf("group %d, %d of %d shares:\n", i+1, group.Threshold, group.Count)
+		for _, share := range shares[i] {
+			fmt.Println("\t" + share)
+		}
+	}
+}
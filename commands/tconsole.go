@@ -225,7 +225,21 @@ func (c *Console) Interactive() {
 				}
 				switch cmd {
 				case "createNewAccount":
-					createNewAccount(arg1)
+					createNewAccount(arg1, arg2)
+					break
+				case "renameAccount":
+					if arg1 == "" || arg2 == "" {
+						fmt.Println("Please enter the old and new account names.")
+						break
+					}
+					renameAccount(arg1, arg2)
+					break
+				case "setAccountAddrType":
+					if arg1 == "" || arg2 == "" {
+						fmt.Println("Please enter the account and the address type, pkh or pk.")
+						break
+					}
+					setAccountAddrType(arg1, arg2)
 					break
 				case "getBalance":
 					if arg1 == "" {
@@ -309,7 +323,7 @@ func (c *Console) Interactive() {
 						filter = wallet.FilterOut
 					}
 
-					getListTxByAddr(arg1, filter, wallet.PageUseDefault, wallet.PageDefaultSize)
+					getListTxByAddr(arg1, filter, wallet.PageUseDefault, wallet.PageDefaultSize, "")
 					break
 				case "getBillByAddr":
 					if arg1 == "" {
@@ -323,7 +337,7 @@ func (c *Console) Interactive() {
 						filter = wallet.FilterOut
 					}
 
-					getBillByAddr(arg1, filter, wallet.PageUseDefault, wallet.PageDefaultSize)
+					getBillByAddr(arg1, filter, wallet.PageUseDefault, wallet.PageDefaultSize, "")
 					break
 				case "getNewAddress":
 					if arg1 == "" {
@@ -339,6 +353,23 @@ func (c *Console) Interactive() {
 					}
 					getAddressesByAccount(arg1)
 					break
+				case "getUnusedAddress":
+					getUnusedAddress(arg1)
+					break
+				case "keypoolrefill":
+					if err := keyPoolRefill(arg1); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
+				case "splitseed":
+					if arg1 == "" {
+						fmt.Println("splitseed err :Please enter the groups, e.g. 3of5.")
+						break
+					}
+					if err := splitSeed(arg1, arg2); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
 				case "getAccountByAddress":
 					if arg1 == "" {
 						fmt.Println("getAccountByAddress err :Please enter your address.")
@@ -410,6 +441,59 @@ func (c *Console) Interactive() {
 				case "syncheight":
 					syncheight()
 					break
+				case "audit":
+					audit(arg1 == "repair")
+					break
+				case "rebuildbalances":
+					rebuildBalances()
+					break
+				case "export":
+					if err := exportAccount(arg1, arg2, arg3); err != nil {
+						fmt.Println("export err :", err.Error())
+					}
+					break
+				case "backupwallet":
+					if arg1 == "" {
+						fmt.Println("backupwallet err : Please enter the pri password.")
+						break
+					}
+					if _, err := backupWallet(arg1, arg2); err != nil {
+						fmt.Println("backupwallet err :", err.Error())
+					}
+					break
+				case "walletpassphrasechange":
+					if arg1 == "" || arg2 == "" {
+						fmt.Println("walletpassphrasechange err : Please enter the old and new password.")
+						break
+					}
+					if err := changePassphrase(arg1, arg2, arg3 == "public"); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
+				case "upgradekdf":
+					if arg1 == "" {
+						fmt.Println("upgradekdf err : Please enter the pri password.")
+						break
+					}
+					if err := upgradeKDF(arg1, arg2, arg3); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
+				case "sweepmasterkey":
+					if err := sweepMasterKey(); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
+				case "showmnemonic":
+					if err := showMnemonic(); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
+				case "verifymnemonic":
+					if err := verifyMnemonic(); err != nil {
+						fmt.Println(err.Error())
+					}
+					break
 				case "unlock":
 					if arg1 == "" {
 						fmt.Println("unlock err : Please enter the pri password.")
@@ -16,13 +16,12 @@ import (
 	"github.com/Qitmeer/qitmeer-wallet/internal/legacy/keystore"
 	"github.com/Qitmeer/qitmeer-wallet/internal/prompt"
 	"github.com/Qitmeer/qitmeer-wallet/utils"
-	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
-	"github.com/Qitmeer/qng/crypto/bip32"
 	btcec "github.com/Qitmeer/qng/crypto/ecc/secp256k1"
 
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
 	"github.com/Qitmeer/qitmeer-wallet/wallet"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
 	"github.com/Qitmeer/qitmeer-wallet/walletdb"
-	"github.com/Qitmeer/qng/crypto/ecc/secp256k1"
 	chaincfg "github.com/Qitmeer/qng/params"
 )
 
@@ -67,18 +66,30 @@ func createSimulationWallet() error {
 	netDir := networkDir(config.Cfg.AppDataDir, config.ActiveNet)
 
 	// Create the wallet.
-	dbPath := filepath.Join(netDir, config.WalletDbName)
+	dbType := config.Cfg.WalletDbType()
+	dbPath, err := config.WalletDbPath(netDir, dbType)
+	if err != nil {
+		return err
+	}
 	fmt.Println("Creating the wallet...")
 
-	// Create the wallet database backed by bolt db.
-	db, err := walletdb.Create("bdb", dbPath)
+	// Settle the key derivation costs before the database is created, so a
+	// bad kdf config does not leave an empty one behind.
+	kdf, err := wallet.ConfigKDF(config.Cfg)
+	if err != nil {
+		return err
+	}
+
+	// Create the wallet database with the configured driver.
+	db, err := walletdb.Create(dbType, dbPath)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
 	// Create the wallet.
-	err = wallet.Create(db, pubPass, privPass, nil, config.ActiveNet, time.Now())
+	err = wallet.Create(db, pubPass, privPass, nil, nil, config.ActiveNet,
+		wallet.ConfigKeyScope(config.Cfg), kdf, time.Now())
 	if err != nil {
 		return err
 	}
@@ -176,52 +187,84 @@ func createWallet(needMnemonic string) (*wallet.Wallet, error) {
 	// Ascertain the wallet generation seed.  This will either be an
 	// automatically generated value the user has already confirmed or a
 	// value the user has entered which has already been validated.
-	seed, err := prompt.Seed(reader)
+	var seed []byte
+	if needMnemonic == "shares" {
+		seed, err = prompt.SeedFromShares(reader)
+	} else {
+		seed, err = prompt.Seed(reader)
+	}
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("Creating the wallet...")
+	// A mnemonic is made of the generated seed as BIP39 entropy, which is
+	// kept encrypted in the wallet to show the mnemonic again.
+	var entropy []byte
 	if needMnemonic == "mnemonic" {
 		mnemonicStr, err := bip39.NewMnemonic(seed)
 		if err != nil {
 			return nil, err
 		}
 		fmt.Println("mnemonic: ", mnemonicStr)
+		entropy = seed
 
-		seed, err = bip39.NewSeedWithErrorChecking(mnemonicStr, "")
+		mnemonicPass, err := prompt.MnemonicPass(reader)
+		if err != nil {
+			return nil, err
+		}
+		seed, err = bip39.NewSeedWithErrorChecking(mnemonicStr, string(mnemonicPass))
 		if err != nil {
 			fmt.Println("failed to derive master extended key with mnemonic.")
 			return nil, err
 		}
 	}
-	seedKey, err := bip32.NewMasterKey(seed)
+
+	// Have the user confirm the first address before anything is written,
+	// a mistyped seed or mnemonic passphrase shows as a different address.
+	firstAddr, err := waddrmgr.FirstAddress(seed, wallet.ConfigKeyScope(config.Cfg), config.ActiveNet)
 	if err != nil {
-		fmt.Println("failed to derive master extended key.")
 		return nil, err
 	}
-	w, err := loader.CreateNewWallet(pubPass, privPass, seed, time.Now())
+	confirmed, err := prompt.FirstAddress(reader, firstAddr.Encode())
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("pri:%x\n", seedKey.Key)
-	pri, _ := secp256k1.PrivKeyFromBytes(seedKey.Key)
-	wif, err := utils.NewWIF(pri, w.ChainParams(), true)
-	if err != nil {
-		fmt.Println("private key decode failed:", err.Error())
-		return nil, err
+	if !confirmed {
+		return nil, fmt.Errorf("first address not confirmed, the wallet was not created")
+	}
+
+	// Offer to split the seed into shares, unless it was just recovered
+	// from some.
+	if needMnemonic != "shares" {
+		groups, groupThreshold, err := prompt.SeedShares(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) > 0 {
+			shares, err := shamir.SplitStrings(seed, groupThreshold, groups)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Println("Your wallet seed shares are:")
+			printSeedShares(groupThreshold, groups, shares)
+			fmt.Println("IMPORTANT: Keep the shares in separate safe " +
+				"places.  Any shares meeting the thresholds above " +
+				"recover the wallet with 'qc create shares'.")
+		}
 	}
-	if !wif.IsForNet(w.ChainParams()) {
-		fmt.Println("Key is not intended for", w.ChainParams().Name, err.Error())
+	fmt.Println("Creating the wallet...")
+	w, err := loader.CreateNewWallet(pubPass, privPass, seed, entropy, time.Now())
+	if err != nil {
 		return nil, err
 	}
-	w.UnLockManager(privPass)
-	_, err = w.ImportPrivateKey(waddrmgr.KeyScopeBIP0044, wif)
+	// Hand out the first receive address of the default account, the
+	// master key itself is never imported.
+	addr, err := w.UnusedAddress(w.Manager.DefaultScope(), waddrmgr.DefaultAccountNum)
 	if err != nil {
-		fmt.Println("ImportPrivateKey err:", err.Error())
 		return nil, err
 	}
 	//w.Manager.Close()
 	fmt.Println("The wallet has been created successfully.")
+	fmt.Println("First receive address:", addr.Encode())
 	return w, nil
 }
 
@@ -2,6 +2,10 @@ package commands
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/Qitmeer/qitmeer-wallet/config"
 	"github.com/Qitmeer/qitmeer-wallet/wserver"
 	"github.com/Qitmeer/qng/log"
@@ -36,6 +40,11 @@ func qitmeerMain(cfg *config.Config) {
 	}
 	wsvr.Start()
 
-	exitCh := make(chan int)
-	<-exitCh
+	// Shut down cleanly on Ctrl-C, a scheduled backup being written is
+	// completed first.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	<-interrupt
+	log.Info("Caught interrupt, shutting down")
+	wsvr.Stop()
 }
@@ -11,10 +11,14 @@ import (
 	"io/ioutil"
 	"math/big"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 
+	"github.com/Qitmeer/qng/core/types"
 	"github.com/Qitmeer/qng/params"
 
 	"github.com/Qitmeer/qitmeer-wallet/rpc/client"
@@ -30,8 +34,35 @@ const (
 	DefaultMinRelayTxFee  = int64(2e5)
 
 	WalletDbName = "wallet.db"
+	// LevelWalletDbName is the directory of a wallet database of the ldb
+	// driver.
+	LevelWalletDbName = "wallet.ldb"
+	DefaultDbType     = "bdb"
+	DefaultBackupKeep = 7
+
+	// DefaultHDPurpose and DefaultHDCoinType derive the keys of new wallets
+	// along m/44'/813'/, 813 being the SLIP-0044 coin type of Qitmeer.
+	DefaultHDPurpose  = 44
+	DefaultHDCoinType = 813
+
+	// DefaultKeyPoolSize is the number of unused addresses derived ahead on
+	// each branch of an account.
+	DefaultKeyPoolSize = 100
+	// DefaultMaxKeyPoolSize bounds the key pool size, every refill derives
+	// and stores the addresses of all accounts in a single transaction.
+	DefaultMaxKeyPoolSize = 5000
+
+	// DefaultKDF is the key derivation function the passphrases of new
+	// wallets are stretched with.
+	DefaultKDF = "scrypt"
 )
 
+// KDFs are the key derivation functions passphrases can be stretched with.
+var KDFs = []string{"scrypt", "argon2id"}
+
+// DbTypes are the walletdb drivers a wallet can be stored with.
+var DbTypes = []string{"bdb", "ldb"}
+
 var (
 	defaultAppDataDir  = utils.AppDataDir("qitwallet", false)
 	DefaultConfigFile  = filepath.Join("./", defaultConfigFilename)
@@ -55,6 +86,46 @@ type Config struct {
 	Version    bool `short:"V" long:"version" description:"Display version information and exit"`
 	Network    string
 
+	// DbType is the walletdb driver of the wallet database, bdb or ldb.
+	DbType string
+
+	// BackupDir is the directory of wallet backups, by default the backups
+	// directory of the network in AppDataDir.
+	BackupDir string
+	// BackupInterval is the interval of scheduled backups in minutes, 0
+	// disables them.  Scheduled backups start after the first unlock.
+	BackupInterval uint32
+	// BackupKeep is the number of scheduled backups kept in BackupDir,
+	// backups made on demand are never removed.
+	BackupKeep uint32
+
+	// PruneDepth prunes the stored transactions mined more than PruneDepth
+	// block orders ago whose outputs are all spent, keeping their summary
+	// only.  0 keeps the full transactions.
+	PruneDepth uint32
+
+	// HDPurpose and HDCoinType are the BIP0043 purpose and the coin type of
+	// the key derivation path m/purpose'/cointype'/account'/branch/index of
+	// new wallets.  They are stored in the wallet at creation.
+	HDPurpose  uint32
+	HDCoinType uint32
+
+	// KeyPoolSize is the number of unused addresses derived ahead on each
+	// branch of an account and watched on the node before they are handed
+	// out.
+	KeyPoolSize uint32
+	// MaxKeyPoolSize is the largest key pool size a refill may ask for,
+	// DefaultMaxKeyPoolSize when 0.
+	MaxKeyPoolSize uint32
+
+	// KDF is the key derivation function, scrypt or argon2id, the
+	// passphrases of new wallets are stretched with.  KDFTarget, when not
+	// zero, tunes its costs so that deriving a key takes about as long on
+	// this machine, otherwise fixed defaults are used.  qc upgradekdf
+	// applies them to an existing wallet.
+	KDF       string
+	KDFTarget time.Duration
+
 	//WalletRPC
 	UI            bool
 	Listeners     []string
@@ -66,6 +137,12 @@ type Config struct {
 	DisableRPC    bool
 	DisableTLS    bool
 	Confirmations uint32
+	// CoinConfirmations overrides Confirmations per coin, as coin=n where
+	// coin is the coin name or id.
+	CoinConfirmations []string
+	// coinConfirmations is CoinConfirmations parsed by Check, keyed by the
+	// lower case coin name or id.
+	coinConfirmations map[string]uint32
 
 	// tx fee
 	MinTxFee int64
@@ -110,10 +187,90 @@ func (cfg *Config) Check() error {
 	if activeNetParams == nil {
 		return fmt.Errorf("network not found: %s", cfg.Network)
 	}
+	if _, err := WalletDbPath("", cfg.WalletDbType()); err != nil {
+		return err
+	}
+	coinConfirmations := make(map[string]uint32, len(cfg.CoinConfirmations))
+	for _, entry := range cfg.CoinConfirmations {
+		name, n, err := parseCoinConfirmations(entry)
+		if err != nil {
+			return err
+		}
+		coinConfirmations[strings.ToLower(name)] = n
+	}
+	cfg.coinConfirmations = coinConfirmations
+	if cfg.KDF != "" && cfg.KDF != "scrypt" && cfg.KDF != "argon2id" {
+		return fmt.Errorf("unknown kdf %q, want one of %s", cfg.KDF,
+			strings.Join(KDFs, ", "))
+	}
+	maxKeyPoolSize := cfg.MaxKeyPoolSize
+	if maxKeyPoolSize == 0 {
+		maxKeyPoolSize = DefaultMaxKeyPoolSize
+	}
+	if cfg.KeyPoolSize > maxKeyPoolSize {
+		return fmt.Errorf("keypoolsize %d exceeds maxkeypoolsize %d",
+			cfg.KeyPoolSize, maxKeyPoolSize)
+	}
+	if cfg.KDFTarget < 0 {
+		return fmt.Errorf("negative kdf-target %s", cfg.KDFTarget)
+	}
 
 	return nil
 }
 
+// BackupDirPath returns the directory of wallet backups.
+func (cfg *Config) BackupDirPath() string {
+	if cfg.BackupDir != "" {
+		return cfg.BackupDir
+	}
+	return filepath.Join(cfg.AppDataDir, "backups", cfg.Network)
+}
+
+// WalletDbType returns the walletdb driver of the wallet database.
+func (cfg *Config) WalletDbType() string {
+	if cfg.DbType == "" {
+		return DefaultDbType
+	}
+	return cfg.DbType
+}
+
+// WalletDbPath returns the path of the wallet database stored with the
+// walletdb driver dbType in netDir.
+func WalletDbPath(netDir, dbType string) (string, error) {
+	switch dbType {
+	case "bdb":
+		return filepath.Join(netDir, WalletDbName), nil
+	case "ldb":
+		return filepath.Join(netDir, LevelWalletDbName), nil
+	}
+	return "", fmt.Errorf("unknown dbtype %q, want one of %s", dbType,
+		strings.Join(DbTypes, ", "))
+}
+
+// ConfirmationsFor returns the number of block confirmations required for
+// transactions of coin.  CoinConfirmations only apply once Check parsed them.
+func (cfg *Config) ConfirmationsFor(coin types.CoinID) uint32 {
+	if n, ok := cfg.coinConfirmations[strings.ToLower(coin.Name())]; ok {
+		return n
+	}
+	if n, ok := cfg.coinConfirmations[strconv.Itoa(int(coin))]; ok {
+		return n
+	}
+	return cfg.Confirmations
+}
+
+func parseCoinConfirmations(entry string) (string, uint32, error) {
+	parts := strings.SplitN(entry, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", 0, fmt.Errorf("coin confirmations %q: want coin=n", entry)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("coin confirmations %q: %v", entry, err)
+	}
+	return strings.TrimSpace(parts[0]), uint32(n), nil
+}
+
 // Save save cfg to file
 func (cfg *Config) Save(savePath string) error {
 	if savePath == "" {
@@ -133,10 +290,17 @@ func (cfg *Config) Save(savePath string) error {
 // NewDefaultConfig make config by default value
 func NewDefaultConfig() (cfg *Config) {
 	cfg = &Config{
-		AppDataDir: defaultAppDataDir,
-		DebugLevel: defaultLogLevel,
-		LogDir:     defaultLogDir,
-		ConfigFile: "config.toml",
+		AppDataDir:     defaultAppDataDir,
+		DebugLevel:     defaultLogLevel,
+		LogDir:         defaultLogDir,
+		ConfigFile:     "config.toml",
+		DbType:         DefaultDbType,
+		BackupKeep:     DefaultBackupKeep,
+		HDPurpose:      DefaultHDPurpose,
+		HDCoinType:     DefaultHDCoinType,
+		KeyPoolSize:    DefaultKeyPoolSize,
+		MaxKeyPoolSize: DefaultMaxKeyPoolSize,
+		KDF:            DefaultKDF,
 
 		Network: "testnet",
 
@@ -3,6 +3,8 @@ package config
 import (
 	"testing"
 
+	"github.com/Qitmeer/qng/core/types"
+
 	"github.com/Qitmeer/qitmeer-wallet/rpc/client"
 )
 
@@ -19,3 +21,38 @@ func TestSave(t *testing.T) {
 		t.Log("failed to save config")
 	}
 }
+
+func TestConfirmationsFor(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.CoinConfirmations = []string{types.MEERA.Name() + "=3", "1 = 20"}
+	if err := cfg.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if n := cfg.ConfirmationsFor(types.MEERA); n != 3 {
+		t.Fatalf("%s confirmations %d, want 3", types.MEERA.Name(), n)
+	}
+	if n := cfg.ConfirmationsFor(types.CoinID(1)); n != 20 {
+		t.Fatalf("coin 1 confirmations %d, want 20", n)
+	}
+	if n := cfg.ConfirmationsFor(types.CoinID(2)); n != cfg.Confirmations {
+		t.Fatalf("coin 2 confirmations %d, want the default %d", n, cfg.Confirmations)
+	}
+
+	cfg.CoinConfirmations = []string{"MEER"}
+	if err := cfg.Check(); err == nil {
+		t.Fatalf("malformed coin confirmations accepted")
+	}
+}
+
+func TestMaxKeyPoolSize(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.KeyPoolSize = cfg.MaxKeyPoolSize + 1
+	if err := cfg.Check(); err == nil {
+		t.Fatalf("key pool size beyond the maximum accepted")
+	}
+	cfg.KeyPoolSize = DefaultMaxKeyPoolSize + 1
+	cfg.MaxKeyPoolSize = 0
+	if err := cfg.Check(); err == nil {
+		t.Fatalf("key pool size beyond the default maximum accepted")
+	}
+}
@@ -10,12 +10,14 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"golang.org/x/crypto/ssh/terminal"
 	//"github.com/Qitmeer/qitmeer-wallet/util/ssh/terminal"
 
 	"github.com/Qitmeer/qitmeer-wallet/internal/legacy/keystore"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
 
 	hdkeychain "github.com/Qitmeer/qng/crypto/seed"
 )
@@ -258,6 +260,116 @@ func PublicPass(reader *bufio.Reader, privPass []byte,
 	return pubPass, nil
 }
 
+// MnemonicPass prompts the user whether they want to extend the mnemonic with
+// a BIP39 passphrase.  When the user answers yes, they are prompted for the
+// passphrase, otherwise an empty passphrase is returned.
+func MnemonicPass(reader *bufio.Reader) ([]byte, error) {
+	useMnemonicPass, err := promptListBool(reader, "Do you want to "+
+		"protect the mnemonic with a passphrase?", "no")
+	if err != nil {
+		return nil, err
+	}
+	if !useMnemonicPass {
+		return nil, nil
+	}
+
+	fmt.Println("IMPORTANT: The mnemonic passphrase is needed together\n" +
+		"with the mnemonic to restore your wallet.  A mistyped\n" +
+		"passphrase restores a different, empty wallet.")
+	return promptPass(reader, "Enter the mnemonic passphrase", true)
+}
+
+// FirstAddress displays the first address of the wallet about to be created
+// and prompts the user to confirm it before the wallet is created.  The
+// prompt is repeated until the user enters a valid response.
+func FirstAddress(reader *bufio.Reader, addr string) (bool, error) {
+	fmt.Println("The first address of your wallet is:")
+	fmt.Println(addr)
+	fmt.Println("When restoring a wallet, check that it matches the\n" +
+		"first address of the original wallet.")
+	return promptListBool(reader, "Create the wallet with this "+
+		"first address?", "no")
+}
+
+// SeedShares prompts the user whether they want to split the wallet seed into
+// Shamir shares.  When the user answers yes, they are prompted for the groups
+// of shares and, for several groups, for the number of groups required.  No
+// groups are returned when the user answers no.
+func SeedShares(reader *bufio.Reader) ([]shamir.Group, uint8, error) {
+	split, err := promptListBool(reader, "Do you want to split the "+
+		"seed into Shamir shares?", "no")
+	if err != nil || !split {
+		return nil, 0, err
+	}
+
+	var groups []shamir.Group
+	for {
+		fmt.Print("Enter the groups of shares as <threshold>of<count>, " +
+			"separated by commas (e.g. 3of5 or 2of3,3of5): ")
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, 0, err
+		}
+		groups, err = shamir.ParseGroups(strings.Split(strings.TrimSpace(reply), ","))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		break
+	}
+	if len(groups) == 1 {
+		return groups, 1, nil
+	}
+
+	for {
+		fmt.Printf("Enter the number of groups required to recover "+
+			"the wallet [%d]: ", len(groups))
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, 0, err
+		}
+		reply = strings.TrimSpace(reply)
+		if reply == "" {
+			return groups, uint8(len(groups)), nil
+		}
+		threshold, err := strconv.ParseUint(reply, 10, 8)
+		if err != nil || threshold == 0 || int(threshold) > len(groups) {
+			fmt.Printf("Enter a number between 1 and %d\n", len(groups))
+			continue
+		}
+		return groups, uint8(threshold), nil
+	}
+}
+
+// SeedFromShares prompts the user for Shamir shares of a wallet seed, one per
+// line, and returns the seed they recover.  The prompts are repeated until
+// the shares recover a seed.
+func SeedFromShares(reader *bufio.Reader) ([]byte, error) {
+	for {
+		fmt.Println("Enter the seed shares, one per line, followed by " +
+			"an empty line:")
+		var shares []string
+		for {
+			reply, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			reply = strings.TrimSpace(reply)
+			if reply == "" {
+				break
+			}
+			shares = append(shares, reply)
+		}
+
+		seed, err := shamir.CombineStrings(shares)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return seed, nil
+	}
+}
+
 // Seed prompts the user whether they want to use an existing wallet generation
 // seed.  When the user answers no, a seed will be generated and displayed to
 // the user along with prompting them for confirmation.  When the user answers
@@ -11,4 +11,6 @@ type PagedBillResult struct {
 	PageNo   int32      `json:"page_no"`
 	PageSize int32      `json:"page_size"`
 	Bill     BillResult `json:"bill,omitempty"`
+	// NextCursor continues the bill after this page, empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
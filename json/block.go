@@ -28,4 +28,6 @@ type PageTxRawResult struct {
 	Page         int32              `json:"page"`
 	PageSize     int32              `json:"page_size"`
 	Transactions []json.TxRawResult `json:"transactions,omitempty"`
+	// NextCursor continues the list after this page, empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
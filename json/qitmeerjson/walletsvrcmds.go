@@ -67,6 +67,8 @@ type GetListTxByAddrCmd struct {
 	Page     int32
 	PageSize int32
 	Stype    int32
+	// Cursor is the next_cursor of a previous page, it replaces Page.
+	Cursor *string
 }
 
 type GetBillByAddrCmd struct {
@@ -74,6 +76,8 @@ type GetBillByAddrCmd struct {
 	Filter   int32
 	PageNo   int32
 	PageSize int32
+	// Cursor is the next_cursor of a previous page, it replaces PageNo.
+	Cursor *string
 }
 
 // GetNewAddressCmd defines the getnewaddress JSON-RPC command.
@@ -81,6 +85,11 @@ type GetNewAddressCmd struct {
 	Account *string
 }
 
+// GetUnusedAddressCmd defines the getunusedaddress JSON-RPC command.
+type GetUnusedAddressCmd struct {
+	Account *string
+}
+
 // GetRawChangeAddressCmd defines the getrawchangeaddress JSON-RPC command.
 type GetRawChangeAddressCmd struct {
 	Account *string
@@ -110,14 +119,53 @@ type GetWalletInfoCmd struct{}
 
 // ImportPrivKeyCmd defines the importprivkey JSON-RPC command.
 type ImportPrivKeyCmd struct {
-	PrivKey string
-	Label   *string
-	Rescan  *bool `jsonrpcdefault:"true"`
+	PrivKey    string
+	Label      *string
+	Rescan     *bool   `jsonrpcdefault:"true"`
+	RescanFrom *uint64 `jsonrpcdefault:"0"`
 }
 
-// KeyPoolRefillCmd defines the keypoolrefill JSON-RPC command.
+// KeyPoolRefillCmd defines the keypoolrefill JSON-RPC command.  Without
+// NewSize the pools are refilled to the configured key pool size.
 type KeyPoolRefillCmd struct {
-	NewSize *uint `jsonrpcdefault:"100"`
+	NewSize *uint
+}
+
+// SplitSeedCmd defines the splitseed JSON-RPC command.  Groups are written as
+// <threshold>of<count>, e.g. 3of5, and all of them are required unless
+// GroupThreshold is set.
+type SplitSeedCmd struct {
+	Groups         []string
+	GroupThreshold *uint8
+}
+
+// UpgradeKDFCmd defines the upgradekdf JSON-RPC command.  The master keys are
+// re-wrapped under keys derived with KDF, scrypt or argon2id, tuned to take
+// about Target, e.g. 1s, or with the default costs.  The public master key is
+// upgraded too when PubPassphrase is set.
+type UpgradeKDFCmd struct {
+	Passphrase    string
+	KDF           *string
+	Target        *string
+	PubPassphrase *string
+}
+
+// SweepMasterKeyCmd defines the sweepmasterkey JSON-RPC command, which moves
+// the funds of the master key address of older wallets to the default
+// account, importing the key first when the wallet does not hold it.
+type SweepMasterKeyCmd struct{}
+
+// ShowMnemonicCmd defines the showmnemonic JSON-RPC command.  The mnemonic is
+// only returned when Confirm is set.
+type ShowMnemonicCmd struct {
+	Confirm bool
+}
+
+// VerifyMnemonicCmd defines the verifymnemonic JSON-RPC command, which checks
+// that Mnemonic, with the optional Passphrase, recovers the wallet.
+type VerifyMnemonicCmd struct {
+	Mnemonic   string
+	Passphrase *string
 }
 
 // ListAddressGroupingsCmd defines the listaddressgroupings JSON-RPC command.
@@ -167,7 +215,8 @@ type LockUnspentCmd struct {
 
 // CreateNewAccountCmd defines the createnewaccount JSON-RPC command.
 type CreateNewAccountCmd struct {
-	Account string
+	Account  string
+	AddrType *string `jsonrpcdefault:"\"pkh\""`
 }
 
 // DumpWalletCmd defines the dumpwallet JSON-RPC command.
@@ -199,6 +248,12 @@ type RenameAccountCmd struct {
 	NewAccount string
 }
 
+// SetAccountAddrTypeCmd defines the setaccountaddrtype JSON-RPC command.
+type SetAccountAddrTypeCmd struct {
+	Account  string
+	AddrType string
+}
+
 // MoveCmd defines the move JSON-RPC command.
 type MoveCmd struct {
 	FromAccount string
@@ -252,6 +307,37 @@ type UpdateBlockToCmd struct {
 	ToOrder int64
 }
 
+// AuditCmd defines the audit JSON-RPC command.
+type AuditCmd struct {
+	Repair *bool `jsonrpcdefault:"false"`
+}
+
+// BackupWalletCmd defines the backupwallet JSON-RPC command.  Destination is
+// a file or directory, the configured backup directory when omitted.
+type BackupWalletCmd struct {
+	Passphrase  string
+	Destination *string
+}
+
+// VerifyBackupCmd defines the verifybackup JSON-RPC command.
+type VerifyBackupCmd struct {
+	Path       string
+	Passphrase string
+}
+
+// ExportHistoryCmd defines the exporthistory JSON-RPC command.  Format is
+// csv, jsonl or ofx; the whole wallet is exported when neither Account nor
+// Address is set.
+type ExportHistoryCmd struct {
+	Format    string `jsonrpcdefault:"\"csv\""`
+	Account   *string
+	Address   *string
+	FromOrder *uint32
+	ToOrder   *uint32
+	From      *string
+	To        *string
+}
+
 // SetAccountCmd defines the setaccount JSON-RPC command.
 type SetAccountCmd struct {
 	Address string
@@ -310,8 +396,10 @@ type WalletPassphraseCmd struct {
 // NewWalletPassphraseCmd returns a new instance which can be used to issue a
 // walletpassphrase JSON-RPC command.
 
-// WalletPassphraseChangeCmd defines the walletpassphrase JSON-RPC command.
+// WalletPassphraseChangeCmd defines the walletpassphrasechange JSON-RPC
+// command.  The private passphrase is changed unless Public is set.
 type WalletPassphraseChangeCmd struct {
 	OldPassphrase string
 	NewPassphrase string
+	Public        *bool `jsonrpcdefault:"false"`
 }
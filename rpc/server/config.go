@@ -9,4 +9,8 @@ type Config struct {
 	RPCMaxClients int    `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	DisableRPC    bool   `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
 	DisableTLS    bool   `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
+
+	// RPCAllowedOrigins are the origins, as scheme://host[:port], besides
+	// the host of the server whose pages may open websocket connections.
+	RPCAllowedOrigins []string
 }
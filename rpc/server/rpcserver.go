@@ -285,6 +285,16 @@ func (s *RpcServer) checkAuth(r *http.Request, require bool) (bool, error) {
 	return false, fmt.Errorf("auth failure")
 }
 
+// Authorize checks the RPC credentials of r for handlers served beside the
+// RPC server, answering 401 Unauthorized when they are missing or wrong.
+func (s *RpcServer) Authorize(w http.ResponseWriter, r *http.Request) bool {
+	if _, err := s.checkAuth(r, true); err != nil {
+		jsonAuthFail(w)
+		return false
+	}
+	return true
+}
+
 // jsonAuthFail sends a message back to the client if the http auth is rejected.
 func jsonAuthFail(w http.ResponseWriter) {
 	w.Header().Add("WWW-Authenticate", `Basic realm="nox RPC"`)
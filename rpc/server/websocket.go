@@ -0,0 +1,75 @@
+// Copyright (c) 2017-2018 The nox developers
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Qitmeer/qng/log"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+)
+
+// WebsocketHandler returns a handler that serves JSON-RPC over websocket.
+// Unlike HandleFunc the connection stays open, so subscriptions are supported.
+// Websocket clients count against the same connection limit.
+func (s *RpcServer) WebsocketHandler() http.Handler {
+	ws := websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			if err := s.checkOrigin(cfg, r); err != nil {
+				return err
+			}
+			_, err := s.checkAuth(r, true)
+			return err
+		},
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maxRequestContentLength
+
+			s.incrementClients()
+			defer s.decrementClients()
+
+			log.Trace("RPC websocket connected", "from", conn.Request().RemoteAddr)
+			s.ServeCodec(NewJSONCodec(conn), OptionMethodInvocation|OptionSubscriptions)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Limit the number of connections to max allowed.
+		if s.limitConnections(w, r.RemoteAddr) {
+			return
+		}
+		ws.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin accepts websocket handshakes from pages of the server itself or
+// of one of the allowed origins.  Browsers send the origin of the page opening
+// the socket along with the credentials of the user, so without this check
+// any site could drive the wallet.  Requests without an origin do not come
+// from a browser and are left to the auth check.
+func (s *RpcServer) checkOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(cfg, r)
+	if err != nil {
+		return err
+	}
+	cfg.Origin = origin
+	if origin == nil || strings.EqualFold(origin.Host, r.Host) {
+		return nil
+	}
+	for _, allowed := range s.config.RPCAllowedOrigins {
+		if strings.EqualFold(allowed, origin.Scheme+"://"+origin.Host) {
+			return nil
+		}
+	}
+	log.Warn("RPC websocket origin rejected", "origin", origin, "from", r.RemoteAddr)
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// ServeCodec reads incoming requests from codec, calls the appropriate callback and writes the
+// response back using the given codec. It will block until the codec is closed or the server is
+// stopped. In either case the codec is closed.
+func (s *RpcServer) ServeCodec(codec ServerCodec, options CodecOption) {
+	defer codec.Close()
+	_ = s.serveRequest(context.Background(), codec, false, options)
+}
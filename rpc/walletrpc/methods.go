@@ -3,6 +3,7 @@ package walletrpc
 import (
 	"encoding/hex"
 	"fmt"
+	"io"
 	"time"
 
 	util "github.com/Qitmeer/qitmeer-wallet/utils"
@@ -16,6 +17,9 @@ import (
 	"github.com/Qitmeer/qng/core/types"
 
 	"github.com/Qitmeer/qitmeer-wallet/wallet"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/backup"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/export"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
 )
 
 // createNewAccount handles a createnewaccount request by creating and
@@ -30,7 +34,16 @@ func CreateNewAccount(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 		return nil, &qitmeerjson.ErrReservedAccountName
 	}
 
-	_, err := w.NextAccount(waddrmgr.KeyScopeBIP0044, cmd.Account)
+	addrType := waddrmgr.PubKeyHash
+	if cmd.AddrType != nil {
+		var err error
+		addrType, err = waddrmgr.ParseAccountAddrType(*cmd.AddrType)
+		if err != nil {
+			return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter, err.Error())
+		}
+	}
+
+	account, err := w.NextAccount(w.Manager.DefaultScope(), cmd.Account)
 	if waddrmgr.IsError(err, waddrmgr.ErrLocked) {
 		return nil, &qitmeerjson.RPCError{
 			Code: qitmeerjson.ErrRPCWalletUnlockNeeded,
@@ -38,13 +51,70 @@ func CreateNewAccount(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 				"Enter the wallet passphrase with walletpassphrase to unlock",
 		}
 	}
-	return "succ", err
+	if err != nil {
+		return nil, err
+	}
+	if addrType != waddrmgr.PubKeyHash {
+		err = w.SetAccountAddrType(w.Manager.DefaultScope(), account, addrType)
+		if err != nil {
+			log.Error("CreateNewAccount ", "err ", err.Error())
+			return nil, err
+		}
+	}
+	return "succ", nil
+}
+
+// SetAccountAddrType handles a setaccountaddrtype request by setting the
+// type of the addresses an account hands out, pkh or pk.
+func SetAccountAddrType(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.SetAccountAddrTypeCmd)
+
+	addrType, err := waddrmgr.ParseAccountAddrType(cmd.AddrType)
+	if err != nil {
+		return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter, err.Error())
+	}
+	account, err := w.AccountNumber(w.Manager.DefaultScope(), cmd.Account)
+	if err != nil {
+		log.Error("SetAccountAddrType ", "err ", err.Error())
+		return nil, err
+	}
+	err = w.SetAccountAddrType(w.Manager.DefaultScope(), account, addrType)
+	if err != nil {
+		log.Error("SetAccountAddrType ", "err ", err.Error())
+		return nil, err
+	}
+	return "succ", nil
+}
+
+// RenameAccount handles a renameaccount request by renaming an account.
+// If the account does not exist an appropiate error will be returned.
+func RenameAccount(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.RenameAccountCmd)
+
+	// The wildcard * is reserved by the rpc server with the special meaning
+	// of "all accounts", so disallow naming accounts to this string.
+	if cmd.NewAccount == "*" {
+		return nil, &qitmeerjson.ErrReservedAccountName
+	}
+
+	// Check that given account exists
+	account, err := w.AccountNumber(w.Manager.DefaultScope(), cmd.OldAccount)
+	if err != nil {
+		log.Error("RenameAccount ", "err ", err.Error())
+		return nil, err
+	}
+	err = w.RenameAccount(w.Manager.DefaultScope(), account, cmd.NewAccount)
+	if err != nil {
+		log.Error("RenameAccount ", "err ", err.Error())
+		return nil, err
+	}
+	return "succ", nil
 }
 
 // listAccounts handles a listaccounts request by returning a map of account
 // names to their balances.
 func ListAccounts(w *wallet.Wallet) (interface{}, error) {
-	results, err := w.AccountBalances(waddrmgr.KeyScopeBIP0044)
+	results, err := w.AccountBalances(w.Manager.DefaultScope())
 	if err != nil {
 		return nil, err
 	}
@@ -67,11 +137,11 @@ func GetNewAddress(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 	if acctName == "imported" {
 		return nil, fmt.Errorf("Import account cannot create subaddress.")
 	}
-	account, err := w.AccountNumber(waddrmgr.KeyScopeBIP0044, acctName)
+	account, err := w.AccountNumber(w.Manager.DefaultScope(), acctName)
 	if err != nil {
 		return nil, err
 	}
-	addr, err := w.NewAddress(waddrmgr.KeyScopeBIP0044, account)
+	addr, err := w.NewAddress(w.Manager.DefaultScope(), account)
 	if err != nil {
 		return nil, err
 	}
@@ -80,30 +150,44 @@ func GetNewAddress(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 }
 
 // getAddressesByAccount handles a getaddressesbyaccount request by returning
-// all addresses for an account, or an error if the requested account does
-// not exist.
-func GetAddressesByAccount(iCmd interface{}, w *wallet.Wallet) ([]string, error) {
+// all addresses for an account with their usage and received totals, or an
+// error if the requested account does not exist.
+func GetAddressesByAccount(iCmd interface{}, w *wallet.Wallet) ([]wallet.AddressUsage, error) {
 	cmd := iCmd.(*qitmeerjson.GetAddressesByAccountCmd)
 
-	account, err := w.AccountNumber(waddrmgr.KeyScopeBIP0044, cmd.Account)
+	account, err := w.AccountNumber(w.Manager.DefaultScope(), cmd.Account)
 	if err != nil {
 		return nil, err
 	}
 
-	addrs, err := w.AccountAddresses(account)
+	return w.AccountAddressUsage(w.Manager.DefaultScope(), account)
+}
+
+// GetUnusedAddress handles a getunusedaddress request by returning the first
+// external address of an account which has not received any output.
+func GetUnusedAddress(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.GetUnusedAddressCmd)
+
+	acctName := "default"
+	if cmd.Account != nil {
+		acctName = *cmd.Account
+	}
+	if acctName == "imported" {
+		return nil, fmt.Errorf("Import account cannot create subaddress.")
+	}
+	account, err := w.AccountNumber(w.Manager.DefaultScope(), acctName)
 	if err != nil {
 		return nil, err
 	}
-
-	addrStrs := make([]string, len(addrs))
-	for i, a := range addrs {
-		addrStrs[i] = a.Encode()
+	addr, err := w.UnusedAddress(w.Manager.DefaultScope(), account)
+	if err != nil {
+		return nil, err
 	}
-	return addrStrs, nil
+	return addr.Encode(), nil
 }
 
 func GetAccountAndAddress(w *wallet.Wallet) (interface{}, error) {
-	a, err := w.GetAccountAndAddress(waddrmgr.KeyScopeBIP0044)
+	a, err := w.GetAccountAndAddress(w.Manager.DefaultScope())
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +210,7 @@ func GetAccountByAddress(iCmd interface{}, w *wallet.Wallet) (interface{}, error
 		return nil, &qitmeerjson.ErrAddressNotInWallet
 	}
 
-	acctName, err := w.AccountName(waddrmgr.KeyScopeBIP0044, account)
+	acctName, err := w.AccountName(w.Manager.DefaultScope(), account)
 	if err != nil {
 		return nil, &qitmeerjson.ErrAccountNameNotFound
 	}
@@ -176,17 +260,23 @@ func ImportWifPrivKey(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 		}
 	}
 
+	if err := checkRescanFrom(cmd, w); err != nil {
+		return nil, err
+	}
+
 	// Import the private key, handling any errors.
-	_, err = w.ImportPrivateKey(waddrmgr.KeyScopeBIP0044, wif)
+	_, err = w.ImportPrivateKey(w.Manager.DefaultScope(), wif)
 	switch {
 	case waddrmgr.IsError(err, waddrmgr.ErrDuplicateAddress):
 		// Do not return duplicate key errors to the client.
 		return nil, nil
 	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
 		return nil, &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		return nil, err
 	}
 
-	return nil, err
+	return nil, rescanImportedKey(cmd, wif, w)
 }
 func ImportPrivKey(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 	cmd := iCmd.(*qitmeerjson.ImportPrivKeyCmd)
@@ -216,17 +306,58 @@ func ImportPrivKey(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
 		}
 	}
 
+	if err := checkRescanFrom(cmd, w); err != nil {
+		return nil, err
+	}
+
 	// Import the private key, handling any errors.
-	_, err = w.ImportPrivateKey(waddrmgr.KeyScopeBIP0044, wif)
+	_, err = w.ImportPrivateKey(w.Manager.DefaultScope(), wif)
 	switch {
 	case waddrmgr.IsError(err, waddrmgr.ErrDuplicateAddress):
 		// Do not return duplicate key errors to the client.
 		return nil, fmt.Errorf("private key imported")
 	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
 		return nil, &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		return nil, err
+	}
+	if err := rescanImportedKey(cmd, wif, w); err != nil {
+		return nil, err
+	}
+
+	return "ok", nil
+}
+
+// rescanFrom returns whether the command asks for a rescan and its start order.
+func rescanFrom(cmd *qitmeerjson.ImportPrivKeyCmd) (bool, uint64) {
+	if cmd.Rescan != nil && !*cmd.Rescan {
+		return false, 0
 	}
+	var startOrder uint64
+	if cmd.RescanFrom != nil {
+		startOrder = *cmd.RescanFrom
+	}
+	return true, startOrder
+}
+
+// checkRescanFrom rejects a rescan the node can not serve before the key is
+// imported.
+func checkRescanFrom(cmd *qitmeerjson.ImportPrivKeyCmd, w *wallet.Wallet) error {
+	rescan, startOrder := rescanFrom(cmd)
+	if !rescan {
+		return nil
+	}
+	return w.CheckRescanFrom(startOrder)
+}
 
-	return "ok", err
+// rescanImportedKey starts a background rescan for the addresses of an
+// imported key when the command asks for one.
+func rescanImportedKey(cmd *qitmeerjson.ImportPrivKeyCmd, wif *util.WIF, w *wallet.Wallet) error {
+	rescan, startOrder := rescanFrom(cmd)
+	if !rescan {
+		return nil
+	}
+	return w.RescanKey(wif, startOrder)
 }
 
 //sendToAddress handles a sendtoaddress RPC request by creating a new
@@ -354,6 +485,90 @@ func ClearTxData(w *wallet.Wallet) error {
 	return nil
 }
 
+// RebuildBalances rebuilds the account balances from the wallet outputs.
+func RebuildBalances(w *wallet.Wallet) error {
+	return w.RebuildBalances()
+}
+
+// Audit checks the wallet outputs against the node, fixing inconsistencies
+// when Repair is set.
+func Audit(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.AuditCmd)
+	repair := cmd.Repair != nil && *cmd.Repair
+	result, err := w.Audit(repair)
+	if err != nil {
+		log.Error("Audit ", "err ", err.Error())
+		return nil, err
+	}
+	return result, nil
+}
+
+// BackupWallet writes an encrypted backup of the wallet database.
+func BackupWallet(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.BackupWalletCmd)
+	destination := ""
+	if cmd.Destination != nil {
+		destination = *cmd.Destination
+	}
+	info, err := w.Backup(destination, []byte(cmd.Passphrase))
+	if err != nil {
+		log.Error("BackupWallet ", "err ", err.Error())
+		return nil, err
+	}
+	return info, nil
+}
+
+// VerifyBackup decrypts a wallet backup and checks its checksum and database.
+func VerifyBackup(iCmd interface{}) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.VerifyBackupCmd)
+	info, err := backup.Verify(cmd.Path, []byte(cmd.Passphrase))
+	if err != nil {
+		log.Error("VerifyBackup ", "err ", err.Error())
+		return nil, err
+	}
+	return info, nil
+}
+
+// ExportHistory writes the transaction history selected by the command to
+// out and returns the number of exported transactions.
+func ExportHistory(iCmd interface{}, w *wallet.Wallet, out io.Writer) (int, error) {
+	cmd := iCmd.(*qitmeerjson.ExportHistoryCmd)
+	format, err := export.ParseFormat(cmd.Format)
+	if err != nil {
+		return 0, err
+	}
+	var account, address, from, to string
+	var fromOrder, toOrder uint32
+	if cmd.Account != nil {
+		account = *cmd.Account
+	}
+	if cmd.Address != nil {
+		address = *cmd.Address
+	}
+	if cmd.FromOrder != nil {
+		fromOrder = *cmd.FromOrder
+	}
+	if cmd.ToOrder != nil {
+		toOrder = *cmd.ToOrder
+	}
+	if cmd.From != nil {
+		from = *cmd.From
+	}
+	if cmd.To != nil {
+		to = *cmd.To
+	}
+	filter, err := wallet.NewExportFilter(account, address, fromOrder, toOrder, from, to)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.ExportHistory(out, format, filter)
+	if err != nil {
+		log.Error("ExportHistory ", "err ", err.Error())
+		return 0, err
+	}
+	return n, nil
+}
+
 func GetTx(txId string, w *wallet.Wallet) (interface{}, error) {
 	tx, err := w.GetTx(txId)
 	if err != nil {
@@ -394,9 +609,169 @@ func Unlock(password string, w *wallet.Wallet) error {
 	return w.Unlock([]byte(password), time.After(10*time.Minute))
 }
 
+// KeyPoolRefill handles a keypoolrefill request by deriving the key pools of
+// the accounts up to the requested size.  It works while the wallet is locked.
+func KeyPoolRefill(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.KeyPoolRefillCmd)
+
+	size := wallet.KeyPoolSize()
+	if cmd.NewSize != nil {
+		if *cmd.NewSize > uint(wallet.MaxKeyPoolSize()) {
+			return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter,
+				fmt.Sprintf("key pool size is too large, the maximum is %d",
+					wallet.MaxKeyPoolSize()))
+		}
+		size = uint32(*cmd.NewSize)
+	}
+	if err := w.RefillKeyPool(size); err != nil {
+		log.Error("KeyPoolRefill ", "err ", err.Error())
+		return nil, err
+	}
+	return nil, nil
+}
+
+// SplitSeed handles a splitseed request by splitting the seed of the wallet
+// into shares of the requested groups.  The wallet must be unlocked.
+func SplitSeed(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.SplitSeedCmd)
+
+	groups, err := shamir.ParseGroups(cmd.Groups)
+	if err != nil {
+		return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter, err.Error())
+	}
+	groupThreshold := uint8(len(groups))
+	if cmd.GroupThreshold != nil {
+		groupThreshold = *cmd.GroupThreshold
+	}
+	shares, err := w.SplitSeed(groupThreshold, groups)
+	switch {
+	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
+		return nil, &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		log.Error("SplitSeed ", "err ", err.Error())
+		return nil, err
+	}
+	return shares, nil
+}
+
+// UpgradeKDF handles an upgradekdf request by re-wrapping the master keys
+// under the requested key derivation function and costs, which it returns.
+// The wallet must be unlocked.
+func UpgradeKDF(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.UpgradeKDFCmd)
+
+	name := ""
+	if cmd.KDF != nil {
+		name = *cmd.KDF
+	}
+	var target time.Duration
+	if cmd.Target != nil && *cmd.Target != "" {
+		var err error
+		target, err = time.ParseDuration(*cmd.Target)
+		if err != nil || target < 0 {
+			return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter,
+				fmt.Sprintf("invalid kdf target %q", *cmd.Target))
+		}
+	}
+	kdf, err := wallet.KDFOptions(name, target)
+	if err != nil {
+		return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter, err.Error())
+	}
+
+	var pubPass []byte
+	if cmd.PubPassphrase != nil {
+		pubPass = []byte(*cmd.PubPassphrase)
+	}
+	err = w.UpgradeKDF([]byte(cmd.Passphrase), pubPass, kdf)
+	switch {
+	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
+		return nil, &qitmeerjson.ErrWalletUnlockNeeded
+	case waddrmgr.IsError(err, waddrmgr.ErrWeakerKDF):
+		return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter,
+			err.(waddrmgr.ManagerError).Description)
+	case err != nil:
+		log.Error("UpgradeKDF ", "err ", err.Error())
+		return nil, err
+	}
+	return kdf.String(), nil
+}
+
+// SweepMasterKey handles a sweepmasterkey request by sending the funds of the
+// master key address to the default account, importing and rescanning the
+// key when the wallet does not hold it.  It returns the ids of the sent
+// transactions.  The wallet must be unlocked.
+func SweepMasterKey(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	_ = iCmd.(*qitmeerjson.SweepMasterKeyCmd)
+
+	txIds, err := w.SweepMasterKey()
+	switch {
+	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
+		return nil, &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		log.Error("SweepMasterKey ", "err ", err.Error())
+		return txIds, err
+	}
+	return txIds, nil
+}
+
+// ShowMnemonic handles a showmnemonic request by returning the mnemonic the
+// wallet was created from.  The request must be confirmed and the wallet must
+// be unlocked.
+func ShowMnemonic(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.ShowMnemonicCmd)
+	if !cmd.Confirm {
+		return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter,
+			"showmnemonic must be confirmed")
+	}
+
+	mnemonic, err := w.Mnemonic()
+	switch {
+	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
+		return nil, &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		log.Error("ShowMnemonic ", "err ", err.Error())
+		return nil, err
+	}
+	return mnemonic, nil
+}
+
+// VerifyMnemonic handles a verifymnemonic request by reporting whether the
+// mnemonic, with the optional passphrase, recovers the wallet.
+func VerifyMnemonic(iCmd interface{}, w *wallet.Wallet) (interface{}, error) {
+	cmd := iCmd.(*qitmeerjson.VerifyMnemonicCmd)
+
+	passphrase := ""
+	if cmd.Passphrase != nil {
+		passphrase = *cmd.Passphrase
+	}
+	match, err := w.VerifyMnemonic(cmd.Mnemonic, passphrase)
+	if err != nil {
+		log.Error("VerifyMnemonic ", "err ", err.Error())
+		return nil, qitmeerjson.NewRPCError(qitmeerjson.ErrRPCInvalidParameter, err.Error())
+	}
+	return match, nil
+}
+
+// WalletPassphraseChange changes the private passphrase of the wallet, or
+// the public one when the command asks for it.
+func WalletPassphraseChange(iCmd interface{}, w *wallet.Wallet) error {
+	cmd := iCmd.(*qitmeerjson.WalletPassphraseChangeCmd)
+	private := cmd.Public == nil || !*cmd.Public
+	err := w.ChangePassphrase([]byte(cmd.OldPassphrase), []byte(cmd.NewPassphrase), private)
+	if err != nil {
+		log.Error("WalletPassphraseChange ", "err ", err.Error())
+		return err
+	}
+	return nil
+}
+
 func GetListTxByAddr(icmd interface{}, w *wallet.Wallet) (interface{}, error) {
 	cmd := icmd.(*qitmeerjson.GetListTxByAddrCmd)
-	m, err := w.GetListTxByAddr(cmd.Address, int(cmd.Stype), int(cmd.Page), int(cmd.PageSize))
+	cursor := ""
+	if cmd.Cursor != nil {
+		cursor = *cmd.Cursor
+	}
+	m, err := w.GetListTxByAddr(cmd.Address, int(cmd.Stype), int(cmd.Page), int(cmd.PageSize), cursor)
 	if err != nil {
 		log.Error("GetListTxByAddr ", " err", err.Error())
 		return nil, err
@@ -406,7 +781,11 @@ func GetListTxByAddr(icmd interface{}, w *wallet.Wallet) (interface{}, error) {
 
 func GetBillByAddr(icmd interface{}, w *wallet.Wallet) (interface{}, error) {
 	cmd := icmd.(*qitmeerjson.GetBillByAddrCmd)
-	m, err := w.GetBillByAddr(cmd.Address, int(cmd.Filter), int(cmd.PageNo), int(cmd.PageSize))
+	cursor := ""
+	if cmd.Cursor != nil {
+		cursor = *cmd.Cursor
+	}
+	m, err := w.GetBillByAddr(cmd.Address, int(cmd.Filter), int(cmd.PageNo), int(cmd.PageSize), cursor)
 	if err != nil {
 		log.Error("GetBillByAddr ", " err", err.Error())
 		return nil, err
@@ -6,10 +6,13 @@ import (
 	"crypto/subtle"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"runtime/debug"
+	"time"
 
 	"github.com/Qitmeer/qitmeer-wallet/internal/zero"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/nacl/secretbox"
 	"golang.org/x/crypto/scrypt"
 )
@@ -23,6 +26,7 @@ var (
 	ErrInvalidPassword = errors.New("invalid password")
 	ErrMalformed       = errors.New("malformed data")
 	ErrDecryptFailed   = errors.New("unable to decrypt")
+	ErrUnknownKDF      = errors.New("unknown key derivation function")
 )
 
 // Various constants needed for encryption scheme.
@@ -31,6 +35,13 @@ const (
 	Overhead  = secretbox.Overhead
 	KeySize   = 32
 	NonceSize = 24
+
+	// paramsVersion is the version of the marshalled parameters which
+	// start with a header naming the key derivation function.  The
+	// original format is headerless scrypt parameters of
+	// legacyParamsSize bytes.
+	paramsVersion    = 1
+	legacyParamsSize = KeySize + sha256.Size + 24
 )
 
 // CryptoKey represents a secret key which can be used to encrypt and decrypt
@@ -86,13 +97,124 @@ func GenerateCryptoKey() (*CryptoKey, error) {
 	return &key, nil
 }
 
+// KDF identifies the function a secret key is derived from a passphrase with.
+type KDF uint8
+
+const (
+	// KDFScrypt derives keys with scrypt, the function of the original
+	// headerless parameters.
+	KDFScrypt KDF = iota
+
+	// KDFArgon2id derives keys with Argon2id.
+	KDFArgon2id
+)
+
+// String returns the name of the key derivation function.
+func (k KDF) String() string {
+	switch k {
+	case KDFScrypt:
+		return "scrypt"
+	case KDFArgon2id:
+		return "argon2id"
+	}
+	return fmt.Sprintf("KDF(%d)", uint8(k))
+}
+
+// ParseKDF returns the key derivation function named name.
+func ParseKDF(name string) (KDF, error) {
+	switch name {
+	case "scrypt":
+		return KDFScrypt, nil
+	case "argon2id":
+		return KDFArgon2id, nil
+	}
+	return 0, fmt.Errorf("%w %q, want scrypt or argon2id", ErrUnknownKDF, name)
+}
+
+// KDFParams are the key derivation function and its cost settings.  Only the
+// settings of the function are used.
+type KDFParams struct {
+	KDF KDF
+
+	// N, R and P are the CPU/memory cost, block size and parallelization
+	// of scrypt.
+	N int
+	R int
+	P int
+
+	// Time is the number of passes, Memory the memory in KiB and Threads
+	// the parallelism of Argon2id.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// String returns the function and its cost settings.
+func (kp KDFParams) String() string {
+	switch kp.KDF {
+	case KDFScrypt:
+		return fmt.Sprintf("scrypt N=%d r=%d p=%d", kp.N, kp.R, kp.P)
+	case KDFArgon2id:
+		return fmt.Sprintf("argon2id t=%d m=%dKiB p=%d", kp.Time,
+			kp.Memory, kp.Threads)
+	}
+	return kp.KDF.String()
+}
+
+// Weaker reports whether kp costs less than old, so that re-deriving a key
+// with kp would weaken it.  Argon2id is considered stronger than scrypt, and
+// with the same function, a setting below the one of old is weaker.
+func (kp KDFParams) Weaker(old KDFParams) bool {
+	if kp.KDF != old.KDF {
+		return kp.KDF == KDFScrypt && old.KDF == KDFArgon2id
+	}
+	switch kp.KDF {
+	case KDFScrypt:
+		return kp.N < old.N || kp.R < old.R || kp.P < old.P
+	case KDFArgon2id:
+		return kp.Time < old.Time || kp.Memory < old.Memory ||
+			kp.Threads < old.Threads
+	}
+	return false
+}
+
+// validate returns an error when the settings can't derive a key.
+func (kp *KDFParams) validate() error {
+	switch kp.KDF {
+	case KDFScrypt:
+		if kp.N <= 1 || kp.N&(kp.N-1) != 0 || kp.R <= 0 || kp.P <= 0 {
+			return fmt.Errorf("invalid scrypt parameters N=%d r=%d p=%d",
+				kp.N, kp.R, kp.P)
+		}
+	case KDFArgon2id:
+		if kp.Time == 0 || kp.Threads == 0 ||
+			kp.Memory < 8*uint32(kp.Threads) {
+			return fmt.Errorf("invalid argon2id parameters t=%d m=%d p=%d",
+				kp.Time, kp.Memory, kp.Threads)
+		}
+	default:
+		return ErrUnknownKDF
+	}
+	return nil
+}
+
+// key derives a key of keyLen bytes from password and salt.
+func (kp *KDFParams) key(password, salt []byte, keyLen int) ([]byte, error) {
+	if err := kp.validate(); err != nil {
+		return nil, err
+	}
+	if kp.KDF == KDFArgon2id {
+		return argon2.IDKey(password, salt, kp.Time, kp.Memory,
+			kp.Threads, uint32(keyLen)), nil
+	}
+	return scrypt.Key(password, salt, kp.N, kp.R, kp.P, keyLen)
+}
+
 // Parameters are not secret and can be stored in plain text.
 type Parameters struct {
 	Salt   [KeySize]byte
 	Digest [sha256.Size]byte
-	N      int
-	R      int
-	P      int
+	KDFParams
 }
 
 // SecretKey houses a crypto key and the parameters needed to derive it from a
@@ -104,10 +226,7 @@ type SecretKey struct {
 
 // deriveKey fills out the Key field.
 func (sk *SecretKey) deriveKey(password *[]byte) error {
-	key, err := scrypt.Key(*password, sk.Parameters.Salt[:],
-		sk.Parameters.N,
-		sk.Parameters.R,
-		sk.Parameters.P,
+	key, err := sk.Parameters.key(*password, sk.Parameters.Salt[:],
 		len(sk.Key))
 	if err != nil {
 		return err
@@ -115,8 +234,9 @@ func (sk *SecretKey) deriveKey(password *[]byte) error {
 	copy(sk.Key[:], key)
 	zero.Bytes(key)
 
-	// I'm not a fan of forced garbage collections, but scrypt allocates a
-	// ton of memory and calling it back to back without a GC cycle in
+	// I'm not a fan of forced garbage collections, but scrypt and Argon2id
+	// allocate a ton of memory and calling them back to back without a GC
+	// cycle in
 	// between means you end up needing twice the amount of memory.  For
 	// example, if your scrypt parameters are such that you require 1GB and
 	// you call it twice in a row, without this you end up allocating 2GB
@@ -132,41 +252,91 @@ func (sk *SecretKey) Marshal() []byte {
 	params := &sk.Parameters
 
 	// The marshalled format for the the params is as follows:
-	//   <salt><digest><N><R><P>
+	//   <version><kdf><salt><digest><kdf settings>
 	//
-	// KeySize + sha256.Size + N (8 bytes) + R (8 bytes) + P (8 bytes)
-	marshalled := make([]byte, KeySize+sha256.Size+24)
-
-	b := marshalled
-	copy(b[:KeySize], params.Salt[:])
-	b = b[KeySize:]
-	copy(b[:sha256.Size], params.Digest[:])
-	b = b[sha256.Size:]
-	binary.LittleEndian.PutUint64(b[:8], uint64(params.N))
-	b = b[8:]
-	binary.LittleEndian.PutUint64(b[:8], uint64(params.R))
-	b = b[8:]
-	binary.LittleEndian.PutUint64(b[:8], uint64(params.P))
+	// The settings are N, R and P of 8 bytes each for scrypt, and Time (4
+	// bytes), Memory (4 bytes) and Threads (1 byte) for Argon2id.
+	marshalled := make([]byte, 2, 2+KeySize+sha256.Size+24)
+	marshalled[0] = paramsVersion
+	marshalled[1] = byte(params.KDF)
+	marshalled = append(marshalled, params.Salt[:]...)
+	marshalled = append(marshalled, params.Digest[:]...)
+	switch params.KDF {
+	case KDFArgon2id:
+		var b [9]byte
+		binary.LittleEndian.PutUint32(b[:4], params.Time)
+		binary.LittleEndian.PutUint32(b[4:8], params.Memory)
+		b[8] = params.Threads
+		marshalled = append(marshalled, b[:]...)
+	default:
+		var b [24]byte
+		binary.LittleEndian.PutUint64(b[:8], uint64(params.N))
+		binary.LittleEndian.PutUint64(b[8:16], uint64(params.R))
+		binary.LittleEndian.PutUint64(b[16:], uint64(params.P))
+		marshalled = append(marshalled, b[:]...)
+	}
 
 	return marshalled
 }
 
 // Unmarshal unmarshalls the parameters needed to derive the secret key from a
-// passphrase into sk.
+// passphrase into sk.  Both the versioned format of Marshal and the original
+// headerless scrypt format are read.
 func (sk *SecretKey) Unmarshal(marshalled []byte) error {
 	if sk.Key == nil {
 		sk.Key = (*CryptoKey)(&[KeySize]byte{})
 	}
 
-	// The marshalled format for the the params is as follows:
+	// The original format for the the params is as follows:
 	//   <salt><digest><N><R><P>
 	//
 	// KeySize + sha256.Size + N (8 bytes) + R (8 bytes) + P (8 bytes)
-	if len(marshalled) != KeySize+sha256.Size+24 {
+	params := &sk.Parameters
+	if len(marshalled) == legacyParamsSize {
+		params.KDFParams = KDFParams{KDF: KDFScrypt}
+		unmarshalScrypt(params, marshalled)
+		return nil
+	}
+
+	if len(marshalled) < 2+KeySize+sha256.Size {
+		return ErrMalformed
+	}
+	if marshalled[0] != paramsVersion {
 		return ErrMalformed
 	}
+	kdf := KDF(marshalled[1])
+	marshalled = marshalled[2:]
+	switch kdf {
+	case KDFScrypt:
+		if len(marshalled) != legacyParamsSize {
+			return ErrMalformed
+		}
+		params.KDFParams = KDFParams{KDF: KDFScrypt}
+		unmarshalScrypt(params, marshalled)
+	case KDFArgon2id:
+		if len(marshalled) != KeySize+sha256.Size+9 {
+			return ErrMalformed
+		}
+		copy(params.Salt[:], marshalled[:KeySize])
+		marshalled = marshalled[KeySize:]
+		copy(params.Digest[:], marshalled[:sha256.Size])
+		marshalled = marshalled[sha256.Size:]
+		params.KDFParams = KDFParams{
+			KDF:     KDFArgon2id,
+			Time:    binary.LittleEndian.Uint32(marshalled[:4]),
+			Memory:  binary.LittleEndian.Uint32(marshalled[4:8]),
+			Threads: marshalled[8],
+		}
+	default:
+		return ErrUnknownKDF
+	}
 
-	params := &sk.Parameters
+	return nil
+}
+
+// unmarshalScrypt reads the salt, digest and scrypt settings of the original
+// format into params.
+func unmarshalScrypt(params *Parameters, marshalled []byte) {
 	copy(params.Salt[:], marshalled[:KeySize])
 	marshalled = marshalled[KeySize:]
 	copy(params.Digest[:], marshalled[:sha256.Size])
@@ -176,8 +346,6 @@ func (sk *SecretKey) Unmarshal(marshalled []byte) error {
 	params.R = int(binary.LittleEndian.Uint64(marshalled[:8]))
 	marshalled = marshalled[8:]
 	params.P = int(binary.LittleEndian.Uint64(marshalled[:8]))
-
-	return nil
 }
 
 // Zero zeroes the underlying secret key while leaving the parameters intact.
@@ -214,15 +382,20 @@ func (sk *SecretKey) Decrypt(in []byte) ([]byte, error) {
 	return sk.Key.Decrypt(in)
 }
 
-// NewSecretKey returns a SecretKey structure based on the passed parameters.
+// NewSecretKey returns a SecretKey structure derived with scrypt based on the
+// passed parameters.
 func NewSecretKey(password *[]byte, N, r, p int) (*SecretKey, error) {
+	return NewSecretKeyKDF(password, KDFParams{KDF: KDFScrypt, N: N, R: r, P: p})
+}
+
+// NewSecretKeyKDF returns a SecretKey structure derived with the key
+// derivation function and settings of kdf.
+func NewSecretKeyKDF(password *[]byte, kdf KDFParams) (*SecretKey, error) {
 	sk := SecretKey{
 		Key: (*CryptoKey)(&[KeySize]byte{}),
 	}
 	// setup parameters
-	sk.Parameters.N = N
-	sk.Parameters.R = r
-	sk.Parameters.P = p
+	sk.Parameters.KDFParams = kdf
 	_, err := io.ReadFull(prng, sk.Parameters.Salt[:])
 	if err != nil {
 		return nil, err
@@ -239,3 +412,75 @@ func NewSecretKey(password *[]byte, N, r, p int) (*SecretKey, error) {
 
 	return &sk, nil
 }
+
+// Minimum costs TuneKDF starts from, and the most memory it has scrypt use.
+const (
+	tuneScryptN       = 1 << 14
+	tuneScryptR       = 8
+	tuneMaxScryptN    = 1 << 20
+	tuneArgon2Memory  = 64 * 1024
+	tuneArgon2Threads = 4
+)
+
+// TuneKDF returns settings of kdf which take about target to derive a key on
+// this machine.  The cost is measured at the minimum settings and scaled up:
+// scrypt doubles N up to 1 GiB of memory and then raises P, Argon2id uses 64
+// MiB and raises the number of passes.  Settings below the minimum are never
+// returned.
+func TuneKDF(kdf KDF, target time.Duration) (KDFParams, error) {
+	var params KDFParams
+	switch kdf {
+	case KDFScrypt:
+		params = KDFParams{KDF: KDFScrypt, N: tuneScryptN, R: tuneScryptR, P: 1}
+	case KDFArgon2id:
+		params = KDFParams{KDF: KDFArgon2id, Time: 1,
+			Memory: tuneArgon2Memory, Threads: tuneArgon2Threads}
+	default:
+		return KDFParams{}, ErrUnknownKDF
+	}
+
+	elapsed, err := timeKDF(&params)
+	if err != nil {
+		return KDFParams{}, err
+	}
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	scale := float64(target) / float64(elapsed)
+	if scale <= 1 {
+		return params, nil
+	}
+
+	switch kdf {
+	case KDFScrypt:
+		// The cost of scrypt is linear in N and P.
+		for params.N < tuneMaxScryptN && scale >= 2 {
+			params.N <<= 1
+			scale /= 2
+		}
+		params.P = int(float64(params.P) * scale)
+		if params.P < 1 {
+			params.P = 1
+		}
+	case KDFArgon2id:
+		params.Time = uint32(scale)
+		if params.Time < 1 {
+			params.Time = 1
+		}
+	}
+	return params, nil
+}
+
+// timeKDF returns how long deriving a key with params takes.
+func timeKDF(params *KDFParams) (time.Duration, error) {
+	var salt [KeySize]byte
+	start := time.Now()
+	key, err := params.key([]byte("passphrase"), salt[:], KeySize)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	zero.Bytes(key)
+	debug.FreeOSMemory()
+	return elapsed, nil
+}
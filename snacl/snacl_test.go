@@ -0,0 +1,148 @@
+package snacl
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+var (
+	password = []byte("sikrit")
+
+	fastScrypt   = KDFParams{KDF: KDFScrypt, N: 16, R: 8, P: 1}
+	fastArgon2id = KDFParams{KDF: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, kdf := range []KDFParams{fastScrypt, fastArgon2id} {
+		sk, err := NewSecretKeyKDF(&password, kdf)
+		if err != nil {
+			t.Fatalf("%v: %v", kdf, err)
+		}
+		marshalled := sk.Marshal()
+		if marshalled[0] != paramsVersion || KDF(marshalled[1]) != kdf.KDF {
+			t.Fatalf("%v: marshalled header %x", kdf, marshalled[:2])
+		}
+
+		var sk2 SecretKey
+		if err := sk2.Unmarshal(marshalled); err != nil {
+			t.Fatalf("%v: %v", kdf, err)
+		}
+		if sk2.Parameters != sk.Parameters {
+			t.Fatalf("%v: unmarshalled %+v, want %+v", kdf,
+				sk2.Parameters, sk.Parameters)
+		}
+		if err := sk2.DeriveKey(&password); err != nil {
+			t.Fatalf("%v: %v", kdf, err)
+		}
+		if *sk2.Key != *sk.Key {
+			t.Fatalf("%v: derived another key", kdf)
+		}
+
+		wrong := []byte("wrong")
+		if err := sk2.DeriveKey(&wrong); err != ErrInvalidPassword {
+			t.Fatalf("%v: got %v, want ErrInvalidPassword", kdf, err)
+		}
+	}
+}
+
+func TestUnmarshalLegacy(t *testing.T) {
+	sk, err := NewSecretKey(&password, fastScrypt.N, fastScrypt.R, fastScrypt.P)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Marshal the parameters in the original headerless format.
+	legacy := make([]byte, 0, legacyParamsSize)
+	legacy = append(legacy, sk.Parameters.Salt[:]...)
+	legacy = append(legacy, sk.Parameters.Digest[:]...)
+	for _, v := range []int{sk.Parameters.N, sk.Parameters.R, sk.Parameters.P} {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		legacy = append(legacy, b[:]...)
+	}
+
+	var sk2 SecretKey
+	if err := sk2.Unmarshal(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if sk2.Parameters != sk.Parameters {
+		t.Fatalf("unmarshalled %+v, want %+v", sk2.Parameters, sk.Parameters)
+	}
+	if err := sk2.DeriveKey(&password); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	sk, err := NewSecretKeyKDF(&password, fastArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshalled := sk.Marshal()
+
+	var sk2 SecretKey
+	if err := sk2.Unmarshal(marshalled[:len(marshalled)-1]); err != ErrMalformed {
+		t.Errorf("truncated: got %v, want ErrMalformed", err)
+	}
+	unknown := append([]byte(nil), marshalled...)
+	unknown[1] = 9
+	if err := sk2.Unmarshal(unknown); err != ErrUnknownKDF {
+		t.Errorf("unknown kdf: got %v, want ErrUnknownKDF", err)
+	}
+	version := append([]byte(nil), marshalled...)
+	version[0] = 2
+	if err := sk2.Unmarshal(version); err != ErrMalformed {
+		t.Errorf("unknown version: got %v, want ErrMalformed", err)
+	}
+	if err := sk2.Unmarshal(make([]byte, KeySize+sha256.Size)); err != ErrMalformed {
+		t.Errorf("short: got %v, want ErrMalformed", err)
+	}
+}
+
+func TestKDFWeaker(t *testing.T) {
+	scrypt := KDFParams{KDF: KDFScrypt, N: 1 << 18, R: 8, P: 1}
+	argon := KDFParams{KDF: KDFArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+	tests := []struct {
+		name     string
+		kdf, old KDFParams
+		want     bool
+	}{
+		{"same scrypt", scrypt, scrypt, false},
+		{"higher N", KDFParams{KDF: KDFScrypt, N: 1 << 19, R: 8, P: 1}, scrypt, false},
+		{"lower N", KDFParams{KDF: KDFScrypt, N: 1 << 17, R: 8, P: 1}, scrypt, true},
+		{"lower r", KDFParams{KDF: KDFScrypt, N: 1 << 19, R: 4, P: 1}, scrypt, true},
+		{"same argon2id", argon, argon, false},
+		{"less memory", KDFParams{KDF: KDFArgon2id, Time: 4, Memory: 32 * 1024, Threads: 4}, argon, true},
+		{"fewer passes", KDFParams{KDF: KDFArgon2id, Time: 2, Memory: 64 * 1024, Threads: 4}, argon, true},
+		{"scrypt to argon2id", KDFParams{KDF: KDFArgon2id, Time: 1, Memory: 64, Threads: 1}, scrypt, false},
+		{"argon2id to scrypt", KDFParams{KDF: KDFScrypt, N: 1 << 20, R: 8, P: 1}, argon, true},
+	}
+	for _, test := range tests {
+		if got := test.kdf.Weaker(test.old); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTuneKDF(t *testing.T) {
+	if testing.Short() {
+		t.Skip("tuning derives keys at full cost")
+	}
+	for _, kdf := range []KDF{KDFScrypt, KDFArgon2id} {
+		params, err := TuneKDF(kdf, time.Millisecond)
+		if err != nil {
+			t.Fatalf("%v: %v", kdf, err)
+		}
+		if params.KDF != kdf {
+			t.Fatalf("%v: tuned %v", kdf, params)
+		}
+		if err := params.validate(); err != nil {
+			t.Fatalf("%v: %v", kdf, err)
+		}
+	}
+	if _, err := TuneKDF(KDF(9), time.Second); err != ErrUnknownKDF {
+		t.Fatalf("got %v, want ErrUnknownKDF", err)
+	}
+}
@@ -61,7 +61,7 @@ func (w *Wallet) Stop() {
 }
 
 func (w *Wallet) GenerateAddress(usePkAddr bool) (string, error) {
-	account, err := w.wallet.AccountNumber(waddrmgr.KeyScopeBIP0044, "imported")
+	account, err := w.wallet.AccountNumber(w.wallet.Manager.DefaultScope(), "imported")
 	if err != nil {
 		return "", err
 	}
@@ -182,17 +182,22 @@ func createWallet(cfg *config.Config, params *chaincfg.Params, pass, mnemonic, p
 	if err != nil {
 		return nil, err
 	}
+	var entropy []byte
 	if mnemonic != "" {
 		seed, err = bip39.NewSeedWithErrorChecking(mnemonic, "")
 		if err != nil {
 			return nil, err
 		}
+		entropy, err = bip39.EntropyFromMnemonic(mnemonic)
+		if err != nil {
+			return nil, err
+		}
 	}
 	seedKey, err := bip32.NewMasterKey(seed)
 	if err != nil {
 		return nil, err
 	}
-	w, err := loader.CreateNewWallet(privPass, privPass, seed, time.Now())
+	w, err := loader.CreateNewWallet(privPass, privPass, seed, entropy, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -217,7 +222,7 @@ func createWallet(cfg *config.Config, params *chaincfg.Params, pass, mnemonic, p
 	}
 
 	w.UnLockManager(privPass)
-	_, err = w.ImportPrivateKey(waddrmgr.KeyScopeBIP0044, wif)
+	_, err = w.ImportPrivateKey(w.Manager.DefaultScope(), wif)
 	if err != nil {
 		return nil, err
 	}
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/Qitmeer/qitmeer-wallet/config"
-	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
 	"github.com/Qitmeer/qng/core/types"
 	"github.com/Qitmeer/qng/params"
 	"github.com/shopspring/decimal"
@@ -53,7 +52,7 @@ func TestCreateWallet(t *testing.T) {
 		t.Errorf("failed to create wallet, %s", err)
 		return
 	}
-	account, err := w.AccountNumber(waddrmgr.KeyScopeBIP0044, "imported")
+	account, err := w.AccountNumber(w.Manager.DefaultScope(), "imported")
 	if err != nil {
 		t.Errorf("failed to get account number, %s", err)
 		return
@@ -75,7 +74,7 @@ func TestCreateWallet(t *testing.T) {
 		t.Errorf("failed to create wallet, %s", err)
 		return
 	}
-	account, err = w.AccountNumber(waddrmgr.KeyScopeBIP0044, "imported")
+	account, err = w.AccountNumber(w.Manager.DefaultScope(), "imported")
 	if err != nil {
 		t.Errorf("failed to get account number, %s", err)
 		return
@@ -140,7 +139,7 @@ func TestExportAmountToEvm(t *testing.T) {
 		t.Errorf("test failed, expect balance %d, but got %d | %v", 100000000000, b.UnspentAmount.Value, string(b1))
 		return
 	}
-	account, err := h.wallet.wallet.AccountNumber(waddrmgr.KeyScopeBIP0044, "imported")
+	account, err := h.wallet.wallet.AccountNumber(h.wallet.wallet.Manager.DefaultScope(), "imported")
 	if err != nil {
 		t.Errorf("failed to get account number, %s", err)
 		return
@@ -11,6 +11,7 @@ import (
 	"github.com/Qitmeer/qng/crypto/bip32"
 	ecc1 "github.com/Qitmeer/qng/crypto/ecc"
 	ecc "github.com/Qitmeer/qng/crypto/ecc/secp256k1"
+	chaincfg "github.com/Qitmeer/qng/params"
 	"github.com/Qitmeer/qng/qx"
 	"sync"
 )
@@ -40,9 +41,43 @@ const (
 	// WitnessPubKey represents a p2wkh (pay-to-witness-key-hash) address
 	// type.
 	WitnessPubKey
+
+	// SecpPubKey represents a p2pk (pay-to-pubkey) address type.  Keys
+	// handed out as p2pk addresses are also known by their p2pkh address.
 	SecpPubKey
 )
 
+// String returns the name used for the address type by the RPC and the
+// command line, pkh or pk for the types an account can hand out.
+func (t AddressType) String() string {
+	switch t {
+	case PubKeyHash:
+		return "pkh"
+	case Script:
+		return "script"
+	case NestedWitnessPubKey:
+		return "np2wkh"
+	case WitnessPubKey:
+		return "p2wkh"
+	case SecpPubKey:
+		return "pk"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// ParseAccountAddrType returns the account address type named by s, pkh for
+// pay-to-pubkey-hash or pk for pay-to-pubkey addresses.
+func ParseAccountAddrType(s string) (AddressType, error) {
+	switch s {
+	case "pkh":
+		return PubKeyHash, nil
+	case "pk":
+		return SecpPubKey, nil
+	}
+	str := fmt.Sprintf("unknown address type %q, must be pkh or pk", s)
+	return 0, managerError(ErrInvalidAccount, str, nil)
+}
+
 // ManagedAddress is an interface that provides acces to information regarding
 // an address managed by an address manager. Concrete implementations of this
 // type may provide further fields to provide information specific to that type
@@ -198,17 +233,17 @@ func (a *managedAddress) Address() types.Address {
 //
 // This is part of the ManagedAddress interface implementation.
 func (a *managedAddress) AddrHash() []byte {
-	var hash []byte
+	var addrHash []byte
 
 	switch n := a.address.(type) {
 	case *addr.PubKeyHashAddress:
-		hash = n.Hash160()[:]
+		addrHash = n.Hash160()[:]
 	case *addr.ScriptHashAddress:
-		hash = n.Hash160()[:]
+		addrHash = n.Hash160()[:]
 	case *addr.SecpPubKeyAddress:
-		hash = n.PubKey().SerializeCompressed()
+		addrHash = hash.Hash160(n.PubKey().SerializeCompressed())
 	}
-	return hash
+	return addrHash
 }
 
 // Imported returns true if the address was imported instead of being part of an
@@ -450,6 +485,96 @@ func newManagedAddressFromExtKey(s *ScopedKeyManager,
 	return managedAddr, nil
 }
 
+// DeriveAccountPubKey returns the extended public key of account in scope of
+// a manager created from seed, without creating it.
+func DeriveAccountPubKey(seed []byte, scope KeyScope,
+	account uint32) (*bip32.Key, error) {
+
+	root, err := bip32.NewMasterKey(seed)
+	if err != nil {
+		str := "failed to derive master extended key"
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+	coinTypeKey, err := deriveCoinTypeKey(root, scope)
+	if err != nil {
+		str := "failed to derive cointype extended key"
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+	acctKey, err := deriveAccountKey(coinTypeKey, account)
+	if err != nil {
+		str := fmt.Sprintf("failed to derive extended key for account %d",
+			account)
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+	return acctKey.PublicKey(), nil
+}
+
+// FirstAddress returns the first external address of the default account of
+// a manager created from seed with scope as its default scope.  It lets a seed
+// be checked against a known address before a wallet is created from it.
+func FirstAddress(seed []byte, scope KeyScope,
+	chainParams *chaincfg.Params) (types.Address, error) {
+
+	acctKey, err := DeriveAccountPubKey(seed, scope, DefaultAccountNum)
+	if err != nil {
+		return nil, err
+	}
+	branchKey, err := acctKey.NewChildKey(ExternalBranch)
+	if err != nil {
+		str := fmt.Sprintf("failed to derive extended key branch %d",
+			ExternalBranch)
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+	key, err := branchKey.NewChildKey(0)
+	if err != nil {
+		str := "failed to derive child extended key -- branch 0, child 0"
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+	pubKey, err := ecc.ParsePubKey(key.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopeAddrSchema(scope).ExternalAddrType == SecpPubKey {
+		return addr.NewSecpPubKeyAddress(pubKey.SerializeCompressed(), chainParams)
+	}
+	pubKeyHash := hash.Hash160(pubKey.SerializeCompressed())
+	return addr.NewPubKeyHashAddress(pubKeyHash, chainParams, ecc1.ECDSA_Secp256k1)
+}
+
+// MasterKeyAddress returns the pay-to-pubkey-hash address of the root master
+// key of the manager.  Wallets created by older versions imported the master
+// private key, which made this address spendable from the imported account.
+// The manager does not need to be unlocked.
+func (m *Manager) MasterKeyAddress(ns walletdb.ReadBucket) (types.Address, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	_, masterRootPubEnc := fetchMasterHDKeys(ns)
+	if masterRootPubEnc == nil {
+		str := "the master public key is not stored"
+		return nil, managerError(ErrNoExist, str, nil)
+	}
+	serializedMasterRootPub, err := m.cryptoKeyPub.Decrypt(masterRootPubEnc)
+	if err != nil {
+		str := "failed to decrypt master root serialized public key"
+		return nil, managerError(ErrCrypto, str, err)
+	}
+	rootPub, err := bip32.B58Deserialize(string(serializedMasterRootPub), bip32.DefaultBip32Version)
+	if err != nil {
+		str := "failed to create master extended public key"
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+	pubKey, err := ecc.ParsePubKey(rootPub.Key)
+	if err != nil {
+		str := "failed to parse master public key"
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+
+	pubKeyHash := hash.Hash160(pubKey.SerializeCompressed())
+	return addr.NewPubKeyHashAddress(pubKeyHash, m.chainParams, ecc1.ECDSA_Secp256k1)
+}
+
 // scriptAddress represents a pay-to-script-hash address.
 type scriptAddress struct {
 	manager         *ScopedKeyManager
@@ -8,6 +8,7 @@ import (
 	"github.com/Qitmeer/qitmeer-wallet/walletdb"
 	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
 	chainhash "github.com/Qitmeer/qng/common/hash"
+	"sort"
 	"time"
 )
 
@@ -214,6 +215,11 @@ var (
 	// in the manager
 	lastAccountName = []byte("lastaccount")
 
+	// keyPoolEndPrefix prefixes the account number in the metadata key
+	// that stores the indexes following the last pooled external and
+	// internal addresses of the account.
+	keyPoolEndPrefix = []byte("keypoolend")
+
 	// mainBucketName is the name of the bucket that stores the encrypted
 	// crypto keys that encrypt all other generated keys, the watch only
 	// flag, the master private key (encrypted), the master HD private key
@@ -230,6 +236,20 @@ var (
 	// encryption key. This reside under the main bucket.
 	masterHDPubName = []byte("mhdpub")
 
+	// masterSeedName is the name of the key that stores the seed the
+	// master HD key was derived from, so that it can be split into shares
+	// later.  It is encrypted with the master private crypto encryption
+	// key and resides under the main bucket.  Wallets created before it
+	// was stored lack it.
+	masterSeedName = []byte("mseed")
+
+	// mnemonicEntropyName is the name of the key that stores the BIP39
+	// entropy of the mnemonic the seed was derived from, so that the
+	// mnemonic can be shown again.  It is encrypted with the master private
+	// crypto encryption key and resides under the main bucket.  Only
+	// wallets created from a mnemonic have it.
+	mnemonicEntropyName = []byte("mentropy")
+
 	// Db related key names (main bucket).
 	mgrVersionName    = []byte("mgrver")
 	mgrCreateDateName = []byte("mgrcreated")
@@ -242,6 +262,10 @@ var (
 	cryptoScriptKeyName = []byte("cscript")
 	watchingOnlyName    = []byte("watchonly")
 
+	// Key scope related key names (main bucket).
+	defaultScopeName = []byte("defaultscope")
+	pendingScopeName = []byte("pendingscope")
+
 	// Sync related key names (sync bucket).
 	syncedToName              = []byte("syncedto")
 	chainHeightName           = []byte("chainheight")
@@ -401,6 +425,82 @@ func putMasterHDKeys(ns walletdb.ReadWriteBucket, masterHDPrivEnc, masterHDPubEn
 	return nil
 }
 
+// fetchMasterHDKeys attempts to fetch both the master HD private and public
+// keys from the database. If this is a watch only wallet, then it's possible
+// that the master private key isn't stored.
+func fetchMasterHDKeys(ns walletdb.ReadBucket) ([]byte, []byte) {
+	bucket := ns.NestedReadBucket(mainBucketName)
+
+	var masterHDPrivEnc, masterHDPubEnc []byte
+
+	// First, we'll try to fetch the master private key. If this database
+	// is watch only, or the master has been neutered, then this won't be
+	// found on disk.
+	key := bucket.Get(masterHDPrivName)
+	if key != nil {
+		masterHDPrivEnc = make([]byte, len(key))
+		copy(masterHDPrivEnc[:], key)
+	}
+
+	key = bucket.Get(masterHDPubName)
+	if key != nil {
+		masterHDPubEnc = make([]byte, len(key))
+		copy(masterHDPubEnc[:], key)
+	}
+
+	return masterHDPrivEnc, masterHDPubEnc
+}
+
+// putMasterSeed stores the encrypted seed of the master HD key in the top
+// level main bucket.
+func putMasterSeed(ns walletdb.ReadWriteBucket, seedEnc []byte) error {
+	bucket := ns.NestedReadWriteBucket(mainBucketName)
+
+	err := bucket.Put(masterSeedName, seedEnc)
+	if err != nil {
+		str := "failed to store encrypted master seed"
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// fetchMasterSeed returns the encrypted seed of the master HD key, or nil when
+// the wallet was created before it was stored.
+func fetchMasterSeed(ns walletdb.ReadBucket) []byte {
+	bucket := ns.NestedReadBucket(mainBucketName)
+
+	seedEnc := bucket.Get(masterSeedName)
+	if seedEnc == nil {
+		return nil
+	}
+	return append([]byte(nil), seedEnc...)
+}
+
+// putMnemonicEntropy stores the encrypted BIP39 entropy of the mnemonic in the
+// top level main bucket.
+func putMnemonicEntropy(ns walletdb.ReadWriteBucket, entropyEnc []byte) error {
+	bucket := ns.NestedReadWriteBucket(mainBucketName)
+
+	err := bucket.Put(mnemonicEntropyName, entropyEnc)
+	if err != nil {
+		str := "failed to store encrypted mnemonic entropy"
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// fetchMnemonicEntropy returns the encrypted BIP39 entropy of the mnemonic, or
+// nil when the wallet was not created from a mnemonic.
+func fetchMnemonicEntropy(ns walletdb.ReadBucket) []byte {
+	bucket := ns.NestedReadBucket(mainBucketName)
+
+	entropyEnc := bucket.Get(mnemonicEntropyName)
+	if entropyEnc == nil {
+		return nil
+	}
+	return append([]byte(nil), entropyEnc...)
+}
+
 // fetchCryptoKeys loads the encrypted crypto keys which are in turn used to
 // protect the extended keys, imported keys, and scripts.  Any of the returned
 // values can be nil, but in practice only the crypto private and script keys
@@ -500,6 +600,79 @@ func putWatchingOnly(ns walletdb.ReadWriteBucket, watchingOnly bool) error {
 	return nil
 }
 
+// fetchDefaultScope loads the key scope used for new accounts and addresses
+// from the database.  Managers created before it was stored use
+// KeyScopeBIP0044.
+func fetchDefaultScope(ns walletdb.ReadBucket) (KeyScope, error) {
+	bucket := ns.NestedReadBucket(mainBucketName)
+
+	buf := bucket.Get(defaultScopeName)
+	if buf == nil {
+		return KeyScopeBIP0044, nil
+	}
+	if len(buf) != scopeKeySize {
+		str := "malformed default key scope stored in database"
+		return KeyScope{}, managerError(ErrDatabase, str, nil)
+	}
+
+	return scopeFromBytes(buf), nil
+}
+
+// putDefaultScope stores the key scope used for new accounts and addresses to
+// the database.
+func putDefaultScope(ns walletdb.ReadWriteBucket, scope *KeyScope) error {
+	bucket := ns.NestedReadWriteBucket(mainBucketName)
+
+	scopeKey := scopeToBytes(scope)
+	if err := bucket.Put(defaultScopeName, scopeKey[:]); err != nil {
+		str := "failed to store default key scope"
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// fetchPendingScope loads the key scope waiting for the manager to be
+// unlocked to be created, nil when there is none.
+func fetchPendingScope(ns walletdb.ReadBucket) (*KeyScope, error) {
+	bucket := ns.NestedReadBucket(mainBucketName)
+
+	buf := bucket.Get(pendingScopeName)
+	if buf == nil {
+		return nil, nil
+	}
+	if len(buf) != scopeKeySize {
+		str := "malformed pending key scope stored in database"
+		return nil, managerError(ErrDatabase, str, nil)
+	}
+
+	scope := scopeFromBytes(buf)
+	return &scope, nil
+}
+
+// putPendingScope stores a key scope to create on the next unlock of the
+// manager to the database.
+func putPendingScope(ns walletdb.ReadWriteBucket, scope *KeyScope) error {
+	bucket := ns.NestedReadWriteBucket(mainBucketName)
+
+	scopeKey := scopeToBytes(scope)
+	if err := bucket.Put(pendingScopeName, scopeKey[:]); err != nil {
+		str := "failed to store pending key scope"
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// deletePendingScope removes the pending key scope from the database.
+func deletePendingScope(ns walletdb.ReadWriteBucket) error {
+	bucket := ns.NestedReadWriteBucket(mainBucketName)
+
+	if err := bucket.Delete(pendingScopeName); err != nil {
+		str := "failed to delete pending key scope"
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
 // deserializeAccountRow deserializes the passed serialized account information.
 // This is used as a common base for the various account types to deserialize
 // the common parts.
@@ -1251,12 +1424,51 @@ func createScopedManagerNS(ns walletdb.ReadWriteBucket, scope *KeyScope) error {
 
 // scopeSchemaToBytes encodes the passed scope schema as a set of bytes
 // suitable for storage within the database.
+//
+// The serialized schema format is:
+//
+//	<internal type><external type>[<account><type>...]
+//
+// The account address types follow in account order, each one as a 4 byte
+// account number and a 1 byte address type.
 func scopeSchemaToBytes(schema *ScopeAddrSchema) []byte {
-	var schemaBytes [2]byte
+	accounts := make([]uint32, 0, len(schema.AccountAddrTypes))
+	for account := range schema.AccountAddrTypes {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i] < accounts[j]
+	})
+
+	schemaBytes := make([]byte, 2, 2+5*len(accounts))
 	schemaBytes[0] = byte(schema.InternalAddrType)
 	schemaBytes[1] = byte(schema.ExternalAddrType)
+	for _, account := range accounts {
+		schemaBytes = append(schemaBytes, uint32ToBytes(account)...)
+		schemaBytes = append(schemaBytes,
+			byte(schema.AccountAddrTypes[account]))
+	}
+
+	return schemaBytes
+}
+
+// putScopeAddrSchema stores the address schema of the given scope.
+func putScopeAddrSchema(ns walletdb.ReadWriteBucket, scope *KeyScope,
+	schema *ScopeAddrSchema) error {
 
-	return schemaBytes[:]
+	schemaBucket := ns.NestedReadWriteBucket(scopeSchemaBucketName)
+	if schemaBucket == nil {
+		str := "unable to find scope schema bucket"
+		return managerError(ErrScopeNotFound, str, nil)
+	}
+
+	scopeKey := scopeToBytes(scope)
+	err := schemaBucket.Put(scopeKey[:], scopeSchemaToBytes(schema))
+	if err != nil {
+		str := fmt.Sprintf("failed to store schema of scope %v", scope)
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
 }
 
 // fetchAccountName retrieves the account name given an account number from the
@@ -1379,11 +1591,21 @@ func fetchScopeAddrSchema(ns walletdb.ReadBucket,
 // scopeSchemaFromBytes decodes a new scope schema instance from the set of
 // serialized bytes.
 func scopeSchemaFromBytes(schemaBytes []byte) *ScopeAddrSchema {
-
-	return &ScopeAddrSchema{
+	schema := &ScopeAddrSchema{
 		InternalAddrType: AddressType(schemaBytes[0]),
 		ExternalAddrType: AddressType(schemaBytes[1]),
 	}
+
+	// Schemas written before account address types were added end here.
+	for rest := schemaBytes[2:]; len(rest) >= 5; rest = rest[5:] {
+		if schema.AccountAddrTypes == nil {
+			schema.AccountAddrTypes = make(map[uint32]AddressType)
+		}
+		account := binary.LittleEndian.Uint32(rest[:4])
+		schema.AccountAddrTypes[account] = AddressType(rest[4])
+	}
+
+	return schema
 }
 
 // forEachAccountAddress calls the given function with each address of the
@@ -1556,6 +1778,22 @@ func putChainedAddress(ns walletdb.ReadWriteBucket, scope *KeyScope,
 	return nil
 }
 
+// putKeyPoolAddress stores the provided chained address of the key pool of an
+// account.  Unlike putChainedAddress it leaves the next index of the account
+// untouched, the address is handed out once the next index reaches it.
+func putKeyPoolAddress(ns walletdb.ReadWriteBucket, scope *KeyScope,
+	addressID []byte, account, branch, index uint32) error {
+
+	addrRow := dbAddressRow{
+		addrType:   adtChain,
+		account:    account,
+		addTime:    uint64(time.Now().Unix()),
+		syncStatus: ssFull,
+		rawData:    serializeChainedAddress(branch, index),
+	}
+	return putAddress(ns, scope, addressID, &addrRow)
+}
+
 // putScriptAddress stores the provided script address information to the
 // database.
 func putScriptAddress(ns walletdb.ReadWriteBucket, scope *KeyScope,
@@ -1729,6 +1967,31 @@ func fetchAddressUsed(ns walletdb.ReadBucket, scope *KeyScope,
 	return bucket.Get(addrHash[:]) != nil
 }
 
+// markAddressUsed flags the provided address id as used in the database.
+func markAddressUsed(ns walletdb.ReadWriteBucket, scope *KeyScope,
+	addressID []byte) error {
+
+	scopedBucket, err := fetchWriteScopeBucket(ns, scope)
+	if err != nil {
+		return err
+	}
+
+	bucket := scopedBucket.NestedReadWriteBucket(usedAddrBucketName)
+
+	addrHash := sha256.Sum256(addressID)
+	if bucket.Get(addrHash[:]) != nil {
+		return nil
+	}
+
+	err = bucket.Put(addrHash[:], []byte{0})
+	if err != nil {
+		str := fmt.Sprintf("failed to mark address used %x", addressID)
+		return managerError(ErrDatabase, str, err)
+	}
+
+	return nil
+}
+
 // fetchLastAccount retrieves the last account from the database.
 func fetchLastAccount(ns walletdb.ReadBucket, scope *KeyScope) (uint32, error) {
 	scopedBucket, err := fetchReadScopeBucket(ns, scope)
@@ -1749,6 +2012,64 @@ func fetchLastAccount(ns walletdb.ReadBucket, scope *KeyScope) (uint32, error) {
 	return account, nil
 }
 
+// keyPoolEndKey returns the metadata key of the key pool ends of account.
+func keyPoolEndKey(account uint32) []byte {
+	key := make([]byte, 0, len(keyPoolEndPrefix)+4)
+	key = append(key, keyPoolEndPrefix...)
+	return append(key, uint32ToBytes(account)...)
+}
+
+// fetchKeyPoolEnd retrieves the indexes following the last pooled external and
+// internal addresses of an account, zero when no pool was derived yet.
+func fetchKeyPoolEnd(ns walletdb.ReadBucket, scope *KeyScope,
+	account uint32) (uint32, uint32, error) {
+
+	scopedBucket, err := fetchReadScopeBucket(ns, scope)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	metaBucket := scopedBucket.NestedReadBucket(metaBucketName)
+
+	val := metaBucket.Get(keyPoolEndKey(account))
+	if val == nil {
+		return 0, 0, nil
+	}
+	if len(val) != 8 {
+		str := fmt.Sprintf("malformed key pool of account %d stored in "+
+			"database", account)
+		return 0, 0, managerError(ErrDatabase, str, nil)
+	}
+
+	external := binary.LittleEndian.Uint32(val[0:4])
+	internal := binary.LittleEndian.Uint32(val[4:8])
+	return external, internal, nil
+}
+
+// putKeyPoolEnd stores the indexes following the last pooled external and
+// internal addresses of an account.
+func putKeyPoolEnd(ns walletdb.ReadWriteBucket, scope *KeyScope,
+	account, external, internal uint32) error {
+
+	scopedBucket, err := fetchWriteScopeBucket(ns, scope)
+	if err != nil {
+		return err
+	}
+
+	metaBucket := scopedBucket.NestedReadWriteBucket(metaBucketName)
+
+	var val [8]byte
+	binary.LittleEndian.PutUint32(val[0:4], external)
+	binary.LittleEndian.PutUint32(val[4:8], internal)
+	err = metaBucket.Put(keyPoolEndKey(account), val[:])
+	if err != nil {
+		str := fmt.Sprintf("failed to store key pool of account %d",
+			account)
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
 // scopeToBytes transforms a manager's scope into the form that will be used to
 // retrieve the bucket that all information for a particular scope is stored
 // under
@@ -1760,6 +2081,15 @@ func scopeToBytes(scope *KeyScope) [scopeKeySize]byte {
 	return scopeBytes
 }
 
+// scopeFromBytes decodes a manager's scope from the form returned by
+// scopeToBytes.
+func scopeFromBytes(scopeBytes []byte) KeyScope {
+	return KeyScope{
+		Purpose: binary.LittleEndian.Uint32(scopeBytes[:]),
+		Coin:    binary.LittleEndian.Uint32(scopeBytes[4:]),
+	}
+}
+
 // putCoinTypeKeys stores the encrypted cointype keys which are in turn used to
 // derive the extended keys for all accounts.  Either parameter can be nil in
 // which case no value is written for the parameter. Each cointype key is
@@ -1885,3 +2215,45 @@ func putAccountNameIndex(ns walletdb.ReadWriteBucket, scope *KeyScope,
 	}
 	return nil
 }
+
+// deleteAccountNameIndex deletes the given key from the account name index of
+// the database.
+func deleteAccountNameIndex(ns walletdb.ReadWriteBucket, scope *KeyScope,
+	name string) error {
+
+	scopedBucket, err := fetchWriteScopeBucket(ns, scope)
+	if err != nil {
+		return err
+	}
+
+	bucket := scopedBucket.NestedReadWriteBucket(acctNameIdxBucketName)
+
+	// Delete the account name key
+	err = bucket.Delete(stringToBytes(name))
+	if err != nil {
+		str := fmt.Sprintf("failed to delete account name index key %s", name)
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// deleteAccountIDIndex deletes the given key from the account id index of the
+// database.
+func deleteAccountIDIndex(ns walletdb.ReadWriteBucket, scope *KeyScope,
+	account uint32) error {
+
+	scopedBucket, err := fetchWriteScopeBucket(ns, scope)
+	if err != nil {
+		return err
+	}
+
+	bucket := scopedBucket.NestedReadWriteBucket(acctIDIdxBucketName)
+
+	// Delete the account id key
+	err = bucket.Delete(uint32ToBytes(account))
+	if err != nil {
+		str := fmt.Sprintf("failed to delete account id index key %d", account)
+		return managerError(ErrDatabase, str, err)
+	}
+	return nil
+}
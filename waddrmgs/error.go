@@ -132,6 +132,10 @@ const (
 	// ErrBlockNotFound is returned when we attempt to retrieve the hash for
 	// a block that we do not know of.
 	ErrBlockNotFound
+
+	// ErrWeakerKDF indicates that the key derivation settings of a KDF
+	// upgrade cost less than the settings of the stored master keys.
+	ErrWeakerKDF
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -158,6 +162,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrCallBackBreak:     "ErrCallBackBreak",
 	ErrEmptyPassphrase:   "ErrEmptyPassphrase",
 	ErrScopeNotFound:     "ErrScopeNotFound",
+	ErrWeakerKDF:         "ErrWeakerKDF",
 }
 
 // String returns the ErrorCode as a human-readable name.
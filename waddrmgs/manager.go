@@ -93,17 +93,12 @@ func isReservedAccountName(name string) bool {
 	return name == ImportedAddrAccountName
 }
 
-// ScryptOptions is used to hold the scrypt parameters needed when deriving new
-// passphrase keys.
-type ScryptOptions struct {
-	N, R, P int
-}
-
 // AccountProperties contains properties associated with each account, such as
 // the account name, number, and the nubmer of derived and imported keys.
 type AccountProperties struct {
 	AccountNumber    uint32
 	AccountName      string
+	AddrType         AddressType
 	ExternalKeyCount uint32
 	InternalKeyCount uint32
 	ImportedKeyCount uint32
@@ -157,10 +152,28 @@ type accountInfo struct {
 }
 
 // DefaultScryptOptions is the default options used with scrypt.
-var DefaultScryptOptions = ScryptOptions{
-	N: 262144, // 2^18
-	R: 8,
-	P: 1,
+var DefaultScryptOptions = snacl.KDFParams{
+	KDF: snacl.KDFScrypt,
+	N:   262144, // 2^18
+	R:   8,
+	P:   1,
+}
+
+// DefaultArgon2idOptions is the default options used with Argon2id, the
+// second recommended option of RFC 9106.
+var DefaultArgon2idOptions = snacl.KDFParams{
+	KDF:     snacl.KDFArgon2id,
+	Time:    3,
+	Memory:  64 * 1024, // 64 MiB
+	Threads: 4,
+}
+
+// DefaultKDFOptions returns the default options of kdf.
+func DefaultKDFOptions(kdf snacl.KDF) snacl.KDFParams {
+	if kdf == snacl.KDFArgon2id {
+		return DefaultArgon2idOptions
+	}
+	return DefaultScryptOptions
 }
 
 // addrKey is used to uniquely identify an address even when those addresses
@@ -219,6 +232,10 @@ type Manager struct {
 	// itself loaded into memory.
 	scopedManagers map[KeyScope]*ScopedKeyManager
 
+	// defaultScope is the key scope of the accounts and addresses used by
+	// the wallet.
+	defaultScope KeyScope
+
 	externalAddrSchemas map[AddressType][]KeyScope
 	internalAddrSchemas map[AddressType][]KeyScope
 	syncState           syncState
@@ -363,7 +380,7 @@ func (m *Manager) Close() {
 	return
 }
 
-// NewScopedKeyManager creates a newgo bu scoped key manager from the root manager. A
+// NewScopedKeyManager creates a new scoped key manager from the root manager. A
 // scoped key manager is a sub-manager that only has the coin type key of a
 // particular coin type and BIP0043 purpose. This is useful as it enables
 // callers to create an arbitrary BIP0043 like schema with a stand alone
@@ -373,9 +390,158 @@ func (m *Manager) Close() {
 //
 // TODO(roasbeef): addrtype of raw key means it'll look in scripts to possibly
 // mark as gucci?
-func Create(ns walletdb.ReadWriteBucket, seed, pubPassphrase, privPassphrase []byte,
-	chainParams *chaincfg.Params, config *ScryptOptions,
-	birthday time.Time) error {
+func (m *Manager) NewScopedKeyManager(ns walletdb.ReadWriteBucket,
+	scope KeyScope, addrSchema ScopeAddrSchema) (*ScopedKeyManager, error) {
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.newScopedKeyManager(ns, scope, addrSchema)
+}
+
+// newScopedKeyManager creates a new scoped key manager, see
+// NewScopedKeyManager.
+//
+// This function MUST be called with the manager lock held for writes.
+func (m *Manager) newScopedKeyManager(ns walletdb.ReadWriteBucket,
+	scope KeyScope, addrSchema ScopeAddrSchema) (*ScopedKeyManager, error) {
+
+	if m.watchingOnly {
+		return nil, managerError(ErrWatchingOnly, errWatchingOnly, nil)
+	}
+	if _, ok := m.scopedManagers[scope]; ok {
+		str := fmt.Sprintf("scope %v already exists", scope.String())
+		return nil, managerError(ErrDuplicateAccount, str, nil)
+	}
+
+	// If the manager is locked, then we can't create a new scoped
+	// manager.
+	if m.locked {
+		return nil, managerError(ErrLocked, errLocked, nil)
+	}
+
+	// Now that we know the manager is unlocked, we'll need to fetch the
+	// root master HD private key. This is required as we'll be attempting
+	// the following derivation: m/purpose'/cointype'
+	masterRootPrivEnc, _ := fetchMasterHDKeys(ns)
+	if masterRootPrivEnc == nil {
+		str := "the master private key has been neutered"
+		return nil, managerError(ErrWatchingOnly, str, nil)
+	}
+
+	// Before we can derive any new scoped managers using this key, we'll
+	// need to fully decrypt it.
+	serializedMasterRootPriv, err := m.cryptoKeyPriv.Decrypt(masterRootPrivEnc)
+	if err != nil {
+		str := "failed to decrypt master root serialized private key"
+		return nil, managerError(ErrLocked, str, err)
+	}
+	rootPriv, err := bip32.B58Deserialize(string(serializedMasterRootPriv), bip32.DefaultBip32Version)
+	zero.Bytes(serializedMasterRootPriv)
+	if err != nil {
+		str := "failed to create master extended private key"
+		return nil, managerError(ErrKeyChain, str, err)
+	}
+
+	// Now that we know it's possible to actually create a new scoped
+	// manager, we'll carve out its bucket space within the database.
+	scopeBucket := ns.NestedReadWriteBucket(scopeBucketName)
+	if err := createScopedManagerNS(scopeBucket, &scope); err != nil {
+		return nil, err
+	}
+
+	// With the database state created, we'll now write down the address
+	// schema of this particular scope type.
+	scopeSchemas := ns.NestedReadWriteBucket(scopeSchemaBucketName)
+	scopeKey := scopeToBytes(&scope)
+	schemaBytes := scopeSchemaToBytes(&addrSchema)
+	if err := scopeSchemas.Put(scopeKey[:], schemaBytes); err != nil {
+		str := fmt.Sprintf("failed to store schema of scope %v", scope.String())
+		return nil, managerError(ErrDatabase, str, err)
+	}
+	if err := putLastAccount(ns, &scope, DefaultAccountNum); err != nil {
+		return nil, err
+	}
+
+	// With the database state created, we'll now derive the cointype key
+	// using the master HD private key, then encrypt it along with the
+	// first account using our crypto keys.
+	err = createManagerKeyScope(
+		ns, scope, rootPriv, m.cryptoKeyPub, m.cryptoKeyPriv,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Finally, we'll register this new scoped manager with the root
+	// manager.
+	sMgr := &ScopedKeyManager{
+		scope:       scope,
+		addrSchema:  addrSchema,
+		rootManager: m,
+		addrs:       make(map[addrKey]ManagedAddress),
+		acctInfo:    make(map[uint32]*accountInfo),
+	}
+	m.scopedManagers[scope] = sMgr
+	m.externalAddrSchemas[addrSchema.ExternalAddrType] = append(
+		m.externalAddrSchemas[addrSchema.ExternalAddrType], scope,
+	)
+	m.internalAddrSchemas[addrSchema.InternalAddrType] = append(
+		m.internalAddrSchemas[addrSchema.InternalAddrType], scope,
+	)
+
+	return sMgr, nil
+}
+
+// CreatePendingScope creates the key scope added to the manager by a database
+// upgrade, which needs the manager to be unlocked.  It returns the created
+// scope, or nil when there is none pending or the manager is locked.
+func (m *Manager) CreatePendingScope(ns walletdb.ReadWriteBucket) (*KeyScope, error) {
+	scope, err := fetchPendingScope(ns)
+	if err != nil || scope == nil {
+		return nil, err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.watchingOnly || m.locked {
+		return nil, nil
+	}
+	if _, ok := m.scopedManagers[*scope]; !ok {
+		_, err := m.newScopedKeyManager(ns, *scope, scopeAddrSchema(*scope))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := deletePendingScope(ns); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// DefaultScope returns the key scope of the accounts and addresses used by
+// the wallet, chosen when the manager was created.
+func (m *Manager) DefaultScope() KeyScope {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.defaultScope
+}
+
+// Create creates a new address manager in the given namespace.  The seed must
+// conform to the standards described in bip32.Key.NewMasterKey and will be
+// used to create the master root node from which all hierarchical
+// deterministic addresses are derived.  This allows all chained addresses in
+// the address manager to be recovered by using the same seed.  When the seed
+// was derived from a BIP39 mnemonic, mnemonicEntropy is its entropy, stored
+// so that the mnemonic can be shown again, and nil otherwise.  Along with the
+// default key scopes, the manager gets defaultScope, the key scope used for
+// the accounts and addresses of the wallet.  The passphrase keys are derived
+// with the function and costs of config, DefaultScryptOptions when it is nil.
+func Create(ns walletdb.ReadWriteBucket, seed, mnemonicEntropy, pubPassphrase,
+	privPassphrase []byte, chainParams *chaincfg.Params, defaultScope KeyScope,
+	config *snacl.KDFParams, birthday time.Time) error {
 
 	// Return an error if the manager has already been created in
 	// the given database namespace.
@@ -390,8 +556,26 @@ func Create(ns walletdb.ReadWriteBucket, seed, pubPassphrase, privPassphrase []b
 		return managerError(ErrEmptyPassphrase, str, nil)
 	}
 
+	// The purpose and coin type are hardened children of the master node.
+	if defaultScope.Purpose >= HardenedKeyStart {
+		str := fmt.Sprintf("purpose %d is too high", defaultScope.Purpose)
+		return managerError(ErrKeyChain, str, nil)
+	}
+	if defaultScope.Coin >= HardenedKeyStart {
+		str := fmt.Sprintf("coin type %d is too high", defaultScope.Coin)
+		return managerError(ErrCoinTypeTooHigh, str, nil)
+	}
+	scopes := make(map[KeyScope]ScopeAddrSchema, len(ScopeAddrMap)+1)
+	for scope, schema := range ScopeAddrMap {
+		scopes[scope] = schema
+	}
+	scopes[defaultScope] = scopeAddrSchema(defaultScope)
+
 	// Perform the initial bucket creation and database namespace setup.
-	if err := CreateManagerNS(ns, ScopeAddrMap); err != nil {
+	if err := CreateManagerNS(ns, scopes); err != nil {
+		return maybeConvertDbError(err)
+	}
+	if err := putDefaultScope(ns, &defaultScope); err != nil {
 		return maybeConvertDbError(err)
 	}
 
@@ -481,9 +665,9 @@ func Create(ns walletdb.ReadWriteBucket, seed, pubPassphrase, privPassphrase []b
 
 	// Next, for each registers default manager scope, we'll create the
 	// hardened cointype key for it, as well as the first default account.
-	for _, defaultScope := range DefaultKeyScopes {
+	for scope := range scopes {
 		err := createManagerKeyScope(
-			ns, defaultScope, rootKey, cryptoKeyPub, cryptoKeyPriv,
+			ns, scope, rootKey, cryptoKeyPub, cryptoKeyPriv,
 		)
 		if err != nil {
 			return maybeConvertDbError(err)
@@ -506,6 +690,28 @@ func Create(ns walletdb.ReadWriteBucket, seed, pubPassphrase, privPassphrase []b
 		return maybeConvertDbError(err)
 	}
 
+	// Keep the seed too, encrypted like the root master private key, so
+	// that it can be split into backup shares while the wallet is
+	// unlocked.
+	seedEnc, err := cryptoKeyPriv.Encrypt(seed)
+	if err != nil {
+		return maybeConvertDbError(err)
+	}
+	err = putMasterSeed(ns, seedEnc)
+	if err != nil {
+		return maybeConvertDbError(err)
+	}
+	if mnemonicEntropy != nil {
+		entropyEnc, err := cryptoKeyPriv.Encrypt(mnemonicEntropy)
+		if err != nil {
+			return maybeConvertDbError(err)
+		}
+		err = putMnemonicEntropy(ns, entropyEnc)
+		if err != nil {
+			return maybeConvertDbError(err)
+		}
+	}
+
 	// Save the encrypted crypto keys to the database.
 	err = putCryptoKeys(ns, cryptoKeyPubEnc, cryptoKeyPrivEnc,
 		cryptoKeyScriptEnc)
@@ -554,7 +760,7 @@ func Open(ns walletdb.ReadBucket, pubPassphrase []byte,
 
 // newSecretKey generates a new secret key using the active secretKeyGen.
 func newSecretKey(passphrase *[]byte,
-	config *ScryptOptions) (*snacl.SecretKey, error) {
+	config *snacl.KDFParams) (*snacl.SecretKey, error) {
 
 	secretKeyGenMtx.RLock()
 	defer secretKeyGenMtx.RUnlock()
@@ -563,8 +769,8 @@ func newSecretKey(passphrase *[]byte,
 
 // defaultNewSecretKey returns a new secret key.  See newSecretKey.
 func defaultNewSecretKey(passphrase *[]byte,
-	config *ScryptOptions) (*snacl.SecretKey, error) {
-	return snacl.NewSecretKey(passphrase, config.N, config.R, config.P)
+	config *snacl.KDFParams) (*snacl.SecretKey, error) {
+	return snacl.NewSecretKeyKDF(passphrase, *config)
 }
 
 var (
@@ -612,6 +818,12 @@ func loadManager(ns walletdb.ReadBucket, pubPassphrase []byte,
 		return nil, maybeConvertDbError(err)
 	}
 
+	// Load the key scope of the wallet accounts from the db.
+	defaultScope, err := fetchDefaultScope(ns)
+	if err != nil {
+		return nil, maybeConvertDbError(err)
+	}
+
 	// Load the sync state from the db.
 	syncedTo, err := fetchSyncedTo(ns)
 	if err != nil {
@@ -704,6 +916,7 @@ func loadManager(ns walletdb.ReadBucket, pubPassphrase []byte,
 		chainHeight, birthday, privPassphraseSalt, scopedManagers,
 	)
 	mgr.watchingOnly = watchingOnly
+	mgr.defaultScope = defaultScope
 
 	for _, scopedManager := range scopedManagers {
 		scopedManager.rootManager = mgr
@@ -785,6 +998,354 @@ func (m *Manager) isLocked() bool {
 	return m.locked
 }
 
+// CryptoKeyPub returns the crypto key of the public data of the manager.  The
+// transaction store encrypts its values with it, so that they are protected by
+// the public passphrase too.
+func (m *Manager) CryptoKeyPub() EncryptorDecryptor {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.cryptoKeyPub
+}
+
+// Seed returns the seed the master HD key of the manager was derived from.
+// The manager must be unlocked.  An ErrNoExist error is returned for wallets
+// created before the seed was stored.
+func (m *Manager) Seed(ns walletdb.ReadBucket) ([]byte, error) {
+	if m.watchingOnly {
+		return nil, managerError(ErrWatchingOnly, errWatchingOnly, nil)
+	}
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if m.locked {
+		return nil, managerError(ErrLocked, errLocked, nil)
+	}
+
+	seedEnc := fetchMasterSeed(ns)
+	if seedEnc == nil {
+		str := "the wallet was created before its seed was stored"
+		return nil, managerError(ErrNoExist, str, nil)
+	}
+	seed, err := m.cryptoKeyPriv.Decrypt(seedEnc)
+	if err != nil {
+		str := "failed to decrypt master seed"
+		return nil, managerError(ErrCrypto, str, err)
+	}
+	return seed, nil
+}
+
+// MnemonicEntropy returns the BIP39 entropy of the mnemonic the wallet was
+// created from.  It returns ErrNoExist when the wallet was not created from a
+// mnemonic.  The manager must be unlocked.
+func (m *Manager) MnemonicEntropy(ns walletdb.ReadBucket) ([]byte, error) {
+	if m.watchingOnly {
+		return nil, managerError(ErrWatchingOnly, errWatchingOnly, nil)
+	}
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if m.locked {
+		return nil, managerError(ErrLocked, errLocked, nil)
+	}
+
+	entropyEnc := fetchMnemonicEntropy(ns)
+	if entropyEnc == nil {
+		str := "the wallet was not created from a mnemonic"
+		return nil, managerError(ErrNoExist, str, nil)
+	}
+	entropy, err := m.cryptoKeyPriv.Decrypt(entropyEnc)
+	if err != nil {
+		str := "failed to decrypt mnemonic entropy"
+		return nil, managerError(ErrCrypto, str, err)
+	}
+	return entropy, nil
+}
+
+// CheckPrivatePassphrase returns an ErrWrongPassphrase error if passphrase is
+// not the private passphrase of the address manager.  Unlike Unlock, it does
+// not change the lock state of the manager.
+func (m *Manager) CheckPrivatePassphrase(passphrase []byte) error {
+	if m.watchingOnly {
+		return managerError(ErrWatchingOnly, errWatchingOnly, nil)
+	}
+
+	m.mtx.RLock()
+	sk := snacl.SecretKey{
+		Key:        &snacl.CryptoKey{},
+		Parameters: m.masterKeyPriv.Parameters,
+	}
+	m.mtx.RUnlock()
+	defer sk.Zero()
+
+	if err := sk.DeriveKey(&passphrase); err != nil {
+		if err == snacl.ErrInvalidPassword {
+			str := "invalid passphrase for master private key"
+			return managerError(ErrWrongPassphrase, str, nil)
+		}
+
+		str := "failed to derive master private key"
+		return managerError(ErrCrypto, str, err)
+	}
+	return nil
+}
+
+// ChangePassphrase changes either the public or private passphrase to the
+// provided value depending on the private flag.  In order to change the
+// private password, the address manager must not be watching-only.  The new
+// passphrase keys are derived using the key derivation function and costs of
+// the current master key.
+//
+// Only the master key protecting the crypto keys is replaced, the crypto keys
+// and therefore everything they encrypt are unchanged.  The new master key
+// parameters and the re-encrypted crypto keys are written in the transaction
+// of ns, the manager only switches to them once it is committed, so that an
+// interrupted change leaves the old passphrase in effect.
+func (m *Manager) ChangePassphrase(ns walletdb.ReadWriteBucket, oldPassphrase,
+	newPassphrase []byte, private bool) error {
+
+	return m.changePassphrase(ns, oldPassphrase, newPassphrase, private, nil)
+}
+
+// UpgradeKDF re-wraps the crypto keys under new master keys derived from the
+// same passphrases with the function and costs of kdf, so that wallets created
+// with weaker settings can be strengthened.  The private master key is always
+// replaced and requires the manager to be unlocked, the public one only when
+// pubPassphrase is not nil.  An ErrWeakerKDF error is returned when kdf costs
+// less than the settings of a replaced master key.  Like ChangePassphrase, the
+// manager switches to the new keys once the transaction of ns is committed.
+func (m *Manager) UpgradeKDF(ns walletdb.ReadWriteBucket, privPassphrase,
+	pubPassphrase []byte, kdf *snacl.KDFParams) error {
+
+	if m.watchingOnly {
+		return managerError(ErrWatchingOnly, errWatchingOnly, nil)
+	}
+	if m.IsLocked() {
+		return managerError(ErrLocked, errLocked, nil)
+	}
+	if old := m.KDFParams(true); kdf.Weaker(old) {
+		str := fmt.Sprintf("%v is weaker than the %v of the private "+
+			"master key", kdf, old)
+		return managerError(ErrWeakerKDF, str, nil)
+	}
+	if old := m.KDFParams(false); pubPassphrase != nil && kdf.Weaker(old) {
+		str := fmt.Sprintf("%v is weaker than the %v of the public "+
+			"master key", kdf, old)
+		return managerError(ErrWeakerKDF, str, nil)
+	}
+
+	// The public master key goes first.  changePassphrase only clears a new
+	// master key on its own errors, so a wrong public passphrase must fail
+	// before a new private master key is derived.
+	if pubPassphrase != nil {
+		err := m.changePassphrase(ns, pubPassphrase, pubPassphrase, false, kdf)
+		if err != nil {
+			return err
+		}
+	}
+	return m.changePassphrase(ns, privPassphrase, privPassphrase, true, kdf)
+}
+
+// KDFParams returns the key derivation function and costs of the private
+// master key, or of the public one when private is false.
+func (m *Manager) KDFParams(private bool) snacl.KDFParams {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if private {
+		return m.masterKeyPriv.Parameters.KDFParams
+	}
+	return m.masterKeyPub.Parameters.KDFParams
+}
+
+// changePassphrase replaces the master key of the private or public
+// passphrase with one derived from newPassphrase, with the settings of kdf or
+// of the current master key when kdf is nil.  See ChangePassphrase.
+func (m *Manager) changePassphrase(ns walletdb.ReadWriteBucket, oldPassphrase,
+	newPassphrase []byte, private bool, kdf *snacl.KDFParams) error {
+
+	// No private passphrase to change for a watching-only address manager.
+	if private && m.watchingOnly {
+		return managerError(ErrWatchingOnly, errWatchingOnly, nil)
+	}
+	if private && len(newPassphrase) == 0 {
+		str := "the private passphrase may not be empty"
+		return managerError(ErrEmptyPassphrase, str, nil)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	// Ensure the provided old passphrase is correct.  This check is done
+	// using a copy of the appropriate master key depending on the private
+	// flag to ensure the current state is not altered.  The temp key is
+	// cleared when done to avoid leaving a copy in memory.
+	var keyName string
+	secretKey := snacl.SecretKey{Key: &snacl.CryptoKey{}}
+	if private {
+		keyName = "private"
+		secretKey.Parameters = m.masterKeyPriv.Parameters
+	} else {
+		keyName = "public"
+		secretKey.Parameters = m.masterKeyPub.Parameters
+	}
+	if err := secretKey.DeriveKey(&oldPassphrase); err != nil {
+		if err == snacl.ErrInvalidPassword {
+			str := fmt.Sprintf("invalid passphrase for %s master "+
+				"key", keyName)
+			return managerError(ErrWrongPassphrase, str, nil)
+		}
+
+		str := fmt.Sprintf("failed to derive %s master key", keyName)
+		return managerError(ErrCrypto, str, err)
+	}
+	defer secretKey.Zero()
+
+	// Generate a new master key from the passphrase which is used to secure
+	// the actual secret keys.
+	if kdf == nil {
+		kdf = &secretKey.Parameters.KDFParams
+	}
+	newMasterKey, err := newSecretKey(&newPassphrase, kdf)
+	if err != nil {
+		str := "failed to create new master private key"
+		return managerError(ErrCrypto, str, err)
+	}
+	newKeyParams := newMasterKey.Marshal()
+
+	// Clear the new master key on every error path, it is only kept once
+	// the manager is set to switch to it.
+	switched := false
+	defer func() {
+		if !switched {
+			newMasterKey.Zero()
+		}
+	}()
+
+	var onCommit func()
+	if private {
+		// Technically, the locked state could be checked here to only
+		// do the decrypts when the address manager is locked as the
+		// clear text keys are already available in memory when it is
+		// unlocked, but this is not a hot path, decryption is quite
+		// fast, and it's less cyclomatic complexity to simply decrypt
+		// in either case.
+
+		// Create a new salt that will be used for hashing the new
+		// passphrase each unlock.
+		var passphraseSalt [saltSize]byte
+		_, err := rand.Read(passphraseSalt[:])
+		if err != nil {
+			str := "failed to read random source for passphrase salt"
+			return managerError(ErrCrypto, str, err)
+		}
+
+		// Re-encrypt the crypto private key using the new master
+		// private key.
+		decPriv, err := secretKey.Decrypt(m.cryptoKeyPrivEncrypted)
+		if err != nil {
+			str := "failed to decrypt crypto private key"
+			return managerError(ErrCrypto, str, err)
+		}
+		encPriv, err := newMasterKey.Encrypt(decPriv)
+		zero.Bytes(decPriv)
+		if err != nil {
+			str := "failed to encrypt crypto private key"
+			return managerError(ErrCrypto, str, err)
+		}
+
+		// Re-encrypt the crypto script key using the new master
+		// private key.
+		decScript, err := secretKey.Decrypt(m.cryptoKeyScriptEncrypted)
+		if err != nil {
+			str := "failed to decrypt crypto script key"
+			return managerError(ErrCrypto, str, err)
+		}
+		encScript, err := newMasterKey.Encrypt(decScript)
+		zero.Bytes(decScript)
+		if err != nil {
+			str := "failed to encrypt crypto script key"
+			return managerError(ErrCrypto, str, err)
+		}
+
+		// When the manager is locked, ensure the new clear text master
+		// key is cleared from memory now that it is no longer needed.
+		// If unlocked, create the new passphrase hash with the new
+		// passphrase and salt.
+		var hashedPassphrase [sha512.Size]byte
+		if m.locked {
+			newMasterKey.Zero()
+		} else {
+			saltedPassphrase := append(passphraseSalt[:],
+				newPassphrase...)
+			hashedPassphrase = sha512.Sum512(saltedPassphrase)
+			zero.Bytes(saltedPassphrase)
+		}
+
+		// Save the new keys and params to the db in a single
+		// transaction.
+		err = putCryptoKeys(ns, nil, encPriv, encScript)
+		if err != nil {
+			return maybeConvertDbError(err)
+		}
+		err = putMasterKeyParams(ns, nil, newKeyParams)
+		if err != nil {
+			return maybeConvertDbError(err)
+		}
+
+		// Now that the db has been successfully updated, the manager
+		// can switch to the new keys.
+		onCommit = func() {
+			m.mtx.Lock()
+			defer m.mtx.Unlock()
+
+			m.masterKeyPriv.Zero()
+			m.masterKeyPriv = newMasterKey
+			m.cryptoKeyPrivEncrypted = encPriv
+			m.cryptoKeyScriptEncrypted = encScript
+			m.privPassphraseSalt = passphraseSalt
+			if !m.locked {
+				m.hashedPrivPassphrase = hashedPassphrase
+			}
+		}
+	} else {
+		// Re-encrypt the crypto public key using the new master public
+		// key.
+		encryptedPub, err := newMasterKey.Encrypt(m.cryptoKeyPub.Bytes())
+		if err != nil {
+			str := "failed to encrypt crypto public key"
+			return managerError(ErrCrypto, str, err)
+		}
+
+		// Save the new keys and params to the db in a single
+		// transaction.
+		err = putCryptoKeys(ns, encryptedPub, nil, nil)
+		if err != nil {
+			return maybeConvertDbError(err)
+		}
+		err = putMasterKeyParams(ns, newKeyParams, nil)
+		if err != nil {
+			return maybeConvertDbError(err)
+		}
+
+		// Now that the db has been successfully updated, the manager
+		// can switch to the new key.
+		onCommit = func() {
+			m.mtx.Lock()
+			defer m.mtx.Unlock()
+
+			m.masterKeyPub.Zero()
+			m.masterKeyPub = newMasterKey
+		}
+	}
+	switched = true
+	ns.Tx().OnCommit(onCommit)
+
+	return nil
+}
+
 // deriveAccountKey derives the extended key for an account according to the
 // hierarchy described by BIP0044 given the master node.
 //
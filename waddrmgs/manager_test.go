@@ -0,0 +1,423 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package waddrmgr
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	chaincfg "github.com/Qitmeer/qng/params"
+
+	"github.com/Qitmeer/qitmeer-wallet/snacl"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/memdb"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/migration"
+)
+
+var (
+	testNamespaceKey = []byte("waddrmgr")
+
+	testSeed = bytes.Repeat([]byte{0x2a}, 32)
+	pubPass  = []byte("public")
+	privPass = []byte("private")
+
+	// fastKDF keeps the tests quick, the upgrade tests start from it.
+	fastKDF = &snacl.KDFParams{KDF: snacl.KDFScrypt, N: 16, R: 8, P: 1}
+)
+
+// testDB returns a memory database holding a manager created in scope.
+func testDB(t *testing.T, scope KeyScope) walletdb.DB {
+	t.Helper()
+	db, err := walletdb.Create("memdb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		memdb.Remove(t.Name())
+	})
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns, err := tx.CreateTopLevelBucket(testNamespaceKey)
+		if err != nil {
+			return err
+		}
+		return Create(ns, testSeed, nil, pubPass, privPass,
+			&chaincfg.TestNetParams, scope, fastKDF, time.Now())
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return db
+}
+
+func openManager(t *testing.T, db walletdb.DB, pub []byte) (*Manager, error) {
+	t.Helper()
+	var m *Manager
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		var err error
+		m, err = Open(tx.ReadBucket(testNamespaceKey), pub, &chaincfg.TestNetParams)
+		return err
+	})
+	if err == nil {
+		t.Cleanup(m.Close)
+	}
+	return m, err
+}
+
+func update(t *testing.T, db walletdb.DB, f func(ns walletdb.ReadWriteBucket) error) error {
+	t.Helper()
+	return walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		return f(tx.ReadWriteBucket(testNamespaceKey))
+	})
+}
+
+func unlock(db walletdb.DB, m *Manager, pass []byte) error {
+	return walletdb.View(db, func(tx walletdb.ReadTx) error {
+		return m.Unlock(tx.ReadBucket(testNamespaceKey), pass)
+	})
+}
+
+func TestChangePassphrase(t *testing.T) {
+	db := testDB(t, KeyScopeQitmeer)
+	m, err := openManager(t, db, pubPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Data encrypted with the public crypto key, like the transaction
+	// store, must stay readable.
+	record, err := m.CryptoKeyPub().Encrypt([]byte("transaction"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPriv := []byte("new private")
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.ChangePassphrase(ns, []byte("wrong"), newPriv, true)
+	})
+	if !IsError(err, ErrWrongPassphrase) {
+		t.Fatalf("wrong old passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.ChangePassphrase(ns, privPass, newPriv, true)
+	})
+	if err != nil {
+		t.Fatalf("ChangePassphrase private: %v", err)
+	}
+	if err := unlock(db, m, privPass); !IsError(err, ErrWrongPassphrase) {
+		t.Fatalf("unlock with the old passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if err := unlock(db, m, newPriv); err != nil {
+		t.Fatalf("unlock with the new passphrase: %v", err)
+	}
+
+	// The unlocked manager takes the new passphrase too.
+	newPriv2 := []byte("newer private")
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.ChangePassphrase(ns, newPriv, newPriv2, true)
+	})
+	if err != nil {
+		t.Fatalf("ChangePassphrase unlocked: %v", err)
+	}
+	if err := unlock(db, m, newPriv2); err != nil {
+		t.Fatalf("unlock unlocked manager with the new passphrase: %v", err)
+	}
+	if err := unlock(db, m, newPriv); !IsError(err, ErrWrongPassphrase) {
+		t.Fatalf("unlock unlocked manager with the old passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	newPub := []byte("new public")
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.ChangePassphrase(ns, pubPass, newPub, false)
+	})
+	if err != nil {
+		t.Fatalf("ChangePassphrase public: %v", err)
+	}
+	m.Close()
+
+	if _, err := openManager(t, db, pubPass); !IsError(err, ErrWrongPassphrase) {
+		t.Fatalf("open with the old public passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	m, err = openManager(t, db, newPub)
+	if err != nil {
+		t.Fatalf("open with the new public passphrase: %v", err)
+	}
+	plain, err := m.CryptoKeyPub().Decrypt(record)
+	if err != nil || string(plain) != "transaction" {
+		t.Fatalf("decrypt record: %q %v", plain, err)
+	}
+	if err := unlock(db, m, newPriv2); err != nil {
+		t.Fatalf("unlock after reopening: %v", err)
+	}
+}
+
+func TestUpgradeKDF(t *testing.T) {
+	db := testDB(t, KeyScopeQitmeer)
+	m, err := openManager(t, db, pubPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := m.CryptoKeyPub().Encrypt([]byte("transaction"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kdf := &snacl.KDFParams{KDF: snacl.KDFArgon2id, Time: 1, Memory: 64, Threads: 1}
+
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.UpgradeKDF(ns, privPass, pubPass, kdf)
+	})
+	if !IsError(err, ErrLocked) {
+		t.Fatalf("upgrade locked manager: got %v, want %v", err, ErrLocked)
+	}
+	if err := unlock(db, m, privPass); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong public passphrase fails before the private key is touched.
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.UpgradeKDF(ns, privPass, []byte("wrong"), kdf)
+	})
+	if !IsError(err, ErrWrongPassphrase) {
+		t.Fatalf("upgrade with a wrong public passphrase: got %v, want %v", err, ErrWrongPassphrase)
+	}
+	if got := m.KDFParams(true); got != *fastKDF {
+		t.Fatalf("private KDF %v after a failed upgrade, want %v", got, fastKDF)
+	}
+
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return m.UpgradeKDF(ns, privPass, pubPass, kdf)
+	})
+	if err != nil {
+		t.Fatalf("UpgradeKDF: %v", err)
+	}
+	if got := m.KDFParams(true); got != *kdf {
+		t.Fatalf("private KDF %v, want %v", got, kdf)
+	}
+	if got := m.KDFParams(false); got != *kdf {
+		t.Fatalf("public KDF %v, want %v", got, kdf)
+	}
+	m.Close()
+
+	// The stored parameters are used after reopening, with the same
+	// passphrases.
+	m, err = openManager(t, db, pubPass)
+	if err != nil {
+		t.Fatalf("open after upgrade: %v", err)
+	}
+	if got := m.KDFParams(true); got != *kdf {
+		t.Fatalf("stored private KDF %v, want %v", got, kdf)
+	}
+	if got := m.KDFParams(false); got != *kdf {
+		t.Fatalf("stored public KDF %v, want %v", got, kdf)
+	}
+	plain, err := m.CryptoKeyPub().Decrypt(record)
+	if err != nil || string(plain) != "transaction" {
+		t.Fatalf("decrypt record: %q %v", plain, err)
+	}
+	if err := unlock(db, m, privPass); err != nil {
+		t.Fatalf("unlock after upgrade: %v", err)
+	}
+
+	// Weaker settings are refused and leave the keys alone.
+	weaker := []*snacl.KDFParams{
+		fastKDF,
+		{KDF: snacl.KDFArgon2id, Time: 1, Memory: 32, Threads: 1},
+	}
+	for _, w := range weaker {
+		err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+			return m.UpgradeKDF(ns, privPass, nil, w)
+		})
+		if !IsError(err, ErrWeakerKDF) {
+			t.Fatalf("upgrade to %v: got %v, want %v", w, err, ErrWeakerKDF)
+		}
+	}
+	if got := m.KDFParams(true); got != *kdf {
+		t.Fatalf("private KDF %v after refused upgrades, want %v", got, kdf)
+	}
+}
+
+func TestRenameAccount(t *testing.T) {
+	db := testDB(t, KeyScopeQitmeer)
+	m, err := openManager(t, db, pubPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(db, m, privPass); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.FetchScopedKeyManager(KeyScopeQitmeer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var account uint32
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		if _, err := s.NewAccount(ns, "savings"); err != nil {
+			return err
+		}
+		account, err = s.NewAccount(ns, "spending")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return s.RenameAccount(ns, account, "savings")
+	})
+	if !IsError(err, ErrDuplicateAccount) {
+		t.Fatalf("rename to an existing name: got %v, want %v", err, ErrDuplicateAccount)
+	}
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return s.RenameAccount(ns, ImportedAddrAccount, "mine")
+	})
+	if !IsError(err, ErrInvalidAccount) {
+		t.Fatalf("rename the imported account: got %v, want %v", err, ErrInvalidAccount)
+	}
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return s.RenameAccount(ns, account, "daily")
+	})
+	if err != nil {
+		t.Fatalf("RenameAccount: %v", err)
+	}
+
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(testNamespaceKey)
+
+		// Both indexes hold the new name only.
+		if name, err := s.AccountName(ns, account); err != nil || name != "daily" {
+			t.Errorf("account name %q %v, want daily", name, err)
+		}
+		if got, err := s.LookupAccount(ns, "daily"); err != nil || got != account {
+			t.Errorf("lookup new name: %d %v, want %d", got, err, account)
+		}
+		if _, err := s.LookupAccount(ns, "spending"); !IsError(err, ErrAccountNotFound) {
+			t.Errorf("lookup old name: got %v, want %v", err, ErrAccountNotFound)
+		}
+		props, err := s.AccountProperties(ns, account)
+		if err != nil {
+			return err
+		}
+		if props.AccountName != "daily" {
+			t.Errorf("account properties name %q, want daily", props.AccountName)
+		}
+		if got, err := s.LookupAccount(ns, "savings"); err != nil || got != account-1 {
+			t.Errorf("lookup other account: %d %v, want %d", got, err, account-1)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old name is free again.
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		_, err := s.NewAccount(ns, "spending")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reuse the old name: %v", err)
+	}
+}
+
+func TestMigrateQitmeerKeyScope(t *testing.T) {
+	// Wallets created before the key scope could be chosen used
+	// KeyScopeBIP0044, lacked the default scope and were at version 7.
+	db := testDB(t, KeyScopeBIP0044)
+	err := update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		err := ns.NestedReadWriteBucket(mainBucketName).Delete(defaultScopeName)
+		if err != nil {
+			return err
+		}
+		return putManagerVersion(ns, 7)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openManager(t, db, pubPass); !IsError(err, ErrUpgrade) {
+		t.Fatalf("open old database: got %v, want %v", err, ErrUpgrade)
+	}
+
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return migration.Upgrade(NewMigrationManager(ns))
+	})
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(testNamespaceKey)
+		if version, err := fetchManagerVersion(ns); err != nil || version != LatestMgrVersion {
+			t.Errorf("version %d %v, want %d", version, err, LatestMgrVersion)
+		}
+		if buf := ns.NestedReadBucket(mainBucketName).Get(defaultScopeName); buf == nil {
+			t.Errorf("default scope not stored")
+		}
+		if scope, err := fetchPendingScope(ns); err != nil || scope == nil || *scope != KeyScopeQitmeer {
+			t.Errorf("pending scope %v %v, want %v", scope, err, KeyScopeQitmeer)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := openManager(t, db, pubPass)
+	if err != nil {
+		t.Fatalf("open upgraded database: %v", err)
+	}
+	if scope := m.DefaultScope(); scope != KeyScopeBIP0044 {
+		t.Fatalf("default scope %v, want %v", scope, KeyScopeBIP0044)
+	}
+	if _, err := m.FetchScopedKeyManager(KeyScopeQitmeer); err == nil {
+		t.Fatalf("key scope created before the unlock")
+	}
+
+	// The scope waits for the master private key.
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		scope, err := m.CreatePendingScope(ns)
+		if scope != nil {
+			t.Errorf("created scope %v while locked", scope)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(db, m, privPass); err != nil {
+		t.Fatal(err)
+	}
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		scope, err := m.CreatePendingScope(ns)
+		if scope == nil || *scope != KeyScopeQitmeer {
+			t.Errorf("created scope %v, want %v", scope, KeyScopeQitmeer)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("CreatePendingScope: %v", err)
+	}
+	if _, err := m.FetchScopedKeyManager(KeyScopeQitmeer); err != nil {
+		t.Fatalf("key scope not created: %v", err)
+	}
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		scope, err := fetchPendingScope(tx.ReadBucket(testNamespaceKey))
+		if scope != nil {
+			t.Errorf("scope %v still pending", scope)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Running the migrations again changes nothing.
+	err = update(t, db, func(ns walletdb.ReadWriteBucket) error {
+		return migration.Upgrade(NewMigrationManager(ns))
+	})
+	if err != nil {
+		t.Fatalf("Upgrade up to date database: %v", err)
+	}
+}
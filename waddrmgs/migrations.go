@@ -28,6 +28,10 @@ var versions = []migration.Version{
 		Number:    7,
 		Migration: resetSyncedBlockToBirthday,
 	},
+	{
+		Number:    8,
+		Migration: addQitmeerKeyScope,
+	},
 }
 
 // getLatestVersion returns the version number of the latest database version.
@@ -46,6 +50,12 @@ type MigrationManager struct {
 // migration.Manager interface.
 var _ migration.Manager = (*MigrationManager)(nil)
 
+// NewMigrationManager returns a MigrationManager for the address manager in
+// the namespace ns.
+func NewMigrationManager(ns walletdb.ReadWriteBucket) *MigrationManager {
+	return &MigrationManager{ns: ns}
+}
+
 // Name returns the name of the service we'll be attempting to upgrade.
 //
 // NOTE: This method is part of the migration.Manager interface.
@@ -206,3 +216,31 @@ func resetSyncedBlockToBirthday(ns walletdb.ReadWriteBucket) error {
 
 	return PutSyncedTo(ns, &birthdayBlock)
 }
+
+// addQitmeerKeyScope is a migration that adds KeyScopeQitmeer, the key scope
+// with the registered coin type of Qitmeer, to wallets created before the key
+// scope could be chosen.  Their accounts and addresses stay in the scope they
+// were created with, which is stored as the default scope.  Deriving the new
+// cointype key requires the master private key, so the scope is created on
+// the next unlock of the manager.
+func addQitmeerKeyScope(ns walletdb.ReadWriteBucket) error {
+	mainBucket := ns.NestedReadWriteBucket(mainBucketName)
+	if mainBucket.Get(defaultScopeName) == nil {
+		if err := putDefaultScope(ns, &KeyScopeBIP0044); err != nil {
+			return err
+		}
+	}
+
+	scopeKey := scopeToBytes(&KeyScopeQitmeer)
+	if ns.NestedReadBucket(scopeBucketName).NestedReadBucket(scopeKey[:]) != nil {
+		return nil
+	}
+	watchingOnly, err := fetchWatchingOnly(ns)
+	if err != nil {
+		return err
+	}
+	if watchingOnly {
+		return nil
+	}
+	return putPendingScope(ns, &KeyScopeQitmeer)
+}
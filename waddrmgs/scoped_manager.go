@@ -72,6 +72,13 @@ func (k *KeyScope) String() string {
 	return fmt.Sprintf("m/%v'/%v'", k.Purpose, k.Coin)
 }
 
+// PathString returns the full key path of the given derivation path within
+// the target key scope, e.g. m/44'/813'/0'/0/1.
+func (k *KeyScope) PathString(path DerivationPath) string {
+	return fmt.Sprintf("%v/%v'/%v/%v", k.String(), path.Account,
+		path.Branch, path.Index)
+}
+
 // ScopeAddrSchema is the address schema of a particular KeyScope. This will be
 // persisted within the database, and will be consulted when deriving any keys
 // for a particular scope to know how to encode the public keys as addresses.
@@ -82,6 +89,23 @@ type ScopeAddrSchema struct {
 	// InternalAddrType is the address type for all keys within branch 1
 	// (change addresses).
 	InternalAddrType AddressType
+
+	// AccountAddrTypes overrides the address type of both branches for
+	// the accounts it holds, so that an account can hand out pay-to-pubkey
+	// addresses in a pay-to-pubkey-hash scope.
+	AccountAddrTypes map[uint32]AddressType
+}
+
+// AccountAddrType returns the address type of the keys within the external or
+// internal branch of the given account.
+func (s *ScopeAddrSchema) AccountAddrType(account uint32, internal bool) AddressType {
+	if addrType, ok := s.AccountAddrTypes[account]; ok {
+		return addrType
+	}
+	if internal {
+		return s.InternalAddrType
+	}
+	return s.ExternalAddrType
 }
 
 var (
@@ -108,6 +132,14 @@ var (
 		Coin:    0,
 	}
 
+	// KeyScopeQitmeer is the key scope for BIP0044 derivation with the
+	// SLIP-0044 registered coin type of Qitmeer.  New wallets use it by
+	// default, and it is added to wallets created with KeyScopeBIP0044.
+	KeyScopeQitmeer = KeyScope{
+		Purpose: 44,
+		Coin:    813,
+	}
+
 	// DefaultKeyScopes is the set of default key scopes that will be
 	// created by the root manager upon initial creation.
 	DefaultKeyScopes = []KeyScope{
@@ -135,6 +167,25 @@ var (
 	}
 )
 
+// addressID returns the id an address is stored under in the database and the
+// address cache.  A pay-to-pubkey address shares the id of the pay-to-pubkey-hash
+// address of its key, so both forms of a key resolve to the same entry.
+func addressID(address types.Address) []byte {
+	if pka, ok := address.(*addrs.SecpPubKeyAddress); ok {
+		return pka.PKHAddress().Script()
+	}
+	return address.Script()
+}
+
+// scopeAddrSchema returns the address schema of the given scope, the one of
+// BIP0044 when it isn't one of the default key scopes.
+func scopeAddrSchema(scope KeyScope) ScopeAddrSchema {
+	if schema, ok := ScopeAddrMap[scope]; ok {
+		return schema
+	}
+	return ScopeAddrMap[KeyScopeBIP0044]
+}
+
 // ScopedKeyManager is a sub key manager under the main root key manager. The
 // root key manager will handle the root HD key (m/), while each sub scoped key
 // manager will handle the cointype key for a particular key scope
@@ -193,12 +244,7 @@ func (s *ScopedKeyManager) AddrSchema() ScopeAddrSchema {
 func (s *ScopedKeyManager) keyToManaged(derivedKey *bip32.Key,
 	account, branch, index uint32) (ManagedAddress, error) {
 
-	var addrType AddressType
-	if branch == InternalBranch {
-		addrType = s.addrSchema.InternalAddrType
-	} else {
-		addrType = s.addrSchema.ExternalAddrType
-	}
+	addrType := s.addrSchema.AccountAddrType(account, branch == InternalBranch)
 
 	derivationPath := DerivationPath{
 		Account: account,
@@ -397,6 +443,7 @@ func (s *ScopedKeyManager) AccountProperties(ns walletdb.ReadBucket,
 			return nil, err
 		}
 		props.AccountName = acctInfo.acctName
+		props.AddrType = s.addrSchema.AccountAddrType(account, false)
 		props.ExternalKeyCount = acctInfo.nextExternalIndex
 		props.InternalKeyCount = acctInfo.nextInternalIndex
 	} else {
@@ -533,12 +580,12 @@ func (s *ScopedKeyManager) loadAndCacheAddress(ns walletdb.ReadBucket,
 	address types.Address) (ManagedAddress, error) {
 
 	// Attempt to load the raw address information from the database.
-	rowInterface, err := fetchAddress(ns, &s.scope, address.Script())
+	rowInterface, err := fetchAddress(ns, &s.scope, addressID(address))
 
 	if err != nil {
 		if merr, ok := err.(*ManagerError); ok {
 			desc := fmt.Sprintf("failed to fetch address '%s': %v",
-				address.Script(), merr.Description)
+				address.Encode(), merr.Description)
 			merr.Description = desc
 			return nil, merr
 		}
@@ -553,7 +600,7 @@ func (s *ScopedKeyManager) loadAndCacheAddress(ns walletdb.ReadBucket,
 	}
 
 	// Cache and return the new managed address.
-	s.addrs[addrKey(managedAddr.Address().Script())] = managedAddr
+	s.addrs[addrKey(addressID(managedAddr.Address()))] = managedAddr
 
 	return managedAddr, nil
 }
@@ -581,20 +628,13 @@ func (s *ScopedKeyManager) existsAddress(ns walletdb.ReadBucket, addressID []byt
 func (s *ScopedKeyManager) Address(ns walletdb.ReadBucket,
 	address types.Address) (ManagedAddress, error) {
 
-	// ScriptAddress will only return a script hash if we're accessing an
-	// address that is either PKH or SH. In the event we're passed a PK
-	// address, convert the PK to PKH address so that we can access it from
-	// the addrs map and database.
-	if pka, ok := address.(*addrs.PubKeyHashAddress); ok {
-		address = pka
-	}
-
-	// Return the address from cache if it's available.
+	// Return the address from cache if it's available.  A PK address is
+	// looked up by its PKH address, see addressID.
 	//
 	// NOTE: Not using a defer on the lock here since a write lock is
 	// needed if the lookup fails.
 	s.mtx.RLock()
-	if ma, ok := s.addrs[addrKey(address.Script())]; ok {
+	if ma, ok := s.addrs[addrKey(addressID(address))]; ok {
 		s.mtx.RUnlock()
 		return ma, nil
 	}
@@ -611,7 +651,7 @@ func (s *ScopedKeyManager) Address(ns walletdb.ReadBucket,
 func (s *ScopedKeyManager) AddrAccount(ns walletdb.ReadBucket,
 	address types.Address) (uint32, error) {
 
-	account, err := fetchAddrAccount(ns, &s.scope, address.Script())
+	account, err := fetchAddrAccount(ns, &s.scope, addressID(address))
 	if err != nil {
 		return 0, maybeConvertDbError(err)
 	}
@@ -648,10 +688,7 @@ func (s *ScopedKeyManager) nextAddresses(ns walletdb.ReadWriteBucket,
 		nextIndex = acctInfo.nextInternalIndex
 	}
 
-	addrType := s.addrSchema.ExternalAddrType
-	if internal {
-		addrType = s.addrSchema.InternalAddrType
-	}
+	addrType := s.addrSchema.AccountAddrType(account, internal)
 
 	// Ensure the requested number of addresses doesn't exceed the maximum
 	// allowed for this account.
@@ -737,12 +774,10 @@ func (s *ScopedKeyManager) nextAddresses(ns walletdb.ReadWriteBucket,
 	// database in a single transaction.
 	for _, info := range addressInfo {
 		ma := info.managedAddr
-		addressID := ma.Address().Script()
-
 		switch a := ma.(type) {
 		case *managedAddress:
 			err := putChainedAddress(
-				ns, &s.scope, addressID, account, ssFull,
+				ns, &s.scope, addressID(ma.Address()), account, ssFull,
 				info.branch, info.index, adtChain,
 			)
 			if err != nil {
@@ -785,7 +820,7 @@ func (s *ScopedKeyManager) nextAddresses(ns walletdb.ReadWriteBucket,
 
 		for _, info := range addressInfo {
 			ma := info.managedAddr
-			s.addrs[addrKey(ma.Address().Script())] = ma
+			s.addrs[addrKey(addressID(ma.Address()))] = ma
 
 			// Add the new managed address to the list of addresses
 			// that need their private keys derived when the
@@ -862,6 +897,141 @@ func (s *ScopedKeyManager) NewAccount(ns walletdb.ReadWriteBucket, name string)
 	return account, nil
 }
 
+// RenameAccount renames an account stored in the manager based on the given
+// account number with the given name.  If an account with the same name
+// already exists, ErrDuplicateAccount will be returned.  The imported account
+// is reserved and can't be renamed.
+func (s *ScopedKeyManager) RenameAccount(ns walletdb.ReadWriteBucket,
+	account uint32, name string) error {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Ensure that a reserved account is not being renamed.
+	if account == ImportedAddrAccount {
+		str := "reserved account cannot be renamed"
+		return managerError(ErrInvalidAccount, str, nil)
+	}
+
+	// Validate account name
+	if err := ValidateAccountName(name); err != nil {
+		return err
+	}
+
+	// Check that account with the new name does not exist
+	_, err := s.lookupAccount(ns, name)
+	if err == nil {
+		str := fmt.Sprintf("account with the same name already exists")
+		return managerError(ErrDuplicateAccount, str, err)
+	}
+
+	rowInterface, err := fetchAccountInfo(ns, &s.scope, account)
+	if err != nil {
+		return maybeConvertDbError(err)
+	}
+
+	// Ensure the account type is a default account.
+	row, ok := rowInterface.(*dbDefaultAccountRow)
+	if !ok {
+		str := fmt.Sprintf("unsupported account type %T", row)
+		return managerError(ErrDatabase, str, nil)
+	}
+
+	// Remove the old name key from the account id index.
+	if err := deleteAccountIDIndex(ns, &s.scope, account); err != nil {
+		return err
+	}
+
+	// Remove the old name key from the account name index.
+	if err := deleteAccountNameIndex(ns, &s.scope, row.name); err != nil {
+		return err
+	}
+
+	// Store the account row under the new name, which also adds it to
+	// both indexes.
+	err = putAccountInfo(
+		ns, &s.scope, account, row.pubKeyEncrypted,
+		row.privKeyEncrypted, row.nextExternalIndex,
+		row.nextInternalIndex, name,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Drop the cached account info once the rename is committed, it is
+	// loaded again with the new name on the next access.
+	ns.Tx().OnCommit(func() {
+		s.mtx.Lock()
+		delete(s.acctInfo, account)
+		s.mtx.Unlock()
+	})
+
+	return nil
+}
+
+// SetAccountAddrType sets the type of the addresses handed out by the given
+// account to PubKeyHash or SecpPubKey.  Both forms of a chained key are known
+// to the manager, so the addresses the account handed out before keep
+// resolving to it.  The imported account is reserved and can't be changed.
+func (s *ScopedKeyManager) SetAccountAddrType(ns walletdb.ReadWriteBucket,
+	account uint32, addrType AddressType) error {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if account == ImportedAddrAccount {
+		str := "reserved account cannot change its address type"
+		return managerError(ErrInvalidAccount, str, nil)
+	}
+	if addrType != PubKeyHash && addrType != SecpPubKey {
+		str := fmt.Sprintf("address type %v cannot be used by an account",
+			addrType)
+		return managerError(ErrInvalidAccount, str, nil)
+	}
+
+	// Make sure the account exists.
+	if _, err := s.loadAccountInfo(ns, account); err != nil {
+		return err
+	}
+
+	// Copy the schema so the one in use is left untouched until the
+	// change is committed.
+	schema := s.addrSchema
+	schema.AccountAddrTypes = make(map[uint32]AddressType,
+		len(s.addrSchema.AccountAddrTypes)+1)
+	for acct, t := range s.addrSchema.AccountAddrTypes {
+		schema.AccountAddrTypes[acct] = t
+	}
+	if addrType == schema.ExternalAddrType &&
+		addrType == schema.InternalAddrType {
+
+		delete(schema.AccountAddrTypes, account)
+	} else {
+		schema.AccountAddrTypes[account] = addrType
+	}
+
+	if err := putScopeAddrSchema(ns, &s.scope, &schema); err != nil {
+		return err
+	}
+
+	// Once committed, switch to the new schema and drop the addresses of
+	// the account from the caches so they're loaded again in the new form.
+	ns.Tx().OnCommit(func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		s.addrSchema = schema
+		delete(s.acctInfo, account)
+		for k, ma := range s.addrs {
+			if ma.Account() == account {
+				delete(s.addrs, k)
+			}
+		}
+	})
+
+	return nil
+}
+
 // newAccount is a helper function that derives a new precise account number,
 // and creates a mapping from the passed name to the account number in the
 // database.
@@ -1054,7 +1224,7 @@ func (s *ScopedKeyManager) ImportPrivateKey(ns walletdb.ReadWriteBucket,
 
 	// Add the new managed address to the cache of recent addresses and
 	// return it.
-	s.addrs[addrKey(managedAddr.Address().Script())] = managedAddr
+	s.addrs[addrKey(addressID(managedAddr.Address()))] = managedAddr
 	return managedAddr, nil
 }
 
@@ -1082,6 +1252,34 @@ func (s *ScopedKeyManager) fetchUsed(ns walletdb.ReadBucket,
 	return fetchAddressUsed(ns, &s.scope, addressID)
 }
 
+// MarkUsed flags the given address as used in a transaction.  Both forms of a
+// pay-to-pubkey key are flagged, they share the flag of the key.
+func (s *ScopedKeyManager) MarkUsed(ns walletdb.ReadWriteBucket,
+	address types.Address) error {
+
+	ma, err := s.Address(ns, address)
+	if err != nil {
+		return err
+	}
+
+	return markAddressUsed(ns, &s.scope, ma.AddrHash())
+}
+
+// AccountPubKey returns the extended public key of the account, the key its
+// addresses are derived from.
+func (s *ScopedKeyManager) AccountPubKey(ns walletdb.ReadBucket,
+	account uint32) (*bip32.Key, error) {
+
+	defer s.mtx.RUnlock()
+	s.mtx.RLock()
+
+	acctInfo, err := s.loadAccountInfo(ns, account)
+	if err != nil {
+		return nil, err
+	}
+	return acctInfo.acctKeyPub, nil
+}
+
 // AccountName returns the account name for the given account number stored in
 // the manager.
 func (s *ScopedKeyManager) AccountName(ns walletdb.ReadBucket, account uint32) (string, error) {
@@ -1098,10 +1296,49 @@ func (s *ScopedKeyManager) LastAccount(ns walletdb.ReadBucket) (uint32, error) {
 func (s *ScopedKeyManager) ForEachAccountAddress(ns walletdb.ReadBucket,
 	account uint32, fn func(maddr ManagedAddress) error) error {
 
+	return s.forEachAccountAddress(ns, account, false, fn)
+}
+
+// ForEachKeyPoolAddress calls the given function with each address of the key
+// pool of the given account, the derived addresses that weren't handed out
+// yet, breaking early on error.
+func (s *ScopedKeyManager) ForEachKeyPoolAddress(ns walletdb.ReadBucket,
+	account uint32, fn func(maddr ManagedAddress) error) error {
+
+	return s.forEachAccountAddress(ns, account, true, fn)
+}
+
+// forEachAccountAddress calls the given function with each address of the
+// given account, either the handed out addresses or the ones of the key pool.
+func (s *ScopedKeyManager) forEachAccountAddress(ns walletdb.ReadBucket,
+	account uint32, pooled bool, fn func(maddr ManagedAddress) error) error {
+
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
+	// The account info is only needed to tell the pooled addresses apart,
+	// so it's loaded with the first chained address.
+	var acctInfo *accountInfo
 	addrFn := func(rowInterface interface{}) error {
+		inPool := false
+		if row, ok := rowInterface.(*dbChainAddressRow); ok {
+			if acctInfo == nil {
+				var err error
+				acctInfo, err = s.loadAccountInfo(ns, account)
+				if err != nil {
+					return err
+				}
+			}
+			next := acctInfo.nextExternalIndex
+			if row.branch == InternalBranch {
+				next = acctInfo.nextInternalIndex
+			}
+			inPool = row.index >= next
+		}
+		if inPool != pooled {
+			return nil
+		}
+
 		managedAddr, err := s.rowInterfaceToManaged(ns, rowInterface)
 		if err != nil {
 			return err
@@ -1115,3 +1352,100 @@ func (s *ScopedKeyManager) ForEachAccountAddress(ns walletdb.ReadBucket,
 
 	return nil
 }
+
+// FillKeyPool derives the key pool of the given account so that size unused
+// addresses follow the last address handed out on both the external and the
+// internal branch.  The addresses are derived from the account public key, so
+// the pool can be refilled while the manager is locked.  The addresses added
+// to the pool are returned.
+func (s *ScopedKeyManager) FillKeyPool(ns walletdb.ReadWriteBucket,
+	account uint32, size uint32) ([]ManagedAddress, error) {
+
+	if account == ImportedAddrAccount {
+		str := "imported account has no key pool"
+		return nil, managerError(ErrInvalidAccount, str, nil)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	acctInfo, err := s.loadAccountInfo(ns, account)
+	if err != nil {
+		return nil, err
+	}
+	externalEnd, internalEnd, err := fetchKeyPoolEnd(ns, &s.scope, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var pooled []ManagedAddress
+	fill := func(branch, next, end uint32) (uint32, error) {
+		// The pool starts at the next address to hand out.
+		if end < next {
+			end = next
+		}
+		target := next + size
+		if size > MaxAddressesPerAccount || target > MaxAddressesPerAccount {
+			target = MaxAddressesPerAccount
+		}
+		if end >= target {
+			return end, nil
+		}
+
+		branchKey, err := acctInfo.acctKeyPub.NewChildKey(branch)
+		if err != nil {
+			str := fmt.Sprintf("failed to derive extended key branch %d",
+				branch)
+			return 0, managerError(ErrKeyChain, str, err)
+		}
+		addrType := s.addrSchema.AccountAddrType(account,
+			branch == InternalBranch)
+
+		for ; end < target; end++ {
+			key, err := branchKey.NewChildKey(end)
+			if err != nil {
+				// Invalid children are skipped the same way
+				// nextAddresses skips them.
+				if err == bip32.ErrInvalidPrivateKey || err == bip32.ErrInvalidPublicKey {
+					continue
+				}
+				str := fmt.Sprintf("failed to generate child %d", end)
+				return 0, managerError(ErrKeyChain, str, err)
+			}
+
+			path := DerivationPath{
+				Account: account,
+				Branch:  branch,
+				Index:   end,
+			}
+			ma, err := newManagedAddressFromExtKey(s, path, key, addrType)
+			if err != nil {
+				return 0, err
+			}
+			err = putKeyPoolAddress(
+				ns, &s.scope, addressID(ma.Address()), account,
+				branch, end,
+			)
+			if err != nil {
+				return 0, maybeConvertDbError(err)
+			}
+			pooled = append(pooled, ma)
+		}
+		return end, nil
+	}
+
+	externalEnd, err = fill(ExternalBranch, acctInfo.nextExternalIndex, externalEnd)
+	if err != nil {
+		return nil, err
+	}
+	internalEnd, err = fill(InternalBranch, acctInfo.nextInternalIndex, internalEnd)
+	if err != nil {
+		return nil, err
+	}
+	err = putKeyPoolEnd(ns, &s.scope, account, externalEnd, internalEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return pooled, nil
+}
@@ -0,0 +1,156 @@
+package wallet
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Qitmeer/qng/core/types"
+	"github.com/Qitmeer/qng/log"
+
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+// AddressUsage is an address of an account together with whether it has
+// received outputs.
+type AddressUsage struct {
+	Address string
+	// AltAddr is the other form of the key of Address, the outputs to both
+	// forms are counted.
+	AltAddr string `json:",omitempty"`
+	// DerivationPath is the key path of the address, empty for imported
+	// addresses.
+	DerivationPath string `json:",omitempty"`
+	Internal       bool
+	Used           bool
+	// Received is the total ever received by the key in each coin, keyed
+	// by coin name.
+	Received map[string]float64 `json:",omitempty"`
+
+	branch, index uint32
+}
+
+// AccountAddressUsage returns the addresses of an account, external before
+// internal ones and in derivation order, with their usage and received
+// totals.
+func (w *Wallet) AccountAddressUsage(scope waddrmgr.KeyScope, account uint32) ([]AddressUsage, error) {
+	manager, err := w.Manager.FetchScopedKeyManager(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []AddressUsage
+	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		addrMgrNs := tx.ReadBucket(waddrmgrNamespaceKey)
+		return manager.ForEachAccountAddress(addrMgrNs, account, func(ma waddrmgr.ManagedAddress) error {
+			pka, ok := ma.(waddrmgr.ManagedPubKeyAddress)
+			if !ok {
+				return fmt.Errorf("address %s is not a key type", ma.Address())
+			}
+			pkh, pk, err := w.keyAddresses(pka)
+			if err != nil {
+				return err
+			}
+			u := AddressUsage{
+				Address:  pkh.Encode(),
+				AltAddr:  pk.Encode(),
+				Internal: pka.Internal(),
+				Used:     pka.Used(addrMgrNs),
+			}
+			if pka.AddrType() == waddrmgr.SecpPubKey {
+				u.Address, u.AltAddr = u.AltAddr, u.Address
+			}
+			if keyScope, path, ok := pka.DerivationInfo(); ok {
+				u.DerivationPath = keyScope.PathString(path)
+				u.branch, u.index = path.Branch, path.Index
+			}
+			usage = append(usage, u)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(usage, func(i, j int) bool {
+		if usage[i].branch != usage[j].branch {
+			return usage[i].branch < usage[j].branch
+		}
+		return usage[i].index < usage[j].index
+	})
+
+	for i := range usage {
+		usage[i].Received, err = w.addrReceived(usage[i].Address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
+
+// addrReceived returns the total received by the key of addr in each coin,
+// keyed by coin name, leaving out the coins it never received.
+func (w *Wallet) addrReceived(addr string) (map[string]float64, error) {
+	var received map[string]float64
+	for _, token := range w.tokens.tokens {
+		txOuts, err := w.getAddrTxOutputByCoin(addr, types.CoinID(token.CoinId))
+		if err != nil {
+			return nil, err
+		}
+		total := Amount{Id: types.CoinID(token.CoinId)}
+		for _, txOut := range txOuts {
+			total.Value += txOut.Amount.Value
+		}
+		if total.Value == 0 {
+			continue
+		}
+		if received == nil {
+			received = make(map[string]float64)
+		}
+		received[token.CoinName] = total.ToCoin()
+	}
+	return received, nil
+}
+
+// UnusedAddress returns the first external address of an account which has
+// not received any output, handing out a new address when all of them have.
+func (w *Wallet) UnusedAddress(scope waddrmgr.KeyScope, account uint32) (types.Address, error) {
+	manager, err := w.Manager.FetchScopedKeyManager(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		unused types.Address
+		first  uint32
+	)
+	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		addrMgrNs := tx.ReadBucket(waddrmgrNamespaceKey)
+		return manager.ForEachAccountAddress(addrMgrNs, account, func(ma waddrmgr.ManagedAddress) error {
+			if ma.Internal() || ma.Imported() || ma.Used(addrMgrNs) {
+				return nil
+			}
+			pka, ok := ma.(waddrmgr.ManagedPubKeyAddress)
+			if !ok {
+				return nil
+			}
+			_, path, ok := pka.DerivationInfo()
+			if !ok {
+				return nil
+			}
+			if unused == nil || path.Index < first {
+				unused, first = ma.Address(), path.Index
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unused != nil {
+		return unused, nil
+	}
+
+	log.Trace("No unused address, deriving a new one", "account", account)
+	return w.NewAddress(scope, account)
+}
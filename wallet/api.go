@@ -1,15 +1,22 @@
 package wallet
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	corejson "github.com/Qitmeer/qng/core/json"
 	"time"
 
 	"github.com/Qitmeer/qitmeer-wallet/config"
 	clijson "github.com/Qitmeer/qitmeer-wallet/json"
 	"github.com/Qitmeer/qitmeer-wallet/json/qitmeerjson"
+	"github.com/Qitmeer/qitmeer-wallet/rpc/server"
 	"github.com/Qitmeer/qitmeer-wallet/utils"
 	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/backup"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/export"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
 	"github.com/Qitmeer/qitmeer-wallet/wallet/txrules"
 	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
 	"github.com/Qitmeer/qng/core/address"
@@ -47,6 +54,42 @@ func (api *API) SyncStats() (*SyncStats, error) {
 	return stats, nil
 }
 
+// SyncStatus detailed block sync progress
+func (api *API) SyncStatus() (*SyncStatus, error) {
+	status := api.wt.SyncStatus()
+	return &status, nil
+}
+
+// SyncStatusUpdates push the sync status to the client whenever it changes,
+// subscribe with wallet_subscribe ["syncStatusUpdates"] over websocket
+func (api *API) SyncStatusUpdates(ctx context.Context) (*server.Subscription, error) {
+	notifier, supported := server.NotifierFromContext(ctx)
+	if !supported {
+		return nil, server.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	updates, cancel := api.wt.SubscribeSyncStatus()
+
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case status := <-updates:
+				if err := notifier.Notify(sub.ID, status); err != nil {
+					log.Trace("SyncStatusUpdates notify", "err", err)
+					return
+				}
+			case <-sub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
 //Unlock wallet
 func (api *API) Unlock(walletPriPass string, second int64) error {
 	//if api.wSvr.Wt.Locked() {
@@ -71,10 +114,98 @@ func (api *API) Lock() error {
 	return nil
 }
 
+// ChangePassphrase change the private passphrase, or the public one when public is true
+func (api *API) ChangePassphrase(oldPassphrase, newPassphrase string, public *bool) error {
+	private := public == nil || !*public
+	err := api.wt.ChangePassphrase([]byte(oldPassphrase), []byte(newPassphrase), private)
+	if waddrmgr.IsError(err, waddrmgr.ErrWrongPassphrase) {
+		return &qitmeerjson.RPCError{
+			Code:    qitmeerjson.ErrRPCWalletPassphraseIncorrect,
+			Message: "Incorrect passphrase",
+		}
+	}
+	return err
+}
+
+// UpgradeKDF re-wrap the private master key under kdf, scrypt or argon2id, tuned to take about target like 1s, and the public one too when pubPassphrase is set, returns the new settings, the wallet must be unlocked and the settings may not be weaker than the current ones
+func (api *API) UpgradeKDF(passphrase string, kdf *string, target *string, pubPassphrase *string) (string, error) {
+	name := ""
+	if kdf != nil {
+		name = *kdf
+	}
+	var d time.Duration
+	if target != nil && *target != "" {
+		var err error
+		d, err = time.ParseDuration(*target)
+		if err != nil {
+			return "", err
+		}
+	}
+	params, err := KDFOptions(name, d)
+	if err != nil {
+		return "", err
+	}
+	var pubPass []byte
+	if pubPassphrase != nil {
+		pubPass = []byte(*pubPassphrase)
+	}
+	err = api.wt.UpgradeKDF([]byte(passphrase), pubPass, params)
+	if waddrmgr.IsError(err, waddrmgr.ErrWrongPassphrase) {
+		return "", &qitmeerjson.RPCError{
+			Code:    qitmeerjson.ErrRPCWalletPassphraseIncorrect,
+			Message: "Incorrect passphrase",
+		}
+	}
+	if waddrmgr.IsError(err, waddrmgr.ErrWeakerKDF) {
+		return "", &qitmeerjson.RPCError{
+			Code:    qitmeerjson.ErrRPCInvalidParameter,
+			Message: err.(waddrmgr.ManagerError).Description,
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return params.String(), nil
+}
+
+// ImportedMasterKey the address of the master private key imported by older wallets, empty when not held
+func (api *API) ImportedMasterKey() (string, error) {
+	addr, err := api.wt.ImportedMasterKey()
+	if err != nil || addr == nil {
+		return "", err
+	}
+	return addr.Encode(), nil
+}
+
+// SweepMasterKey send the funds of the master key address to the default account, importing and rescanning the key when missing, returns the tx ids, the wallet must be unlocked
+func (api *API) SweepMasterKey() ([]string, error) {
+	return api.wt.SweepMasterKey()
+}
+
+// ShowMnemonic the mnemonic the wallet was created from, confirm must be true, the wallet must be unlocked
+func (api *API) ShowMnemonic(confirm bool) (string, error) {
+	if !confirm {
+		return "", &qitmeerjson.RPCError{
+			Code:    qitmeerjson.ErrRPCInvalidParameter,
+			Message: "showmnemonic must be confirmed",
+		}
+	}
+	return api.wt.Mnemonic()
+}
+
+// VerifyMnemonic whether mnemonic with the optional mnemonic passphrase recovers the wallet
+func (api *API) VerifyMnemonic(mnemonic string, passphrase *string) (bool, error) {
+	pass := ""
+	if passphrase != nil {
+		pass = *passphrase
+	}
+	return api.wt.VerifyMnemonic(mnemonic, pass)
+}
+
 // GetAccountsAndBalance List all accounts[{account,balance}]
 func (api *API) GetAccountsAndBalance(coin types.CoinID) (map[string]*Value, error) {
 	accountsBalances := make(map[string]*Value)
-	aaas, err := api.wt.GetAccountAndAddress(waddrmgr.KeyScopeBIP0044)
+	results, err := api.wt.AccountBalances(api.wt.Manager.DefaultScope())
 	if err != nil {
 		return nil, err
 	}
@@ -82,28 +213,15 @@ func (api *API) GetAccountsAndBalance(coin types.CoinID) (map[string]*Value, err
 	if err != nil {
 		return map[string]*Value{}, err
 	}
-	for _, aaa := range aaas {
-
-		if _, ok := accountsBalances[aaa.AccountName]; !ok {
-			accountsBalances[aaa.AccountName] = &Value{}
-		}
-
-		accountBalance := accountsBalances[aaa.AccountName]
-		for _, addr := range aaa.AddrsOutput {
-			accountBalance.TotalAmount += addr.balanceMap[coinID].TotalAmount.Value
-			accountBalance.SpendAmount += addr.balanceMap[coinID].SpendAmount.Value
-			accountBalance.UnspentAmount += addr.balanceMap[coinID].UnspentAmount.Value
-			accountBalance.UnconfirmedAmount += addr.balanceMap[coinID].UnconfirmedAmount.Value
-			accountBalance.LockAmount += addr.balanceMap[coinID].LockAmount.Value
-		}
-
+	for _, result := range results {
+		accountsBalances[result.AccountName] = accountValue(result, coinID)
 	}
 	return accountsBalances, nil
 }
 
 // GetBalanceByAccount get account balance
 func (api *API) GetBalanceByAccount(name string, coin types.CoinID) (*Value, error) {
-	results, err := api.wt.GetAccountAndAddress(waddrmgr.KeyScopeBIP0044)
+	results, err := api.wt.AccountBalances(api.wt.Manager.DefaultScope())
 	if err != nil {
 		return nil, err
 	}
@@ -112,20 +230,75 @@ func (api *API) GetBalanceByAccount(name string, coin types.CoinID) (*Value, err
 	if err != nil {
 		return nil, err
 	}
-	accountBalance := &Value{}
 	for _, result := range results {
 		if result.AccountName == name {
-			for _, addr := range result.AddrsOutput {
-				accountBalance.TotalAmount += addr.balanceMap[coinID].TotalAmount.Value
-				accountBalance.SpendAmount += addr.balanceMap[coinID].SpendAmount.Value
-				accountBalance.UnspentAmount += addr.balanceMap[coinID].UnspentAmount.Value
-				accountBalance.UnconfirmedAmount += addr.balanceMap[coinID].UnconfirmedAmount.Value
-				accountBalance.LockAmount += addr.balanceMap[coinID].LockAmount.Value
-			}
+			return accountValue(result, coinID), nil
 		}
 	}
 
-	return accountBalance, nil
+	return &Value{}, nil
+}
+
+// RebuildBalances rebuild the account balances from the wallet outputs
+func (api *API) RebuildBalances() error {
+	return api.wt.RebuildBalances()
+}
+
+// ExportHistory export the transaction history of the wallet, an account or
+// an address as csv, jsonl or ofx, over a block order and time range
+func (api *API) ExportHistory(format string, account *string, address *string,
+	fromOrder *uint32, toOrder *uint32, from *string, to *string) (string, error) {
+	f, err := export.ParseFormat(format)
+	if err != nil {
+		return "", err
+	}
+	var acct, addr, fromTime, toTime string
+	var fromO, toO uint32
+	if account != nil {
+		acct = *account
+	}
+	if address != nil {
+		addr = *address
+	}
+	if fromOrder != nil {
+		fromO = *fromOrder
+	}
+	if toOrder != nil {
+		toO = *toOrder
+	}
+	if from != nil {
+		fromTime = *from
+	}
+	if to != nil {
+		toTime = *to
+	}
+	filter, err := NewExportFilter(acct, addr, fromO, toO, fromTime, toTime)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if _, err := api.wt.ExportHistory(&buf, f, filter); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// accountValue returns the balance of an account in a coin
+func accountValue(result AccountBalanceResult, coin types.CoinID) *Value {
+	for _, b := range result.AccountBalanceList {
+		if b.TotalAmount.Id != coin {
+			continue
+		}
+		return &Value{
+			TotalAmount:       b.TotalAmount.Value,
+			UnspentAmount:     b.UnspentAmount.Value,
+			LockAmount:        b.LockAmount.Value,
+			UnconfirmedAmount: b.UnconfirmedAmount.Value,
+			ImmatureAmount:    b.ImmatureAmount.Value,
+			SpendAmount:       b.SpendAmount.Value,
+		}
+	}
+	return &Value{}
 }
 
 // GetUTxo addr unSpend UTxo
@@ -146,15 +319,54 @@ func (api *API) GetTx(txID string) (*corejson.TxRawResult, error) {
 	return &result, nil
 }
 
-// CreateAccount create account
-func (api *API) CreateAccount(name string) error {
+// Audit check unspent outputs against the node, repair fixes what is found
+func (api *API) Audit(repair *bool) (*AuditResult, error) {
+	return api.wt.Audit(repair != nil && *repair)
+}
+
+// BackupWallet write an encrypted backup of the wallet database to
+// destination, a file or directory in the backup directory, or to the backup
+// directory when omitted
+func (api *API) BackupWallet(passphrase string, destination *string) (*backup.Info, error) {
+	path := ""
+	if destination != nil && *destination != "" {
+		var err error
+		path, err = api.wt.BackupDirFile(*destination)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return api.wt.Backup(path, []byte(passphrase))
+}
+
+// VerifyBackup check the checksum of a wallet backup in the backup directory
+// and decrypt it
+func (api *API) VerifyBackup(path string, passphrase string) (*backup.Info, error) {
+	path, err := api.wt.BackupDirFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return backup.Verify(path, []byte(passphrase))
+}
+
+// CreateAccount create account, handing out addresses of addrType pkh (default) or pk
+func (api *API) CreateAccount(name string, addrType *string) error {
 	// The wildcard * is reserved by the rpc server with the special meaning
 	// of "all accounts", so disallow naming accounts to this string.
 	if name == "*" {
 		return &qitmeerjson.ErrReservedAccountName
 	}
 
-	_, err := api.wt.NextAccount(waddrmgr.KeyScopeBIP0044, name)
+	typ := waddrmgr.PubKeyHash
+	if addrType != nil {
+		var err error
+		typ, err = waddrmgr.ParseAccountAddrType(*addrType)
+		if err != nil {
+			return err
+		}
+	}
+
+	account, err := api.wt.NextAccount(api.wt.Manager.DefaultScope(), name)
 	if waddrmgr.IsError(err, waddrmgr.ErrLocked) {
 		return &qitmeerjson.RPCError{
 			Code: qitmeerjson.ErrRPCWalletUnlockNeeded,
@@ -162,19 +374,53 @@ func (api *API) CreateAccount(name string) error {
 				"Enter the wallet passphrase with walletpassphrase to unlock",
 		}
 	}
+	if err != nil {
+		return err
+	}
+	if typ != waddrmgr.PubKeyHash {
+		return api.wt.SetAccountAddrType(api.wt.Manager.DefaultScope(), account, typ)
+	}
 	return nil
 }
 
+// RenameAccount rename the account oldName to newName
+func (api *API) RenameAccount(oldName, newName string) error {
+	// The wildcard * is reserved by the rpc server with the special meaning
+	// of "all accounts", so disallow naming accounts to this string.
+	if newName == "*" {
+		return &qitmeerjson.ErrReservedAccountName
+	}
+
+	account, err := api.wt.AccountNumber(api.wt.Manager.DefaultScope(), oldName)
+	if err != nil {
+		return err
+	}
+	return api.wt.RenameAccount(api.wt.Manager.DefaultScope(), account, newName)
+}
+
+// SetAccountAddrType set the type of the addresses handed out by an account, pkh or pk
+func (api *API) SetAccountAddrType(accountName string, addrType string) error {
+	typ, err := waddrmgr.ParseAccountAddrType(addrType)
+	if err != nil {
+		return err
+	}
+	account, err := api.wt.AccountNumber(api.wt.Manager.DefaultScope(), accountName)
+	if err != nil {
+		return err
+	}
+	return api.wt.SetAccountAddrType(api.wt.Manager.DefaultScope(), account, typ)
+}
+
 // CreateAddress by accountName
 func (api *API) CreateAddress(accountName string) (string, error) {
 	if accountName == "" {
 		accountName = "default"
 	}
-	account, err := api.wt.AccountNumber(waddrmgr.KeyScopeBIP0044, accountName)
+	account, err := api.wt.AccountNumber(api.wt.Manager.DefaultScope(), accountName)
 	if err != nil {
 		return "", err
 	}
-	addr, err := api.wt.NewAddress(waddrmgr.KeyScopeBIP0044, account)
+	addr, err := api.wt.NewAddress(api.wt.Manager.DefaultScope(), account)
 	if err != nil {
 		return "", err
 	}
@@ -182,23 +428,59 @@ func (api *API) CreateAddress(accountName string) (string, error) {
 	return addr.Encode(), nil
 }
 
-// GetAddressesByAccount by account
-func (api *API) GetAddressesByAccount(accountName string) ([]string, error) {
-	account, err := api.wt.AccountNumber(waddrmgr.KeyScopeBIP0044, accountName)
+// GetUnusedAddress by accountName, the first address which has not received any output
+func (api *API) GetUnusedAddress(accountName string) (string, error) {
+	if accountName == "" {
+		accountName = "default"
+	}
+	account, err := api.wt.AccountNumber(api.wt.Manager.DefaultScope(), accountName)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	addr, err := api.wt.UnusedAddress(api.wt.Manager.DefaultScope(), account)
+	if err != nil {
+		return "", err
 	}
+	return addr.Encode(), nil
+}
 
-	adds, err := api.wt.AccountAddresses(account)
+// SplitSeed split the wallet seed into shares of groups written as 3of5, all groups required unless groupThreshold, the wallet must be unlocked
+func (api *API) SplitSeed(groups []string, groupThreshold *uint8) ([][]string, error) {
+	gs, err := shamir.ParseGroups(groups)
 	if err != nil {
 		return nil, err
 	}
+	threshold := uint8(len(gs))
+	if groupThreshold != nil {
+		threshold = *groupThreshold
+	}
+	return api.wt.SplitSeed(threshold, gs)
+}
+
+// KeyPoolRefill derive the key pools of the accounts up to newSize unused addresses, the configured size by default, at most the configured maximum
+func (api *API) KeyPoolRefill(newSize *uint32) error {
+	size := KeyPoolSize()
+	if newSize != nil {
+		size = *newSize
+	}
+	err := api.wt.RefillKeyPool(size)
+	if errors.Is(err, ErrKeyPoolSize) {
+		return &qitmeerjson.RPCError{
+			Code:    qitmeerjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return err
+}
 
-	addrStr := make([]string, len(adds))
-	for i, a := range adds {
-		addrStr[i] = a.Encode()
+// GetAddressesByAccount by account, with their usage and received totals
+func (api *API) GetAddressesByAccount(accountName string) ([]AddressUsage, error) {
+	account, err := api.wt.AccountNumber(api.wt.Manager.DefaultScope(), accountName)
+	if err != nil {
+		return nil, err
 	}
-	return addrStr, nil
+
+	return api.wt.AccountAddressUsage(api.wt.Manager.DefaultScope(), account)
 }
 
 // GetAccountByAddress get account name
@@ -213,7 +495,7 @@ func (api *API) GetAccountByAddress(addrStr string) (string, error) {
 		return "", &qitmeerjson.ErrAddressNotInWallet
 	}
 
-	acctName, err := api.wt.AccountName(waddrmgr.KeyScopeBIP0044, account)
+	acctName, err := api.wt.AccountName(api.wt.Manager.DefaultScope(), account)
 	if err != nil {
 		return "", &qitmeerjson.ErrAccountNameNotFound
 	}
@@ -242,7 +524,9 @@ func (api *API) DumpPrivKey(addrStr string) (string, error) {
 
 // ImportWifPrivKey import a WIF-encoded private key and adding it to an account
 // a WIF-encoded private key and adding it to an account.
-func (api *API) ImportWifPrivKey(accountName string, key string) error {
+// Unless rescan is false the key's history is rescanned in the background,
+// starting at rescanFrom or the genesis block.
+func (api *API) ImportWifPrivKey(accountName string, key string, rescan *bool, rescanFrom *uint64) error {
 	// Ensure that private keys are only imported to the correct account.
 	if accountName != "" && accountName != waddrmgr.ImportedAddrAccountName {
 		return &qitmeerjson.ErrNotImportedAccount
@@ -262,21 +546,27 @@ func (api *API) ImportWifPrivKey(accountName string, key string) error {
 		}
 	}
 
+	if err := api.checkRescanFrom(rescan, rescanFrom); err != nil {
+		return err
+	}
+
 	// Import the private key, handling any errors.
-	_, err = api.wt.ImportPrivateKey(waddrmgr.KeyScopeBIP0044, wif)
+	_, err = api.wt.ImportPrivateKey(api.wt.Manager.DefaultScope(), wif)
 	switch {
 	case waddrmgr.IsError(err, waddrmgr.ErrDuplicateAddress):
 		// Do not return duplicate key errors to the client.
 		return nil
 	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
 		return &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		return err
 	}
 
-	return err
+	return api.rescanImportedKey(wif, rescan, rescanFrom)
 }
 
-// ImportPrivKey import pri key
-func (api *API) ImportPrivKey(accountName string, key string) error {
+// ImportPrivKey import pri key, rescan and rescanFrom as ImportWifPrivKey
+func (api *API) ImportPrivKey(accountName string, key string, rescan *bool, rescanFrom *uint64) error {
 	// Ensure that private keys are only imported to the correct account.
 	//
 	// Yes, Label is the account name.
@@ -303,17 +593,53 @@ func (api *API) ImportPrivKey(accountName string, key string) error {
 		}
 	}
 
+	if err := api.checkRescanFrom(rescan, rescanFrom); err != nil {
+		return err
+	}
+
 	// Import the private key, handling any errors.
-	_, err = api.wt.ImportPrivateKey(waddrmgr.KeyScopeBIP0044, wif)
+	_, err = api.wt.ImportPrivateKey(api.wt.Manager.DefaultScope(), wif)
 	switch {
 	case waddrmgr.IsError(err, waddrmgr.ErrDuplicateAddress):
 		// Do not return duplicate key errors to the client.
 		return nil
 	case waddrmgr.IsError(err, waddrmgr.ErrLocked):
 		return &qitmeerjson.ErrWalletUnlockNeeded
+	case err != nil:
+		return err
 	}
 
-	return err
+	return api.rescanImportedKey(wif, rescan, rescanFrom)
+}
+
+// rescanStart returns whether a rescan is asked for and its start order.
+func rescanStart(rescan *bool, rescanFrom *uint64) (bool, uint64) {
+	if rescan != nil && !*rescan {
+		return false, 0
+	}
+	var startOrder uint64
+	if rescanFrom != nil {
+		startOrder = *rescanFrom
+	}
+	return true, startOrder
+}
+
+// checkRescanFrom rejects a rescan the node can not serve before the key is
+// imported.
+func (api *API) checkRescanFrom(rescan *bool, rescanFrom *uint64) error {
+	ok, startOrder := rescanStart(rescan, rescanFrom)
+	if !ok {
+		return nil
+	}
+	return api.wt.CheckRescanFrom(startOrder)
+}
+
+func (api *API) rescanImportedKey(wif *utils.WIF, rescan *bool, rescanFrom *uint64) error {
+	ok, startOrder := rescanStart(rescan, rescanFrom)
+	if !ok {
+		return nil
+	}
+	return api.wt.RescanKey(wif, startOrder)
 }
 
 type ApiAmount struct {
@@ -398,7 +724,7 @@ func (api *API) SendToMany(addAmounts map[string]float64, coin types.CoinID, byA
 // SendToAddressByAccount by account
 func (api *API) SendToAddressByAccount(accountName string, addressStr string, amount float64, coin types.CoinID, comment string, commentTo string) (string, error) {
 
-	accountNum, err := api.wt.AccountNumber(waddrmgr.KeyScopeBIP0044, accountName)
+	accountNum, err := api.wt.AccountNumber(api.wt.Manager.DefaultScope(), accountName)
 	if err != nil {
 		return "", err
 	}
@@ -432,13 +758,22 @@ func (api *API) GetBalanceByAddr(addrStr string, coin types.CoinID) (map[string]
 }
 
 //GetTxListByAddr get transactions affecting specific address, one transaction could affect MULTIPLE addresses
-func (api *API) GetTxListByAddr(addr string, sType int, page int, pageSize int) (*clijson.PageTxRawResult, error) {
-	rs, err := api.wt.GetListTxByAddr(addr, sType, page, pageSize)
+//cursor is the next_cursor of a previous page, it replaces page
+func (api *API) GetTxListByAddr(addr string, sType int, page int, pageSize int, cursor *string) (*clijson.PageTxRawResult, error) {
+	rs, err := api.wt.GetListTxByAddr(addr, sType, page, pageSize, stringOrEmpty(cursor))
 	return rs, err
 }
 
 //GetBillByAddr get bill of payments affecting specific address, one payment could affect ONE address
-func (api *API) GetBillByAddr(addr string, filter int, page int, pageSize int) (*clijson.PagedBillResult, error) {
-	rs, err := api.wt.GetBillByAddr(addr, filter, page, pageSize)
+//cursor is the next_cursor of a previous page, it replaces page
+func (api *API) GetBillByAddr(addr string, filter int, page int, pageSize int, cursor *string) (*clijson.PagedBillResult, error) {
+	rs, err := api.wt.GetBillByAddr(addr, filter, page, pageSize, stringOrEmpty(cursor))
 	return rs, err
 }
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,343 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+	"github.com/Qitmeer/qng/log"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
+)
+
+// Kinds of inconsistencies reported by Audit.
+const (
+	// AuditPhantomUTXO is an unspent output the node does not know, or
+	// whose transaction failed.
+	AuditPhantomUTXO = "phantom_utxo"
+	// AuditMissedSpend is an output the wallet holds unspent although the
+	// node has seen it spent.
+	AuditMissedSpend = "missed_spend"
+	// AuditStaleUnconfirmed is a transaction the wallet still waits on
+	// although the node confirmed or dropped it.
+	AuditStaleUnconfirmed = "stale_unconfirmed"
+	// AuditMissingTxJson is an output whose transaction is not stored.
+	AuditMissingTxJson = "missing_txjson"
+	// AuditTxJsonMismatch is an output disagreeing with its stored
+	// transaction.
+	AuditTxJsonMismatch = "txjson_mismatch"
+)
+
+// AuditIssue is an inconsistency between the wallet database and the node.
+type AuditIssue struct {
+	Kind     string `json:"kind"`
+	Address  string `json:"address,omitempty"`
+	TxId     string `json:"txid"`
+	Index    uint32 `json:"index"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+// AuditResult is the result of Audit.
+type AuditResult struct {
+	Outputs     int          `json:"outputs"`
+	Unconfirmed int          `json:"unconfirmed"`
+	Issues      []AuditIssue `json:"issues"`
+	Repaired    bool         `json:"repaired"`
+}
+
+// auditFix repairs a single AuditIssue.
+type auditFix func(ns walletdb.ReadWriteBucket) error
+
+// auditor caches node answers during an audit.
+type auditor struct {
+	w      *Wallet
+	txs    map[string]*corejson.TxRawResult
+	blues  map[string]bool
+	issues []AuditIssue
+	fixes  []auditFix
+}
+
+type auditOutput struct {
+	coin types.CoinID
+	out  *wtxmgr.AddrTxOutput
+}
+
+// Audit checks the unspent outputs and unconfirmed transactions of the wallet
+// against the node: every unspent output must exist on the node, be unspent
+// there and belong to a valid transaction, its stored transaction must match
+// it, and unconfirmed transactions must still be pending.  With repair set
+// all inconsistencies found are fixed in a single database transaction, which
+// also rebuilds the account balances.
+func (w *Wallet) Audit(repair bool) (*AuditResult, error) {
+	var outputs []auditOutput
+	txJson := map[string]storedTx{}
+	unconfirmed := map[string]*wtxmgr.UnconfirmTx{}
+	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(wtxmgrNamespaceKey)
+		for _, coin := range types.CoinIDList {
+			outNs := ns.NestedReadBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, coin))
+			if outNs == nil {
+				continue
+			}
+			err := w.TxStore.ForEachTxOut(outNs, func(out *wtxmgr.AddrTxOutput) error {
+				if out.Spend != wtxmgr.SpendStatusUnspent || out.Status == wtxmgr.TxStatusFailed {
+					return nil
+				}
+				outputs = append(outputs, auditOutput{coin: coin, out: out})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, o := range outputs {
+			txId := o.out.TxId.String()
+			if _, ok := txJson[txId]; ok {
+				continue
+			}
+			tr, err := w.TxStore.FetchTxJson(ns, &o.out.TxId)
+			txJson[txId] = storedTx{tr: tr, err: err}
+		}
+
+		return w.TxStore.ForEachUnconfirmed(ns, func(txId *hash.Hash, u *wtxmgr.UnconfirmTx) error {
+			unconfirmed[txId.String()] = u
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &auditor{
+		w:     w,
+		txs:   map[string]*corejson.TxRawResult{},
+		blues: map[string]bool{},
+	}
+	for _, o := range outputs {
+		if err := a.checkOutput(o, txJson[o.out.TxId.String()]); err != nil {
+			return nil, err
+		}
+	}
+	for txId := range unconfirmed {
+		if err := a.checkUnconfirmed(txId); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &AuditResult{
+		Outputs:     len(outputs),
+		Unconfirmed: len(unconfirmed),
+		Issues:      a.issues,
+	}
+	if !repair || len(a.fixes) == 0 {
+		return result, nil
+	}
+
+	err = walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(wtxmgrNamespaceKey)
+		for _, fix := range a.fixes {
+			if err := fix(ns); err != nil {
+				return err
+			}
+		}
+		return w.rebuildBalances(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Issues {
+		result.Issues[i].Repaired = true
+	}
+	result.Repaired = true
+	log.Info("audit repaired wallet", "issues", len(result.Issues))
+	return result, nil
+}
+
+func (a *auditor) report(issue AuditIssue, fix auditFix) {
+	a.issues = append(a.issues, issue)
+	a.fixes = append(a.fixes, fix)
+}
+
+// getTx returns the node's view of txId, nil if the node does not know it.
+func (a *auditor) getTx(txId string) (*corejson.TxRawResult, error) {
+	if tr, ok := a.txs[txId]; ok {
+		return tr, nil
+	}
+	tr, err := a.w.HttpClient.GetRawTransaction(txId)
+	if err == ErrTxNotFound {
+		tr, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit get tx %s: %w", txId, err)
+	}
+	a.txs[txId] = tr
+	return tr, nil
+}
+
+// status computes the wallet status of a transaction from the node's view.
+func (a *auditor) status(tr *corejson.TxRawResult) (wtxmgr.TxStatus, error) {
+	if tr.BlockHash == "" {
+		return wtxmgr.TxStatusMemPool, nil
+	}
+	isBlue, ok := a.blues[tr.BlockHash]
+	if !ok {
+		var err error
+		isBlue, err = a.w.HttpClient.IsBlue(tr.BlockHash)
+		if err != nil {
+			return 0, fmt.Errorf("audit block %s: %w", tr.BlockHash, err)
+		}
+		a.blues[tr.BlockHash] = isBlue
+	}
+	return a.w.txStatus(txConfirmations(*tr), uint32(tr.Confirmations), tr.Txsvalid, isBlue, wtxmgr.TxRawIsCoinBase(*tr), false), nil
+}
+
+func (a *auditor) checkOutput(o auditOutput, stored storedTx) error {
+	out := o.out
+	txId := out.TxId.String()
+	issue := AuditIssue{Address: out.Address, TxId: txId, Index: out.Index}
+	point := types.TxOutPoint{Hash: out.TxId, OutIndex: out.Index}
+
+	tr, err := a.getTx(txId)
+	if err != nil {
+		return err
+	}
+	if tr == nil || int(out.Index) >= len(tr.Vout) || !voutPaysTo(tr.Vout[out.Index], out.Address) {
+		issue.Kind = AuditPhantomUTXO
+		issue.Detail = "output unknown to the node"
+		a.report(issue, func(ns walletdb.ReadWriteBucket) error {
+			outNs := ns.NestedAndCreateReadWriteBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, o.coin))
+			if err := a.w.TxStore.DeleteHistoryOutput(ns, out); err != nil {
+				return err
+			}
+			return a.w.TxStore.DeleteAddrTxOut(outNs, out.Address, point)
+		})
+		return nil
+	}
+
+	status, err := a.status(tr)
+	if err != nil {
+		return err
+	}
+	if status == wtxmgr.TxStatusFailed {
+		issue.Kind = AuditPhantomUTXO
+		issue.Detail = fmt.Sprintf("transaction failed in block %s", tr.BlockHash)
+		a.report(issue, a.setOutput(o, func(out *wtxmgr.AddrTxOutput) {
+			out.Status = wtxmgr.TxStatusFailed
+		}))
+		return nil
+	}
+
+	if stored.tr == nil && stored.err == nil {
+		issue.Kind = AuditMissingTxJson
+		issue.Detail = "transaction not stored"
+		a.report(issue, a.putTxJson(tr))
+	} else if err := checkTxJson(stored, out); err != nil {
+		issue.Kind = AuditTxJsonMismatch
+		issue.Detail = err.Error()
+		a.report(issue, a.putTxJson(tr))
+	}
+
+	unspent, err := a.w.HttpClient.IsUnspent(txId, out.Index)
+	if err != nil {
+		return fmt.Errorf("audit output %s:%d: %w", txId, out.Index, err)
+	}
+	if !unspent {
+		issue.Kind = AuditMissedSpend
+		issue.Detail = "output spent on the node"
+		a.report(issue, a.setOutput(o, func(out *wtxmgr.AddrTxOutput) {
+			out.Spend = wtxmgr.SpendStatusSpend
+		}))
+	}
+
+	if out.Status < wtxmgr.TxStatusConfirmed && status >= wtxmgr.TxStatusConfirmed {
+		issue.Kind = AuditStaleUnconfirmed
+		issue.Detail = fmt.Sprintf("output confirmed %d times", tr.Confirmations)
+		a.report(issue, a.setOutput(o, func(out *wtxmgr.AddrTxOutput) {
+			out.Status = status
+		}))
+	}
+	return nil
+}
+
+func (a *auditor) checkUnconfirmed(txId string) error {
+	tr, err := a.getTx(txId)
+	if err != nil {
+		return err
+	}
+	issue := AuditIssue{Kind: AuditStaleUnconfirmed, TxId: txId}
+	if tr == nil {
+		issue.Detail = "transaction unknown to the node"
+	} else {
+		status, err := a.status(tr)
+		if err != nil {
+			return err
+		}
+		if status < wtxmgr.TxStatusConfirmed {
+			return nil
+		}
+		issue.Detail = fmt.Sprintf("transaction confirmed %d times", tr.Confirmations)
+	}
+	a.report(issue, func(ns walletdb.ReadWriteBucket) error {
+		h, err := hash.NewHashFromStr(txId)
+		if err != nil {
+			return err
+		}
+		return a.w.TxStore.DeleteUnconfirmed(ns, h)
+	})
+	return nil
+}
+
+// setOutput returns a fix rereading the output and applying update, so that
+// several fixes of the same output add up.
+func (a *auditor) setOutput(o auditOutput, update func(out *wtxmgr.AddrTxOutput)) auditFix {
+	return func(ns walletdb.ReadWriteBucket) error {
+		outNs := ns.NestedAndCreateReadWriteBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, o.coin))
+		point := types.TxOutPoint{Hash: o.out.TxId, OutIndex: o.out.Index}
+		out, err := a.w.TxStore.GetAddrTxOut(outNs, o.out.Address, point)
+		if err != nil {
+			return err
+		}
+		out.Address = o.out.Address
+		update(out)
+		return a.w.TxStore.UpdateAddrTxOut(outNs, out)
+	}
+}
+
+func (a *auditor) putTxJson(tr *corejson.TxRawResult) auditFix {
+	return func(ns walletdb.ReadWriteBucket) error {
+		return a.w.TxStore.PutTxJson(ns, tr)
+	}
+}
+
+// storedTx is a transaction read from the store, or the error reading it.
+type storedTx struct {
+	tr  *corejson.TxRawResult
+	err error
+}
+
+// checkTxJson verifies the stored transaction pays out.
+func checkTxJson(stored storedTx, out *wtxmgr.AddrTxOutput) error {
+	if stored.err != nil {
+		return fmt.Errorf("stored transaction unreadable: %v", stored.err)
+	}
+	tr := stored.tr
+	if int(out.Index) >= len(tr.Vout) {
+		return fmt.Errorf("stored transaction has %d outputs", len(tr.Vout))
+	}
+	vout := tr.Vout[out.Index]
+	if !voutPaysTo(vout, out.Address) {
+		return fmt.Errorf("stored output pays to %v", vout.ScriptPubKey.Addresses)
+	}
+	if int64(vout.Amount) != out.Amount.Value || types.CoinID(vout.CoinId) != out.Amount.Id {
+		return fmt.Errorf("stored output amount %d of coin %d, wallet has %v", vout.Amount, vout.CoinId, out.Amount)
+	}
+	return nil
+}
+
+func voutPaysTo(vout corejson.Vout, addr string) bool {
+	return len(vout.ScriptPubKey.Addresses) > 0 && vout.ScriptPubKey.Addresses[0] == addr
+}
@@ -0,0 +1,117 @@
+package wallet_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/mocknode"
+)
+
+func auditIssues(t *testing.T, w *wallet.Wallet, repair bool) (*wallet.AuditResult, []string) {
+	t.Helper()
+	res, err := w.Audit(repair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issues []string
+	for _, issue := range res.Issues {
+		issues = append(issues, fmt.Sprintf("%s %s:%d %s", issue.Kind, issue.TxId, issue.Index, issue.Address))
+	}
+	sort.Strings(issues)
+	return res, issues
+}
+
+func equalIssues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAudit(t *testing.T) {
+	h := newHarness(t)
+	spent := h.fund(1e8)
+	kept := h.fund(4e8)
+	h.mine(2)
+	h.sync()
+
+	if _, issues := auditIssues(t, h.w, false); len(issues) != 0 {
+		t.Fatalf("issues in a synced wallet: %v", issues)
+	}
+
+	// stale is mined but still needs a confirmation, phantom stays in the
+	// mempool.
+	stale := h.fund(2e8)
+	h.mine(1)
+	phantom := h.fund(3e8)
+	h.waitFor("unconfirmed funds", func() bool {
+		return h.balance().UnconfirmedAmount.Value == 5e8
+	})
+	h.stop()
+
+	// Behind the wallet's back the node evicts phantom, spends an output
+	// and confirms stale.
+	if err := h.node.Drop(phantom.TxId); err != nil {
+		t.Fatal(err)
+	}
+	h.node.AcceptTx(h.node.NewTx([]mocknode.Input{{TxId: spent.TxId}},
+		mocknode.Output{Address: otherAddr, Amount: 1e8, Coin: coin}))
+	h.mine(2)
+
+	want := []string{
+		fmt.Sprintf("%s %s:0 %s", wallet.AuditMissedSpend, spent.TxId, h.addr),
+		fmt.Sprintf("%s %s:0 %s", wallet.AuditPhantomUTXO, phantom.TxId, h.addr),
+		fmt.Sprintf("%s %s:0 ", wallet.AuditStaleUnconfirmed, stale.TxId),
+		fmt.Sprintf("%s %s:0 %s", wallet.AuditStaleUnconfirmed, stale.TxId, h.addr),
+	}
+	sort.Strings(want)
+	res, issues := auditIssues(t, h.w, false)
+	if !equalIssues(issues, want) {
+		t.Fatalf("issues\n%v\nwant\n%v", issues, want)
+	}
+	if res.Repaired {
+		t.Fatalf("audit without repair repaired")
+	}
+	if b := h.balance(); b.UnspentAmount.Value != 5e8 || b.UnconfirmedAmount.Value != 5e8 {
+		t.Fatalf("audit changed the balance to %d unconfirmed %d", b.UnspentAmount.Value, b.UnconfirmedAmount.Value)
+	}
+
+	res, issues = auditIssues(t, h.w, true)
+	if !equalIssues(issues, want) {
+		t.Fatalf("repaired issues\n%v\nwant\n%v", issues, want)
+	}
+	if !res.Repaired {
+		t.Fatalf("audit did not repair")
+	}
+	for _, issue := range res.Issues {
+		if !issue.Repaired {
+			t.Fatalf("issue %+v not repaired", issue)
+		}
+	}
+
+	if _, issues := auditIssues(t, h.w, false); len(issues) != 0 {
+		t.Fatalf("issues after repair: %v", issues)
+	}
+	b := h.balance()
+	if b.UnspentAmount.Value != 6e8 || b.UnconfirmedAmount.Value != 0 || b.SpendAmount.Value != 1e8 {
+		t.Fatalf("balance %d unconfirmed %d spent %d after repair, want 6e8 0 1e8",
+			b.UnspentAmount.Value, b.UnconfirmedAmount.Value, b.SpendAmount.Value)
+	}
+	var unspent []string
+	for _, out := range h.unspent() {
+		unspent = append(unspent, fmt.Sprintf("%s:%d", out.TxId.String(), out.Index))
+	}
+	sort.Strings(unspent)
+	wantUnspent := []string{kept.TxId + ":0", stale.TxId + ":0"}
+	sort.Strings(wantUnspent)
+	if !equalIssues(unspent, wantUnspent) {
+		t.Fatalf("unspent %v after repair, want %v", unspent, wantUnspent)
+	}
+}
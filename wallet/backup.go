@@ -0,0 +1,161 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Qitmeer/qng/log"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/backup"
+)
+
+// backupConfig returns the config of the wallet, or the global config when
+// the wallet was opened without one.
+func (w *Wallet) backupConfig() *config.Config {
+	if w.cfg != nil {
+		return w.cfg
+	}
+	return config.Cfg
+}
+
+// Backup writes an encrypted backup of the wallet database, encrypted with a
+// key derived from the private passphrase privPass.  The backup is written to
+// path, or to a new file in path when it is a directory, or to a new file in
+// the configured backup directory when path is empty.  Existing files and
+// paths in the wallet database are refused.  The database is read in a single
+// transaction, the wallet stays usable while the backup is written.
+func (w *Wallet) Backup(path string, privPass []byte) (*backup.Info, error) {
+	if err := w.Manager.CheckPrivatePassphrase(privPass); err != nil {
+		return nil, err
+	}
+
+	if path == "" {
+		path = w.backupConfig().BackupDirPath()
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, backup.FileName(time.Now()))
+	}
+	if w.dbPath != "" {
+		inDB, err := withinDir(w.dbPath, path)
+		if err != nil {
+			return nil, err
+		}
+		if inDB {
+			return nil, fmt.Errorf("%s is the wallet database", path)
+		}
+	}
+
+	key, err := backup.NewKey(privPass, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Zero()
+	info, err := backup.WriteFile(path, w.db, key)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Wallet backup written", "path", info.Path, "sha256", info.SHA256)
+	return info, nil
+}
+
+// BackupDirFile returns the path of name in the configured backup directory.
+// name is relative to the backup directory unless absolute, it fails for
+// paths outside of the backup directory.
+func (w *Wallet) BackupDirFile(name string) (string, error) {
+	dir := w.backupConfig().BackupDirPath()
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	inDir, err := withinDir(dir, path)
+	if err != nil {
+		return "", err
+	}
+	if !inDir {
+		return "", fmt.Errorf("%s is outside of the backup directory %s", name, dir)
+	}
+	return path, nil
+}
+
+// withinDir returns whether path is dir or in dir.
+func withinDir(dir, path string) (bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// setBackupKey derives the key of scheduled backups from the private
+// passphrase, when scheduled backups are enabled.  The key is derived in the
+// background, so unlocking is not slowed down.
+func (w *Wallet) setBackupKey(privPass []byte) {
+	if w.backupConfig().BackupInterval == 0 {
+		return
+	}
+	w.backupMu.Lock()
+	derived := w.backupKey != nil
+	w.backupMu.Unlock()
+	if derived {
+		return
+	}
+
+	pass := append([]byte(nil), privPass...)
+	go func() {
+		key, err := backup.NewKey(pass, nil)
+		if err != nil {
+			log.Error("Could not derive the backup key", "err", err.Error())
+			return
+		}
+		w.backupMu.Lock()
+		if w.backupKey == nil {
+			w.backupKey = key
+		} else {
+			key.Zero()
+		}
+		w.backupMu.Unlock()
+	}()
+}
+
+// ScheduledBackup writes a backup to the configured backup directory and
+// removes the oldest scheduled backups beyond the configured number to keep,
+// backups written by Backup are kept.  It
+// returns the new backup and the paths of the removed ones.  Scheduled
+// backups are encrypted with a key derived at the first unlock of the
+// wallet, they fail until then.
+func (w *Wallet) ScheduledBackup() (*backup.Info, []string, error) {
+	w.backupMu.Lock()
+	defer w.backupMu.Unlock()
+	if w.backupKey == nil {
+		return nil, nil, errors.New("scheduled backups wait for the first unlock of the wallet")
+	}
+
+	cfg := w.backupConfig()
+	dir := cfg.BackupDirPath()
+	info, err := backup.WriteFile(filepath.Join(dir, backup.ScheduledFileName(time.Now())), w.db, w.backupKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keep := int(cfg.BackupKeep)
+	if keep < 1 {
+		keep = 1
+	}
+	removed, err := backup.Rotate(dir, keep)
+	if err != nil {
+		return info, nil, err
+	}
+	return info, removed, nil
+}
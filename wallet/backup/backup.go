@@ -0,0 +1,313 @@
+// Package backup implements encrypted backups of the wallet database.
+//
+// A backup holds a copy of the wallet database, as written by
+// walletdb.DB.Copy, encrypted with a key derived from the private passphrase
+// of the wallet:
+//
+//	<magic "QWBK"><version><params length><snacl parameters><chunk>...<final chunk>
+//
+// The params length is a 2 byte little endian length of the snacl parameters,
+// which vary with their key derivation function.  Version 1 backups lack it
+// and hold the original fixed size scrypt parameters.
+//
+// A chunk is a 4 byte little endian length followed by a snacl encrypted blob
+// holding the 8 byte index of the chunk, a flag marking the final chunk, and
+// data.  The final chunk holds the SHA-256 of the database, so that a
+// truncated, reordered or modified backup is detected when it is read.
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/Qitmeer/qitmeer-wallet/snacl"
+)
+
+const (
+	magic   = "QWBK"
+	version = 2
+
+	// chunkSize is the size of the database data in a chunk.
+	chunkSize = 1 << 20
+
+	// v1ParamsSize is the size of the snacl parameters of version 1
+	// backups.
+	v1ParamsSize = snacl.KeySize + sha256.Size + 24
+	// maxParamsSize bounds the snacl parameters a backup may claim.
+	maxParamsSize = 1024
+	// chunkHeaderSize is the size of the index and final flag of a chunk.
+	chunkHeaderSize = 9
+	maxSealedSize   = snacl.NonceSize + snacl.Overhead + chunkHeaderSize + chunkSize
+)
+
+var (
+	// ErrNotBackup is returned when reading a file which is not a backup.
+	ErrNotBackup = errors.New("not a wallet backup")
+
+	// ErrVersion is returned when reading a backup of an unknown version.
+	ErrVersion = errors.New("unsupported wallet backup version")
+
+	// ErrWrongPassphrase is returned when the passphrase does not match the
+	// passphrase the backup was encrypted with.
+	ErrWrongPassphrase = errors.New("wrong passphrase for wallet backup")
+
+	// ErrCorrupt is returned when a backup was truncated or modified.
+	ErrCorrupt = errors.New("wallet backup is corrupt")
+)
+
+// ScryptOptions are the scrypt parameters used to derive a backup key.
+type ScryptOptions struct {
+	N, R, P int
+}
+
+// DefaultScryptOptions match the options the address manager derives the
+// master private key with.
+var DefaultScryptOptions = ScryptOptions{
+	N: 262144, // 2^18
+	R: 8,
+	P: 1,
+}
+
+// Key is the key backups are encrypted with.  A key can encrypt several
+// backups, each backup stores the parameters to derive it again from the
+// passphrase.
+type Key struct {
+	sk *snacl.SecretKey
+}
+
+// NewKey derives a new key from passphrase.  Default options are used when
+// opts is nil.
+func NewKey(passphrase []byte, opts *ScryptOptions) (*Key, error) {
+	if opts == nil {
+		opts = &DefaultScryptOptions
+	}
+	sk, err := snacl.NewSecretKey(&passphrase, opts.N, opts.R, opts.P)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{sk: sk}, nil
+}
+
+// Zero clears the key, it is no longer usable after this call.
+func (k *Key) Zero() {
+	k.sk.Zero()
+}
+
+// Writer encrypts a database copy into a backup.  Close must be called to
+// complete the backup.
+type Writer struct {
+	w      io.Writer
+	key    *Key
+	buf    []byte
+	index  uint64
+	digest hash.Hash
+	closed bool
+}
+
+// NewWriter writes the header of a backup encrypted with key to w and returns
+// a Writer for the database data.
+func NewWriter(w io.Writer, key *Key) (*Writer, error) {
+	params := key.sk.Marshal()
+	header := make([]byte, 0, len(magic)+3+len(params))
+	header = append(header, magic...)
+	header = append(header, version)
+	header = append(header, byte(len(params)), byte(len(params)>>8))
+	header = append(header, params...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:      w,
+		key:    key,
+		buf:    make([]byte, 0, chunkSize),
+		digest: sha256.New(),
+	}, nil
+}
+
+// Write buffers p and writes the chunks it completes.
+func (bw *Writer) Write(p []byte) (int, error) {
+	if bw.closed {
+		return 0, errors.New("backup writer closed")
+	}
+	n := len(p)
+	bw.digest.Write(p)
+	for len(p) > 0 {
+		m := copy(bw.buf[len(bw.buf):cap(bw.buf)], p)
+		bw.buf = bw.buf[:len(bw.buf)+m]
+		p = p[m:]
+		if len(bw.buf) == cap(bw.buf) {
+			if err := bw.writeChunk(bw.buf, false); err != nil {
+				return 0, err
+			}
+			bw.buf = bw.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// Close writes the buffered data and the final chunk.  It does not close the
+// underlying writer.
+func (bw *Writer) Close() error {
+	if bw.closed {
+		return nil
+	}
+	bw.closed = true
+	if len(bw.buf) > 0 {
+		if err := bw.writeChunk(bw.buf, false); err != nil {
+			return err
+		}
+	}
+	return bw.writeChunk(bw.digest.Sum(nil), true)
+}
+
+func (bw *Writer) writeChunk(data []byte, final bool) error {
+	plain := make([]byte, chunkHeaderSize+len(data))
+	binary.LittleEndian.PutUint64(plain, bw.index)
+	if final {
+		plain[8] = 1
+	}
+	copy(plain[chunkHeaderSize:], data)
+	bw.index++
+
+	sealed, err := bw.key.sk.Encrypt(plain)
+	if err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := bw.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = bw.w.Write(sealed)
+	return err
+}
+
+// Reader decrypts the database copy of a backup.  Read returns io.EOF only
+// after the checksum of the final chunk was verified.
+type Reader struct {
+	r      io.Reader
+	sk     *snacl.SecretKey
+	buf    []byte
+	index  uint64
+	digest hash.Hash
+	done   bool
+}
+
+// NewReader reads the header of the backup r and derives its key from
+// passphrase.
+func NewReader(r io.Reader, passphrase []byte) (*Reader, error) {
+	header := make([]byte, len(magic)+1)
+	if err := readHeader(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, ErrNotBackup
+	}
+
+	paramsSize := v1ParamsSize
+	switch header[len(magic)] {
+	case 1:
+	case version:
+		var size [2]byte
+		if err := readHeader(r, size[:]); err != nil {
+			return nil, err
+		}
+		paramsSize = int(binary.LittleEndian.Uint16(size[:]))
+		if paramsSize > maxParamsSize {
+			return nil, ErrNotBackup
+		}
+	default:
+		return nil, fmt.Errorf("%w %d", ErrVersion, header[len(magic)])
+	}
+	params := make([]byte, paramsSize)
+	if err := readHeader(r, params); err != nil {
+		return nil, err
+	}
+
+	var sk snacl.SecretKey
+	if err := sk.Unmarshal(params); err != nil {
+		return nil, ErrNotBackup
+	}
+	if err := sk.DeriveKey(&passphrase); err != nil {
+		if err == snacl.ErrInvalidPassword {
+			return nil, ErrWrongPassphrase
+		}
+		return nil, err
+	}
+	return &Reader{r: r, sk: &sk, digest: sha256.New()}, nil
+}
+
+// readHeader reads len(b) bytes of the header of a backup from r.
+func readHeader(r io.Reader, b []byte) error {
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrNotBackup
+		}
+		return err
+	}
+	return nil
+}
+
+// Read reads decrypted database data.
+func (br *Reader) Read(p []byte) (int, error) {
+	for len(br.buf) == 0 {
+		if br.done {
+			return 0, io.EOF
+		}
+		if err := br.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, br.buf)
+	br.buf = br.buf[n:]
+	return n, nil
+}
+
+func (br *Reader) readChunk() error {
+	var size [4]byte
+	if _, err := io.ReadFull(br.r, size[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrCorrupt
+		}
+		return err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n > maxSealedSize {
+		return ErrCorrupt
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(br.r, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrCorrupt
+		}
+		return err
+	}
+	plain, err := br.sk.Decrypt(sealed)
+	if err != nil || len(plain) < chunkHeaderSize ||
+		binary.LittleEndian.Uint64(plain) != br.index {
+		return ErrCorrupt
+	}
+	br.index++
+	data := plain[chunkHeaderSize:]
+
+	if plain[8] == 0 {
+		br.digest.Write(data)
+		br.buf = data
+		return nil
+	}
+
+	// The final chunk holds the checksum and must end the backup.
+	if !bytes.Equal(data, br.digest.Sum(nil)) {
+		return ErrCorrupt
+	}
+	if m, _ := br.r.Read(size[:1]); m != 0 {
+		return ErrCorrupt
+	}
+	br.done = true
+	return nil
+}
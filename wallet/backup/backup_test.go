@@ -0,0 +1,227 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet/backup"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/ldb"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/memdb"
+)
+
+var fastScrypt = &backup.ScryptOptions{N: 16, R: 8, P: 1}
+
+// testDB returns a database holding enough data for backups of several
+// chunks.
+func testDB(t *testing.T) walletdb.DB {
+	name := t.Name()
+	db, err := walletdb.Create("memdb", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		memdb.Remove(name)
+	})
+
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns, err := tx.CreateTopLevelBucket([]byte("wtxmgr"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 3000; i++ {
+			value := bytes.Repeat([]byte{byte(i)}, 1000)
+			if err := ns.Put([]byte(fmt.Sprintf("tx%05d", i)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBackupRestore(t *testing.T) {
+	db := testDB(t)
+	dir := t.TempDir()
+	pass := []byte("private")
+
+	key, err := backup.NewKey(pass, fastScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, backup.FileName(time.Now()))
+	info, err := backup.WriteFile(path, db, key)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := backup.WriteFile(path, db, key); err == nil {
+		t.Fatalf("WriteFile overwrote %s", path)
+	}
+
+	// Other existing files are refused and left as they are.
+	other := filepath.Join(dir, "wallet.db")
+	if err := os.WriteFile(other, []byte("database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.WriteFile(other, db, key); err == nil {
+		t.Fatalf("WriteFile overwrote %s", other)
+	}
+	if data, err := os.ReadFile(other); err != nil || string(data) != "database" {
+		t.Fatalf("WriteFile changed %s to %q %v", other, data, err)
+	}
+	if _, err := os.Stat(other + backup.ChecksumExt); !os.IsNotExist(err) {
+		t.Fatalf("WriteFile left %s%s: %v", other, backup.ChecksumExt, err)
+	}
+
+	verified, err := backup.Verify(path, pass)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if *verified != *info {
+		t.Fatalf("Verify: info %+v, want %+v", verified, info)
+	}
+	if _, err := backup.Verify(path, []byte("wrong")); err != backup.ErrWrongPassphrase {
+		t.Fatalf("Verify: got %v, want %v", err, backup.ErrWrongPassphrase)
+	}
+
+	for _, dbType := range []string{"bdb", "ldb"} {
+		dbPath := filepath.Join(dir, "restore-"+dbType)
+		if err := backup.Restore(path, pass, dbType, dbPath); err != nil {
+			t.Fatalf("Restore %s: %v", dbType, err)
+		}
+		restored, err := walletdb.Open(dbType, dbPath)
+		if err != nil {
+			t.Fatalf("open restored %s: %v", dbType, err)
+		}
+		err = walletdb.CompareDB(db, restored)
+		restored.Close()
+		if err != nil {
+			t.Fatalf("restored %s: %v", dbType, err)
+		}
+		if err := backup.Restore(path, pass, dbType, dbPath); err == nil {
+			t.Fatalf("Restore %s overwrote the database", dbType)
+		}
+	}
+}
+
+func TestBackupCorrupt(t *testing.T) {
+	db := testDB(t)
+	dir := t.TempDir()
+	pass := []byte("private")
+
+	key, err := backup.NewKey(pass, fastScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, backup.FileName(time.Now()))
+	if _, err := backup.WriteFile(path, db, key); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+	}{
+		{"flipped byte", func(b []byte) []byte {
+			b[len(b)/2] ^= 1
+			return b
+		}},
+		{"truncated", func(b []byte) []byte {
+			return b[:len(b)-100]
+		}},
+		{"final chunk removed", func(b []byte) []byte {
+			// The final chunk holds a 9 byte header and the checksum.
+			return b[:len(b)-4-24-16-9-32]
+		}},
+		{"trailing data", func(b []byte) []byte {
+			return append(b, 0)
+		}},
+	}
+	for _, test := range tests {
+		modified := test.modify(append([]byte(nil), data...))
+		if err := os.WriteFile(path, modified, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		// The checksum file detects the change.
+		if _, err := backup.Verify(path, pass); !errors.Is(err, backup.ErrCorrupt) {
+			t.Errorf("%s: got %v, want %v", test.name, err, backup.ErrCorrupt)
+		}
+
+		// Without the checksum file, decryption detects it.
+		checksum, err := os.ReadFile(path + backup.ChecksumExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(path + backup.ChecksumExt)
+		if _, err := backup.Verify(path, pass); !errors.Is(err, backup.ErrCorrupt) {
+			t.Errorf("%s without checksum: got %v, want %v", test.name, err, backup.ErrCorrupt)
+		}
+		os.WriteFile(path+backup.ChecksumExt, checksum, 0600)
+	}
+
+	if err := os.WriteFile(path, []byte("not a backup"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path + backup.ChecksumExt)
+	if _, err := backup.Verify(path, pass); err != backup.ErrNotBackup {
+		t.Errorf("got %v, want %v", err, backup.ErrNotBackup)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	db := testDB(t)
+	dir := t.TempDir()
+
+	key, err := backup.NewKey([]byte("private"), fastScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Backups within the same second get distinct names.
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(dir, backup.ScheduledFileName(start.Add(time.Duration(i)*time.Millisecond)))
+		if _, err := backup.WriteFile(path, db, key); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// A backup made on demand is older than all of them but never rotated.
+	manual := filepath.Join(dir, backup.FileName(start.Add(-time.Hour)))
+	if _, err := backup.WriteFile(manual, db, key); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := backup.Rotate(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 3 {
+		t.Fatalf("removed %v, want the 3 oldest backups", removed)
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		_, checksumErr := os.Stat(path + backup.ChecksumExt)
+		if kept := i >= 3; kept != (err == nil) || kept != (checksumErr == nil) {
+			t.Errorf("backup %d: kept %v, stat %v, checksum stat %v", i, kept, err, checksumErr)
+		}
+	}
+	if _, err := os.Stat(manual); err != nil {
+		t.Errorf("manual backup removed: %v", err)
+	}
+}
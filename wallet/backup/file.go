@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/bdb"
+)
+
+const (
+	filePrefix = "wallet-"
+	// scheduledPrefix names scheduled backups, so that rotating them never
+	// removes a backup made on demand.
+	scheduledPrefix = "scheduled-wallet-"
+	fileExt         = ".backup"
+	// timeFormat has a fixed width, so that names sort by time.
+	timeFormat = "20060102T150405.000000000Z"
+
+	// ChecksumExt is appended to the path of a backup to name the file
+	// holding its checksum, in the format of sha256sum.
+	ChecksumExt = ".sha256"
+)
+
+// Info describes a backup file.
+type Info struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// FileName returns the name of a backup made on demand at t.  Names have
+// nanosecond resolution and sort by time.
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format(timeFormat) + fileExt
+}
+
+// ScheduledFileName returns the name of a scheduled backup made at t, the
+// backups Rotate removes.
+func ScheduledFileName(t time.Time) string {
+	return scheduledPrefix + t.UTC().Format(timeFormat) + fileExt
+}
+
+// WriteFile writes an encrypted backup of db to path, together with its
+// checksum file.  It fails when path or its checksum file exist, existing
+// files are never replaced.  The copy is read in a single transaction of db,
+// so the database stays usable while the backup is written.
+func WriteFile(path string, db walletdb.DB, key *Key) (*Info, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// Reserve path and the checksum file, the finished backup is renamed
+	// over the reservation.
+	if err := createExcl(path); err != nil {
+		return nil, err
+	}
+	written := false
+	defer func() {
+		if !written {
+			os.Remove(path)
+		}
+	}()
+	if err := createExcl(path + ChecksumExt); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !written {
+			os.Remove(path + ChecksumExt)
+		}
+	}()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digest := sha256.New()
+	counter := &countWriter{}
+	out := bufio.NewWriter(io.MultiWriter(tmp, digest, counter))
+	bw, err := NewWriter(out, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Copy(bw); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	if err := out.Flush(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Path:   path,
+		Size:   counter.n,
+		SHA256: hex.EncodeToString(digest.Sum(nil)),
+	}
+	checksum := fmt.Sprintf("%s  %s\n", info.SHA256, filepath.Base(path))
+	if err := os.WriteFile(path+ChecksumExt, []byte(checksum), 0600); err != nil {
+		return nil, err
+	}
+	written = true
+	return info, nil
+}
+
+// createExcl creates the empty file path, it fails when path exists.
+func createExcl(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// checkFile returns the Info of the backup file path and compares its
+// checksum with the checksum file, if there is one.
+func checkFile(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	size, err := io.Copy(digest, f)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Path:   path,
+		Size:   size,
+		SHA256: hex.EncodeToString(digest.Sum(nil)),
+	}
+
+	checksum, err := os.ReadFile(path + ChecksumExt)
+	switch {
+	case os.IsNotExist(err):
+		return info, nil
+	case err != nil:
+		return nil, err
+	}
+	fields := strings.Fields(string(checksum))
+	if len(fields) == 0 || !strings.EqualFold(fields[0], info.SHA256) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	return info, nil
+}
+
+// decryptFile decrypts the backup path into the database file dbPath.
+func decryptFile(path string, passphrase []byte, dbPath string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br, err := NewReader(bufio.NewReader(f), passphrase)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, br); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// checkDB ensures the decrypted database dbPath can be opened and holds
+// buckets.
+func checkDB(dbPath string) error {
+	db, err := walletdb.Open("bdb", dbPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	defer db.Close()
+
+	buckets := 0
+	err = walletdb.View(db, func(tx walletdb.ReadTx) error {
+		return tx.ForEachBucket(func([]byte) error {
+			buckets++
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if buckets == 0 {
+		return fmt.Errorf("%w: empty database", ErrCorrupt)
+	}
+	return nil
+}
+
+// Verify checks the checksum of the backup path, decrypts it with
+// passphrase, and ensures it holds a database.
+func Verify(path string, passphrase []byte) (*Info, error) {
+	info, err := checkFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "wallet-verify")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "wallet.db")
+	if err := decryptFile(path, passphrase, dbPath); err != nil {
+		return nil, err
+	}
+	if err := checkDB(dbPath); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Restore decrypts the backup path with passphrase into a new wallet
+// database of the walletdb driver dbType at dbPath.  dbPath must not exist.
+func Restore(path string, passphrase []byte, dbType, dbPath string) error {
+	if _, err := os.Stat(dbPath); err == nil {
+		return fmt.Errorf("%s already exists", dbPath)
+	}
+	if _, err := checkFile(path); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		return err
+	}
+
+	// Decrypt next to the destination, so a bolt database can be moved in
+	// place.
+	tmpPath := dbPath + ".restore"
+	os.Remove(tmpPath)
+	defer os.Remove(tmpPath)
+	if err := decryptFile(path, passphrase, tmpPath); err != nil {
+		return err
+	}
+	if err := checkDB(tmpPath); err != nil {
+		return err
+	}
+	if dbType == "bdb" {
+		return os.Rename(tmpPath, dbPath)
+	}
+
+	// Backups hold a bolt database, copy it into the configured driver.
+	src, err := walletdb.Open("bdb", tmpPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := walletdb.Create(dbType, dbPath)
+	if err != nil {
+		return err
+	}
+	err = walletdb.CopyDB(dst, src)
+	if err == nil {
+		err = walletdb.CompareDB(src, dst)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(dbPath)
+		return err
+	}
+	return nil
+}
+
+// Rotate removes the oldest scheduled backups named by ScheduledFileName in
+// dir, keeping the newest keep ones, and returns the paths of the removed
+// backups.  Backups named by FileName are left alone.
+func Rotate(dir string, keep int) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, scheduledPrefix+"*"+fileExt))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) <= keep {
+		return nil, nil
+	}
+	sort.Strings(paths)
+
+	removed := paths[:len(paths)-keep]
+	for _, path := range removed {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		os.Remove(path + ChecksumExt)
+	}
+	return removed, nil
+}
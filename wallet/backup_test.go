@@ -0,0 +1,52 @@
+package wallet_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+)
+
+func TestBackupDirFile(t *testing.T) {
+	h := newHarness(t)
+	dir := t.TempDir()
+	config.Cfg.BackupDir = dir
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"wallet.backup", filepath.Join(dir, "wallet.backup")},
+		{"usb/wallet.backup", filepath.Join(dir, "usb", "wallet.backup")},
+		{filepath.Join(dir, "wallet.backup"), filepath.Join(dir, "wallet.backup")},
+		{".", dir},
+		{"../wallet.db", ""},
+		{"usb/../../wallet.db", ""},
+		{filepath.Join(filepath.Dir(dir), "wallet.db"), ""},
+	}
+	for _, test := range tests {
+		path, err := h.w.BackupDirFile(test.name)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", test.name, path)
+			}
+			continue
+		}
+		if err != nil || path != test.want {
+			t.Errorf("%s: got %s %v, want %s", test.name, path, err, test.want)
+		}
+	}
+
+	// An existing file is never replaced by a backup.
+	existing := filepath.Join(dir, "wallet.db")
+	if err := os.WriteFile(existing, []byte("database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.w.Backup(existing, privPass); err == nil {
+		t.Fatalf("backup replaced %s", existing)
+	}
+	if data, err := os.ReadFile(existing); err != nil || string(data) != "database" {
+		t.Fatalf("backup changed %s to %q %v", existing, data, err)
+	}
+}
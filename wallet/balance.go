@@ -0,0 +1,157 @@
+package wallet
+
+import (
+	"github.com/Qitmeer/qng/core/address"
+	"github.com/Qitmeer/qng/core/types"
+	"github.com/Qitmeer/qng/log"
+
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
+)
+
+// balanceUpdater keeps the account balances of the transaction store up to
+// date with the outputs changed in a database transaction, and flags the
+// wallet addresses receiving them as used.
+type balanceUpdater struct {
+	w         *Wallet
+	addrMgrNs walletdb.ReadWriteBucket
+	ns        walletdb.ReadWriteBucket
+	accounts  map[string]*addrAccount
+}
+
+// addrAccount is the account of an address, if it belongs to the wallet.
+type addrAccount struct {
+	manager *waddrmgr.ScopedKeyManager
+	addr    types.Address
+	account uint32
+	ok      bool
+	used    bool
+}
+
+func (w *Wallet) newBalanceUpdater(tx walletdb.ReadWriteTx) *balanceUpdater {
+	return &balanceUpdater{
+		w:         w,
+		addrMgrNs: tx.ReadWriteBucket(waddrmgrNamespaceKey),
+		ns:        tx.ReadWriteBucket(wtxmgrNamespaceKey),
+		accounts:  map[string]*addrAccount{},
+	}
+}
+
+// account returns the account of addr, or false when addr does not belong to
+// the wallet.  Outputs to the public key of a wallet address belong to its
+// account.
+func (u *balanceUpdater) account(addr string) (*addrAccount, error) {
+	if a, ok := u.accounts[addr]; ok {
+		return a, nil
+	}
+	a := &addrAccount{}
+	decoded, err := address.DecodeAddress(addr)
+	if err == nil {
+		if pkAddr, ok := decoded.(*address.SecpPubKeyAddress); ok {
+			decoded = pkAddr.PKHAddress()
+		}
+		a.manager, a.account, err = u.w.Manager.AddrAccount(u.addrMgrNs, decoded)
+		if err != nil && !waddrmgr.IsError(err, waddrmgr.ErrAddressNotFound) {
+			return nil, err
+		}
+		a.addr = decoded
+		a.ok = err == nil
+	}
+	u.accounts[addr] = a
+	return a, nil
+}
+
+// update moves an output from its old state to out in the balance of its
+// account.  old is nil for a new output and out is nil for a deleted one.  The
+// address of out is flagged as used.
+func (u *balanceUpdater) update(old, out *wtxmgr.AddrTxOutput) error {
+	addr := ""
+	if out != nil {
+		addr = out.Address
+	} else if old != nil {
+		addr = old.Address
+	}
+	a, err := u.account(addr)
+	if err != nil || !a.ok {
+		return err
+	}
+	if out != nil && !a.used {
+		if err := a.manager.MarkUsed(u.addrMgrNs, a.addr); err != nil {
+			return err
+		}
+		a.used = true
+	}
+	return u.w.TxStore.UpdateAccountBalance(u.ns, a.account, old, out)
+}
+
+// rebuildBalances sums every output of the wallet into the account balances
+// and flags the addresses which received them as used.
+func (w *Wallet) rebuildBalances(tx walletdb.ReadWriteTx) error {
+	ns := tx.ReadWriteBucket(wtxmgrNamespaceKey)
+	if err := w.TxStore.ClearAccountBalances(ns); err != nil {
+		return err
+	}
+	u := w.newBalanceUpdater(tx)
+	for _, coin := range types.CoinIDList {
+		outNs := ns.NestedReadBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, coin))
+		if outNs == nil {
+			continue
+		}
+		var outs []*wtxmgr.AddrTxOutput
+		err := w.TxStore.ForEachTxOut(outNs, func(out *wtxmgr.AddrTxOutput) error {
+			outs = append(outs, out)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, out := range outs {
+			if err := u.update(nil, out); err != nil {
+				return err
+			}
+		}
+	}
+	return w.TxStore.SetBalancesBuilt(ns)
+}
+
+// RebuildBalances rebuilds the account balances from the outputs of the
+// wallet, repairing balances which disagree with them.  The addresses which
+// received the outputs are flagged as used, which also flags the addresses of
+// wallets synced before usage was tracked.
+func (w *Wallet) RebuildBalances() error {
+	err := walletdb.Update(w.db, w.rebuildBalances)
+	if err != nil {
+		return err
+	}
+	log.Info("Rebuilt account balances")
+	return nil
+}
+
+// buildBalances builds the account balances of wallets created before them.
+func (w *Wallet) buildBalances() error {
+	return walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		if w.TxStore.BalancesBuilt(tx.ReadBucket(wtxmgrNamespaceKey)) {
+			return nil
+		}
+		log.Info("Building account balances")
+		return w.rebuildBalances(tx)
+	})
+}
+
+// accountBalance returns the balance of account in coin at the chain height.
+func (w *Wallet) accountBalance(ns walletdb.ReadBucket, account uint32, coin types.CoinID, height uint32) (*Balance, error) {
+	b, err := w.TxStore.FetchAccountBalance(ns, account, coin)
+	if err != nil {
+		return nil, err
+	}
+	balance := NewBalance(coin)
+	balance.UnspentAmount.Value = b.Spendable(height)
+	balance.LockAmount.Value = b.LockedAt(height)
+	balance.UnconfirmedAmount.Value = b.Unconfirmed + b.Immature
+	balance.ImmatureAmount.Value = b.Immature
+	balance.SpendAmount.Value = b.Spent
+	balance.TotalAmount.Value = balance.UnspentAmount.Value + balance.LockAmount.Value +
+		balance.UnconfirmedAmount.Value
+	return balance, nil
+}
@@ -0,0 +1,104 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+
+	clijson "github.com/Qitmeer/qitmeer-wallet/json"
+	qJson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/rpc/client"
+	"github.com/Qitmeer/qng/rpc/client/cmds"
+)
+
+// ChainBackend is the node the wallet reads chain data from, publishes
+// transactions to and receives notifications from.  httpConfig talks to a
+// qitmeer node over RPC, wallet/mocknode provides an in-memory node for
+// offline tests.
+type ChainBackend interface {
+	// GetBlockCount returns the number of blocks, the latest order plus one.
+	GetBlockCount() (uint64, error)
+	GetBlockByOrder(order int64) (*clijson.BlockHttpResult, error)
+	SendRawTransaction(tx string, allowHighFees bool) (string, error)
+	GetNodeInfo() (*qJson.InfoNodeResult, error)
+	GetTokenInfo() ([]qJson.TokenState, error)
+
+	// GetRawTransaction returns a mined or mempool transaction, ErrTxNotFound
+	// if the node does not know it.
+	GetRawTransaction(txId string) (*qJson.TxRawResult, error)
+	// IsUnspent reports whether output index of txId is unspent, an output
+	// spent by a mempool transaction counts as spent.
+	IsUnspent(txId string, index uint32) (bool, error)
+	IsBlue(blockHash string) (bool, error)
+
+	// Notifications opens a notification connection which delivers node
+	// events to handlers.
+	Notifications(handlers client.NotificationHandlers) (ChainNotifier, error)
+}
+
+// ErrTxNotFound is returned by ChainBackend.GetRawTransaction for
+// transactions unknown to the node.
+var ErrTxNotFound = errors.New("transaction not found")
+
+// ChainNotifier is a notification connection opened by a ChainBackend.
+type ChainNotifier interface {
+	NotifyBlocks() error
+	NotifyNewTransactions(verbose bool) error
+	NotifyTxsByAddr(addrs []string) error
+	NotifyTxsConfirmed(txs []cmds.TxConfirm) error
+	// Rescan blocks in [startOrder, endOrder) for transactions involving
+	// addrs, it returns once the rescan finished.
+	Rescan(startOrder, endOrder uint64, addrs []string) error
+	Shutdown()
+	WaitForShutdown()
+}
+
+// rpcNotifier adapts the node's websocket client to ChainNotifier.
+type rpcNotifier struct {
+	*client.Client
+}
+
+func (n rpcNotifier) NotifyTxsByAddr(addrs []string) error {
+	return n.Client.NotifyTxsByAddr(false, addrs, nil)
+}
+
+func (n rpcNotifier) Rescan(startOrder, endOrder uint64, addrs []string) error {
+	return n.Client.Rescan(startOrder, endOrder, addrs, nil)
+}
+
+// Notifications connects to the websocket endpoint of the node.
+func (cfg *httpConfig) Notifications(handlers client.NotificationHandlers) (ChainNotifier, error) {
+	connCfg := &client.ConnConfig{
+		Host:               cfg.RPCServer,
+		Endpoint:           "ws",
+		User:               cfg.RPCUser,
+		Pass:               cfg.RPCPassword,
+		DisableTLS:         cfg.NoTLS,
+		HTTPPostMode:       false,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+	}
+	c, err := newNotificationClient(connCfg, cfg.RPCCert, handlers)
+	if err != nil {
+		return nil, err
+	}
+	return rpcNotifier{c}, nil
+}
+
+func newNotificationClient(connCfg *client.ConnConfig, certFile string, handlers client.NotificationHandlers) (*client.Client, error) {
+	if !connCfg.DisableTLS {
+		certs, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return nil, err
+		}
+		connCfg.Certificates = certs
+	}
+
+	c, err := client.New(connCfg, &handlers)
+	if err != nil {
+		return nil, err
+	}
+	// Register for block connect and disconnect notifications.
+	if err := c.NotifyBlocks(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,198 @@
+package wallet
+
+import (
+	"sync"
+
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+	"github.com/Qitmeer/qng/log"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
+)
+
+// confirmTracker follows the confirmations of unconfirmed transactions.
+// Each transaction is registered once with the order of its block and the
+// confirmations it needs, and its confirmations are counted from the orders
+// of connected blocks.  The node is only asked about a transaction once it
+// should have reached its confirmations.
+type confirmTracker struct {
+	mu  sync.Mutex
+	tip uint32
+	txs map[hash.Hash]*trackedTx
+}
+
+type trackedTx struct {
+	order    uint32
+	required uint32
+}
+
+func newConfirmTracker() *confirmTracker {
+	return &confirmTracker{txs: make(map[hash.Hash]*trackedTx)}
+}
+
+// add registers txId, mined at order, until it has required confirmations.
+func (t *confirmTracker) add(txId hash.Hash, order, required uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.txs[txId] = &trackedTx{order: order, required: required}
+}
+
+func (t *confirmTracker) remove(txId hash.Hash) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.txs, txId)
+}
+
+// reset drops all transactions and sets the latest block order to tip.
+func (t *confirmTracker) reset(tip uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tip = tip
+	t.txs = make(map[hash.Hash]*trackedTx)
+}
+
+// connect records a block connected at order.
+func (t *confirmTracker) connect(order uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if order > t.tip {
+		t.tip = order
+	}
+}
+
+// pending returns the transactions which may have reached their
+// confirmations at the current tip.
+func (t *confirmTracker) pending() []hash.Hash {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.due()
+}
+
+// due must be called with the lock held.
+func (t *confirmTracker) due() []hash.Hash {
+	var txIds []hash.Hash
+	for txId, tx := range t.txs {
+		if t.tip >= tx.order && t.tip-tx.order+1 >= tx.required {
+			txIds = append(txIds, txId)
+		}
+	}
+	return txIds
+}
+
+// postpone resets the count of txId to confirmations as reported by the
+// node, e.g. after its block was reordered, so it is not due again before
+// it can have reached its required confirmations.
+func (t *confirmTracker) postpone(txId hash.Hash, confirmations uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.txs[txId]
+	if !ok {
+		return
+	}
+	if confirmations > t.tip+1 {
+		confirmations = t.tip + 1
+	}
+	tx.order = t.tip + 1 - confirmations
+}
+
+// loadUnconfirmed registers every transaction of the unconfirmed bucket.
+func (w *Wallet) loadUnconfirmed(tip uint32) error {
+	w.confirms.reset(tip)
+	return walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(wtxmgrNamespaceKey)
+		return w.TxStore.ForEachUnconfirmed(ns, func(txId *hash.Hash, u *wtxmgr.UnconfirmTx) error {
+			w.confirms.add(*txId, u.Order, u.Confirmations)
+			return nil
+		})
+	})
+}
+
+// queueConfirmCheck wakes the confirmation worker.  Requests made while the
+// worker is busy are merged into a single further check.
+func (w *Wallet) queueConfirmCheck() {
+	select {
+	case w.confirmCheck <- struct{}{}:
+	default:
+	}
+}
+
+// confirmWorker checks the transactions due at the current tip whenever it
+// is woken, until done is closed.  It keeps the node requests off the
+// notification goroutine.
+func (w *Wallet) confirmWorker(done <-chan struct{}) {
+	defer w.syncWg.Done()
+
+	for {
+		select {
+		case <-w.confirmCheck:
+			w.checkConfirmations(w.confirms.pending())
+		case <-done:
+			return
+		}
+	}
+}
+
+// checkConfirmations asks the node for the state of transactions which may
+// have reached their confirmations and stores the ones which did.
+func (w *Wallet) checkConfirmations(txIds []hash.Hash) {
+	for _, txId := range txIds {
+		tr, err := w.HttpClient.GetRawTransaction(txId.String())
+		if err == ErrTxNotFound {
+			w.confirms.postpone(txId, 0)
+			continue
+		}
+		if err != nil {
+			log.Warn("check tx confirmations", "txid", txId, "error", err)
+			continue
+		}
+		if tr.BlockHash == "" {
+			w.confirms.postpone(txId, 0)
+			continue
+		}
+		isBlue, err := w.HttpClient.IsBlue(tr.BlockHash)
+		if err != nil {
+			log.Warn("check tx confirmations", "txid", txId, "error", err)
+			continue
+		}
+		status := w.txStatus(txConfirmations(*tr), uint32(tr.Confirmations), tr.Txsvalid, isBlue, wtxmgr.TxRawIsCoinBase(*tr), false)
+		if status < wtxmgr.TxStatusConfirmed {
+			w.confirms.postpone(txId, uint32(tr.Confirmations))
+			continue
+		}
+		if err := w.updateTxStatus(*tr, status); err != nil {
+			log.Warn("update tx status", "txid", txId, "error", err)
+		}
+	}
+}
+
+// requiredConfirmations returns the confirmations a transaction needs.
+func (w *Wallet) requiredConfirmations(tr corejson.TxRawResult) uint32 {
+	if wtxmgr.TxRawIsCoinBase(tr) {
+		return uint32(w.chainParams.CoinbaseMaturity)
+	}
+	return txConfirmations(tr)
+}
+
+// txConfirmations returns the confirmations a transaction which is not a
+// coinbase needs, the most any coin it pays requires.
+func txConfirmations(tr corejson.TxRawResult) uint32 {
+	if len(tr.Vout) == 0 {
+		return config.Cfg.ConfirmationsFor(types.MEERA)
+	}
+	var required uint32
+	for _, vout := range tr.Vout {
+		if n := config.Cfg.ConfirmationsFor(types.CoinID(vout.CoinId)); n > required {
+			required = n
+		}
+	}
+	return required
+}
@@ -0,0 +1,82 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+)
+
+func TestConfirmTracker(t *testing.T) {
+	tr := newConfirmTracker()
+	tr.reset(10)
+
+	a, b := hash.Hash{1}, hash.Hash{2}
+	tr.add(a, 9, 3)
+	tr.add(b, 10, 1)
+
+	if due := tr.pending(); len(due) != 1 || due[0] != b {
+		t.Fatalf("pending %v, want [%v]", due, b)
+	}
+	tr.remove(b)
+	tr.connect(11)
+	if due := tr.pending(); len(due) != 1 || due[0] != a {
+		t.Fatalf("due at 11 %v, want [%v]", due, a)
+	}
+
+	// The node saw a single confirmation, a was reordered.
+	tr.postpone(a, 1)
+	tr.connect(12)
+	if due := tr.pending(); len(due) != 0 {
+		t.Fatalf("postponed tx due at 12")
+	}
+	tr.connect(13)
+	if due := tr.pending(); len(due) != 1 || due[0] != a {
+		t.Fatalf("due at 13 %v, want [%v]", due, a)
+	}
+
+	// Stale orders do not move the tip back.
+	tr.postpone(a, 0)
+	tr.connect(5)
+	if due := tr.pending(); len(due) != 0 {
+		t.Fatalf("due after stale order %v", due)
+	}
+}
+
+func TestTxConfirmations(t *testing.T) {
+	cfg := config.NewDefaultConfig()
+	cfg.Confirmations = 10
+	cfg.CoinConfirmations = []string{"1=20", "2=5"}
+	if err := cfg.Check(); err != nil {
+		t.Fatal(err)
+	}
+	oldCfg := config.Cfg
+	config.Cfg = cfg
+	defer func() { config.Cfg = oldCfg }()
+
+	vouts := func(coins ...types.CoinID) corejson.TxRawResult {
+		var tr corejson.TxRawResult
+		for _, coin := range coins {
+			tr.Vout = append(tr.Vout, corejson.Vout{CoinId: uint16(coin)})
+		}
+		return tr
+	}
+	tests := []struct {
+		coins []types.CoinID
+		want  uint32
+	}{
+		{nil, 10},
+		{[]types.CoinID{types.MEERA}, 10},
+		{[]types.CoinID{2}, 5},
+		{[]types.CoinID{2, types.MEERA}, 10},
+		{[]types.CoinID{types.MEERA, 1}, 20},
+	}
+	for _, test := range tests {
+		if got := txConfirmations(vouts(test.coins...)); got != test.want {
+			t.Errorf("coins %v: %d confirmations, want %d", test.coins, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package wallet
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet/export"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
+)
+
+// ExportFilter selects the transactions of an exported history.  The zero
+// filter selects the whole history of the wallet.
+type ExportFilter struct {
+	// Account is the name of the exported account, and Address the
+	// exported address.  At most one of them is set; the whole wallet is
+	// exported otherwise.
+	Account string
+	Address string
+	// FromOrder and ToOrder bound the block orders of the exported
+	// transactions; a zero ToOrder has no upper bound.  Unmined
+	// transactions are only exported without upper bound.
+	FromOrder uint32
+	ToOrder   uint32
+	// From and To bound the times of the exported transactions; zero times
+	// do not bound them.
+	From time.Time
+	To   time.Time
+}
+
+// NewExportFilter returns the filter of an exported history.  from and to are
+// RFC 3339 times or dates, empty when not bounded.
+func NewExportFilter(account, address string, fromOrder, toOrder uint32, from, to string) (ExportFilter, error) {
+	filter := ExportFilter{
+		Account:   account,
+		Address:   address,
+		FromOrder: fromOrder,
+		ToOrder:   toOrder,
+	}
+	if account != "" && address != "" {
+		return filter, fmt.Errorf("export either an account or an address")
+	}
+	if toOrder != 0 && toOrder < fromOrder {
+		return filter, fmt.Errorf("block order range ends before it starts")
+	}
+	var err error
+	filter.From, filter.To, err = export.ParseRange(from, to)
+	return filter, err
+}
+
+// exportTx is a transaction of an exported history, with the variations of
+// the exported addresses per coin.
+type exportTx struct {
+	order      uint32
+	txId       hash.Hash
+	variations map[types.CoinID]int64
+	spends     bool
+}
+
+// ExportHistory writes the history of the wallet selected by filter to out in
+// format, oldest transaction first, and returns the number of exported
+// transactions.
+func (w *Wallet) ExportHistory(out io.Writer, format export.Format, filter ExportFilter) (int, error) {
+	if filter.Account != "" && filter.Address != "" {
+		return 0, fmt.Errorf("export either an account or an address")
+	}
+	scope, name, err := w.exportScope(filter)
+	if err != nil {
+		return 0, err
+	}
+	writer, err := export.NewWriter(out, format, name)
+	if err != nil {
+		return 0, err
+	}
+
+	match := func(e *wtxmgr.AddrHistoryEntry) bool {
+		if e.Order == wtxmgr.HistoryUnminedOrder {
+			return filter.ToOrder == 0
+		}
+		return e.Order >= filter.FromOrder && (filter.ToOrder == 0 || e.Order <= filter.ToOrder)
+	}
+
+	tip := w.getSyncOrder()
+	count := 0
+	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(wtxmgrNamespaceKey)
+
+		txs := map[hash.Hash]*exportTx{}
+		for addr := range scope {
+			entries, _, err := w.TxStore.AddrHistory(ns, addr, nil, PageMaxSize, match)
+			if err != nil {
+				return err
+			}
+			for i := range entries {
+				e := &entries[i]
+				t, ok := txs[e.TxId]
+				if !ok {
+					t = &exportTx{order: e.Order, txId: e.TxId, variations: map[types.CoinID]int64{}}
+					txs[e.TxId] = t
+				}
+				for coin, v := range e.CoinVariations() {
+					t.variations[coin] += v
+				}
+				for _, p := range e.Parts {
+					t.spends = t.spends || p.Spent
+				}
+			}
+		}
+
+		sorted := make([]*exportTx, 0, len(txs))
+		for _, t := range txs {
+			sorted = append(sorted, t)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			if sorted[i].order != sorted[j].order {
+				return sorted[i].order < sorted[j].order
+			}
+			return sorted[i].txId.String() < sorted[j].txId.String()
+		})
+
+		for _, t := range sorted {
+			entry, err := w.exportEntry(ns, scope, t, tip)
+			if err != nil {
+				return err
+			}
+			if !filter.From.IsZero() && entry.Time.Before(filter.From) {
+				continue
+			}
+			if !filter.To.IsZero() && entry.Time.After(filter.To) {
+				continue
+			}
+			if err := writer.Write(entry); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, writer.Flush()
+}
+
+// exportScope returns the addresses exported with filter, and the name of
+// the export.
+func (w *Wallet) exportScope(filter ExportFilter) (map[string]bool, string, error) {
+	scope := map[string]bool{}
+	switch {
+	case filter.Address != "":
+		scope[filter.Address] = true
+		return scope, filter.Address, nil
+	case filter.Account != "":
+		account, err := w.AccountNumber(w.Manager.DefaultScope(), filter.Account)
+		if err != nil {
+			return nil, "", err
+		}
+		addrs, err := w.AccountAddresses(account)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, addr := range addrs {
+			scope[addr.String()] = true
+		}
+		return scope, filter.Account, nil
+	}
+	addrs, err := w.walletAddress()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, addr := range addrs {
+		scope[addr] = true
+	}
+	return scope, "wallet", nil
+}
+
+// exportEntry returns the ledger entry of t.  The counterparties are the
+// addresses outside of scope the transaction pays to when it spends from
+// scope, and the addresses it spends from otherwise.  The fee is only known
+// when the transaction spends from scope and all its inputs are stored.
+func (w *Wallet) exportEntry(ns walletdb.ReadBucket, scope map[string]bool, t *exportTx, tip uint32) (*export.Entry, error) {
+	entry := &export.Entry{TxId: t.txId.String()}
+	if t.order != wtxmgr.HistoryUnminedOrder {
+		entry.Mined = true
+		entry.BlockOrder = uint64(t.order)
+		if tip >= t.order {
+			entry.Confirmations = int64(tip - t.order + 1)
+		}
+	}
+
+	coins := make([]types.CoinID, 0, len(t.variations))
+	for coin := range t.variations {
+		coins = append(coins, coin)
+	}
+	sort.Slice(coins, func(i, j int) bool { return coins[i] < coins[j] })
+	for _, coin := range coins {
+		entry.Amounts = append(entry.Amounts, export.Amount{Coin: coin.Name(), Value: t.variations[coin]})
+	}
+	entry.SetDirection()
+
+	tr, err := w.TxStore.FetchTxJson(ns, &t.txId)
+	if err != nil {
+		return nil, err
+	}
+	if tr == nil {
+		return entry, nil
+	}
+	if ts, err := time.Parse(time.RFC3339, tr.Timestamp); err == nil {
+		entry.Time = ts
+	}
+	if tr.Confirmations > entry.Confirmations {
+		entry.Confirmations = tr.Confirmations
+	}
+	if wtxmgr.TxRawIsCoinBase(*tr) {
+		entry.Memo = "coinbase"
+	}
+
+	seen := map[string]bool{}
+	addCounterparty := func(addr string) {
+		if !scope[addr] && !seen[addr] {
+			seen[addr] = true
+			entry.Counterparties = append(entry.Counterparties, addr)
+		}
+	}
+	if t.spends {
+		for _, vo := range tr.Vout {
+			if len(vo.ScriptPubKey.Addresses) > 0 {
+				addCounterparty(vo.ScriptPubKey.Addresses[0])
+			}
+		}
+	}
+
+	var prevOuts []*corejson.Vout
+	known := t.spends && entry.Memo == ""
+	for _, vi := range tr.Vin {
+		prev, err := w.exportPrevOut(ns, vi)
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil {
+			known = false
+			continue
+		}
+		if !t.spends && len(prev.ScriptPubKey.Addresses) > 0 {
+			addCounterparty(prev.ScriptPubKey.Addresses[0])
+		}
+		prevOuts = append(prevOuts, prev)
+	}
+	if known {
+		entry.Fee = txFee(prevOuts, tr.Vout)
+	}
+	return entry, nil
+}
+
+// txFee returns the fee of a transaction spending prevOuts.  A transaction
+// may move several coins, the fee is paid in the one whose inputs exceed its
+// outputs.
+func txFee(prevOuts []*corejson.Vout, vouts []corejson.Vout) *export.Amount {
+	diff := map[types.CoinID]int64{}
+	for _, prev := range prevOuts {
+		diff[types.CoinID(prev.CoinId)] += int64(prev.Amount)
+	}
+	for _, vo := range vouts {
+		diff[types.CoinID(vo.CoinId)] -= int64(vo.Amount)
+	}
+	coins := make([]types.CoinID, 0, len(diff))
+	for coin := range diff {
+		coins = append(coins, coin)
+	}
+	sort.Slice(coins, func(i, j int) bool { return coins[i] < coins[j] })
+	for _, coin := range coins {
+		if diff[coin] > 0 {
+			return &export.Amount{Coin: coin.Name(), Value: diff[coin]}
+		}
+	}
+	return &export.Amount{Coin: types.MEERA.Name()}
+}
+
+// exportPrevOut returns the output spent by vi, or nil when its transaction
+// is not stored.
+func (w *Wallet) exportPrevOut(ns walletdb.ReadBucket, vi corejson.Vin) (*corejson.Vout, error) {
+	if vi.Coinbase != "" || vi.Txid == "" {
+		return nil, nil
+	}
+	prevId, err := hash.NewHashFromStr(vi.Txid)
+	if err != nil {
+		return nil, nil
+	}
+	prev, err := w.TxStore.FetchTxJson(ns, prevId)
+	if err != nil || prev == nil || int(vi.Vout) >= len(prev.Vout) {
+		return nil, err
+	}
+	return &prev.Vout[vi.Vout], nil
+}
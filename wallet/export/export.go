@@ -0,0 +1,498 @@
+// Package export writes the transaction history of a wallet as a ledger for
+// accounting software.
+//
+// A ledger is a chronological list of entries, one per transaction, holding
+// the amount the transaction moved in and out of the exported addresses in
+// each coin.  It is written as CSV, with one row per transaction and coin, as
+// JSON lines, with one object per transaction, or as an OFX 2 bank statement
+// per coin.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the format of an exported ledger.
+type Format string
+
+const (
+	// FormatCSV writes one row per transaction and coin, after a header.
+	FormatCSV Format = "csv"
+	// FormatJSON writes one JSON object per transaction and line.
+	FormatJSON Format = "jsonl"
+	// FormatOFX writes an OFX 2 bank statement per coin.
+	FormatOFX Format = "ofx"
+)
+
+// ParseFormat returns the format named s.  "json" is accepted for JSON lines.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatJSON, FormatOFX:
+		return f, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown export format %q, use csv, jsonl or ofx", s)
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatJSON:
+		return "application/x-ndjson"
+	case FormatOFX:
+		return "application/x-ofx"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file name extension of the format.
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+const dateLayout = "2006-01-02"
+
+// ParseRange parses the bounds of a time range, each either empty, an RFC 3339
+// time or a date.  A date ends the range at the end of that day.
+func ParseRange(from, to string) (time.Time, time.Time, error) {
+	start, err := parseTime(from)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseTime(to)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if len(to) == len(dateLayout) {
+		end = end.Add(24*time.Hour - time.Nanosecond)
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("time range ends before it starts")
+	}
+	return start, end, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// Directions of a transaction relative to the exported addresses.
+const (
+	// DirectionIn is a transaction paying the exported addresses.
+	DirectionIn = "in"
+	// DirectionOut is a transaction paying from the exported addresses.
+	DirectionOut = "out"
+	// DirectionSelf is a transaction which only moves coins between the
+	// exported addresses.
+	DirectionSelf = "self"
+)
+
+// atomsPerCoin is the number of atoms in a coin.
+const atomsPerCoin = 1e8
+
+// Amount is an amount of atoms in a coin.
+type Amount struct {
+	Coin  string `json:"coin"`
+	Value int64  `json:"value"`
+}
+
+// Decimal returns the amount in coins with eight decimals.
+func (a Amount) Decimal() string {
+	v := a.Value
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	return fmt.Sprintf("%s%d.%08d", sign, v/atomsPerCoin, v%atomsPerCoin)
+}
+
+// Entry is a transaction of the ledger.
+type Entry struct {
+	// Time is the time of the block of the transaction, or the time it was
+	// received when unmined.
+	Time time.Time
+	// BlockOrder is the order of the block of the transaction.  It is only
+	// meaningful when Mined.
+	BlockOrder uint64
+	Mined      bool
+	TxId       string
+	Direction  string
+	// Counterparties are the addresses outside of the export the
+	// transaction pays or spends from.
+	Counterparties []string
+	// Amounts are the net amounts the transaction moved in each coin,
+	// negative when paid from the exported addresses.
+	Amounts []Amount
+	// Fee is the fee paid by the exported addresses, if known.
+	Fee           *Amount
+	Confirmations int64
+	Memo          string
+}
+
+// SetDirection sets the direction of the entry from its amounts.
+func (e *Entry) SetDirection() {
+	var in, out bool
+	for _, a := range e.Amounts {
+		in = in || a.Value > 0
+		out = out || a.Value < 0
+	}
+	switch {
+	case out:
+		e.Direction = DirectionOut
+	case in:
+		e.Direction = DirectionIn
+	default:
+		e.Direction = DirectionSelf
+	}
+}
+
+// Writer writes the entries of a ledger in chronological order.
+type Writer interface {
+	Write(e *Entry) error
+	// Flush writes the buffered entries and the end of the ledger.
+	Flush() error
+}
+
+// NewWriter returns a writer of the format to w.  account names the exported
+// account in OFX statements.
+func NewWriter(w io.Writer, format Format, account string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatJSON:
+		return &jsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatOFX:
+		return &ofxWriter{w: w, account: account}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func blockOrder(e *Entry) string {
+	if !e.Mined {
+		return ""
+	}
+	return strconv.FormatUint(e.BlockOrder, 10)
+}
+
+// feeIn returns the fee of e in coin as a decimal, or "" when it is not paid
+// in coin.
+func feeIn(e *Entry, coin string) string {
+	if e.Fee == nil || e.Fee.Coin != coin {
+		return ""
+	}
+	return e.Fee.Decimal()
+}
+
+var csvHeader = []string{"timestamp", "block_order", "txid", "direction",
+	"counterparties", "coin", "amount", "fee", "confirmations", "memo"}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(e *Entry) error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	for _, a := range e.Amounts {
+		err := c.w.Write([]string{
+			timestamp(e.Time),
+			blockOrder(e),
+			e.TxId,
+			e.Direction,
+			strings.Join(e.Counterparties, " "),
+			a.Coin,
+			a.Decimal(),
+			feeIn(e, a.Coin),
+			strconv.FormatInt(e.Confirmations, 10),
+			e.Memo,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) Flush() error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonAmount struct {
+	Coin   string `json:"coin"`
+	Amount string `json:"amount"`
+	Atoms  int64  `json:"atoms"`
+}
+
+type jsonEntry struct {
+	Timestamp      string       `json:"timestamp"`
+	BlockOrder     *uint64      `json:"block_order"`
+	TxId           string       `json:"txid"`
+	Direction      string       `json:"direction"`
+	Counterparties []string     `json:"counterparties"`
+	Amounts        []jsonAmount `json:"amounts"`
+	Fee            *jsonAmount  `json:"fee,omitempty"`
+	Confirmations  int64        `json:"confirmations"`
+	Memo           string       `json:"memo,omitempty"`
+}
+
+func newJSONAmount(a Amount) jsonAmount {
+	return jsonAmount{Coin: a.Coin, Amount: a.Decimal(), Atoms: a.Value}
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonWriter) Write(e *Entry) error {
+	je := jsonEntry{
+		Timestamp:      timestamp(e.Time),
+		TxId:           e.TxId,
+		Direction:      e.Direction,
+		Counterparties: e.Counterparties,
+		Amounts:        make([]jsonAmount, len(e.Amounts)),
+		Confirmations:  e.Confirmations,
+		Memo:           e.Memo,
+	}
+	if e.Mined {
+		order := e.BlockOrder
+		je.BlockOrder = &order
+	}
+	if je.Counterparties == nil {
+		je.Counterparties = []string{}
+	}
+	for i, a := range e.Amounts {
+		je.Amounts[i] = newJSONAmount(a)
+	}
+	if e.Fee != nil {
+		fee := newJSONAmount(*e.Fee)
+		je.Fee = &fee
+	}
+	return j.enc.Encode(&je)
+}
+
+func (j *jsonWriter) Flush() error {
+	return nil
+}
+
+// ofxWriter buffers the entries to write a statement per coin, since OFX
+// statements are in a single currency.
+type ofxWriter struct {
+	w       io.Writer
+	account string
+	entries []*Entry
+}
+
+func (o *ofxWriter) Write(e *Entry) error {
+	o.entries = append(o.entries, e)
+	return nil
+}
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+type ofxDoc struct {
+	XMLName xml.Name     `xml:"OFX"`
+	SignOn  ofxSignOn    `xml:"SIGNONMSGSRSV1>SONRS"`
+	Stmts   []ofxStmtTrn `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignOn struct {
+	Status   ofxStatus `xml:"STATUS"`
+	DtServer string    `xml:"DTSERVER"`
+	Language string    `xml:"LANGUAGE"`
+}
+
+type ofxStmtTrn struct {
+	TrnUID string    `xml:"TRNUID"`
+	Status ofxStatus `xml:"STATUS"`
+	Stmt   ofxStmt   `xml:"STMTRS"`
+}
+
+type ofxStmt struct {
+	CurDef  string      `xml:"CURDEF"`
+	Account ofxAccount  `xml:"BANKACCTFROM"`
+	List    ofxTranList `xml:"BANKTRANLIST"`
+	Balance ofxBalance  `xml:"LEDGERBAL"`
+}
+
+type ofxAccount struct {
+	BankID   string `xml:"BANKID"`
+	AcctID   string `xml:"ACCTID"`
+	AcctType string `xml:"ACCTTYPE"`
+}
+
+type ofxTranList struct {
+	DtStart string       `xml:"DTSTART"`
+	DtEnd   string       `xml:"DTEND"`
+	Trans   []ofxStmtTrx `xml:"STMTTRN"`
+}
+
+type ofxStmtTrx struct {
+	TrnType  string `xml:"TRNTYPE"`
+	DtPosted string `xml:"DTPOSTED"`
+	TrnAmt   string `xml:"TRNAMT"`
+	FitID    string `xml:"FITID"`
+	Name     string `xml:"NAME,omitempty"`
+	Memo     string `xml:"MEMO,omitempty"`
+}
+
+type ofxBalance struct {
+	BalAmt string `xml:"BALAMT"`
+	DtAsOf string `xml:"DTASOF"`
+}
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+// ofxName is the NAME of a transaction, limited to 32 characters by OFX.
+func ofxName(e *Entry) string {
+	if len(e.Counterparties) == 0 {
+		return ""
+	}
+	name := e.Counterparties[0]
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+func ofxMemo(e *Entry, coin string) string {
+	var parts []string
+	if e.Memo != "" {
+		parts = append(parts, e.Memo)
+	}
+	if len(e.Counterparties) > 0 {
+		parts = append(parts, strings.Join(e.Counterparties, " "))
+	}
+	if fee := feeIn(e, coin); fee != "" {
+		parts = append(parts, "fee "+fee)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (o *ofxWriter) Flush() error {
+	byCoin := map[string][]ofxStmtTrx{}
+	balances := map[string]int64{}
+	var start, end time.Time
+	for _, e := range o.entries {
+		if start.IsZero() || e.Time.Before(start) {
+			start = e.Time
+		}
+		if e.Time.After(end) {
+			end = e.Time
+		}
+		for _, a := range e.Amounts {
+			trnType := "XFER"
+			if a.Value > 0 {
+				trnType = "CREDIT"
+			} else if a.Value < 0 {
+				trnType = "DEBIT"
+			}
+			byCoin[a.Coin] = append(byCoin[a.Coin], ofxStmtTrx{
+				TrnType:  trnType,
+				DtPosted: ofxTime(e.Time),
+				TrnAmt:   a.Decimal(),
+				FitID:    e.TxId + "-" + a.Coin,
+				Name:     ofxName(e),
+				Memo:     ofxMemo(e, a.Coin),
+			})
+			balances[a.Coin] += a.Value
+		}
+	}
+	coins := make([]string, 0, len(byCoin))
+	for coin := range byCoin {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+
+	now := ofxTime(time.Now())
+	doc := ofxDoc{
+		SignOn: ofxSignOn{
+			Status:   ofxStatus{Severity: "INFO"},
+			DtServer: now,
+			Language: "ENG",
+		},
+	}
+	for i, coin := range coins {
+		doc.Stmts = append(doc.Stmts, ofxStmtTrn{
+			TrnUID: strconv.Itoa(i + 1),
+			Status: ofxStatus{Severity: "INFO"},
+			Stmt: ofxStmt{
+				CurDef: coin,
+				Account: ofxAccount{
+					BankID:   "QITMEER",
+					AcctID:   o.account,
+					AcctType: "CHECKING",
+				},
+				List: ofxTranList{
+					DtStart: ofxTime(start),
+					DtEnd:   ofxTime(end),
+					Trans:   byCoin[coin],
+				},
+				Balance: ofxBalance{
+					BalAmt: Amount{Coin: coin, Value: balances[coin]}.Decimal(),
+					DtAsOf: now,
+				},
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(ofxHeader)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := o.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,213 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet/export"
+)
+
+func testEntries() []*export.Entry {
+	received := &export.Entry{
+		Time:           time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+		BlockOrder:     100,
+		Mined:          true,
+		TxId:           "aa",
+		Counterparties: []string{"TmFrom"},
+		Amounts:        []export.Amount{{Coin: "MEER", Value: 150000000}},
+		Confirmations:  20,
+	}
+	sent := &export.Entry{
+		Time:           time.Date(2020, 5, 2, 12, 0, 0, 0, time.UTC),
+		TxId:           "bb",
+		Counterparties: []string{"TmTo1", "TmTo2"},
+		Amounts: []export.Amount{
+			{Coin: "MEER", Value: -50010000},
+			{Coin: "QIT", Value: -7},
+		},
+		Fee:  &export.Amount{Coin: "MEER", Value: 10000},
+		Memo: "rent, May",
+	}
+	for _, e := range []*export.Entry{received, sent} {
+		e.SetDirection()
+	}
+	return []*export.Entry{received, sent}
+}
+
+func write(t *testing.T, format export.Format, entries []*export.Entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := export.NewWriter(&buf, format, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		s    string
+		want export.Format
+	}{
+		{"csv", export.FormatCSV},
+		{"JSON", export.FormatJSON},
+		{"jsonl", export.FormatJSON},
+		{"ofx", export.FormatOFX},
+	}
+	for _, test := range tests {
+		if got, err := export.ParseFormat(test.s); err != nil || got != test.want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", test.s, got, err, test.want)
+		}
+	}
+	if _, err := export.ParseFormat("xls"); err == nil {
+		t.Error("ParseFormat accepted xls")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	from, to, err := export.ParseRange("2020-05-01", "2020-05-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("from %v", from)
+	}
+	// A date includes the whole day.
+	if end := time.Date(2020, 5, 2, 23, 59, 59, 0, time.UTC); to.Before(end) {
+		t.Errorf("to %v before %v", to, end)
+	}
+	from, to, err = export.ParseRange("", "2020-05-02T10:00:00+02:00")
+	if err != nil || !from.IsZero() || !to.Equal(time.Date(2020, 5, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("open range %v %v %v", from, to, err)
+	}
+	if _, _, err := export.ParseRange("2020-05-02", "2020-05-01"); err == nil {
+		t.Error("reversed range accepted")
+	}
+	if _, _, err := export.ParseRange("yesterday", ""); err == nil {
+		t.Error("invalid time accepted")
+	}
+}
+
+func TestAmountDecimal(t *testing.T) {
+	tests := []struct {
+		value int64
+		want  string
+	}{
+		{0, "0.00000000"},
+		{1, "0.00000001"},
+		{150000000, "1.50000000"},
+		{-50010000, "-0.50010000"},
+	}
+	for _, test := range tests {
+		if got := (export.Amount{Value: test.value}).Decimal(); got != test.want {
+			t.Errorf("Decimal(%d) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(write(t, export.FormatCSV, testEntries()))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"timestamp", "block_order", "txid", "direction", "counterparties", "coin", "amount", "fee", "confirmations", "memo"},
+		{"2020-05-01T12:00:00Z", "100", "aa", "in", "TmFrom", "MEER", "1.50000000", "", "20", ""},
+		{"2020-05-02T12:00:00Z", "", "bb", "out", "TmTo1 TmTo2", "MEER", "-0.50010000", "0.00010000", "0", "rent, May"},
+		{"2020-05-02T12:00:00Z", "", "bb", "out", "TmTo1 TmTo2", "QIT", "-0.00000007", "", "0", "rent, May"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("%d records, want %d: %v", len(records), len(want), records)
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d: %v, want %v", i, records[i], want[i])
+		}
+	}
+
+	// An empty ledger still has its header.
+	if got := string(write(t, export.FormatCSV, nil)); !strings.HasPrefix(got, "timestamp,") {
+		t.Errorf("empty CSV %q", got)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	out := write(t, export.FormatJSON, testEntries())
+	var lines []map[string]interface{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %v", s.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("%d lines, want 2", len(lines))
+	}
+	if lines[0]["block_order"] != float64(100) || lines[0]["direction"] != "in" {
+		t.Errorf("received line %v", lines[0])
+	}
+	if lines[1]["block_order"] != nil || lines[1]["direction"] != "out" {
+		t.Errorf("sent line %v", lines[1])
+	}
+	if fee, _ := lines[1]["fee"].(map[string]interface{}); fee["amount"] != "0.00010000" {
+		t.Errorf("fee %v", lines[1]["fee"])
+	}
+	if amounts, _ := lines[1]["amounts"].([]interface{}); len(amounts) != 2 {
+		t.Errorf("amounts %v", lines[1]["amounts"])
+	}
+}
+
+func TestOFX(t *testing.T) {
+	out := write(t, export.FormatOFX, testEntries())
+	if !bytes.Contains(out, []byte(`<?OFX OFXHEADER="200" VERSION="220"`)) {
+		t.Fatalf("missing OFX header:\n%s", out)
+	}
+	var doc struct {
+		Stmts []struct {
+			CurDef string `xml:"STMTRS>CURDEF"`
+			AcctID string `xml:"STMTRS>BANKACCTFROM>ACCTID"`
+			Trans  []struct {
+				TrnType string `xml:"TRNTYPE"`
+				TrnAmt  string `xml:"TRNAMT"`
+				FitID   string `xml:"FITID"`
+				Memo    string `xml:"MEMO"`
+			} `xml:"STMTRS>BANKTRANLIST>STMTTRN"`
+			Balance string `xml:"STMTRS>LEDGERBAL>BALAMT"`
+		} `xml:"BANKMSGSRSV1>STMTTRNRS"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Stmts) != 2 {
+		t.Fatalf("%d statements, want 2:\n%s", len(doc.Stmts), out)
+	}
+	meer, qit := doc.Stmts[0], doc.Stmts[1]
+	if meer.CurDef != "MEER" || qit.CurDef != "QIT" || meer.AcctID != "default" {
+		t.Fatalf("statements %+v", doc.Stmts)
+	}
+	if len(meer.Trans) != 2 || meer.Trans[0].TrnType != "CREDIT" || meer.Trans[1].TrnType != "DEBIT" {
+		t.Fatalf("MEER transactions %+v", meer.Trans)
+	}
+	if meer.Trans[1].FitID != "bb-MEER" || !strings.Contains(meer.Trans[1].Memo, "fee 0.00010000") {
+		t.Errorf("MEER debit %+v", meer.Trans[1])
+	}
+	if meer.Balance != "0.99990000" || qit.Balance != "-0.00000007" {
+		t.Errorf("balances %s %s", meer.Balance, qit.Balance)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -213,7 +214,61 @@ func (cfg *httpConfig) getBlockHashByOrder(i int64) (*hash.Hash, error) {
 	}
 	return blockHash, nil
 }
-func (cfg *httpConfig) isBlue(blockHash string) (bool, error) {
+
+// GetBlockCount returns the number of blocks on the node.
+func (cfg *httpConfig) GetBlockCount() (uint64, error) {
+	blockCount, err := cfg.getblockCount()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(blockCount, strIntBase, strIntBitSize32)
+}
+
+// GetBlockByOrder returns the block at order with its transactions.
+func (cfg *httpConfig) GetBlockByOrder(order int64) (*clijson.BlockHttpResult, error) {
+	buf, err := cfg.getBlockByOrder(order)
+	if err != nil {
+		return nil, err
+	}
+	block := &clijson.BlockHttpResult{}
+	if err := json.Unmarshal(buf, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// GetRawTransaction returns the verbose form of the transaction txId.
+func (cfg *httpConfig) GetRawTransaction(txId string) (*qJson.TxRawResult, error) {
+	params := []interface{}{txId, true}
+	buf, err := cfg.getResByte("getRawTransaction", params)
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code == rpcErrNoTxInfo {
+			return nil, ErrTxNotFound
+		}
+		return nil, err
+	}
+	tx := &qJson.TxRawResult{}
+	if err := json.Unmarshal(buf, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// IsUnspent asks the node for the output, getUtxo returns null for spent
+// and unknown outputs.
+func (cfg *httpConfig) IsUnspent(txId string, index uint32) (bool, error) {
+	params := []interface{}{txId, index, true}
+	buf, err := cfg.getResByte("getUtxo", params)
+	if err != nil {
+		return false, err
+	}
+	res := strings.TrimSpace(string(buf))
+	return res != "" && res != "null", nil
+}
+
+// IsBlue reports whether the block blockHash is blue.
+func (cfg *httpConfig) IsBlue(blockHash string) (bool, error) {
 	params := []interface{}{blockHash}
 	isBlue, err := cfg.getResString("isBlue", params)
 	if err == nil {
@@ -322,7 +377,7 @@ func (cfg *httpConfig) sendPostRequest(marshalledJSON []byte) ([]byte, error) {
 	}
 
 	if resp.Error != nil {
-		return nil, fmt.Errorf("sendPostRequest: resp.Error: %s", respBytes)
+		return nil, fmt.Errorf("sendPostRequest: resp.Error: %w", resp.Error)
 		//return nil, fmt.Errorf("sendPostRequest: resp.Error: %s,sendData: %s", respBytes, string(marshalledJSON))
 	}
 	return resp.Result, nil
@@ -338,6 +393,9 @@ type Response struct {
 // A specific type is used to help ensure the wrong errors aren't used.
 type RPCErrorCode int
 
+// rpcErrNoTxInfo is returned by the node for unknown transactions.
+const rpcErrNoTxInfo RPCErrorCode = -5
+
 // RPCError represents an error that is used as a part of a JSON-RPC Response
 // object.
 type RPCError struct {
@@ -0,0 +1,138 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/log"
+)
+
+// ErrKeyPoolSize is returned by RefillKeyPool for a size beyond
+// MaxKeyPoolSize.
+var ErrKeyPoolSize = errors.New("key pool size is too large")
+
+// KeyPoolSize returns the configured number of unused addresses derived ahead
+// on each branch of an account.
+func KeyPoolSize() uint32 {
+	if config.Cfg == nil || config.Cfg.KeyPoolSize == 0 {
+		return config.DefaultKeyPoolSize
+	}
+	return config.Cfg.KeyPoolSize
+}
+
+// MaxKeyPoolSize returns the configured largest key pool size a refill may
+// ask for.
+func MaxKeyPoolSize() uint32 {
+	if config.Cfg == nil || config.Cfg.MaxKeyPoolSize == 0 {
+		return config.DefaultMaxKeyPoolSize
+	}
+	return config.Cfg.MaxKeyPoolSize
+}
+
+// RefillKeyPool derives the key pools of the accounts of the default scope up
+// to size unused addresses per branch, and registers the new pool addresses
+// with the node when the wallet is connected.  The pool is derived from the
+// account public keys, so it can be refilled while the wallet is locked.
+// Sizes beyond MaxKeyPoolSize fail with ErrKeyPoolSize, the whole refill
+// holds the database write lock.
+func (w *Wallet) RefillKeyPool(size uint32) error {
+	if maxSize := MaxKeyPoolSize(); size > maxSize {
+		return fmt.Errorf("%w: %d, the maximum is %d", ErrKeyPoolSize, size, maxSize)
+	}
+	pooled, err := w.refillKeyPool(size)
+	if err != nil {
+		return err
+	}
+	return w.notifyAddrs(pooled)
+}
+
+// refillKeyPool derives the key pools of the accounts of the default scope up
+// to size unused addresses per branch and returns the new pool addresses.
+func (w *Wallet) refillKeyPool(size uint32) ([]waddrmgr.ManagedAddress, error) {
+	manager, err := w.Manager.FetchScopedKeyManager(w.Manager.DefaultScope())
+	if err != nil {
+		return nil, err
+	}
+
+	var pooled []waddrmgr.ManagedAddress
+	err = walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		lastAcct, err := manager.LastAccount(addrMgrNs)
+		if err != nil {
+			return err
+		}
+		for account := uint32(0); account <= lastAcct; account++ {
+			addrs, err := manager.FillKeyPool(addrMgrNs, account, size)
+			if err != nil {
+				return err
+			}
+			pooled = append(pooled, addrs...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pooled) > 0 {
+		log.Info("Key pool refilled", "size", size, "new addresses", len(pooled))
+	}
+	return pooled, nil
+}
+
+// notifyAddrs registers both forms of the given addresses with the node when
+// the wallet is connected, so payments to them are seen as soon as they are
+// handed out.
+func (w *Wallet) notifyAddrs(maddrs []waddrmgr.ManagedAddress) error {
+	if len(maddrs) == 0 || w.notificationRpc == nil {
+		return nil
+	}
+	addrs := make([]string, 0, 2*len(maddrs))
+	for _, ma := range maddrs {
+		pka, ok := ma.(waddrmgr.ManagedPubKeyAddress)
+		if !ok {
+			continue
+		}
+		pkh, pk, err := w.keyAddresses(pka)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, pkh.Encode(), pk.Encode())
+	}
+	return w.notifyTxByAddr(addrs)
+}
+
+// keyPoolAddresses returns both forms of the addresses in the key pools of the
+// accounts of the default scope.
+func (w *Wallet) keyPoolAddresses(addrNs walletdb.ReadBucket) ([]string, error) {
+	manager, err := w.Manager.FetchScopedKeyManager(w.Manager.DefaultScope())
+	if err != nil {
+		return nil, err
+	}
+	lastAcct, err := manager.LastAccount(addrNs)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for account := uint32(0); account <= lastAcct; account++ {
+		err := manager.ForEachKeyPoolAddress(addrNs, account, func(ma waddrmgr.ManagedAddress) error {
+			pka, ok := ma.(waddrmgr.ManagedPubKeyAddress)
+			if !ok {
+				return nil
+			}
+			pkh, pk, err := w.keyAddresses(pka)
+			if err != nil {
+				return err
+			}
+			addrs = append(addrs, pkh.Encode(), pk.Encode())
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,21 @@
+package wallet_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+)
+
+func TestRefillKeyPoolMax(t *testing.T) {
+	h := newHarness(t)
+	config.Cfg.MaxKeyPoolSize = 10
+
+	if err := h.w.RefillKeyPool(11); !errors.Is(err, wallet.ErrKeyPoolSize) {
+		t.Fatalf("refill beyond the maximum: got %v, want %v", err, wallet.ErrKeyPoolSize)
+	}
+	if err := h.w.RefillKeyPool(10); err != nil {
+		t.Fatalf("refill to the maximum: %v", err)
+	}
+}
@@ -4,22 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/snacl"
 	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
 	"github.com/Qitmeer/qitmeer-wallet/walletdb"
 	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/bdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/ldb"
 	"github.com/Qitmeer/qng/log"
 	chaincfg "github.com/Qitmeer/qng/params"
 )
 
-const (
-	walletDbName = "wallet.db"
-)
-
 var (
 	// ErrLoaded describes the error condition of attempting to load or
 	// create a wallet when the loader has already done so.
@@ -67,6 +64,61 @@ func fileExists(filePath string) (bool, error) {
 	return true, nil
 }
 
+// dbType returns the walletdb driver of the wallet database.
+func (l *Loader) dbType() string {
+	if l.Cfg != nil && l.Cfg.DbType != "" {
+		return l.Cfg.DbType
+	}
+	return config.Cfg.WalletDbType()
+}
+
+// keyScope returns the key scope of new wallets, set by the loader config or
+// else by the global one.
+func (l *Loader) keyScope() waddrmgr.KeyScope {
+	if l.Cfg != nil && l.Cfg.HDPurpose != 0 {
+		return ConfigKeyScope(l.Cfg)
+	}
+	return ConfigKeyScope(config.Cfg)
+}
+
+// kdf returns the key derivation function and costs of new wallets, set by
+// the loader config when it names a function and by the global config
+// otherwise.
+func (l *Loader) kdf() (*snacl.KDFParams, error) {
+	if l.Cfg != nil && l.Cfg.KDF != "" {
+		return ConfigKDF(l.Cfg)
+	}
+	return ConfigKDF(config.Cfg)
+}
+
+// dbPath returns the path of the wallet database.  It fails when the wallet
+// database only exists stored with another driver, so that a new wallet is
+// not created next to it.
+func (l *Loader) dbPath() (string, error) {
+	dbType := l.dbType()
+	dbPath, err := config.WalletDbPath(l.dbDirPath, dbType)
+	if err != nil {
+		return "", err
+	}
+	if exists, err := fileExists(dbPath); err != nil || exists {
+		return dbPath, err
+	}
+	for _, other := range config.DbTypes {
+		if other == dbType {
+			continue
+		}
+		otherPath, err := config.WalletDbPath(l.dbDirPath, other)
+		if err != nil {
+			return "", err
+		}
+		if exists, _ := fileExists(otherPath); exists {
+			return "", fmt.Errorf("wallet database %s is stored with dbtype "+
+				"%s, set dbtype to %s or run migratedb", otherPath, other, other)
+		}
+	}
+	return dbPath, nil
+}
+
 // onLoaded executes each added callback and prevents loader from loading any
 // additional wallets.  Requires mutex to be locked.
 func (l *Loader) onLoaded(w *Wallet, db walletdb.DB) {
@@ -102,15 +154,17 @@ func (l *Loader) OpenWallet() (*Wallet, error) {
 	if b {
 		return l.OpenExistingWallet(nil, false)
 	} else {
-		return l.CreateNewWallet(nil, nil, nil, time.Now())
+		return l.CreateNewWallet(nil, nil, nil, nil, time.Now())
 	}
 }
 
 // CreateNewWallet creates a new wallet using the provided public and private
 // passphrases.  The seed is optional.  If non-nil, addresses are derived from
-// this seed.  If nil, a secure random seed is generated.
-func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed []byte,
-	bday time.Time) (*Wallet, error) {
+// this seed.  If nil, a secure random seed is generated.  mnemonicEntropy is
+// the BIP39 entropy of the mnemonic the seed was derived from, nil when it was
+// not derived from a mnemonic.
+func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed,
+	mnemonicEntropy []byte, bday time.Time) (*Wallet, error) {
 
 	defer l.mu.Unlock()
 	l.mu.Lock()
@@ -119,7 +173,10 @@ func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed []byte,
 		return nil, ErrLoaded
 	}
 
-	dbPath := filepath.Join(l.dbDirPath, walletDbName)
+	dbPath, err := l.dbPath()
+	if err != nil {
+		return nil, err
+	}
 	exists, err := fileExists(dbPath)
 	if err != nil {
 		return nil, err
@@ -128,19 +185,27 @@ func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed []byte,
 		return nil, ErrExists
 	}
 
-	// Create the wallet database backed by bolt db.
+	// Settle the key derivation costs first, tuning them takes a while
+	// and may fail on a bad config.
+	kdf, err := l.kdf()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the wallet database with the configured driver.
 	err = os.MkdirAll(l.dbDirPath, 0700)
 	if err != nil {
 		return nil, err
 	}
-	db, err := walletdb.Create("bdb", dbPath)
+	db, err := walletdb.Create(l.dbType(), dbPath)
 	if err != nil {
 		return nil, err
 	}
 
 	// Initialize the newly created database for the wallet before opening.
 	err = Create(
-		db, pubPassphrase, privPassphrase, seed, l.chainParams, bday,
+		db, pubPassphrase, privPassphrase, seed, mnemonicEntropy,
+		l.chainParams, l.keyScope(), kdf, bday,
 	)
 	if err != nil {
 		return nil, err
@@ -152,6 +217,7 @@ func (l *Loader) CreateNewWallet(pubPassphrase, privPassphrase, seed []byte,
 		return nil, err
 	}
 	//w.Start()
+	w.dbPath = dbPath
 
 	l.onLoaded(w, db)
 	return w, nil
@@ -180,11 +246,14 @@ func (l *Loader) OpenExistingWallet(pubPassphrase []byte, canConsolePrompt bool)
 		return nil, err
 	}
 
-	// Open the database using the boltdb backend.
-	dbPath := filepath.Join(l.dbDirPath, walletDbName)
+	// Open the database using the configured driver.
+	dbPath, err := l.dbPath()
+	if err != nil {
+		return nil, err
+	}
 	log.Trace("OpenExistingWallet", "dbPath", dbPath)
 
-	db, err := walletdb.Open("bdb", dbPath)
+	db, err := walletdb.Open(l.dbType(), dbPath)
 	if err != nil {
 		log.Trace("Failed to open database", "err", err)
 		return nil, err
@@ -222,6 +291,7 @@ func (l *Loader) OpenExistingWallet(pubPassphrase []byte, canConsolePrompt bool)
 		log.Error(fmt.Sprintf("wallet start, NewHtpc err: %s", err))
 		return nil, err
 	}
+	w.dbPath = dbPath
 
 	l.onLoaded(w, db)
 	return w, nil
@@ -230,7 +300,10 @@ func (l *Loader) OpenExistingWallet(pubPassphrase []byte, canConsolePrompt bool)
 // WalletExists returns whether a file exists at the loader's database path.
 // This may return an error for unexpected I/O failures.
 func (l *Loader) WalletExists() (bool, error) {
-	dbPath := filepath.Join(l.dbDirPath, walletDbName)
+	dbPath, err := l.dbPath()
+	if err != nil {
+		return false, err
+	}
 	return fileExists(dbPath)
 }
 
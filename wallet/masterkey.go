@@ -0,0 +1,246 @@
+package wallet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/types"
+	"github.com/Qitmeer/qng/crypto/bip32"
+	"github.com/Qitmeer/qng/crypto/ecc/secp256k1"
+	"github.com/Qitmeer/qng/log"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/internal/zero"
+	"github.com/Qitmeer/qitmeer-wallet/utils"
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
+)
+
+// ImportedMasterKey returns the address of the master private key which
+// wallets created by older versions imported next to their HD keys, or nil
+// when the wallet does not hold it.
+func (w *Wallet) ImportedMasterKey() (types.Address, error) {
+	var imported types.Address
+	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		addrMgrNs := tx.ReadBucket(waddrmgrNamespaceKey)
+		addr, err := w.Manager.MasterKeyAddress(addrMgrNs)
+		if waddrmgr.IsError(err, waddrmgr.ErrNoExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ma, err := w.Manager.Address(addrMgrNs, addr)
+		if waddrmgr.IsError(err, waddrmgr.ErrAddressNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ma.Imported() {
+			imported = addr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// warnImportedMasterKey warns when the wallet holds the imported master
+// private key, whose address exposes master key material.
+func (w *Wallet) warnImportedMasterKey() {
+	addr, err := w.ImportedMasterKey()
+	if err != nil {
+		log.Error("Failed to look up the imported master key", "err", err)
+		return
+	}
+	if addr == nil {
+		return
+	}
+	log.Warn("The wallet holds the imported master private key, stop "+
+		"using its address and move its funds to the default account "+
+		"with sweepmasterkey", "address", addr.Encode())
+}
+
+// masterKeyWIF returns the master private key of the wallet seed, the key
+// older versions imported.  The wallet must be unlocked.
+func (w *Wallet) masterKeyWIF() (*utils.WIF, error) {
+	var seed []byte
+	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		var err error
+		seed, err = w.Manager.Seed(tx.ReadBucket(waddrmgrNamespaceKey))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer zero.Bytes(seed)
+
+	masterKey, err := bip32.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	defer zero.Bytes(masterKey.Key)
+	pri, _ := secp256k1.PrivKeyFromBytes(masterKey.Key)
+	return utils.NewWIF(pri, w.chainParams, true)
+}
+
+// ImportMasterKey imports the master private key of the wallet seed, as
+// older versions did, so that the funds of its address are synced and can be
+// swept.  Wallets recovered from the seed or mnemonic of such a wallet do not
+// hold it otherwise.  It returns the address of the key.  The wallet must be
+// unlocked.
+func (w *Wallet) ImportMasterKey() (types.Address, error) {
+	addr, err := w.ImportedMasterKey()
+	if err != nil || addr != nil {
+		return addr, err
+	}
+	wif, err := w.masterKeyWIF()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.ImportPrivateKey(w.Manager.DefaultScope(), wif); err != nil {
+		return nil, err
+	}
+	return w.ImportedMasterKey()
+}
+
+// SweepMasterKey sends all the unspent outputs of both forms of the master
+// key address, for each coin, to the first unused receive address of the
+// default account.  The fee is taken from the swept amount.  When the wallet
+// does not hold the imported master key, e.g. after recovering a wallet of
+// an older version from its mnemonic, the key is imported and its addresses
+// are rescanned from the first block before the sweep.  It returns the ids
+// of the sent transactions, none when there was nothing to sweep.  The
+// wallet must be unlocked.
+func (w *Wallet) SweepMasterKey() ([]string, error) {
+	addr, err := w.ImportedMasterKey()
+	if err != nil {
+		return nil, err
+	}
+	imported := addr == nil
+	if imported {
+		if addr, err = w.ImportMasterKey(); err != nil {
+			return nil, err
+		}
+		log.Info("Imported the master key to sweep it", "address", addr.Encode())
+	}
+
+	var froms []types.Address
+	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		addrMgrNs := tx.ReadBucket(waddrmgrNamespaceKey)
+		ma, err := w.Manager.Address(addrMgrNs, addr)
+		if err != nil {
+			return err
+		}
+		pka, ok := ma.(waddrmgr.ManagedPubKeyAddress)
+		if !ok {
+			return fmt.Errorf("address %s is not a key type", addr.Encode())
+		}
+		pkh, pk, err := w.keyAddresses(pka)
+		if err != nil {
+			return err
+		}
+		froms = []types.Address{pkh, pk}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if imported {
+		// The funds of the new key are only known after a rescan.
+		addrs := []string{froms[0].Encode(), froms[1].Encode()}
+		if err := w.rescanAddressesWait(addrs, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	to, err := w.UnusedAddress(w.Manager.DefaultScope(), waddrmgr.DefaultAccountNum)
+	if err != nil {
+		return nil, err
+	}
+
+	var txIds []string
+	for _, token := range w.tokens.tokens {
+		for _, from := range froms {
+			txId, err := w.sweepAddress(from, to, types.CoinID(token.CoinId))
+			if err != nil {
+				return txIds, err
+			}
+			if txId != "" {
+				log.Info("Swept the imported master key", "from", from.Encode(),
+					"to", to.Encode(), "coin", token.CoinName, "tx", txId)
+				txIds = append(txIds, txId)
+			}
+		}
+	}
+	return txIds, nil
+}
+
+// sweepAddress sends all the unspent outputs of coin of from to to, less the
+// fee, in a transaction without change.  It returns the id of the sent
+// transaction, or an empty one when from has no unspent outputs.
+func (w *Wallet) sweepAddress(from, to types.Address, coin types.CoinID) (string, error) {
+	syncSendOutputs.Lock()
+	defer syncSendOutputs.Unlock()
+
+	utxos, err := w.GetUnspentAddrOutput(from.Encode(), coin)
+	if err != nil {
+		return "", err
+	}
+	total := types.Amount{Id: coin}
+	for _, utxo := range utxos {
+		total.Value += utxo.Amount.Value
+	}
+	if total.Value == 0 {
+		return "", nil
+	}
+
+	satPerKb := config.Cfg.MinTxFee
+	addrs := []types.Address{from}
+
+	// Size the transaction spending everything, the one paying the fee
+	// has the same inputs and output.
+	outputs, _, err := makeOutputs(map[string]types.Amount{to.Encode(): total}, 0)
+	if err != nil {
+		return "", err
+	}
+	signedRaw, _, _, err := w.createTx(addrs, outputs, coin, 0, satPerKb)
+	if err != nil {
+		return "", err
+	}
+	fees := w.fees(signedRaw, coin)
+	if fees >= total.Value {
+		return "", fmt.Errorf("the %v of %s do not cover the fee of %d",
+			total, from.Encode(), fees)
+	}
+	outputs, _, err = makeOutputs(map[string]types.Amount{
+		to.Encode(): {Value: total.Value - fees, Id: coin},
+	}, 0)
+	if err != nil {
+		return "", err
+	}
+	signedRaw, _, spent, err := w.createTx(addrs, outputs, coin, fees, satPerKb)
+	if err != nil {
+		return "", err
+	}
+
+	msg, err := w.HttpClient.SendRawTransaction(signedRaw, false)
+	if err != nil {
+		return "", err
+	}
+	msg = strings.ReplaceAll(msg, "\"", "")
+	txId, err := hash.NewHashFromStr(msg)
+	if err != nil {
+		return "", err
+	}
+	err = w.updateUTXOSpent(spent, &wtxmgr.SpendTo{TxId: *txId})
+	if err != nil {
+		return "", err
+	}
+	return msg, nil
+}
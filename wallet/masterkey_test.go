@@ -0,0 +1,79 @@
+package wallet_test
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/address"
+	"github.com/Qitmeer/qng/crypto/bip32"
+	"github.com/Qitmeer/qng/crypto/ecc"
+	"github.com/Qitmeer/qng/crypto/ecc/secp256k1"
+	chaincfg "github.com/Qitmeer/qng/params"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet/mocknode"
+)
+
+// masterKeyAddr returns the address of the master key of testSeed, the
+// address older versions funded.
+func masterKeyAddr(t *testing.T) string {
+	t.Helper()
+	masterKey, err := bip32.NewMasterKey(testSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pub := secp256k1.PrivKeyFromBytes(masterKey.Key)
+	addr, err := address.NewPubKeyHashAddress(hash.Hash160(pub.SerializeCompressed()),
+		&chaincfg.TestNetParams, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr.String()
+}
+
+func TestSweepMasterKeyNotImported(t *testing.T) {
+	h := newHarness(t)
+	masterAddr := masterKeyAddr(t)
+	funding := h.node.NewTx(nil, mocknode.Output{Address: masterAddr, Amount: 5e8, Coin: coin})
+	h.node.AcceptTx(funding)
+	h.mine(2)
+	h.sync()
+	defer h.stop()
+
+	if addr, err := h.w.ImportedMasterKey(); err != nil || addr != nil {
+		t.Fatalf("imported master key %v %v, want none", addr, err)
+	}
+	if _, err := h.w.SweepMasterKey(); err == nil {
+		t.Fatalf("swept while locked")
+	}
+	if err := h.w.UnLockManager(privPass); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key of a recovered wallet is imported, rescanned and swept.
+	txIds, err := h.w.SweepMasterKey()
+	if err != nil {
+		t.Fatalf("SweepMasterKey: %v", err)
+	}
+	if len(txIds) != 1 {
+		t.Fatalf("sent %v, want one sweep", txIds)
+	}
+	if addr, err := h.w.ImportedMasterKey(); err != nil || addr == nil || addr.String() != masterAddr {
+		t.Fatalf("imported master key %v %v, want %s", addr, err, masterAddr)
+	}
+	sent, ok := h.node.Tx(txIds[0])
+	if !ok {
+		t.Fatalf("sweep %s unknown to the node", txIds[0])
+	}
+	if len(sent.Inputs) != 1 || sent.Inputs[0] != (mocknode.Input{TxId: funding.TxId}) {
+		t.Fatalf("sweep spends %v, want the master key funding", sent.Inputs)
+	}
+	if len(sent.Outputs) != 1 || sent.Outputs[0].Address == masterAddr ||
+		sent.Outputs[0].Amount == 0 || sent.Outputs[0].Amount >= 5e8 {
+		t.Fatalf("sweep pays %+v, want the funds less the fee to the wallet", sent.Outputs)
+	}
+
+	// Nothing is left to sweep.
+	if txIds, err := h.w.SweepMasterKey(); err != nil || len(txIds) != 0 {
+		t.Fatalf("second sweep sent %v %v, want nothing", txIds, err)
+	}
+}
@@ -0,0 +1,75 @@
+package wallet
+
+import (
+	"github.com/Qitmeer/qng/crypto/bip39"
+
+	"github.com/Qitmeer/qitmeer-wallet/internal/zero"
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+// Mnemonic returns the BIP39 mnemonic the wallet was created from.  The
+// mnemonic passphrase, if one was used, is not stored and is needed with it
+// to recover the wallet.  Only wallets created from a mnemonic have one, and
+// the wallet must be unlocked.
+func (w *Wallet) Mnemonic() (string, error) {
+	var entropy []byte
+	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		var err error
+		entropy, err = w.Manager.MnemonicEntropy(tx.ReadBucket(waddrmgrNamespaceKey))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer zero.Bytes(entropy)
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// VerifyMnemonic reports whether mnemonic, with the mnemonic passphrase,
+// recovers the wallet.  The extended public keys of the accounts of the
+// default scope derived from it are compared with those of the wallet, so
+// it works on locked wallets and on wallets which do not store their
+// mnemonic.
+func (w *Wallet) VerifyMnemonic(mnemonic, passphrase string) (bool, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return false, err
+	}
+	defer zero.Bytes(seed)
+
+	scope := w.Manager.DefaultScope()
+	manager, err := w.Manager.FetchScopedKeyManager(scope)
+	if err != nil {
+		return false, err
+	}
+
+	match := true
+	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		addrMgrNs := tx.ReadBucket(waddrmgrNamespaceKey)
+		lastAccount, err := manager.LastAccount(addrMgrNs)
+		if err != nil {
+			return err
+		}
+		for account := uint32(0); account <= lastAccount; account++ {
+			acctKey, err := manager.AccountPubKey(addrMgrNs, account)
+			if err != nil {
+				return err
+			}
+			derived, err := waddrmgr.DeriveAccountPubKey(seed, scope, account)
+			if err != nil {
+				return err
+			}
+			if derived.String() != acctKey.String() {
+				match = false
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return match, nil
+}
@@ -0,0 +1,59 @@
+package wallet_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Qitmeer/qng/crypto/bip39"
+)
+
+func TestVerifyMnemonic(t *testing.T) {
+	entropy := bytes.Repeat([]byte{0x07}, 16)
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := bip39.NewMnemonic(bytes.Repeat([]byte{0x08}, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHarnessSeed(t, seed, entropy)
+
+	tests := []struct {
+		name       string
+		mnemonic   string
+		passphrase string
+		want       bool
+	}{
+		{"wallet mnemonic", mnemonic, "", true},
+		{"wrong passphrase", mnemonic, "passphrase", false},
+		{"other mnemonic", other, "", false},
+	}
+	for _, test := range tests {
+		got, err := h.w.VerifyMnemonic(test.mnemonic, test.passphrase)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+	if _, err := h.w.VerifyMnemonic("not a mnemonic", ""); err == nil {
+		t.Errorf("invalid mnemonic verified without error")
+	}
+
+	// Verifying works on the locked wallet, showing the mnemonic does not.
+	if _, err := h.w.Mnemonic(); err == nil {
+		t.Fatalf("mnemonic shown by a locked wallet")
+	}
+	if err := h.w.UnLockManager(privPass); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := h.w.Mnemonic(); err != nil || got != mnemonic {
+		t.Fatalf("mnemonic %q %v, want %q", got, err, mnemonic)
+	}
+}
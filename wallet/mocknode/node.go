@@ -0,0 +1,637 @@
+// Package mocknode provides an in-memory qitmeer node implementing
+// wallet.ChainBackend, so wallet sync can be exercised without a network.
+//
+// The node keeps a linear block order.  Transactions built by tests are
+// described by their inputs and outputs instead of being serialized, raw
+// transactions passed to SendRawTransaction are decoded into the same form.
+// The node tracks which outputs are spent and rejects double spends of raw
+// transactions.
+package mocknode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/address"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+	"github.com/Qitmeer/qng/engine/txscript"
+	chaincfg "github.com/Qitmeer/qng/params"
+	"github.com/Qitmeer/qng/rpc/client"
+	"github.com/Qitmeer/qng/rpc/client/cmds"
+
+	clijson "github.com/Qitmeer/qitmeer-wallet/json"
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+)
+
+// Output is a transaction output paying Amount of Coin to Address.
+type Output struct {
+	Address string
+	Amount  uint64
+	Coin    types.CoinID
+
+	// PkScript is the script of decoded outputs, when nil the output pays
+	// to Address.
+	PkScript []byte
+}
+
+// Input spends output Index of transaction TxId.
+type Input struct {
+	TxId  string
+	Index uint32
+}
+
+// Tx is a transaction known to the node.
+type Tx struct {
+	TxId     string
+	Inputs   []Input
+	Outputs  []Output
+	Coinbase bool
+
+	// Raw holds the hex of transactions received by SendRawTransaction.
+	Raw string
+	// Msg is the decoded form of Raw.
+	Msg *types.Transaction
+
+	block *Block
+}
+
+// Block is a block known to the node.
+type Block struct {
+	Hash      hash.Hash
+	Order     uint32
+	Timestamp time.Time
+	IsBlue    bool
+	Txsvalid  bool
+	Txs       []*Tx
+}
+
+// Node is an in-memory node.  All methods are safe for concurrent use,
+// notifications are delivered synchronously by the goroutine changing the
+// node state, after the node lock was released.
+type Node struct {
+	params *chaincfg.Params
+
+	mu        sync.Mutex
+	blocks    []*Block
+	txs       map[string]*Tx
+	spent     map[Input]string
+	mempool   []*Tx
+	tokens    []corejson.TokenState
+	notifiers map[*notifier]struct{}
+	nonce     uint64
+}
+
+var _ wallet.ChainBackend = (*Node)(nil)
+
+// New returns a node of the params network holding only a genesis block.
+func New(params *chaincfg.Params) *Node {
+	n := &Node{
+		params:    params,
+		txs:       make(map[string]*Tx),
+		spent:     make(map[Input]string),
+		notifiers: make(map[*notifier]struct{}),
+	}
+	n.blocks = append(n.blocks, n.newBlock(nil))
+	return n
+}
+
+func (n *Node) nextHash() hash.Hash {
+	n.nonce++
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n.nonce)
+	return hash.Hash(sha256.Sum256(buf[:]))
+}
+
+func (n *Node) newBlock(txs []*Tx) *Block {
+	b := &Block{
+		Hash:      n.nextHash(),
+		Order:     uint32(len(n.blocks)),
+		Timestamp: time.Unix(int64(len(n.blocks)), 0),
+		IsBlue:    true,
+		Txsvalid:  true,
+		Txs:       txs,
+	}
+	for _, tx := range txs {
+		tx.block = b
+	}
+	return b
+}
+
+// NewTx builds a transaction with a fresh txid, it is not yet known to the
+// node, see AcceptTx and MineBlock.
+func (n *Node) NewTx(inputs []Input, outputs ...Output) *Tx {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	h := n.nextHash()
+	return &Tx{TxId: h.String(), Inputs: inputs, Outputs: outputs}
+}
+
+// AcceptTx adds tx to the mempool and notifies it to watchers.  Unlike
+// SendRawTransaction it does not check the inputs, tests may spend outputs
+// the node does not know or spend an output twice.
+func (n *Node) AcceptTx(tx *Tx) {
+	n.mu.Lock()
+	n.addTx(tx)
+	ntfns := n.txNotifications(tx)
+	n.mu.Unlock()
+
+	deliver(ntfns)
+}
+
+// MineBlock connects a block with a coinbase paying coinbase, when not nil,
+// followed by all mempool transactions.
+func (n *Node) MineBlock(coinbase *Output) *Block {
+	n.mu.Lock()
+	var txs []*Tx
+	if coinbase != nil {
+		h := n.nextHash()
+		cb := &Tx{TxId: h.String(), Outputs: []Output{*coinbase}, Coinbase: true}
+		n.txs[cb.TxId] = cb
+		txs = append(txs, cb)
+	}
+	txs = append(txs, n.mempool...)
+	n.mempool = nil
+
+	b := n.newBlock(txs)
+	n.blocks = append(n.blocks, b)
+	ntfns := n.blockNotifications(b)
+	for _, tx := range b.Txs {
+		ntfns = append(ntfns, n.txNotifications(tx)...)
+	}
+	ntfns = append(ntfns, n.confirmNotifications()...)
+	n.mu.Unlock()
+
+	deliver(ntfns)
+	return b
+}
+
+// Reorder disconnects every block from order on and puts their non coinbase
+// transactions back into the mempool, as happens when the DAG reorders and
+// those blocks turn red or get ordered later.  Mine new blocks to continue.
+func (n *Node) Reorder(order uint32) error {
+	n.mu.Lock()
+	if order == 0 || int(order) >= len(n.blocks) {
+		n.mu.Unlock()
+		return fmt.Errorf("cannot reorder from order %d, latest is %d", order, len(n.blocks)-1)
+	}
+	var mempool []*Tx
+	for _, b := range n.blocks[order:] {
+		for _, tx := range b.Txs {
+			tx.block = nil
+			if tx.Coinbase {
+				delete(n.txs, tx.TxId)
+				continue
+			}
+			mempool = append(mempool, tx)
+		}
+	}
+	n.blocks = n.blocks[:order]
+	n.mempool = append(mempool, n.mempool...)
+	ntfns := n.confirmNotifications()
+	n.mu.Unlock()
+
+	deliver(ntfns)
+	return nil
+}
+
+// Drop removes a mempool transaction and releases its inputs, as happens
+// when the node evicts it.
+func (n *Node) Drop(txId string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for i, tx := range n.mempool {
+		if tx.TxId != txId {
+			continue
+		}
+		n.mempool = append(n.mempool[:i], n.mempool[i+1:]...)
+		delete(n.txs, txId)
+		for _, in := range tx.Inputs {
+			if n.spent[in] == txId {
+				delete(n.spent, in)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("transaction %s not in the mempool", txId)
+}
+
+// SetBlockState changes the blue and txsvalid state of the block at order,
+// and notifies confirmation watchers of its transactions.
+func (n *Node) SetBlockState(order uint32, isBlue, txsvalid bool) error {
+	n.mu.Lock()
+	if int(order) >= len(n.blocks) {
+		n.mu.Unlock()
+		return fmt.Errorf("block order %d not found", order)
+	}
+	b := n.blocks[order]
+	b.IsBlue = isBlue
+	b.Txsvalid = txsvalid
+	ntfns := n.confirmNotifications()
+	n.mu.Unlock()
+
+	deliver(ntfns)
+	return nil
+}
+
+// AddToken adds a token returned by GetTokenInfo.
+func (n *Node) AddToken(token corejson.TokenState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.tokens = append(n.tokens, token)
+}
+
+// Mempool returns the transactions waiting to be mined.
+func (n *Node) Mempool() []*Tx {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]*Tx(nil), n.mempool...)
+}
+
+// Tx returns a transaction known to the node.
+func (n *Node) Tx(txId string) (*Tx, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	tx, ok := n.txs[txId]
+	return tx, ok
+}
+
+// Shutdown emits node exit notifications, as the node does when it stops.
+func (n *Node) Shutdown() {
+	n.mu.Lock()
+	var ntfns []func()
+	for nt := range n.notifiers {
+		if h := nt.handlers.OnNodeExit; h != nil {
+			ntfns = append(ntfns, func() { h(&cmds.NodeExitNtfn{}) })
+		}
+	}
+	n.mu.Unlock()
+
+	deliver(ntfns)
+}
+
+// GetBlockCount implements wallet.ChainBackend.
+func (n *Node) GetBlockCount() (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return uint64(len(n.blocks)), nil
+}
+
+// GetBlockByOrder implements wallet.ChainBackend.
+func (n *Node) GetBlockByOrder(order int64) (*clijson.BlockHttpResult, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if order < 0 || order >= int64(len(n.blocks)) {
+		return nil, fmt.Errorf("block order %d not found", order)
+	}
+	b := n.blocks[order]
+	res := &clijson.BlockHttpResult{
+		Hash:          b.Hash.String(),
+		Confirmations: n.confirmations(b),
+		Order:         b.Order,
+		Timestamp:     b.Timestamp,
+		Txsvalid:      b.Txsvalid,
+		IsBlue:        b.IsBlue,
+	}
+	for _, tx := range b.Txs {
+		res.Transactions = append(res.Transactions, n.txRawResult(tx))
+	}
+	return res, nil
+}
+
+// SendRawTransaction implements wallet.ChainBackend.  The transaction is
+// decoded and accepted into the mempool when all its inputs are known and
+// unspent.  Signatures are not checked.
+func (n *Node) SendRawTransaction(tx string, allowHighFees bool) (string, error) {
+	raw, err := hex.DecodeString(tx)
+	if err != nil {
+		return "", err
+	}
+	var msg types.Transaction
+	if err := msg.Deserialize(bytes.NewReader(raw)); err != nil {
+		return "", fmt.Errorf("decode transaction: %w", err)
+	}
+	t := &Tx{TxId: msg.TxHash().String(), Raw: tx, Msg: &msg}
+	for _, in := range msg.TxIn {
+		t.Inputs = append(t.Inputs, Input{TxId: in.PreviousOut.Hash.String(), Index: in.PreviousOut.OutIndex})
+	}
+	for _, out := range msg.TxOut {
+		o := Output{
+			Amount:   uint64(out.Amount.Value),
+			Coin:     out.Amount.Id,
+			PkScript: out.PkScript,
+		}
+		_, addrs, _, err := txscript.ExtractPkScriptAddrs(out.PkScript, n.params)
+		if err == nil && len(addrs) > 0 {
+			o.Address = addrs[0].String()
+		}
+		t.Outputs = append(t.Outputs, o)
+	}
+
+	n.mu.Lock()
+	if err := n.checkTx(t); err != nil {
+		n.mu.Unlock()
+		return "", err
+	}
+	n.addTx(t)
+	ntfns := n.txNotifications(t)
+	n.mu.Unlock()
+
+	deliver(ntfns)
+	return t.TxId, nil
+}
+
+// GetNodeInfo implements wallet.ChainBackend.
+func (n *Node) GetNodeInfo() (*corejson.InfoNodeResult, error) {
+	return &corejson.InfoNodeResult{}, nil
+}
+
+// GetTokenInfo implements wallet.ChainBackend.
+func (n *Node) GetTokenInfo() ([]corejson.TokenState, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]corejson.TokenState(nil), n.tokens...), nil
+}
+
+// GetRawTransaction implements wallet.ChainBackend.
+func (n *Node) GetRawTransaction(txId string) (*corejson.TxRawResult, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	tx, ok := n.txs[txId]
+	if !ok {
+		return nil, wallet.ErrTxNotFound
+	}
+	tr := n.txRawResult(tx)
+	return &tr, nil
+}
+
+// IsUnspent implements wallet.ChainBackend.  Outputs spent in the mempool
+// count as spent.
+func (n *Node) IsUnspent(txId string, index uint32) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	tx, ok := n.txs[txId]
+	if !ok || int(index) >= len(tx.Outputs) {
+		return false, nil
+	}
+	_, spent := n.spent[Input{TxId: txId, Index: index}]
+	return !spent, nil
+}
+
+// SpentBy returns the transaction spending an output, if any.
+func (n *Node) SpentBy(txId string, index uint32) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	by, ok := n.spent[Input{TxId: txId, Index: index}]
+	return by, ok
+}
+
+// IsBlue implements wallet.ChainBackend.
+func (n *Node) IsBlue(blockHash string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, b := range n.blocks {
+		if b.Hash.String() == blockHash {
+			return b.IsBlue, nil
+		}
+	}
+	return false, fmt.Errorf("block %s not found", blockHash)
+}
+
+// Notifications implements wallet.ChainBackend.
+func (n *Node) Notifications(handlers client.NotificationHandlers) (wallet.ChainNotifier, error) {
+	nt := &notifier{
+		node:     n,
+		handlers: handlers,
+		addrs:    make(map[string]struct{}),
+		confirms: make(map[string]struct{}),
+		quit:     make(chan struct{}),
+	}
+	n.mu.Lock()
+	n.notifiers[nt] = struct{}{}
+	n.mu.Unlock()
+	return nt, nil
+}
+
+// addTx adds tx to the mempool and records its spends, it must be called
+// with the node lock held.
+func (n *Node) addTx(tx *Tx) {
+	n.txs[tx.TxId] = tx
+	for _, in := range tx.Inputs {
+		n.spent[in] = tx.TxId
+	}
+	n.mempool = append(n.mempool, tx)
+}
+
+// checkTx verifies tx is new and spends only known, unspent outputs, it must
+// be called with the node lock held.
+func (n *Node) checkTx(tx *Tx) error {
+	if _, ok := n.txs[tx.TxId]; ok {
+		return fmt.Errorf("transaction %s already exists", tx.TxId)
+	}
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("transaction %s has no inputs", tx.TxId)
+	}
+	seen := make(map[Input]struct{}, len(tx.Inputs))
+	for _, in := range tx.Inputs {
+		prev, ok := n.txs[in.TxId]
+		if !ok || int(in.Index) >= len(prev.Outputs) {
+			return fmt.Errorf("transaction %s spends unknown output %s:%d", tx.TxId, in.TxId, in.Index)
+		}
+		if by, ok := n.spent[in]; ok {
+			return fmt.Errorf("transaction %s double spends %s:%d, already spent by %s", tx.TxId, in.TxId, in.Index, by)
+		}
+		if _, ok := seen[in]; ok {
+			return fmt.Errorf("transaction %s spends %s:%d twice", tx.TxId, in.TxId, in.Index)
+		}
+		seen[in] = struct{}{}
+	}
+	return nil
+}
+
+func (n *Node) tip() uint32 {
+	return uint32(len(n.blocks) - 1)
+}
+
+func (n *Node) confirmations(b *Block) uint32 {
+	if b == nil {
+		return 0
+	}
+	return n.tip() - b.Order + 1
+}
+
+// involves reports whether tx pays to or spends from one of addrs.
+func (n *Node) involves(tx *Tx, addrs map[string]struct{}) bool {
+	for _, out := range tx.Outputs {
+		if _, ok := addrs[out.Address]; ok {
+			return true
+		}
+	}
+	for _, in := range tx.Inputs {
+		prev, ok := n.txs[in.TxId]
+		if !ok || int(in.Index) >= len(prev.Outputs) {
+			continue
+		}
+		if _, ok := addrs[prev.Outputs[in.Index].Address]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Node) vins(tx *Tx) []corejson.Vin {
+	if tx.Coinbase {
+		return []corejson.Vin{{Coinbase: hex.EncodeToString([]byte(tx.TxId))}}
+	}
+	vins := make([]corejson.Vin, 0, len(tx.Inputs))
+	for _, in := range tx.Inputs {
+		vins = append(vins, corejson.Vin{Txid: in.TxId, Vout: in.Index})
+	}
+	return vins
+}
+
+func (n *Node) vouts(tx *Tx) []corejson.Vout {
+	vouts := make([]corejson.Vout, 0, len(tx.Outputs))
+	for _, out := range tx.Outputs {
+		vout := corejson.Vout{
+			Amount: out.Amount,
+			CoinId: uint16(out.Coin),
+		}
+		script := out.PkScript
+		if script == nil {
+			script = payToAddrScript(out.Address)
+		}
+		vout.ScriptPubKey.Hex = hex.EncodeToString(script)
+		vout.ScriptPubKey.Type = "pubkeyhash"
+		if script != nil {
+			vout.ScriptPubKey.Type = txscript.GetScriptClass(0, script).String()
+		}
+		if out.Address != "" {
+			vout.ScriptPubKey.Addresses = []string{out.Address}
+		}
+		vouts = append(vouts, vout)
+	}
+	return vouts
+}
+
+// payToAddrScript returns the script paying to addr, nil when addr is not a
+// valid address, tests may use placeholders for outputs the wallet ignores.
+func payToAddrScript(addr string) []byte {
+	decoded, err := address.DecodeAddress(addr)
+	if err != nil {
+		return nil
+	}
+	script, err := txscript.PayToAddrScript(decoded)
+	if err != nil {
+		return nil
+	}
+	return script
+}
+
+func (n *Node) txRawResult(tx *Tx) corejson.TxRawResult {
+	tr := corejson.TxRawResult{
+		Txid:   tx.TxId,
+		TxHash: tx.TxId,
+		Vin:    n.vins(tx),
+		Vout:   n.vouts(tx),
+	}
+	if tx.block != nil {
+		tr.BlockHash = tx.block.Hash.String()
+		tr.BlockOrder = uint64(tx.block.Order)
+		tr.Confirmations = int64(n.confirmations(tx.block))
+		tr.Txsvalid = tx.block.Txsvalid
+	}
+	return tr
+}
+
+func (n *Node) decodedTx(tx *Tx) *corejson.DecodeRawTransactionResult {
+	res := &corejson.DecodeRawTransactionResult{
+		Txid: tx.TxId,
+		Hash: tx.TxId,
+		Vin:  n.vins(tx),
+		Vout: n.vouts(tx),
+	}
+	if tx.block != nil {
+		res.BlockHash = tx.block.Hash.String()
+		res.Order = uint64(tx.block.Order)
+		res.Confirms = uint64(n.confirmations(tx.block))
+		res.Txvalid = tx.block.Txsvalid
+		res.IsBlue = tx.block.IsBlue
+	}
+	return res
+}
+
+func (n *Node) blockNotifications(b *Block) []func() {
+	var ntfns []func()
+	for nt := range n.notifiers {
+		if h := nt.handlers.OnBlockConnected; h != nil && nt.blocks {
+			blockHash := b.Hash
+			ntfns = append(ntfns, func() {
+				h(&blockHash, int64(b.Order), int64(b.Order), b.Timestamp, nil)
+			})
+		}
+	}
+	return ntfns
+}
+
+func (n *Node) txNotifications(tx *Tx) []func() {
+	var ntfns []func()
+	for nt := range n.notifiers {
+		h := nt.handlers.OnTxAcceptedVerbose
+		if h == nil || !nt.newTxs || !n.involves(tx, nt.addrs) {
+			continue
+		}
+		decoded := n.decodedTx(tx)
+		ntfns = append(ntfns, func() { h(nil, decoded) })
+	}
+	return ntfns
+}
+
+func (n *Node) confirmNotifications() []func() {
+	var ntfns []func()
+	for nt := range n.notifiers {
+		h := nt.handlers.OnTxConfirm
+		if h == nil {
+			continue
+		}
+		for txId := range nt.confirms {
+			tx, ok := n.txs[txId]
+			if !ok || tx.block == nil {
+				continue
+			}
+			res := &cmds.TxConfirmResult{
+				Tx:       txId,
+				Order:    uint64(tx.block.Order),
+				Confirms: uint64(n.confirmations(tx.block)),
+				IsValid:  tx.block.Txsvalid,
+				IsBlue:   tx.block.IsBlue,
+			}
+			ntfns = append(ntfns, func() { h(res) })
+		}
+	}
+	return ntfns
+}
+
+func deliver(ntfns []func()) {
+	for _, ntfn := range ntfns {
+		ntfn()
+	}
+}
@@ -0,0 +1,285 @@
+package mocknode
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+	chaincfg "github.com/Qitmeer/qng/params"
+	"github.com/Qitmeer/qng/rpc/client"
+	"github.com/Qitmeer/qng/rpc/client/cmds"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+)
+
+const (
+	testAddr  = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	otherAddr = "TmgD1mu8zMMV9aWmJrXqQYnWRhR9SBfDZG6"
+)
+
+type recorder struct {
+	blocks   []int64
+	txs      []*corejson.DecodeRawTransactionResult
+	confirms []*cmds.TxConfirmResult
+	finished int
+}
+
+func (r *recorder) handlers() client.NotificationHandlers {
+	return client.NotificationHandlers{
+		OnBlockConnected: func(hash *hash.Hash, height int64, order int64, t time.Time, txs []*types.Transaction) {
+			r.blocks = append(r.blocks, order)
+		},
+		OnTxAcceptedVerbose: func(c *client.Client, tx *corejson.DecodeRawTransactionResult) {
+			r.txs = append(r.txs, tx)
+		},
+		OnTxConfirm: func(txConfirm *cmds.TxConfirmResult) {
+			r.confirms = append(r.confirms, txConfirm)
+		},
+		OnRescanFinish: func(rescanFinish *cmds.RescanFinishedNtfn) {
+			r.finished++
+		},
+	}
+}
+
+func TestMineAndNotify(t *testing.T) {
+	n := New(&chaincfg.TestNetParams)
+	r := &recorder{}
+	nt, err := n.Notifications(r.handlers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nt.NotifyBlocks(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nt.NotifyNewTransactions(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := nt.NotifyTxsByAddr([]string{testAddr}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := n.MineBlock(&Output{Address: testAddr, Amount: 100})
+	if b.Order != 1 {
+		t.Fatalf("mined order %d, want 1", b.Order)
+	}
+	if len(r.blocks) != 1 || r.blocks[0] != 1 {
+		t.Fatalf("block notifications %v, want [1]", r.blocks)
+	}
+	if len(r.txs) != 1 || r.txs[0].Order != 1 || r.txs[0].BlockHash != b.Hash.String() {
+		t.Fatalf("unexpected tx notifications %v", r.txs)
+	}
+
+	count, err := n.GetBlockCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("block count %d, want 2", count)
+	}
+	block, err := n.GetBlockByOrder(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 1 || block.Transactions[0].Vout[0].ScriptPubKey.Addresses[0] != testAddr {
+		t.Fatalf("unexpected block transactions %v", block.Transactions)
+	}
+
+	// Spending the coinbase is seen through the input.
+	spend := n.NewTx([]Input{{TxId: b.Txs[0].TxId}}, Output{Address: "other", Amount: 90})
+	n.AcceptTx(spend)
+	if len(r.txs) != 2 || r.txs[1].BlockHash != "" {
+		t.Fatalf("mempool tx not notified %v", r.txs)
+	}
+
+	nt.Shutdown()
+	nt.WaitForShutdown()
+	n.MineBlock(nil)
+	if len(r.blocks) != 1 {
+		t.Fatalf("notified after shutdown")
+	}
+}
+
+func TestConfirmAndReorder(t *testing.T) {
+	n := New(&chaincfg.TestNetParams)
+	r := &recorder{}
+	nt, _ := n.Notifications(r.handlers())
+
+	tx := n.NewTx(nil, Output{Address: testAddr, Amount: 5})
+	n.AcceptTx(tx)
+	n.MineBlock(nil)
+	n.MineBlock(nil)
+
+	if err := nt.NotifyTxsConfirmed([]cmds.TxConfirm{{Txid: tx.TxId}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.confirms) != 1 || r.confirms[0].Confirms != 2 {
+		t.Fatalf("unexpected confirm notifications %v", r.confirms)
+	}
+	n.MineBlock(nil)
+	if len(r.confirms) != 2 || r.confirms[1].Confirms != 3 {
+		t.Fatalf("unexpected confirm notifications %v", r.confirms)
+	}
+
+	if err := n.Reorder(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Mempool()) != 1 {
+		t.Fatalf("reordered tx not back in mempool")
+	}
+	b := n.MineBlock(nil)
+	if b.Order != 1 || len(b.Txs) != 1 || b.Txs[0] != tx {
+		t.Fatalf("tx not mined again at order 1")
+	}
+	if err := n.SetBlockState(1, false, true); err != nil {
+		t.Fatal(err)
+	}
+	last := r.confirms[len(r.confirms)-1]
+	if last.IsBlue || last.Order != 1 {
+		t.Fatalf("unexpected confirm notification %v", last)
+	}
+}
+
+func TestRescan(t *testing.T) {
+	n := New(&chaincfg.TestNetParams)
+	n.MineBlock(&Output{Address: testAddr, Amount: 1})
+	n.MineBlock(&Output{Address: "other", Amount: 1})
+	n.MineBlock(&Output{Address: testAddr, Amount: 1})
+
+	r := &recorder{}
+	nt, _ := n.Notifications(r.handlers())
+	if err := nt.Rescan(0, 4, []string{testAddr}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.txs) != 2 || r.txs[0].Order != 1 || r.txs[1].Order != 3 {
+		t.Fatalf("unexpected rescan result %v", r.txs)
+	}
+	if r.finished != 1 {
+		t.Fatalf("rescan finished %d times, want 1", r.finished)
+	}
+	if err := nt.Rescan(0, 5, nil); err == nil {
+		t.Fatalf("rescan beyond the last block succeeded")
+	}
+}
+
+func TestTxQueries(t *testing.T) {
+	n := New(&chaincfg.TestNetParams)
+	b := n.MineBlock(&Output{Address: testAddr, Amount: 1})
+	cb := b.Txs[0].TxId
+
+	if _, err := n.GetRawTransaction("unknown"); err != wallet.ErrTxNotFound {
+		t.Fatalf("unknown tx error %v, want ErrTxNotFound", err)
+	}
+	tr, err := n.GetRawTransaction(cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.BlockHash != b.Hash.String() || tr.Confirmations != 1 {
+		t.Fatalf("unexpected raw tx %v", tr)
+	}
+	if blue, err := n.IsBlue(tr.BlockHash); err != nil || !blue {
+		t.Fatalf("IsBlue %v %v, want true", blue, err)
+	}
+
+	if unspent, _ := n.IsUnspent(cb, 0); !unspent {
+		t.Fatalf("coinbase output reported spent")
+	}
+	n.AcceptTx(n.NewTx([]Input{{TxId: cb}}, Output{Address: "other", Amount: 1}))
+	if unspent, _ := n.IsUnspent(cb, 0); unspent {
+		t.Fatalf("output spent in the mempool reported unspent")
+	}
+	if unspent, _ := n.IsUnspent(cb, 1); unspent {
+		t.Fatalf("missing output reported unspent")
+	}
+}
+
+// rawTx serializes a transaction spending inputs with one output paying
+// amount to addr.
+func rawTx(t *testing.T, inputs []Input, addr string, amount int64) (string, *types.Transaction) {
+	t.Helper()
+	mtx := types.NewTransaction()
+	for _, in := range inputs {
+		h, err := hash.NewHashFromStr(in.TxId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtx.AddTxIn(types.NewTxInput(types.NewOutPoint(h, in.Index), []byte{}))
+	}
+	mtx.AddTxOut(types.NewTxOutput(types.Amount{Value: amount, Id: types.MEERA}, payToAddrScript(addr)))
+	raw, err := mtx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(raw), mtx
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	n := New(&chaincfg.TestNetParams)
+	b := n.MineBlock(&Output{Address: testAddr, Amount: 100})
+	cb := b.Txs[0].TxId
+
+	r := &recorder{}
+	nt, _ := n.Notifications(r.handlers())
+	if err := nt.NotifyNewTransactions(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := nt.NotifyTxsByAddr([]string{otherAddr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := n.SendRawTransaction("00", false); err == nil {
+		t.Fatalf("garbage accepted")
+	}
+	unknownTx := hash.Hash{1}
+	unknown, _ := rawTx(t, []Input{{TxId: unknownTx.String()}}, otherAddr, 90)
+	if _, err := n.SendRawTransaction(unknown, false); err == nil {
+		t.Fatalf("spend of an unknown output accepted")
+	}
+
+	raw, mtx := rawTx(t, []Input{{TxId: cb}}, otherAddr, 90)
+	txId, err := n.SendRawTransaction(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mtx.TxHash().String(); txId != want {
+		t.Fatalf("txid %s, want %s", txId, want)
+	}
+	tx, ok := n.Tx(txId)
+	if !ok || len(tx.Inputs) != 1 || tx.Inputs[0] != (Input{TxId: cb}) {
+		t.Fatalf("unexpected decoded tx %+v", tx)
+	}
+	if len(tx.Outputs) != 1 || tx.Outputs[0].Address != otherAddr || tx.Outputs[0].Amount != 90 {
+		t.Fatalf("unexpected decoded outputs %+v", tx.Outputs)
+	}
+	if len(r.txs) != 1 || r.txs[0].Txid != txId {
+		t.Fatalf("raw tx not notified %v", r.txs)
+	}
+	vout := r.txs[0].Vout[0]
+	if vout.ScriptPubKey.Hex != hex.EncodeToString(mtx.TxOut[0].PkScript) {
+		t.Fatalf("script %s, want %x", vout.ScriptPubKey.Hex, mtx.TxOut[0].PkScript)
+	}
+
+	if unspent, _ := n.IsUnspent(cb, 0); unspent {
+		t.Fatalf("output spent by a raw tx reported unspent")
+	}
+	if by, ok := n.SpentBy(cb, 0); !ok || by != txId {
+		t.Fatalf("spent by %s %v, want %s", by, ok, txId)
+	}
+	double, _ := rawTx(t, []Input{{TxId: cb}}, testAddr, 80)
+	if _, err := n.SendRawTransaction(double, false); err == nil {
+		t.Fatalf("double spend accepted")
+	}
+
+	// Evicting the spend releases the output.
+	if err := n.Drop(txId); err != nil {
+		t.Fatal(err)
+	}
+	if unspent, _ := n.IsUnspent(cb, 0); !unspent {
+		t.Fatalf("output of a dropped spend reported spent")
+	}
+	if _, err := n.SendRawTransaction(double, false); err != nil {
+		t.Fatalf("spend after drop: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package mocknode
+
+import (
+	"fmt"
+
+	"github.com/Qitmeer/qng/rpc/client"
+	"github.com/Qitmeer/qng/rpc/client/cmds"
+)
+
+// notifier is a notification connection to a Node.
+type notifier struct {
+	node     *Node
+	handlers client.NotificationHandlers
+
+	// Guarded by node.mu.
+	blocks   bool
+	newTxs   bool
+	addrs    map[string]struct{}
+	confirms map[string]struct{}
+	closed   bool
+
+	quit chan struct{}
+}
+
+func (nt *notifier) NotifyBlocks() error {
+	nt.node.mu.Lock()
+	defer nt.node.mu.Unlock()
+
+	nt.blocks = true
+	return nt.err()
+}
+
+func (nt *notifier) NotifyNewTransactions(verbose bool) error {
+	nt.node.mu.Lock()
+	defer nt.node.mu.Unlock()
+
+	nt.newTxs = true
+	return nt.err()
+}
+
+func (nt *notifier) NotifyTxsByAddr(addrs []string) error {
+	nt.node.mu.Lock()
+	defer nt.node.mu.Unlock()
+
+	for _, addr := range addrs {
+		nt.addrs[addr] = struct{}{}
+	}
+	return nt.err()
+}
+
+// NotifyTxsConfirmed registers txs for confirmation notifications and
+// notifies their current state right away.
+func (nt *notifier) NotifyTxsConfirmed(txs []cmds.TxConfirm) error {
+	n := nt.node
+	n.mu.Lock()
+	if err := nt.err(); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	for _, tx := range txs {
+		nt.confirms[tx.Txid] = struct{}{}
+	}
+	var ntfns []func()
+	if h := nt.handlers.OnTxConfirm; h != nil {
+		for _, tx := range txs {
+			t, ok := n.txs[tx.Txid]
+			if !ok || t.block == nil {
+				continue
+			}
+			res := &cmds.TxConfirmResult{
+				Tx:       tx.Txid,
+				Order:    uint64(t.block.Order),
+				Confirms: uint64(n.confirmations(t.block)),
+				IsValid:  t.block.Txsvalid,
+				IsBlue:   t.block.IsBlue,
+			}
+			ntfns = append(ntfns, func() { h(res) })
+		}
+	}
+	n.mu.Unlock()
+
+	deliver(ntfns)
+	return nil
+}
+
+// Rescan delivers every transaction in [startOrder, endOrder) involving
+// addrs, a progress notification per block and a final rescan finished
+// notification.
+func (nt *notifier) Rescan(startOrder, endOrder uint64, addrs []string) error {
+	n := nt.node
+	n.mu.Lock()
+	if err := nt.err(); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	if endOrder > uint64(len(n.blocks)) {
+		n.mu.Unlock()
+		return fmt.Errorf("rescan end order %d beyond block count %d", endOrder, len(n.blocks))
+	}
+	watch := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		watch[addr] = struct{}{}
+	}
+	var ntfns []func()
+	for order := startOrder; order < endOrder; order++ {
+		b := n.blocks[order]
+		if h := nt.handlers.OnTxAcceptedVerbose; h != nil {
+			for _, tx := range b.Txs {
+				if !n.involves(tx, watch) {
+					continue
+				}
+				decoded := n.decodedTx(tx)
+				ntfns = append(ntfns, func() { h(nil, decoded) })
+			}
+		}
+		if h := nt.handlers.OnRescanProgress; h != nil {
+			progress := &cmds.RescanProgressNtfn{Hash: b.Hash.String(), Order: uint64(b.Order)}
+			ntfns = append(ntfns, func() { h(progress) })
+		}
+	}
+	if h := nt.handlers.OnRescanFinish; h != nil && endOrder > 0 {
+		last := n.blocks[endOrder-1]
+		finished := &cmds.RescanFinishedNtfn{Hash: last.Hash.String(), Order: uint64(last.Order)}
+		ntfns = append(ntfns, func() { h(finished) })
+	}
+	n.mu.Unlock()
+
+	deliver(ntfns)
+	return nil
+}
+
+func (nt *notifier) Shutdown() {
+	n := nt.node
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if nt.closed {
+		return
+	}
+	nt.closed = true
+	delete(n.notifiers, nt)
+	close(nt.quit)
+}
+
+func (nt *notifier) WaitForShutdown() {
+	<-nt.quit
+}
+
+// err must be called with the node lock held.
+func (nt *notifier) err() error {
+	if nt.closed {
+		return fmt.Errorf("notification connection is shut down")
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package wallet_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+	chaincfg "github.com/Qitmeer/qng/params"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/snacl"
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/mocknode"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/txrules"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/memdb"
+	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
+)
+
+const (
+	// otherAddr is a testnet address outside the test wallet.
+	otherAddr = "TmgD1mu8zMMV9aWmJrXqQYnWRhR9SBfDZG6"
+
+	coin = types.MEERA
+)
+
+var (
+	pubPass  = []byte("public")
+	privPass = []byte("private")
+	testSeed = bytes.Repeat([]byte{0x2a}, 32)
+
+	// fastKDF keeps wallet creation and unlocking quick.
+	fastKDF = &snacl.KDFParams{KDF: snacl.KDFScrypt, N: 16, R: 8, P: 1}
+)
+
+// harness is a wallet synchronizing with a mock node.
+type harness struct {
+	t    *testing.T
+	node *mocknode.Node
+	w    *wallet.Wallet
+	addr string
+	done chan error
+}
+
+// newHarness creates a wallet on a memory database backed by a fresh mock
+// node, transactions need two confirmations.
+func newHarness(t *testing.T) *harness {
+	return newHarnessSeed(t, testSeed, nil)
+}
+
+// newHarnessSeed is newHarness for a wallet created from seed, derived from
+// the mnemonic entropy when it is not nil.
+func newHarnessSeed(t *testing.T, seed, entropy []byte) *harness {
+	cfg := config.NewDefaultConfig()
+	cfg.Confirmations = 2
+	cfg.KeyPoolSize = 5
+	if err := cfg.Check(); err != nil {
+		t.Fatal(err)
+	}
+	oldCfg := config.Cfg
+	config.Cfg = cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+
+	params := &chaincfg.TestNetParams
+	db, err := walletdb.Create("memdb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		memdb.Remove(t.Name())
+	})
+	err = wallet.Create(db, pubPass, privPass, seed, entropy, params,
+		wallet.ConfigKeyScope(cfg), fastKDF, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := wallet.Open(db, pubPass, nil, params, 0, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := w.NewAddress(w.Manager.DefaultScope(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := mocknode.New(params)
+	n.AddToken(corejson.TokenState{CoinId: uint16(coin), CoinName: coin.Name()})
+	w.HttpClient = n
+	return &harness{t: t, node: n, w: w, addr: addr.String()}
+}
+
+// fund accepts a transaction paying amount to the wallet address into the
+// node's mempool.
+func (h *harness) fund(amount uint64) *mocknode.Tx {
+	tx := h.node.NewTx(nil, mocknode.Output{Address: h.addr, Amount: amount, Coin: coin})
+	h.node.AcceptTx(tx)
+	return tx
+}
+
+// mine mines count blocks.
+func (h *harness) mine(count int) {
+	for i := 0; i < count; i++ {
+		h.node.MineBlock(nil)
+	}
+}
+
+// sync starts the block sync and waits until the wallet caught up.
+func (h *harness) sync() {
+	h.t.Helper()
+	h.done = make(chan error, 1)
+	go func() { h.done <- h.w.UpdateBlock(0) }()
+	h.waitFor("sync to catch up", func() bool {
+		return h.w.SyncStatus().CaughtUp
+	})
+}
+
+// stop shuts the node down and waits for the sync to end.
+func (h *harness) stop() {
+	h.t.Helper()
+	h.node.Shutdown()
+	select {
+	case err := <-h.done:
+		if err != nil {
+			h.t.Fatalf("sync: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		h.t.Fatalf("sync did not stop")
+	}
+}
+
+func (h *harness) waitFor(what string, cond func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (h *harness) balance() wallet.Balance {
+	h.t.Helper()
+	balances, err := h.w.GetBalance(h.addr)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return balances[coin]
+}
+
+// unspent returns the confirmed unspent outputs of the wallet address.
+func (h *harness) unspent() []*wtxmgr.AddrTxOutput {
+	h.t.Helper()
+	outs, err := h.w.GetUnspentAddrOutput(h.addr, coin)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return outs
+}
+
+func TestSyncHistory(t *testing.T) {
+	h := newHarness(t)
+	funding := h.fund(10e8)
+	h.mine(1)
+	h.node.MineBlock(&mocknode.Output{Address: otherAddr, Amount: 1e8, Coin: coin})
+	h.mine(2)
+
+	h.sync()
+	defer h.stop()
+
+	if b := h.balance(); b.UnspentAmount.Value != 10e8 || b.UnconfirmedAmount.Value != 0 {
+		t.Fatalf("balance %d unconfirmed %d, want 10e8 0", b.UnspentAmount.Value, b.UnconfirmedAmount.Value)
+	}
+	outs := h.unspent()
+	if len(outs) != 1 || outs[0].TxId.String() != funding.TxId || outs[0].Index != 0 {
+		t.Fatalf("unexpected unspent outputs %v", outs)
+	}
+}
+
+func TestConfirmation(t *testing.T) {
+	h := newHarness(t)
+	h.sync()
+	defer h.stop()
+
+	h.fund(5e8)
+	h.waitFor("mempool tx", func() bool {
+		return h.balance().UnconfirmedAmount.Value == 5e8
+	})
+
+	// One confirmation is not enough.
+	h.mine(1)
+	time.Sleep(100 * time.Millisecond)
+	if b := h.balance(); b.UnspentAmount.Value != 0 || b.UnconfirmedAmount.Value != 5e8 {
+		t.Fatalf("balance %d unconfirmed %d after one block, want 0 5e8", b.UnspentAmount.Value, b.UnconfirmedAmount.Value)
+	}
+
+	h.mine(1)
+	h.waitFor("confirmation", func() bool {
+		b := h.balance()
+		return b.UnspentAmount.Value == 5e8 && b.UnconfirmedAmount.Value == 0
+	})
+	if outs := h.unspent(); len(outs) != 1 {
+		t.Fatalf("%d unspent outputs, want 1", len(outs))
+	}
+}
+
+func TestSend(t *testing.T) {
+	h := newHarness(t)
+	funding := h.fund(10e8)
+	h.mine(2)
+	h.sync()
+	defer h.stop()
+
+	if err := h.w.UnLockManager(privPass); err != nil {
+		t.Fatal(err)
+	}
+	pairs := map[string]types.Amount{otherAddr: {Value: 3e8, Id: coin}}
+	txId, err := h.w.SendPairs(pairs, int64(waddrmgr.AccountMergePayNum), txrules.DefaultRelayFeePerKb, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The node decoded the transaction and saw the spend.
+	sent, ok := h.node.Tx(txId)
+	if !ok {
+		t.Fatalf("sent tx %s unknown to the node", txId)
+	}
+	if len(sent.Inputs) != 1 || sent.Inputs[0] != (mocknode.Input{TxId: funding.TxId}) {
+		t.Fatalf("sent tx spends %v, want the funding output", sent.Inputs)
+	}
+	if by, ok := h.node.SpentBy(funding.TxId, 0); !ok || by != txId {
+		t.Fatalf("funding output spent by %q, want %s", by, txId)
+	}
+	var change uint64
+	for _, out := range sent.Outputs {
+		switch out.Address {
+		case otherAddr:
+			if out.Amount != 3e8 {
+				t.Fatalf("paid %d, want 3e8", out.Amount)
+			}
+		case h.addr:
+			change = out.Amount
+		default:
+			t.Fatalf("unexpected output %+v", out)
+		}
+	}
+	if change == 0 || change >= 7e8 {
+		t.Fatalf("change %d, want below 7e8 by the fee", change)
+	}
+
+	// The wallet no longer offers the spent output.
+	if len(h.unspent()) != 0 {
+		t.Fatalf("spent output still unspent in the wallet")
+	}
+	if _, err := h.w.SendPairs(pairs, int64(waddrmgr.AccountMergePayNum), txrules.DefaultRelayFeePerKb, 0, ""); err == nil {
+		t.Fatalf("sent without confirmed funds")
+	}
+
+	h.waitFor("unconfirmed change", func() bool {
+		return h.balance().UnconfirmedAmount.Value == int64(change)
+	})
+	h.mine(2)
+	h.waitFor("confirmed change", func() bool {
+		b := h.balance()
+		return b.UnspentAmount.Value == int64(change) && b.UnconfirmedAmount.Value == 0
+	})
+}
+
+func TestBillPaging(t *testing.T) {
+	h := newHarness(t)
+	for i := 1; i <= 3; i++ {
+		h.fund(uint64(i) * 1e8)
+	}
+	h.mine(2)
+	h.sync()
+	defer h.stop()
+
+	first, err := h.w.GetBillByAddr(h.addr, wallet.FilterAll, 1, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Bill) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page %+v, want 2 payments and a cursor", first)
+	}
+	second, err := h.w.GetBillByAddr(h.addr, wallet.FilterAll, 2, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Bill) != 1 || second.NextCursor != "" {
+		t.Fatalf("second page %+v, want the last payment", second)
+	}
+	next, err := h.w.GetBillByAddr(h.addr, wallet.FilterAll, 0, 2, first.NextCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Bill) != 1 || next.Bill[0] != second.Bill[0] {
+		t.Fatalf("page after the cursor %+v, want %+v", next.Bill, second.Bill)
+	}
+
+	// A page past the end of the bill is an error.
+	if _, err := h.w.GetBillByAddr(h.addr, wallet.FilterAll, 3, 2, ""); err == nil {
+		t.Fatalf("page past the end returned no error")
+	}
+}
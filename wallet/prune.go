@@ -0,0 +1,43 @@
+package wallet
+
+import (
+	"github.com/Qitmeer/qng/log"
+
+	"github.com/Qitmeer/qitmeer-wallet/config"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+// PruneTxs prunes the stored transactions mined more than depth block orders
+// before the synced order whose outputs are all spent, keeping the summary
+// used by bills, balances and exports.  GetTx fetches pruned transactions
+// from the node.  It returns the number of pruned transactions.
+func (w *Wallet) PruneTxs(depth uint32) (int, error) {
+	synced := w.getSyncOrder()
+	if depth == 0 || synced <= depth {
+		return 0, nil
+	}
+	var n int
+	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		var err error
+		n, err = w.TxStore.PruneSpentTxs(tx.ReadWriteBucket(wtxmgrNamespaceKey), synced-depth)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		log.Info("Pruned spent transactions", "count", n, "before", synced-depth)
+	}
+	return n, nil
+}
+
+// pruneTxs prunes the spent transactions when pruning is configured.  It is
+// called once the wallet caught up with the node.
+func (w *Wallet) pruneTxs() {
+	if config.Cfg.PruneDepth == 0 {
+		return
+	}
+	if _, err := w.PruneTxs(config.Cfg.PruneDepth); err != nil {
+		log.Warn("prune transactions", "error", err)
+	}
+}
@@ -0,0 +1,164 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/address"
+	j "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/crypto/ecc"
+	"github.com/Qitmeer/qng/log"
+	"github.com/Qitmeer/qng/rpc/client"
+	"github.com/Qitmeer/qng/rpc/client/cmds"
+
+	"github.com/Qitmeer/qitmeer-wallet/utils"
+)
+
+// KeyAddresses returns every address form the wallet watches for a key,
+// the pubkey hash address and the pubkey address.
+func (w *Wallet) KeyAddresses(wif *utils.WIF) ([]string, error) {
+	pubKey := wif.SerializePubKey()
+	pkhAddr, err := address.NewPubKeyHashAddress(hash.Hash160(pubKey), w.chainParams, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		return nil, err
+	}
+	pkAddr, err := address.NewSecpPubKeyAddress(pubKey, w.chainParams)
+	if err != nil {
+		return nil, err
+	}
+	return []string{pkhAddr.String(), pkAddr.String()}, nil
+}
+
+// RescanKey rescans the chain from startOrder for transactions paying to or
+// spending from the addresses of an imported key.
+func (w *Wallet) RescanKey(wif *utils.WIF, startOrder uint64) error {
+	addrs, err := w.KeyAddresses(wif)
+	if err != nil {
+		return err
+	}
+	return w.RescanAddresses(addrs, startOrder)
+}
+
+// CheckRescanFrom returns an error when a rescan can not start at startOrder,
+// because the node is unreachable or startOrder lies beyond its next block.
+// Callers check before importing a key, so a bad rescan request leaves the
+// wallet unchanged.
+func (w *Wallet) CheckRescanFrom(startOrder uint64) error {
+	endOrder, err := w.maxBlockOrder()
+	if err != nil {
+		return err
+	}
+	if startOrder > endOrder {
+		return fmt.Errorf("rescan start order %d is beyond the next block %d", startOrder, endOrder)
+	}
+	return nil
+}
+
+// RescanAddresses scans blocks from startOrder up to the node's latest block
+// for transactions involving addrs, and registers addrs for notification of
+// new transactions.  The scan runs in the background on its own notification
+// connection, so it neither blocks the caller nor the regular block sync.
+// Starting past the latest block only registers addrs.
+func (w *Wallet) RescanAddresses(addrs []string, startOrder uint64) error {
+	endOrder, err := w.watchAddresses(addrs, startOrder)
+	if err != nil || startOrder >= endOrder {
+		return err
+	}
+	go func() {
+		if err := w.rescanAddresses(addrs, startOrder, endOrder); err != nil {
+			log.Error("rescan addresses", "error", err)
+		}
+	}()
+	return nil
+}
+
+// rescanAddressesWait is RescanAddresses returning once the transactions
+// found are stored, for callers spending them right after.
+func (w *Wallet) rescanAddressesWait(addrs []string, startOrder uint64) error {
+	endOrder, err := w.watchAddresses(addrs, startOrder)
+	if err != nil || startOrder >= endOrder {
+		return err
+	}
+	return w.rescanAddresses(addrs, startOrder, endOrder)
+}
+
+// watchAddresses registers addrs for notification of new transactions and
+// returns the order following the node's latest block.
+func (w *Wallet) watchAddresses(addrs []string, startOrder uint64) (uint64, error) {
+	endOrder, err := w.maxBlockOrder()
+	if err != nil {
+		return 0, err
+	}
+
+	if w.notificationRpc != nil {
+		if err := w.notifyTxByAddr(addrs); err != nil {
+			log.Warn("notify imported addresses", "error", err)
+		}
+	}
+
+	if startOrder >= endOrder {
+		log.Debug("rescan addresses: no blocks to scan", "addrs", addrs, "start", startOrder)
+	}
+	return endOrder, nil
+}
+
+// rescanAddresses scans the blocks in [startOrder, endOrder) for addrs and
+// returns once the node sent the rescan finished notification, which follows
+// the transactions found.
+func (w *Wallet) rescanAddresses(addrs []string, startOrder, endOrder uint64) error {
+	finished := make(chan struct{})
+	var finishOnce sync.Once
+	ntfnHandlers := client.NotificationHandlers{
+		OnTxAcceptedVerbose: w.onRescanAddressesTx,
+		OnRescanFinish: func(*cmds.RescanFinishedNtfn) {
+			finishOnce.Do(func() { close(finished) })
+		},
+	}
+	c, err := w.HttpClient.Notifications(ntfnHandlers)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer c.Shutdown()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-w.quitChan():
+			c.Shutdown()
+		case <-done:
+		}
+	}()
+
+	log.Info("rescan addresses", "addrs", addrs, "start", startOrder, "end", endOrder-1)
+	if err := c.Rescan(startOrder, endOrder, addrs); err != nil {
+		return err
+	}
+	select {
+	case <-finished:
+	case <-w.quitChan():
+		return errors.New("the wallet stopped before the rescan finished")
+	}
+	log.Info("rescan addresses finished", "addrs", addrs)
+	return nil
+}
+
+// onRescanAddressesTx stores a transaction found by RescanAddresses.  Unlike
+// OnTxAcceptedVerbose it leaves the synced block alone, the targeted scan
+// runs behind the regular sync and must not move it backwards.
+func (w *Wallet) onRescanAddressesTx(c *client.Client, tx *j.DecodeRawTransactionResult) {
+	if tx.Duplicate || tx.BlockHash == "" {
+		return
+	}
+	txIns, txOuts, status, trRs, err := w.parseTx(tx)
+	if err != nil {
+		log.Error("rescan addresses parse tx", "error", err)
+		return
+	}
+	err = w.insertTx(uint32(tx.Order), txIns, txOuts, status, trRs)
+	if err != nil {
+		log.Error("rescan addresses insert tx", "error", err)
+	}
+}
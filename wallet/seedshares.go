@@ -0,0 +1,25 @@
+package wallet
+
+import (
+	"github.com/Qitmeer/qitmeer-wallet/internal/zero"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+// SplitSeed splits the seed of the wallet into shares, any groupThreshold of
+// groups of which recover the wallet.  The shares are returned per group.
+// The wallet must be unlocked.
+func (w *Wallet) SplitSeed(groupThreshold uint8, groups []shamir.Group) ([][]string, error) {
+	var seed []byte
+	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		var err error
+		seed, err = w.Manager.Seed(tx.ReadBucket(waddrmgrNamespaceKey))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer zero.Bytes(seed)
+
+	return shamir.SplitStrings(seed, groupThreshold, groups)
+}
@@ -0,0 +1,66 @@
+package shamir
+
+// Arithmetic in GF(2^8) with the Rijndael polynomial x^8 + x^4 + x^3 + x + 1,
+// the field of SLIP-0039.  Addition is xor, multiplication and division go
+// through the log and exp tables of the generator x + 1.
+
+var (
+	expTable [255]byte
+	logTable [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		// Multiply by the generator x + 1.
+		x ^= xtime(x)
+	}
+}
+
+// xtime multiplies b by x.
+func xtime(b byte) byte {
+	if b&0x80 != 0 {
+		return b<<1 ^ 0x1b
+	}
+	return b << 1
+}
+
+// point is the value of a polynomial per byte at x.
+type point struct {
+	x byte
+	y []byte
+}
+
+// interpolate returns the value at x of the polynomials of the lowest degree
+// through points.  The x of points must be distinct and their values of the
+// same length.
+func interpolate(points []point, x byte) []byte {
+	for _, p := range points {
+		if p.x == x {
+			return append([]byte(nil), p.y...)
+		}
+	}
+
+	result := make([]byte, len(points[0].y))
+	for i, pi := range points {
+		// The log of the Lagrange basis polynomial of pi at x, the
+		// product of (x - xj) / (xi - xj) over the other points.
+		logBasis := 0
+		for j, pj := range points {
+			if i == j {
+				continue
+			}
+			logBasis += int(logTable[x^pj.x]) - int(logTable[pi.x^pj.x])
+		}
+		logBasis = (logBasis%255 + 255) % 255
+
+		for k, y := range pi.y {
+			if y != 0 {
+				result[k] ^= expTable[(int(logTable[y])+logBasis)%255]
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,402 @@
+// Package shamir splits a wallet seed into shares, a threshold of which
+// recovers it, following the two level scheme of SLIP-0039.
+//
+// The seed is split into group shares, any group threshold of which recover
+// it, and each group share is split into member shares, any member threshold
+// of which recover the group share.  As in SLIP-0039, a polynomial of a
+// threshold above one also passes through a digest of the secret, so that
+// shares of different splits or modified shares which still pass their
+// checksum are detected when combined.
+//
+// A share is written as
+//
+//	qs1-<base32 of the share>
+//
+// with the base32 grouped by dashes.  The share holds
+//
+//	<version><identifier><group index|group threshold><group count|member index>
+//	<member threshold><value><checksum>
+//
+// where the identifier is random and common to the shares of a split, the
+// indexes and counts take 4 bits each, and the checksum is the first 4 bytes
+// of the SHA-256 of the share.
+package shamir
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxShares is the maximum number of groups and of members of a
+	// group.
+	MaxShares = 16
+
+	// MinSecretLen is the minimum length of a secret.
+	MinSecretLen = 16
+
+	version  = 1
+	prefix   = "qs1-"
+	hrp      = "QS1"
+	checkLen = 4
+	// headerLen is the length of the fields before the share value.
+	headerLen = 6
+
+	digestLen   = 4
+	digestIndex = 254
+	secretIndex = 255
+)
+
+var (
+	// ErrChecksum describes a share which fails its checksum, a mistyped
+	// share.
+	ErrChecksum = errors.New("share checksum mismatch")
+
+	// ErrMismatch describes shares which are not of the same split.
+	ErrMismatch = errors.New("shares are not of the same split")
+
+	// ErrTooFewShares describes shares which do not meet the thresholds.
+	ErrTooFewShares = errors.New("not enough shares")
+
+	// ErrDigest describes shares which meet the thresholds but do not
+	// recover the secret they were split from.
+	ErrDigest = errors.New("shares do not recover the secret, a share is invalid")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Group is the member threshold and the member count of a group.
+type Group struct {
+	Threshold uint8
+	Count     uint8
+}
+
+// ParseGroup parses a group written as <threshold>of<count>, e.g. 3of5.
+func ParseGroup(s string) (Group, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "of")
+	if len(parts) != 2 {
+		return Group{}, fmt.Errorf("invalid group %q, want <threshold>of<count>", s)
+	}
+	threshold, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return Group{}, fmt.Errorf("invalid group %q: %v", s, err)
+	}
+	count, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return Group{}, fmt.Errorf("invalid group %q: %v", s, err)
+	}
+	g := Group{Threshold: uint8(threshold), Count: uint8(count)}
+	return g, g.validate()
+}
+
+// ParseGroups parses groups written as by ParseGroup.
+func ParseGroups(ss []string) ([]Group, error) {
+	groups := make([]Group, 0, len(ss))
+	for _, s := range ss {
+		g, err := ParseGroup(s)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// String returns the group written as <threshold>of<count>.
+func (g Group) String() string {
+	return fmt.Sprintf("%dof%d", g.Threshold, g.Count)
+}
+
+func (g Group) validate() error {
+	switch {
+	case g.Threshold == 0 || g.Threshold > g.Count:
+		return fmt.Errorf("group %v: threshold must be between 1 and the count", g)
+	case g.Count > MaxShares:
+		return fmt.Errorf("group %v: at most %d members", g, MaxShares)
+	case g.Threshold == 1 && g.Count > 1:
+		// Every member would hold the group share, 1of1 says so.
+		return fmt.Errorf("group %v: use 1of1 for a group of threshold 1", g)
+	}
+	return nil
+}
+
+// Share is a member share of a split secret.
+type Share struct {
+	// Identifier is common to the shares of a split.
+	Identifier      uint16
+	GroupIndex      uint8
+	GroupThreshold  uint8
+	GroupCount      uint8
+	MemberIndex     uint8
+	MemberThreshold uint8
+	Value           []byte
+}
+
+// String returns the share written as described in the package documentation.
+func (s *Share) String() string {
+	b := make([]byte, headerLen, headerLen+len(s.Value)+checkLen)
+	b[0] = version
+	binary.BigEndian.PutUint16(b[1:3], s.Identifier)
+	b[3] = s.GroupIndex<<4 | (s.GroupThreshold - 1)
+	b[4] = (s.GroupCount-1)<<4 | s.MemberIndex
+	b[5] = (s.MemberThreshold - 1) << 4
+	b = append(b, s.Value...)
+	b = append(b, checksum(b)...)
+
+	enc := strings.ToLower(encoding.EncodeToString(b))
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for i := 0; i < len(enc); i += 4 {
+		if i > 0 {
+			sb.WriteByte('-')
+		}
+		end := i + 4
+		if end > len(enc) {
+			end = len(enc)
+		}
+		sb.WriteString(enc[i:end])
+	}
+	return sb.String()
+}
+
+// ParseShare parses a share written as by Share.String.  Case, dashes and
+// white space are ignored.
+func ParseShare(str string) (*Share, error) {
+	enc := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(str))
+	if !strings.HasPrefix(enc, hrp) {
+		return nil, fmt.Errorf("not a seed share, want the %s prefix", prefix)
+	}
+	b, err := encoding.DecodeString(enc[len(hrp):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed share: %v", err)
+	}
+	if len(b) < headerLen+MinSecretLen+checkLen {
+		return nil, errors.New("seed share is too short")
+	}
+	body := b[:len(b)-checkLen]
+	if !hmac.Equal(checksum(body), b[len(b)-checkLen:]) {
+		return nil, ErrChecksum
+	}
+	if body[0] != version {
+		return nil, fmt.Errorf("unsupported seed share version %d", body[0])
+	}
+
+	s := &Share{
+		Identifier:      binary.BigEndian.Uint16(body[1:3]),
+		GroupIndex:      body[3] >> 4,
+		GroupThreshold:  body[3]&0x0f + 1,
+		GroupCount:      body[4]>>4 + 1,
+		MemberIndex:     body[4] & 0x0f,
+		MemberThreshold: body[5]>>4 + 1,
+		Value:           append([]byte(nil), body[headerLen:]...),
+	}
+	if s.GroupThreshold > s.GroupCount || s.GroupIndex >= s.GroupCount {
+		return nil, errors.New("seed share has an invalid group")
+	}
+	return s, nil
+}
+
+func checksum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:checkLen]
+}
+
+// Split splits secret into the member shares of groups, any groupThreshold
+// groups of which recover it.  The shares are returned per group.
+func Split(secret []byte, groupThreshold uint8, groups []Group) ([][]*Share, error) {
+	if len(secret) < MinSecretLen {
+		return nil, fmt.Errorf("secret must be at least %d bytes", MinSecretLen)
+	}
+	if len(groups) == 0 || len(groups) > MaxShares {
+		return nil, fmt.Errorf("between 1 and %d groups are required", MaxShares)
+	}
+	if groupThreshold == 0 || int(groupThreshold) > len(groups) {
+		return nil, errors.New("group threshold must be between 1 and the number of groups")
+	}
+	for _, g := range groups {
+		if err := g.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	identifier := binary.BigEndian.Uint16(id[:])
+
+	groupPoints, err := splitSecret(groupThreshold, uint8(len(groups)), secret)
+	if err != nil {
+		return nil, err
+	}
+	shares := make([][]*Share, len(groups))
+	for i, g := range groups {
+		memberPoints, err := splitSecret(g.Threshold, g.Count, groupPoints[i].y)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range memberPoints {
+			shares[i] = append(shares[i], &Share{
+				Identifier:      identifier,
+				GroupIndex:      uint8(i),
+				GroupThreshold:  groupThreshold,
+				GroupCount:      uint8(len(groups)),
+				MemberIndex:     p.x,
+				MemberThreshold: g.Threshold,
+				Value:           p.y,
+			})
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from shares meeting the member thresholds of at
+// least the group threshold of groups.  Extra shares are ignored.
+func Combine(shares []*Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrTooFewShares
+	}
+	first := shares[0]
+	groups := make(map[uint8][]point)
+	memberThresholds := make(map[uint8]uint8)
+	for _, s := range shares {
+		if s.Identifier != first.Identifier || s.GroupThreshold != first.GroupThreshold ||
+			s.GroupCount != first.GroupCount || len(s.Value) != len(first.Value) {
+			return nil, ErrMismatch
+		}
+		if t, ok := memberThresholds[s.GroupIndex]; ok && t != s.MemberThreshold {
+			return nil, ErrMismatch
+		}
+		memberThresholds[s.GroupIndex] = s.MemberThreshold
+
+		duplicate := false
+		for _, p := range groups[s.GroupIndex] {
+			if p.x != s.MemberIndex {
+				continue
+			}
+			if !hmac.Equal(p.y, s.Value) {
+				return nil, fmt.Errorf("group %d has different shares of member %d",
+					s.GroupIndex+1, s.MemberIndex+1)
+			}
+			duplicate = true
+		}
+		if !duplicate {
+			groups[s.GroupIndex] = append(groups[s.GroupIndex],
+				point{x: s.MemberIndex, y: s.Value})
+		}
+	}
+
+	var groupPoints []point
+	for index, members := range groups {
+		threshold := memberThresholds[index]
+		if len(members) < int(threshold) {
+			continue
+		}
+		groupSecret, err := recoverSecret(threshold, members[:threshold])
+		if err != nil {
+			return nil, err
+		}
+		groupPoints = append(groupPoints, point{x: index, y: groupSecret})
+	}
+	if len(groupPoints) < int(first.GroupThreshold) {
+		return nil, fmt.Errorf("%w: %d of the %d groups required are complete",
+			ErrTooFewShares, len(groupPoints), first.GroupThreshold)
+	}
+	return recoverSecret(first.GroupThreshold, groupPoints[:first.GroupThreshold])
+}
+
+// splitSecret returns count shares of secret, any threshold of which recover
+// it.  Above a threshold of one, the polynomial passes through the secret at
+// secretIndex and through a digest of it at digestIndex.
+func splitSecret(threshold, count uint8, secret []byte) ([]point, error) {
+	shares := make([]point, count)
+	if threshold == 1 {
+		for i := range shares {
+			shares[i] = point{x: uint8(i), y: append([]byte(nil), secret...)}
+		}
+		return shares, nil
+	}
+
+	base := make([]point, 0, threshold)
+	for i := 0; i < int(threshold)-2; i++ {
+		y := make([]byte, len(secret))
+		if _, err := rand.Read(y); err != nil {
+			return nil, err
+		}
+		shares[i] = point{x: uint8(i), y: y}
+		base = append(base, shares[i])
+	}
+	random := make([]byte, len(secret)-digestLen)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	digest := append(createDigest(random, secret), random...)
+	base = append(base, point{x: digestIndex, y: digest}, point{x: secretIndex, y: secret})
+
+	for i := int(threshold) - 2; i < int(count); i++ {
+		shares[i] = point{x: uint8(i), y: interpolate(base, uint8(i))}
+	}
+	return shares, nil
+}
+
+// recoverSecret recovers the secret from threshold shares, checking it
+// against its digest.
+func recoverSecret(threshold uint8, shares []point) ([]byte, error) {
+	if threshold == 1 {
+		return append([]byte(nil), shares[0].y...), nil
+	}
+	secret := interpolate(shares, secretIndex)
+	digest := interpolate(shares, digestIndex)
+	if !hmac.Equal(digest[:digestLen], createDigest(digest[digestLen:], secret)) {
+		return nil, ErrDigest
+	}
+	return secret, nil
+}
+
+func createDigest(random, secret []byte) []byte {
+	mac := hmac.New(sha256.New, random)
+	mac.Write(secret)
+	return mac.Sum(nil)[:digestLen]
+}
+
+// SplitStrings splits secret like Split and returns the shares written as
+// strings.
+func SplitStrings(secret []byte, groupThreshold uint8, groups []Group) ([][]string, error) {
+	shares, err := Split(secret, groupThreshold, groups)
+	if err != nil {
+		return nil, err
+	}
+	strs := make([][]string, len(shares))
+	for i, group := range shares {
+		for _, s := range group {
+			strs[i] = append(strs[i], s.String())
+		}
+	}
+	return strs, nil
+}
+
+// CombineStrings recovers the secret from shares written as strings like
+// Combine.
+func CombineStrings(strs []string) ([]byte, error) {
+	shares := make([]*Share, 0, len(strs))
+	for i, str := range strs {
+		s, err := ParseShare(str)
+		if err != nil {
+			return nil, fmt.Errorf("share %d: %w", i+1, err)
+		}
+		shares = append(shares, s)
+	}
+	return Combine(shares)
+}
@@ -0,0 +1,145 @@
+package shamir_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+
+func split(t *testing.T, groupThreshold uint8, groups ...string) [][]*shamir.Share {
+	t.Helper()
+	gs, err := shamir.ParseGroups(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, err := shamir.Split(testSecret, groupThreshold, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return shares
+}
+
+func combine(t *testing.T, shares ...*shamir.Share) {
+	t.Helper()
+	secret, err := shamir.Combine(shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, testSecret) {
+		t.Fatalf("combined %x, want %x", secret, testSecret)
+	}
+}
+
+func TestSingleGroup(t *testing.T) {
+	shares := split(t, 1, "3of5")[0]
+	if len(shares) != 5 {
+		t.Fatalf("got %d shares, want 5", len(shares))
+	}
+	combine(t, shares[0], shares[1], shares[2])
+	combine(t, shares[4], shares[2], shares[0])
+	combine(t, shares...)
+
+	_, err := shamir.Combine(shares[:2])
+	if !errors.Is(err, shamir.ErrTooFewShares) {
+		t.Fatalf("combining 2 of 3 shares: got %v, want ErrTooFewShares", err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	shares := split(t, 2, "1of1", "2of3", "3of5")
+	combine(t, shares[0][0], shares[1][0], shares[1][2])
+	combine(t, shares[1][1], shares[1][2], shares[2][0], shares[2][3], shares[2][4])
+
+	// A complete group and an incomplete one do not recover the secret.
+	_, err := shamir.Combine([]*shamir.Share{shares[0][0], shares[1][0], shares[2][0], shares[2][1]})
+	if !errors.Is(err, shamir.ErrTooFewShares) {
+		t.Fatalf("got %v, want ErrTooFewShares", err)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	for _, s := range split(t, 2, "2of3", "2of2")[1] {
+		str := s.String()
+		if !strings.HasPrefix(str, "qs1-") {
+			t.Fatalf("share %s lacks the prefix", str)
+		}
+		parsed, err := shamir.ParseShare(" " + strings.ToUpper(strings.ReplaceAll(str, "-", " - ")) + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.String() != str {
+			t.Fatalf("parsed %s, want %s", parsed, str)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	str := split(t, 1, "2of2")[0][0].String()
+	// Change one character of the value.
+	i := len(str) / 2
+	if str[i] == '-' {
+		i++
+	}
+	c := "a"
+	if str[i] == 'a' {
+		c = "b"
+	}
+	mistyped := str[:i] + c + str[i+1:]
+	if _, err := shamir.ParseShare(mistyped); err != shamir.ErrChecksum {
+		t.Fatalf("got %v, want ErrChecksum", err)
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	a := split(t, 1, "2of3")[0]
+	b := split(t, 1, "2of3")[0]
+	b[1].Identifier = a[0].Identifier + 1
+	if _, err := shamir.Combine([]*shamir.Share{a[0], b[1]}); err != shamir.ErrMismatch {
+		t.Fatalf("got %v, want ErrMismatch", err)
+	}
+
+	// A share of another split under the same identifier fails the digest.
+	b[1].Identifier = a[0].Identifier
+	if _, err := shamir.Combine([]*shamir.Share{a[0], b[1]}); err != shamir.ErrDigest {
+		t.Fatalf("got %v, want ErrDigest", err)
+	}
+}
+
+func TestInvalidSplits(t *testing.T) {
+	for _, g := range []string{"0of3", "4of3", "1of3", "2of17", "3", "aofb"} {
+		if _, err := shamir.ParseGroup(g); err == nil {
+			t.Errorf("group %s was accepted", g)
+		}
+	}
+	if _, err := shamir.Split(testSecret[:15], 1, []shamir.Group{{Threshold: 2, Count: 3}}); err == nil {
+		t.Error("short secret was accepted")
+	}
+	if _, err := shamir.Split(testSecret, 2, []shamir.Group{{Threshold: 2, Count: 3}}); err == nil {
+		t.Error("group threshold above the number of groups was accepted")
+	}
+}
+
+func TestStrings(t *testing.T) {
+	gs := []shamir.Group{{Threshold: 2, Count: 3}}
+	strs, err := shamir.SplitStrings(testSecret, 1, gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := shamir.CombineStrings([]string{strs[0][2], strs[0][0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, testSecret) {
+		t.Fatalf("combined %x, want %x", secret, testSecret)
+	}
+
+	_, err = shamir.CombineStrings([]string{strs[0][2], "qs1-aaaa"})
+	if err == nil || !strings.HasPrefix(err.Error(), "share 2:") {
+		t.Fatalf("got %v, want an error of share 2", err)
+	}
+}
@@ -0,0 +1,195 @@
+package wallet
+
+import (
+	"sync"
+	"time"
+)
+
+// ConnState describes the state of the notification connection to the node.
+type ConnState string
+
+const (
+	ConnStateDisconnected ConnState = "disconnected"
+	ConnStateConnecting   ConnState = "connecting"
+	ConnStateConnected    ConnState = "connected"
+)
+
+// syncRateSmoothing is the weight of the newest sample in the moving average
+// used for the blocks per second estimate.
+const syncRateSmoothing = 0.3
+
+// SyncStatus describes the progress of block synchronisation.
+type SyncStatus struct {
+	CurrentOrder uint32    `json:"currentOrder"`
+	TargetOrder  uint32    `json:"targetOrder"`
+	NodeOrder    uint32    `json:"nodeOrder"`
+	Percentage   float64   `json:"percentage"`
+	BlocksPerSec float64   `json:"blocksPerSec"`
+	ETA          int64     `json:"eta"` // seconds, -1 when unknown
+	ConnState    ConnState `json:"connState"`
+	LastError    string    `json:"lastError,omitempty"`
+	CaughtUp     bool      `json:"caughtUp"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// syncTracker holds the current SyncStatus and fans out changes to
+// subscribers.  Subscribers only ever see the latest status, slow readers
+// skip intermediate updates instead of blocking the sync process.
+type syncTracker struct {
+	mu     sync.RWMutex
+	status SyncStatus
+
+	sampleOrder uint32
+	sampleTime  time.Time
+	now         func() time.Time
+
+	nextID      uint64
+	subscribers map[uint64]chan SyncStatus
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{
+		status: SyncStatus{
+			ETA:       -1,
+			ConnState: ConnStateDisconnected,
+		},
+		subscribers: make(map[uint64]chan SyncStatus),
+		now:         time.Now,
+	}
+}
+
+// Status returns a copy of the current sync status.
+func (t *syncTracker) Status() SyncStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.status
+}
+
+// update applies fn to the status, recomputes the derived fields and
+// notifies subscribers if anything changed.
+func (t *syncTracker) update(fn func(s *SyncStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old := t.status
+	fn(&t.status)
+	now := t.now()
+	t.updateRate(now)
+	t.updateProgress()
+
+	s := t.status
+	s.UpdatedAt = old.UpdatedAt
+	if s == old {
+		return
+	}
+	t.status.UpdatedAt = now
+	for _, ch := range t.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- t.status
+	}
+}
+
+func (t *syncTracker) updateRate(now time.Time) {
+	s := &t.status
+	if t.sampleTime.IsZero() || s.CurrentOrder < t.sampleOrder {
+		t.sampleOrder = s.CurrentOrder
+		t.sampleTime = now
+		s.BlocksPerSec = 0
+		return
+	}
+	elapsed := now.Sub(t.sampleTime).Seconds()
+	if s.CurrentOrder == t.sampleOrder || elapsed < 1 {
+		return
+	}
+	rate := float64(s.CurrentOrder-t.sampleOrder) / elapsed
+	if s.BlocksPerSec == 0 {
+		s.BlocksPerSec = rate
+	} else {
+		s.BlocksPerSec = syncRateSmoothing*rate + (1-syncRateSmoothing)*s.BlocksPerSec
+	}
+	t.sampleOrder = s.CurrentOrder
+	t.sampleTime = now
+}
+
+func (t *syncTracker) updateProgress() {
+	s := &t.status
+	switch {
+	case s.TargetOrder == 0 || s.CurrentOrder >= s.TargetOrder:
+		s.Percentage = 100
+	default:
+		s.Percentage = float64(s.CurrentOrder) * 100 / float64(s.TargetOrder)
+	}
+
+	remain := int64(s.TargetOrder) - int64(s.CurrentOrder)
+	switch {
+	case remain <= 0:
+		s.ETA = 0
+	case s.BlocksPerSec > 0:
+		s.ETA = int64(float64(remain) / s.BlocksPerSec)
+	default:
+		s.ETA = -1
+	}
+	if remain > 0 {
+		s.CaughtUp = false
+	}
+}
+
+// subscribe registers a new subscriber, the returned func removes it.
+func (t *syncTracker) subscribe() (<-chan SyncStatus, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := t.nextID
+	t.nextID++
+	ch := make(chan SyncStatus, 1)
+	ch <- t.status
+	t.subscribers[id] = ch
+
+	return ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.subscribers, id)
+	}
+}
+
+// SyncStatus returns the current block synchronisation status.
+func (w *Wallet) SyncStatus() SyncStatus {
+	return w.syncStatus.Status()
+}
+
+// SubscribeSyncStatus returns a channel receiving the sync status whenever it
+// changes, and a func to cancel the subscription.
+func (w *Wallet) SubscribeSyncStatus() (<-chan SyncStatus, func()) {
+	return w.syncStatus.subscribe()
+}
+
+func (w *Wallet) setSyncError(err error) {
+	w.syncStatus.update(func(s *SyncStatus) {
+		if err == nil {
+			s.LastError = ""
+		} else {
+			s.LastError = err.Error()
+		}
+	})
+}
+
+func (w *Wallet) setConnState(state ConnState) {
+	w.syncStatus.update(func(s *SyncStatus) {
+		s.ConnState = state
+		if state != ConnStateConnected {
+			s.CaughtUp = false
+		}
+	})
+}
+
+// lastOrder converts a block count into the order of the last block.
+func lastOrder(count uint32) uint32 {
+	if count == 0 {
+		return 0
+	}
+	return count - 1
+}
@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock drives the sync tracker without sleeping.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestTracker() (*syncTracker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1600000000, 0)}
+	tr := newSyncTracker()
+	tr.now = clock.now
+	return tr, clock
+}
+
+func setOrders(tr *syncTracker, current, target uint32) {
+	tr.update(func(s *SyncStatus) {
+		s.CurrentOrder = current
+		s.TargetOrder = target
+	})
+}
+
+func TestSyncTrackerPercentage(t *testing.T) {
+	tests := []struct {
+		current, target uint32
+		want            float64
+	}{
+		{0, 0, 100},
+		{50, 200, 25},
+		{199, 200, 99.5},
+		{200, 200, 100},
+		{250, 200, 100},
+	}
+	for _, test := range tests {
+		tr, _ := newTestTracker()
+		setOrders(tr, test.current, test.target)
+		if got := tr.Status().Percentage; got != test.want {
+			t.Errorf("%d/%d: percentage %v, want %v", test.current,
+				test.target, got, test.want)
+		}
+	}
+}
+
+func TestSyncTrackerRate(t *testing.T) {
+	tr, clock := newTestTracker()
+
+	// The first update only takes a sample, nothing is known yet.
+	setOrders(tr, 100, 300)
+	if s := tr.Status(); s.BlocksPerSec != 0 || s.ETA != -1 {
+		t.Fatalf("first sample: rate %v eta %d, want 0 -1", s.BlocksPerSec, s.ETA)
+	}
+
+	// Samples closer than a second apart are ignored.
+	clock.advance(500 * time.Millisecond)
+	setOrders(tr, 150, 300)
+	if s := tr.Status(); s.BlocksPerSec != 0 || s.ETA != -1 {
+		t.Fatalf("short sample: rate %v eta %d, want 0 -1", s.BlocksPerSec, s.ETA)
+	}
+
+	// 100 blocks in 2s since the sample.
+	clock.advance(1500 * time.Millisecond)
+	setOrders(tr, 200, 300)
+	s := tr.Status()
+	if s.BlocksPerSec != 50 {
+		t.Fatalf("rate %v, want 50", s.BlocksPerSec)
+	}
+	if s.ETA != 2 {
+		t.Fatalf("eta %d, want 2", s.ETA)
+	}
+
+	// 40 blocks per second are smoothed into the average.
+	clock.advance(time.Second)
+	setOrders(tr, 240, 300)
+	s = tr.Status()
+	want := syncRateSmoothing*40 + (1-syncRateSmoothing)*50
+	if math.Abs(s.BlocksPerSec-want) > 1e-9 {
+		t.Fatalf("smoothed rate %v, want %v", s.BlocksPerSec, want)
+	}
+	if s.ETA != int64(60/want) {
+		t.Fatalf("eta %d, want %d", s.ETA, int64(60/want))
+	}
+
+	// Caught up.
+	clock.advance(time.Second)
+	setOrders(tr, 300, 300)
+	if s := tr.Status(); s.ETA != 0 || s.Percentage != 100 {
+		t.Fatalf("caught up: eta %d percentage %v, want 0 100", s.ETA, s.Percentage)
+	}
+
+	// Going backwards, e.g. after a rollback, restarts the estimate.
+	clock.advance(time.Second)
+	setOrders(tr, 100, 300)
+	if s := tr.Status(); s.BlocksPerSec != 0 || s.ETA != -1 {
+		t.Fatalf("after rollback: rate %v eta %d, want 0 -1", s.BlocksPerSec, s.ETA)
+	}
+}
+
+func TestSyncTrackerSubscribe(t *testing.T) {
+	tr, clock := newTestTracker()
+	ch, cancel := tr.subscribe()
+	defer cancel()
+
+	if s := <-ch; s.ConnState != ConnStateDisconnected {
+		t.Fatalf("initial state %v, want %v", s.ConnState, ConnStateDisconnected)
+	}
+
+	// A slow subscriber only sees the latest status.
+	setOrders(tr, 10, 100)
+	clock.advance(time.Second)
+	setOrders(tr, 20, 100)
+	if s := <-ch; s.CurrentOrder != 20 {
+		t.Fatalf("current order %d, want 20", s.CurrentOrder)
+	}
+	select {
+	case s := <-ch:
+		t.Fatalf("unexpected status %+v", s)
+	default:
+	}
+
+	// Updates that change nothing are not sent.
+	clock.advance(time.Second)
+	setOrders(tr, 20, 100)
+	select {
+	case s := <-ch:
+		t.Fatalf("unexpected status %+v", s)
+	default:
+	}
+}
@@ -9,13 +9,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -42,10 +39,13 @@ import (
 
 	"github.com/Qitmeer/qitmeer-wallet/config"
 	clijson "github.com/Qitmeer/qitmeer-wallet/json"
+	"github.com/Qitmeer/qitmeer-wallet/snacl"
 	"github.com/Qitmeer/qitmeer-wallet/utils"
 	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/backup"
 	"github.com/Qitmeer/qitmeer-wallet/wallet/txrules"
 	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/migration"
 	"github.com/Qitmeer/qitmeer-wallet/wtxmgr"
 )
 
@@ -56,8 +56,8 @@ const (
 	// passphrase from discovering all past and future wallet addresses if
 	// they gain access to the wallet database.
 	//
-	// NOTE: at time of writing, public encryption only applies to public
-	// data in the waddrmgr namespace.  Transactions are not yet encrypted.
+	// The transaction history in the wtxmgr namespace is encrypted with the
+	// public crypto key as well.
 	InsecurePubPassphrase   = "public"
 	webUpdateBlockTicker    = 30
 	defaultNewAddressNumber = 1
@@ -83,10 +83,15 @@ type Wallet struct {
 	Manager *waddrmgr.Manager
 	TxStore *wtxmgr.Store
 	tokens  *QitmeerToken
+	// dbPath is the path of db when the wallet was loaded by a Loader,
+	// backups are never written there.
+	dbPath string
 
-	HttpClient *httpConfig
+	// HttpClient is the node backend, an RPC client of a qitmeer node
+	// unless replaced, e.g. by a mock node in tests.
+	HttpClient ChainBackend
 
-	notificationRpc *client.Client
+	notificationRpc ChainNotifier
 
 	// Channels for the manager locker.
 	unlockRequests chan unlockRequest
@@ -110,6 +115,15 @@ type Wallet struct {
 	syncWg     *sync.WaitGroup
 	scanEnd    chan struct{}
 	orderMutex sync.RWMutex
+	syncStatus *syncTracker
+	confirms   *confirmTracker
+	// confirmCheck wakes the confirmation worker of the running sync.
+	confirmCheck chan struct{}
+
+	// backupKey encrypts scheduled backups, it is derived at the first
+	// unlock.
+	backupKey *backup.Key
+	backupMu  sync.Mutex
 }
 
 // Start starts the goroutines necessary to manage a wallet.
@@ -149,6 +163,8 @@ func (w *Wallet) Start() {
 					err := w.UpdateBlock(0)
 					if err != nil {
 						w.UploadRun = false
+						w.setConnState(ConnStateDisconnected)
+						w.setSyncError(err)
 						log.Warn("Start.Updateblock err", "err", err.Error())
 					}
 				}
@@ -224,6 +240,7 @@ type Value struct {
 	UnspentAmount     int64 // 可用余额
 	LockAmount        int64 // 锁定
 	UnconfirmedAmount int64 // 待确认
+	ImmatureAmount    int64 // 未成熟, 含在待确认中
 	SpendAmount       int64 // 已花费
 }
 
@@ -232,6 +249,7 @@ type Balance struct {
 	UnspentAmount     *Amount // 可用余额
 	LockAmount        *Amount // 锁定
 	UnconfirmedAmount *Amount // 待确认
+	ImmatureAmount    *Amount // 未成熟, 含在待确认中
 	SpendAmount       *Amount // 已花费
 }
 
@@ -241,6 +259,7 @@ func NewBalance(coinId types.CoinID) *Balance {
 		UnspentAmount:     &Amount{Value: 0, Id: coinId},
 		LockAmount:        &Amount{Value: 0, Id: coinId},
 		UnconfirmedAmount: &Amount{Value: 0, Id: coinId},
+		ImmatureAmount:    &Amount{Value: 0, Id: coinId},
 		SpendAmount:       &Amount{Value: 0, Id: coinId},
 	}
 }
@@ -262,9 +281,16 @@ type AccountAddress struct {
 	Addrs         []types.Address
 }
 type AddrAndAddrTxOutput struct {
-	Addr        string
-	balanceMap  map[types.CoinID]Balance
-	TxoutputMap map[types.CoinID][]wtxmgr.AddrTxOutput
+	Addr string
+	// AltAddr is the other form of the key of Addr, the pay-to-pubkey
+	// address of a pay-to-pubkey-hash one and the reverse.  The outputs
+	// to both forms are merged.
+	AltAddr string `json:",omitempty"`
+	// DerivationPath is the key path of the address, empty for imported
+	// addresses.
+	DerivationPath string `json:",omitempty"`
+	balanceMap     map[types.CoinID]Balance
+	TxoutputMap    map[types.CoinID][]wtxmgr.AddrTxOutput
 }
 
 func NewAddrAndAddrTxOutput() *AddrAndAddrTxOutput {
@@ -331,7 +357,56 @@ func (w *Wallet) Database() walletdb.DB {
 	return w.db
 }
 
-func Create(db walletdb.DB, pubPass, privPass, seed []byte, params *chaincfg.Params,
+// ConfigKeyScope returns the key scope of new wallets set by the HDPurpose and
+// HDCoinType of cfg, KeyScopeQitmeer when no purpose is configured.
+func ConfigKeyScope(cfg *config.Config) waddrmgr.KeyScope {
+	if cfg == nil || cfg.HDPurpose == 0 {
+		return waddrmgr.KeyScopeQitmeer
+	}
+	return waddrmgr.KeyScope{Purpose: cfg.HDPurpose, Coin: cfg.HDCoinType}
+}
+
+// ConfigKDF returns the key derivation function and costs of new wallets set
+// by the KDF and KDFTarget of cfg, see KDFOptions.
+func ConfigKDF(cfg *config.Config) (*snacl.KDFParams, error) {
+	if cfg == nil {
+		return KDFOptions("", 0)
+	}
+	return KDFOptions(cfg.KDF, cfg.KDFTarget)
+}
+
+// KDFOptions returns the settings of the key derivation function name, the
+// default one when empty.  With a target, the costs are tuned by measuring a
+// derivation on this machine, otherwise the defaults of the function are
+// used.
+func KDFOptions(name string, target time.Duration) (*snacl.KDFParams, error) {
+	if name == "" {
+		name = config.DefaultKDF
+	}
+	kdf, err := snacl.ParseKDF(name)
+	if err != nil {
+		return nil, err
+	}
+	if target <= 0 {
+		params := waddrmgr.DefaultKDFOptions(kdf)
+		return &params, nil
+	}
+
+	params, err := snacl.TuneKDF(kdf, target)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Tuned the key derivation function", "target", target,
+		"kdf", params)
+	return &params, nil
+}
+
+// Create creates the wallet in db.  The accounts and addresses of the wallet
+// are derived in scope, and its passphrases are stretched with kdf, the
+// default scrypt options when nil.  mnemonicEntropy is the BIP39 entropy of
+// the mnemonic seed was derived from, if any, kept to show the mnemonic again.
+func Create(db walletdb.DB, pubPass, privPass, seed, mnemonicEntropy []byte,
+	params *chaincfg.Params, scope waddrmgr.KeyScope, kdf *snacl.KDFParams,
 	birthday time.Time) error {
 
 	// If a seed was provided, ensure that it is of valid length. Otherwise,
@@ -351,8 +426,8 @@ func Create(db walletdb.DB, pubPass, privPass, seed []byte, params *chaincfg.Par
 			return err
 		}
 		err = waddrmgr.Create(
-			addrMgrNs, seed, pubPass, privPass, params, nil,
-			birthday,
+			addrMgrNs, seed, mnemonicEntropy, pubPass, privPass, params,
+			scope, kdf, birthday,
 		)
 		if err != nil {
 			return err
@@ -386,12 +461,19 @@ func Open(db walletdb.DB, pubPass []byte, _ *waddrmgr.OpenCallbacks,
 		}
 		tokenBucket := tx.ReadWriteBucket(tokenmgrNamespaceKey)
 		tokens = NewQitmeerToken(tokenBucket)
-		var err error
+		err := migration.Upgrade(waddrmgr.NewMigrationManager(addrMgrBucket))
+		if err != nil {
+			return err
+		}
 		addrMgr, err = waddrmgr.Open(addrMgrBucket, pubPass, params)
 		if err != nil {
 			return err
 		}
-		txMgr, err = wtxmgr.Open(txMgrBucket, params)
+		err = migration.Upgrade(wtxmgr.NewMigrationManager(txMgrBucket, addrMgr.CryptoKeyPub()))
+		if err != nil {
+			return err
+		}
+		txMgr, err = wtxmgr.Open(txMgrBucket, params, addrMgr.CryptoKeyPub())
 		if err != nil {
 			return err
 		}
@@ -418,7 +500,14 @@ func Open(db walletdb.DB, pubPass []byte, _ *waddrmgr.OpenCallbacks,
 		quit:           make(chan struct{}),
 		syncQuit:       make(chan struct{}, 1),
 		scanEnd:        make(chan struct{}, 1),
+		syncStatus:     newSyncTracker(),
+		confirms:       newConfirmTracker(),
+		confirmCheck:   make(chan struct{}, 1),
 	}
+	if err := w.buildBalances(); err != nil {
+		return nil, err
+	}
+	w.warnImportedMasterKey()
 
 	return w, nil
 }
@@ -433,50 +522,43 @@ func NewNotificationRpc(cfg *config.Config, handlers client.NotificationHandlers
 		HTTPPostMode:       false,
 		InsecureSkipVerify: cfg.QTLSSkipVerify,
 	}
-	if !connCfg.DisableTLS {
-		certs, err := ioutil.ReadFile(cfg.QCert)
-		if err != nil {
-			return nil, err
-		}
-		connCfg.Certificates = certs
-	}
-
-	client, err := client.New(connCfg, &handlers)
-	if err != nil {
-		return nil, err
-	}
-	// Register for block connect and disconnect notifications.
-	if err := client.NotifyBlocks(); err != nil {
-		return nil, err
-	}
-	return client, nil
+	return newNotificationClient(connCfg, cfg.QCert, handlers)
 }
 
 func (w *Wallet) GetTx(txId string) (corejson.TxRawResult, error) {
 	trx := corejson.TxRawResult{}
+	var pruned bool
 	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
 		ns := tx.ReadBucket(wtxmgrNamespaceKey)
 
-		txNs := ns.NestedReadBucket(wtxmgr.BucketTxJson)
 		k, err := hash.NewHashFromStr(txId)
 		if err != nil {
 			return err
 		}
-		v := txNs.Get(k.Bytes())
-		if v != nil {
-			err := json.Unmarshal(v, &trx)
-			if err != nil {
-				return err
-			}
-		} else {
+		tr, p, err := w.TxStore.FetchStoredTx(ns, k)
+		if err != nil {
+			return err
+		}
+		if tr == nil {
 			return errors.New("GetTx fail ")
 		}
+		trx = *tr
+		pruned = p
 		return nil
 	})
 	if err != nil {
 		return trx, err
 	}
 
+	// Pruned transactions only keep their summary, the node has the rest.
+	if pruned {
+		tr, err := w.HttpClient.GetRawTransaction(txId)
+		if err != nil {
+			log.Warn("GetTx of pruned transaction", "txid", txId, "error", err)
+			return trx, nil
+		}
+		return *tr, nil
+	}
 	return trx, nil
 }
 
@@ -545,18 +627,10 @@ func (w *Wallet) GetAccountAndAddress(scope waddrmgr.KeyScope) ([]AccountAndAddr
 		results[len(results)-1].AccountNumber = waddrmgr.ImportedAddrAccount
 		results[len(results)-1].AccountName = waddrmgr.ImportedAddrAccountName
 		for k := range results {
-			adds, err := w.AccountAddresses(results[k].AccountNumber)
+			addrOutputs, err := w.accountAddrOutputs(addrNs, results[k].AccountNumber)
 			if err != nil {
 				return err
 			}
-			var addrOutputs []AddrAndAddrTxOutput
-			for _, addr := range adds {
-				addrOutput, err := w.getAddrAndAddrTxOutputByAddr(addr.Encode())
-				if err != nil {
-					return err
-				}
-				addrOutputs = append(addrOutputs, *addrOutput)
-			}
 			results[k].AddrsOutput = addrOutputs
 		}
 		return nil
@@ -567,6 +641,85 @@ func (w *Wallet) GetAccountAndAddress(scope waddrmgr.KeyScope) ([]AccountAndAddr
 	return results, err
 }
 
+// accountAddrOutputs returns the outputs of every key of account, one entry
+// per key under the address the account handed out for it.
+func (w *Wallet) accountAddrOutputs(addrNs walletdb.ReadBucket, account uint32) ([]AddrAndAddrTxOutput, error) {
+	var keys []AddrAndAddrTxOutput
+	err := w.Manager.ForEachAccountAddress(addrNs, account, func(mAddr waddrmgr.ManagedAddress) error {
+		pka, ok := mAddr.(waddrmgr.ManagedPubKeyAddress)
+		if !ok {
+			return fmt.Errorf("address %s is not a key type", mAddr.Address())
+		}
+		pkh, pk, err := w.keyAddresses(pka)
+		if err != nil {
+			return err
+		}
+		key := AddrAndAddrTxOutput{Addr: pkh.Encode(), AltAddr: pk.Encode()}
+		if pka.AddrType() == waddrmgr.SecpPubKey {
+			key.Addr, key.AltAddr = key.AltAddr, key.Addr
+		}
+		if scope, path, ok := pka.DerivationInfo(); ok {
+			key.DerivationPath = scope.PathString(path)
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	addrOutputs := make([]AddrAndAddrTxOutput, 0, len(keys))
+	for _, key := range keys {
+		addrOutput, err := w.getAddrAndAddrTxOutputByAddr(key.Addr)
+		if err != nil {
+			return nil, err
+		}
+		addrOutput.AltAddr = key.AltAddr
+		addrOutput.DerivationPath = key.DerivationPath
+		addrOutputs = append(addrOutputs, *addrOutput)
+	}
+	return addrOutputs, nil
+}
+
+// keyAddresses returns the pay-to-pubkey-hash and the pay-to-pubkey address of
+// the key of a managed address.
+func (w *Wallet) keyAddresses(pka waddrmgr.ManagedPubKeyAddress) (pkh, pk types.Address, err error) {
+	if pkAddr, ok := pka.Address().(*address.SecpPubKeyAddress); ok {
+		return pkAddr.PKHAddress(), pkAddr, nil
+	}
+	pk, err = address.NewSecpPubKeyAddress(pka.PubKey().SerializeCompressed(), w.chainParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pka.Address(), pk, nil
+}
+
+// addrForms returns the addresses the outputs to the key of addr are stored
+// under, both forms of the key when addr belongs to the wallet and addr
+// alone otherwise.
+func (w *Wallet) addrForms(addrNs walletdb.ReadBucket, addr string) ([]string, error) {
+	decoded, err := address.DecodeAddress(addr)
+	if err != nil {
+		return []string{addr}, nil
+	}
+	maddr, err := w.Manager.Address(addrNs, decoded)
+	if waddrmgr.IsError(err, waddrmgr.ErrAddressNotFound) {
+		return []string{addr}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pka, ok := maddr.(waddrmgr.ManagedPubKeyAddress)
+	if !ok {
+		return []string{addr}, nil
+	}
+	pkh, pk, err := w.keyAddresses(pka)
+	if err != nil {
+		return nil, err
+	}
+	return []string{pkh.Encode(), pk.Encode()}, nil
+}
+
 func (w *Wallet) GetAddress(scope waddrmgr.KeyScope, account int) ([]AccountAndAddressResult, error) {
 	manager, err := w.Manager.FetchScopedKeyManager(scope)
 	if err != nil {
@@ -591,18 +744,10 @@ func (w *Wallet) GetAddress(scope waddrmgr.KeyScope, account int) ([]AccountAndA
 		results[len(results)-1].AccountNumber = waddrmgr.ImportedAddrAccount
 		results[len(results)-1].AccountName = waddrmgr.ImportedAddrAccountName
 		for k := range results {
-			adds, err := w.AccountAddresses(results[k].AccountNumber)
+			addrOutputs, err := w.accountAddrOutputs(addrNs, results[k].AccountNumber)
 			if err != nil {
 				return err
 			}
-			var addrOutputs []AddrAndAddrTxOutput
-			for _, addr := range adds {
-				addrOutput, err := w.getAddrAndAddrTxOutputByAddr(addr.Encode())
-				if err != nil {
-					return err
-				}
-				addrOutputs = append(addrOutputs, *addrOutput)
-			}
 			results[k].AddrsOutput = addrOutputs
 		}
 		return nil
@@ -613,22 +758,22 @@ func (w *Wallet) GetAddress(scope waddrmgr.KeyScope, account int) ([]AccountAndA
 	return results, err
 }
 
+// getAddrTxOutputByCoin returns the outputs of coin to the key of addr, paid
+// to either form of it.
 func (w *Wallet) getAddrTxOutputByCoin(addr string, coin types.CoinID) (wtxmgr.AddrTxOutputs, error) {
 	var txOuts wtxmgr.AddrTxOutputs
 	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
-		hs := []byte(addr)
 		ns := tx.ReadBucket(wtxmgrNamespaceKey)
 		outNs := ns.NestedReadBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, types.CoinID(coin)))
 		if outNs == nil {
 			return nil
 		}
-		hsOutNs := outNs.NestedReadBucket(hs)
-		if hsOutNs != nil {
-			err := hsOutNs.ForEach(func(k, v []byte) error {
-				to, err := wtxmgr.DecodeAddrTxOutput(v)
-				if err != nil {
-					return err
-				}
+		forms, err := w.addrForms(tx.ReadBucket(waddrmgrNamespaceKey), addr)
+		if err != nil {
+			return err
+		}
+		for _, form := range forms {
+			err := w.TxStore.ForEachAddrTxOut(outNs, form, func(to *wtxmgr.AddrTxOutput) error {
 				txOuts = append(txOuts, *to)
 				return nil
 			})
@@ -688,6 +833,7 @@ func (w *Wallet) getAddrAndAddrTxOutputByAddr(addr string) (*AddrAndAddrTxOutput
 
 		b.UnspentAmount = usableAmount
 		b.UnconfirmedAmount = UnconfirmedAmount
+		b.ImmatureAmount = NewAmount(0, types.CoinID(token.CoinId))
 		b.LockAmount = lockAmount
 		b.SpendAmount = spendAmount
 		b.TotalAmount = totalAmount
@@ -745,6 +891,7 @@ func (w *Wallet) getAddrAndAddrTxOutputByCoin(addr string, coin int) (*AddrAndAd
 
 	b.UnspentAmount = usableAmount
 	b.UnconfirmedAmount = UnconfirmedAmount
+	b.ImmatureAmount = NewAmount(0, types.CoinID(token.CoinId))
 	b.LockAmount = lockAmount
 	b.SpendAmount = spendAmount
 	b.TotalAmount = totalAmount
@@ -770,10 +917,11 @@ request all the transactions that affect a specific address,
 a transaction can have MULTIPLE payments and affect MULTIPLE addresses
 
 sType 0 Turn in 1 Turn out 2 all no page
+cursor is the next_cursor of a previous page, it replaces pageNo
 */
-func (w *Wallet) GetListTxByAddr(addr string, sType int, pageNo int, pageSize int) (*clijson.PageTxRawResult, error) {
+func (w *Wallet) GetListTxByAddr(addr string, sType int, pageNo int, pageSize int, cursor string) (*clijson.PageTxRawResult, error) {
 
-	bill, err := w.getPagedBillByAddr(addr, sType, pageNo, pageSize)
+	bill, next, err := w.getPagedBillByAddr(addr, sType, pageNo, pageSize, cursor)
 	if err != nil {
 		return nil, err
 	}
@@ -782,23 +930,21 @@ func (w *Wallet) GetListTxByAddr(addr string, sType int, pageNo int, pageSize in
 	result.Page = int32(pageNo)
 	result.PageSize = int32(pageSize)
 	result.Total = int32(bill.Len())
+	result.NextCursor = next
 
 	var transactions []corejson.TxRawResult
 	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
 		ns := tx.ReadBucket(wtxmgrNamespaceKey)
-		txNs := ns.NestedReadBucket(wtxmgr.BucketTxJson)
 		for _, b := range *bill {
 			txHs := b.TxID
-			v := txNs.Get(txHs.Bytes())
-			if v == nil {
-				return fmt.Errorf("db uploadblock err tx:%s non-existent", txHs.String())
-			}
-			var txr corejson.TxRawResult
-			err := json.Unmarshal(v, &txr)
+			txr, err := w.TxStore.FetchTxJson(ns, &txHs)
 			if err != nil {
 				return err
 			}
-			transactions = append(transactions, txr)
+			if txr == nil {
+				return fmt.Errorf("db uploadblock err tx:%s non-existent", txHs.String())
+			}
+			transactions = append(transactions, *txr)
 		}
 		return nil
 	})
@@ -813,8 +959,8 @@ func (w *Wallet) GetListTxByAddr(addr string, sType int, pageNo int, pageSize in
 // request the bill of a specific address, a bill is the log of payments,
 // which are the effects that a transaction makes on a specific address
 // a payment can affect only ONE address
-func (w *Wallet) GetBillByAddr(addr string, filter int, pageNo int, pageSize int) (*clijson.PagedBillResult, error) {
-	bill, err := w.getPagedBillByAddr(addr, filter, pageNo, pageSize)
+func (w *Wallet) GetBillByAddr(addr string, filter int, pageNo int, pageSize int, cursor string) (*clijson.PagedBillResult, error) {
+	bill, next, err := w.getPagedBillByAddr(addr, filter, pageNo, pageSize, cursor)
 	if err != nil {
 		return nil, err
 	}
@@ -823,6 +969,7 @@ func (w *Wallet) GetBillByAddr(addr string, filter int, pageNo int, pageSize int
 	res.PageNo = int32(pageNo)
 	res.PageSize = int32(pageSize)
 	res.Total = int32(bill.Len())
+	res.NextCursor = next
 
 	for _, p := range *bill {
 		res.Bill = append(res.Bill, clijson.PaymentResult{
@@ -834,98 +981,99 @@ func (w *Wallet) GetBillByAddr(addr string, filter int, pageNo int, pageSize int
 	return &res, nil
 }
 
-func (w *Wallet) getPagedBillByAddr(addr string, filter int, pageNo int, pageSize int) (*wt.Bill, error) {
-	//TODO
-	at, err := w.getAddrAndAddrTxOutputByAddr(addr)
-	if err != nil {
-		return nil, err
-	}
+// getPagedBillByAddr returns a page of the bill of addr, newest payment
+// first, read from the address history index.  Like the balance, the bill
+// of a wallet key merges the payments to all forms of its address.  The page starts after cursor,
+// a token returned by a previous call, or at page pageNo when cursor is empty.
+// It returns the bill and the cursor of the next page, empty on the last page.
+// A page starting past the end of the bill is an error.
+func (w *Wallet) getPagedBillByAddr(addr string, filter int, pageNo int, pageSize int, cursor string) (*wt.Bill, string, error) {
 	if pageNo == 0 {
 		pageNo = PageDefaultNo
 	}
 	if pageSize == 0 {
 		pageSize = PageDefaultSize
 	}
-	startIndex := (pageNo - 1) * pageSize
-	var endIndex int
-	var allTxs wt.Bill
-	var inTxs wt.Bill
-	var outTxs wt.Bill
-	var dataLen int
-
-	allMap := make(map[hash.Hash]wt.Payment)
-
-	for _, at := range at.TxoutputMap {
-		for _, o := range at {
-			txOut, found := allMap[o.TxId]
-			if found {
-				txOut.Variation += o.Amount.Value
-			} else {
-				txOut.TxID = o.TxId
-				txOut.Variation = o.Amount.Value
-				txOut.BlockHash = o.Block.Hash
-				txOut.BlockOrder = uint32(o.Block.Order)
-			}
-			//log.Debug(fmt.Sprintf("%s %v %v", o.TxId.String(), float64(o.Amount)/math.Pow10(8), float64(txOut.Amount)/math.Pow10(8)))
-
-			allMap[o.TxId] = txOut
-
-			if o.SpendTo != nil {
-				txOut, found := allMap[o.SpendTo.TxId]
-				if found {
-					txOut.Variation -= o.Amount.Value
-				} else {
-					txOut.TxID = o.SpendTo.TxId
-					txOut.Variation = -o.Amount.Value
-					// ToDo: add Block to SpendTo
-					txOut.BlockHash = o.Block.Hash
-					txOut.BlockOrder = uint32(o.Block.Order)
-				}
-				allMap[o.SpendTo.TxId] = txOut
-				//log.Debug(fmt.Sprintf("%s %v %v", o.SpendTo.TxHash.String(), float64(-o.Amount)/math.Pow10(8), float64(txOut.Amount)/math.Pow10(8)))
-			}
-		}
-
-	}
-
-	for _, out := range allMap {
-		if out.Variation > 0 {
-			inTxs = append(inTxs, out)
-		} else {
-			outTxs = append(outTxs, out)
-		}
+	if pageNo < 0 {
+		pageNo = PageDefaultNo
+		pageSize = PageMaxSize
 	}
 
+	var match func(e *wtxmgr.AddrHistoryEntry) bool
 	switch filter {
 	case FilterIn:
-		allTxs = inTxs
+		match = func(e *wtxmgr.AddrHistoryEntry) bool { return e.Variation() > 0 }
 	case FilterOut:
-		allTxs = outTxs
+		match = func(e *wtxmgr.AddrHistoryEntry) bool { return e.Variation() <= 0 }
 	case FilterAll:
-		allTxs = append(inTxs, outTxs...)
 	default:
-		return nil, fmt.Errorf("err filter:%d", filter)
+		return nil, "", fmt.Errorf("err filter:%d", filter)
 	}
 
-	sort.Sort(allTxs)
+	var start []byte
+	if cursor != "" {
+		var err error
+		start, err = hex.DecodeString(cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %s", cursor)
+		}
+	}
 
-	dataLen = len(allTxs)
-	if pageNo < 0 {
-		pageNo = PageDefaultNo
-		pageSize = PageMaxSize
-	} else {
-		if startIndex > dataLen {
-			return nil, fmt.Errorf("no data, index:%d len:%d", startIndex, dataLen)
-		} else {
-			if (startIndex + pageSize) > dataLen {
-				endIndex = dataLen
-			} else {
-				endIndex = startIndex + pageSize
+	bill := wt.Bill{}
+	var next []byte
+	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		ns := tx.ReadBucket(wtxmgrNamespaceKey)
+		forms, err := w.addrForms(tx.ReadBucket(waddrmgrNamespaceKey), addr)
+		if err != nil {
+			return err
+		}
+
+		// Without a cursor, skip the entries of the previous pages.
+		if start == nil && pageNo > 1 {
+			startIndex := (pageNo - 1) * pageSize
+			skipped, skipCursor, err := w.TxStore.AddrsHistory(ns, forms, nil, startIndex, match)
+			if err != nil {
+				return err
+			}
+			if skipCursor == nil {
+				if len(skipped) < startIndex {
+					return fmt.Errorf("no data, index:%d len:%d", startIndex, len(skipped))
+				}
+				return nil
+			}
+			start = skipCursor
+		}
+
+		entries, nextCursor, err := w.TxStore.AddrsHistory(ns, forms, start, pageSize, match)
+		if err != nil {
+			return err
+		}
+		for i := range entries {
+			payment := wt.Payment{
+				TxID:       entries[i].TxId,
+				Variation:  entries[i].Variation(),
+				BlockOrder: entries[i].Order,
 			}
-			allTxs = allTxs[startIndex:endIndex]
+			tr, _, err := w.TxStore.FetchStoredTx(ns, &entries[i].TxId)
+			if err != nil {
+				return err
+			}
+			if tr != nil && tr.BlockHash != "" {
+				blockHash, err := hash.NewHashFromStr(tr.BlockHash)
+				if err != nil {
+					return err
+				}
+				payment.BlockHash = *blockHash
+			}
+			bill = append(bill, payment)
 		}
+		next = nextCursor
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
-	return &allTxs, nil
+	return &bill, hex.EncodeToString(next), nil
 }
 
 func (w *Wallet) GetBalanceByCoin(addr string, coin types.CoinID) (map[string]Value, error) {
@@ -943,6 +1091,7 @@ func (w *Wallet) GetBalanceByCoin(addr string, coin types.CoinID) (map[string]Va
 			UnspentAmount:     val.UnspentAmount.Value,
 			LockAmount:        val.LockAmount.Value,
 			UnconfirmedAmount: val.UnconfirmedAmount.Value,
+			ImmatureAmount:    val.ImmatureAmount.Value,
 			SpendAmount:       val.SpendAmount.Value,
 		}
 	}
@@ -972,17 +1121,14 @@ func (w *Wallet) GetTxSpendInfo(txId string) ([]*wtxmgr.AddrTxOutput, error) {
 	}
 	err = walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
 		rb := tx.ReadWriteBucket(wtxmgrNamespaceKey)
-		txNrb := rb.NestedReadWriteBucket(wtxmgr.BucketTxJson)
 
-		v := txNrb.Get(txHash.Bytes())
-		if v == nil {
-			return fmt.Errorf("txid does not exist")
-		}
-		var txr corejson.TxRawResult
-		err := json.Unmarshal(v, &txr)
+		txr, err := w.TxStore.FetchTxJson(rb, txHash)
 		if err != nil {
 			return err
 		}
+		if txr == nil {
+			return fmt.Errorf("txid does not exist")
+		}
 		for i, vOut := range txr.Vout {
 			addr := vOut.ScriptPubKey.Addresses[0]
 			top := types.TxOutPoint{
@@ -1008,46 +1154,53 @@ func (w *Wallet) GetTxSpendInfo(txId string) ([]*wtxmgr.AddrTxOutput, error) {
 func (w *Wallet) insertTx(order uint32, txins []wtxmgr.TxInputPoint, txouts []wtxmgr.AddrTxOutput, status []wtxmgr.TxConfirmed, trrs []corejson.TxRawResult) error {
 	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
 		ns := tx.ReadWriteBucket(wtxmgrNamespaceKey)
-		txNs := ns.NestedReadWriteBucket(wtxmgr.BucketTxJson)
-		unTxNs := ns.NestedReadWriteBucket(wtxmgr.BucketUnConfirmed)
+		balances := w.newBalanceUpdater(tx)
+		historyOrders := make(map[hash.Hash]uint32, len(trrs))
 		for _, tr := range trrs {
 			k, err := hash.NewHashFromStr(tr.Txid)
 			if err != nil {
 				return err
 			}
-			v, err := json.Marshal(tr)
-			if err != nil {
-				return err
-			}
-			ks := k.Bytes()
-			err = txNs.Put(ks, v)
+			historyOrders[*k] = wtxmgr.TxHistoryOrder(&tr)
+			err = w.TxStore.PutTxJson(ns, &tr)
 			if err != nil {
 				return err
 			}
 		}
 		for _, txo := range txouts {
 			outNs := ns.NestedAndCreateReadWriteBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, txo.Amount.Id))
-			err := w.TxStore.InsertAddrTxOut(outNs, &txo)
+			old, err := w.TxStore.FetchAddrTxOut(outNs, txo.Address, types.TxOutPoint{Hash: txo.TxId, OutIndex: txo.Index})
+			if err != nil {
+				return err
+			}
+			err = w.TxStore.InsertAddrTxOut(outNs, &txo)
+			if err != nil {
+				return err
+			}
+			err = balances.update(old, &txo)
+			if err != nil {
+				return err
+			}
+			err = w.TxStore.PutHistoryOutput(ns, &txo, wtxmgr.HistoryUnminedOrder)
 			if err != nil {
 				return err
 			}
 		}
 		for _, txi := range txins {
-			v := txNs.Get(txi.TxOutPoint.Hash.Bytes())
-			if v == nil {
-				continue
-			}
-			var txr corejson.TxRawResult
-			err := json.Unmarshal(v, &txr)
+			txr, err := w.TxStore.FetchTxJson(ns, &txi.TxOutPoint.Hash)
 			if err != nil {
 				return err
 			}
+			if txr == nil {
+				continue
+			}
 			addr := txr.Vout[txi.TxOutPoint.OutIndex].ScriptPubKey.Addresses[0]
 			outNs := ns.NestedAndCreateReadWriteBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, types.CoinID(txr.Vout[txi.TxOutPoint.OutIndex].CoinId)))
 			spendOut, err := w.TxStore.GetAddrTxOut(outNs, addr, txi.TxOutPoint)
 			if err != nil {
 				return err
 			}
+			old := *spendOut
 
 			spendOut.Spend = wtxmgr.SpendStatusSpend
 			spendOut.Address = addr
@@ -1056,6 +1209,18 @@ func (w *Wallet) insertTx(order uint32, txins []wtxmgr.TxInputPoint, txouts []wt
 			if err != nil {
 				return err
 			}
+			err = balances.update(&old, spendOut)
+			if err != nil {
+				return err
+			}
+			spendOrder, ok := historyOrders[txi.SpendTo.TxId]
+			if !ok {
+				spendOrder = wtxmgr.HistoryUnminedOrder
+			}
+			err = w.TxStore.PutHistoryOutput(ns, spendOut, spendOrder)
+			if err != nil {
+				return err
+			}
 		}
 		for _, s := range status {
 			k, err := hash.NewHashFromStr(s.TxId)
@@ -1067,14 +1232,28 @@ func (w *Wallet) insertTx(order uint32, txins []wtxmgr.TxInputPoint, txouts []wt
 					Order:         order,
 					Confirmations: s.Confirmations,
 				}
-				unTxNs.Put(k.Bytes(), value.Marshal())
+				err = w.TxStore.PutUnconfirmed(ns, k, value)
 			} else {
-				unTxNs.Delete(k.Bytes())
+				err = w.TxStore.DeleteUnconfirmed(ns, k)
+			}
+			if err != nil {
+				return err
 			}
 		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		k, _ := hash.NewHashFromStr(s.TxId)
+		if s.TxStatus == wtxmgr.TxStatusUnConfirmed {
+			w.confirms.add(*k, order, s.Confirmations)
+		} else {
+			w.confirms.remove(*k)
+		}
+	}
+	return nil
 }
 
 func (w *Wallet) parseTx(tx *j.DecodeRawTransactionResult) ([]wtxmgr.TxInputPoint, []wtxmgr.AddrTxOutput, []wtxmgr.TxConfirmed, []corejson.TxRawResult, error) {
@@ -1082,8 +1261,6 @@ func (w *Wallet) parseTx(tx *j.DecodeRawTransactionResult) ([]wtxmgr.TxInputPoin
 	var txOuts []wtxmgr.AddrTxOutput
 	var status []wtxmgr.TxConfirmed
 	var txRaws []corejson.TxRawResult
-	var confirmations uint32
-	confirmations = config.Cfg.Confirmations
 	tr := corejson.TxRawResult{
 		Txid:          tx.Txid,
 		TxHash:        tx.Hash,
@@ -1099,16 +1276,13 @@ func (w *Wallet) parseTx(tx *j.DecodeRawTransactionResult) ([]wtxmgr.TxInputPoin
 		Txsvalid:      tx.Txvalid,
 	}
 	txRaws = append(txRaws, tr)
-	tin, tout, txStatus, isCoinBase, err := w.parseTxDetail(tr, uint32(tr.BlockOrder), tx.IsBlue)
+	tin, tout, txStatus, _, err := w.parseTxDetail(tr, uint32(tr.BlockOrder), tx.IsBlue)
 	if err != nil {
 		return nil, nil, nil, nil, err
 	} else {
-		if isCoinBase {
-			confirmations = uint32(w.chainParams.CoinbaseMaturity)
-		}
 		status = append(status, wtxmgr.TxConfirmed{
 			TxId:          tr.Txid,
-			Confirmations: confirmations,
+			Confirmations: w.requiredConfirmations(tr),
 			TxStatus:      txStatus,
 		})
 		txIns = append(txIns, tin...)
@@ -1165,7 +1339,7 @@ func (w *Wallet) parseTxDetail(tr corejson.TxRawResult, order uint32, isBlue boo
 			}
 		}
 	}
-	txStatus := w.txStatus(uint32(tr.Confirmations), tr.Txsvalid, isBlue, isCoinBase, inMemPool)
+	txStatus := w.txStatus(txConfirmations(tr), uint32(tr.Confirmations), tr.Txsvalid, isBlue, isCoinBase, inMemPool)
 	for index, vo := range tr.Vout {
 		var lock uint64
 		switch vo.ScriptPubKey.Type {
@@ -1210,7 +1384,9 @@ func (w *Wallet) parseTxDetail(tr corejson.TxRawResult, order uint32, isBlue boo
 	return txins, txouts, txStatus, isCoinBase, nil
 }
 
-func (w *Wallet) txStatus(confirmations uint32, txsvalid, isBlue, isCoinBase, inMemPool bool) wtxmgr.TxStatus {
+// txStatus returns the status of a transaction with confirmations, required
+// is the number it needs unless it is a coinbase, see txConfirmations.
+func (w *Wallet) txStatus(required, confirmations uint32, txsvalid, isBlue, isCoinBase, inMemPool bool) wtxmgr.TxStatus {
 	if isCoinBase {
 		if confirmations < uint32(w.chainParams.CoinbaseMaturity) {
 			return wtxmgr.TxStatusUnConfirmed
@@ -1222,7 +1398,7 @@ func (w *Wallet) txStatus(confirmations uint32, txsvalid, isBlue, isCoinBase, in
 			return wtxmgr.TxStatusRead
 		}
 	} else {
-		if confirmations < config.Cfg.Confirmations {
+		if confirmations < required {
 			if inMemPool {
 				return wtxmgr.TxStatusMemPool
 			}
@@ -1241,37 +1417,31 @@ func (w *Wallet) GetSyncBlockOrder() uint32 {
 }
 
 func (w *Wallet) SetSyncedToNum(order int64) error {
-	var block clijson.BlockHttpResult
-	blockByte, err := w.HttpClient.getBlockByOrder(order)
+	block, err := w.HttpClient.GetBlockByOrder(order)
 	if err != nil {
 		return err
 	}
-	if err := json.Unmarshal(blockByte, &block); err == nil {
-		if !block.Txsvalid {
-			log.Trace(fmt.Sprintf("block:%v err,txsvalid is false", block.Hash))
-			return nil
-		}
-		hs, err := hash.NewHashFromStr(block.Hash)
-		if err != nil {
-			return fmt.Errorf("blockhash string to hash  err:%s", err.Error())
-		}
-		stamp := &waddrmgr.BlockStamp{Hash: *hs, Order: block.Order}
-		err = walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
-			ns := tx.ReadWriteBucket(waddrmgrNamespaceKey)
-			err := w.Manager.SetSyncedTo(ns, stamp)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
+	if !block.Txsvalid {
+		log.Trace(fmt.Sprintf("block:%v err,txsvalid is false", block.Hash))
+		return nil
+	}
+	hs, err := hash.NewHashFromStr(block.Hash)
+	if err != nil {
+		return fmt.Errorf("blockhash string to hash  err:%s", err.Error())
+	}
+	stamp := &waddrmgr.BlockStamp{Hash: *hs, Order: block.Order}
+	err = walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		err := w.Manager.SetSyncedTo(ns, stamp)
 		if err != nil {
 			return err
 		}
 		return nil
-	} else {
-		log.Error(err.Error())
+	})
+	if err != nil {
 		return err
 	}
+	return nil
 }
 
 func (w *Wallet) updateTokens() error {
@@ -1324,6 +1494,10 @@ func (w *Wallet) UpdateBlock(toOrder uint64) error {
 		w.syncAll = false
 	}
 	_ = w.updateTokens()
+	// The pool is registered below along with the other addresses.
+	if _, err := w.refillKeyPool(KeyPoolSize()); err != nil {
+		return err
+	}
 	addrs, err := w.walletAddress()
 	if err != nil {
 		return err
@@ -1333,6 +1507,7 @@ func (w *Wallet) UpdateBlock(toOrder uint64) error {
 		return err
 	}
 	w.setOrder(w.Manager.SyncedTo().Order)
+	w.setConnState(ConnStateConnecting)
 	// w.scanEnd <- struct{}{}
 	ntfnHandlers := client.NotificationHandlers{
 		OnBlockConnected:    w.OnBlockConnected,
@@ -1343,10 +1518,12 @@ func (w *Wallet) UpdateBlock(toOrder uint64) error {
 		OnNodeExit:          w.OnNodeExit,
 	}
 
-	w.notificationRpc, err = NewNotificationRpc(w.cfg, ntfnHandlers)
+	w.notificationRpc, err = w.HttpClient.Notifications(ntfnHandlers)
 	if err != nil {
 		return err
 	}
+	w.setConnState(ConnStateConnected)
+	w.setSyncError(nil)
 	if err = w.notifyBlock(); err != nil {
 		return err
 	}
@@ -1359,14 +1536,21 @@ func (w *Wallet) UpdateBlock(toOrder uint64) error {
 		return err
 	}
 
+	if err := w.loadUnconfirmed(lastOrder(w.getToOrder())); err != nil {
+		return err
+	}
+	confirmDone := make(chan struct{})
 	w.syncWg.Add(1)
-	go w.notifyTxConfirmed()
+	go w.confirmWorker(confirmDone)
+	w.queueConfirmCheck()
 
 	w.syncWg.Add(1)
 	go w.notifyScanTxByAddr(addrs)
 
 	w.notificationRpc.WaitForShutdown()
+	close(confirmDone)
 	w.syncWg.Wait()
+	w.setConnState(ConnStateDisconnected)
 	log.Info("Stop notify sync process")
 	return nil
 }
@@ -1392,17 +1576,26 @@ func (w *Wallet) notifyScanTxByAddr(addrs []string) {
 			if err := w.updateSyncToOrder(0); err != nil {
 				// w.stopSync()
 				log.Warn(err.Error())
+				w.setSyncError(err)
 			}
 			if w.getToOrder() > w.getSyncOrder()+1 {
 				w.syncLatest = false
 				log.Info("notification rescan block", "start", w.getSyncOrder(), "end", w.getToOrder()-1)
-				err := w.notificationRpc.Rescan(uint64(w.getSyncOrder()), uint64(w.getToOrder()), addrs, nil)
+				err := w.notificationRpc.Rescan(uint64(w.getSyncOrder()), uint64(w.getToOrder()), addrs)
 				if err != nil {
+					w.setSyncError(err)
 					return
 				}
 			} else {
+				caughtUp := !w.syncLatest
 				w.syncLatest = true
-				fmt.Fprintf(os.Stdout, "update history block:%d/%d\r", w.getSyncOrder(), w.getToOrder()-1)
+				w.syncStatus.update(func(s *SyncStatus) {
+					s.CaughtUp = true
+				})
+				printSyncProgress(w.SyncStatus())
+				if caughtUp {
+					w.pruneTxs()
+				}
 			}
 			// }
 			time.Sleep(time.Second * 1)
@@ -1453,7 +1646,14 @@ func (w *Wallet) OnTxAcceptedVerbose(c *client.Client, tx *j.DecodeRawTransactio
 
 func (w *Wallet) OnRescanProgress(rescanPro *cmds.RescanProgressNtfn) {
 	//log.Info("scan block progress", "order", rescanPro.Order)
-	_, _ = fmt.Fprintf(os.Stdout, "update history blcok:%d/%d\r", rescanPro.Order, w.getToOrder()-1)
+	w.syncStatus.update(func(s *SyncStatus) {
+		s.CurrentOrder = uint32(rescanPro.Order)
+	})
+	printSyncProgress(w.SyncStatus())
+}
+
+func printSyncProgress(s SyncStatus) {
+	_, _ = fmt.Fprintf(os.Stdout, "update history block:%d/%d %.2f%%\r", s.CurrentOrder, s.TargetOrder, s.Percentage)
 }
 
 func (w *Wallet) updateSyncToOrder(toOrder uint32) error {
@@ -1467,6 +1667,10 @@ func (w *Wallet) updateSyncToOrder(toOrder uint32) error {
 		return fmt.Errorf("the target Order %d cannot be larger than the number of existing blocks  %d on the node", toOrder, maxOrder)
 	}
 	w.setToOrder(toOrder)
+	w.syncStatus.update(func(s *SyncStatus) {
+		s.TargetOrder = lastOrder(toOrder)
+		s.NodeOrder = lastOrder(uint32(maxOrder))
+	})
 	return nil
 }
 
@@ -1474,6 +1678,13 @@ func (w *Wallet) OnBlockConnected(hash *hash.Hash, height int64, order int64, t
 	if err := w.updateChainHeight(uint32(height)); err != nil {
 		log.Warn("update chain height", "error", err.Error())
 	}
+	w.syncStatus.update(func(s *SyncStatus) {
+		if uint32(order) > s.NodeOrder {
+			s.NodeOrder = uint32(order)
+		}
+	})
+	w.confirms.connect(uint32(order))
+	w.queueConfirmCheck()
 }
 
 func (w *Wallet) OnRescanFinish(rescanFinish *cmds.RescanFinishedNtfn) {
@@ -1481,12 +1692,17 @@ func (w *Wallet) OnRescanFinish(rescanFinish *cmds.RescanFinishedNtfn) {
 		// w.scanEnd <- struct{}{}
 	}()
 
-	hash, err := w.HttpClient.getBlockHashByOrder(int64(w.getToOrder() - 1))
+	block, err := w.HttpClient.GetBlockByOrder(int64(w.getToOrder() - 1))
 	if err != nil {
 		log.Warn("get block hash by order", "error", err)
 		return
 	}
-	err = w.updateBlockTemp(*hash, w.getToOrder()-1)
+	blockHash, err := hash.NewHashFromStr(block.Hash)
+	if err != nil {
+		log.Warn("get block hash by order", "error", err)
+		return
+	}
+	err = w.updateBlockTemp(*blockHash, w.getToOrder()-1)
 	if err != nil {
 		return
 	}
@@ -1494,6 +1710,7 @@ func (w *Wallet) OnRescanFinish(rescanFinish *cmds.RescanFinishedNtfn) {
 }
 
 func (w *Wallet) OnNodeExit(nodeExit *cmds.NodeExitNtfn) {
+	w.setConnState(ConnStateDisconnected)
 	w.notificationRpc.Shutdown()
 	w.stopSync()
 }
@@ -1530,7 +1747,7 @@ func (w *Wallet) updateChainHeight(height uint32) error {
 }
 
 func (w *Wallet) notifyTxByAddr(addrs []string) error {
-	err := w.notificationRpc.NotifyTxsByAddr(false, addrs, nil)
+	err := w.notificationRpc.NotifyTxsByAddr(addrs)
 	if err != nil {
 		return err
 	}
@@ -1553,59 +1770,14 @@ func (w *Wallet) notifyNewTransaction() error {
 	return nil
 }
 
-func (w *Wallet) notifyTxConfirmed() {
-	defer w.syncWg.Done()
-
-	t := time.NewTicker(time.Second * 1)
-	for {
-		select {
-		case <-w.syncQuit:
-			log.Info("Stop notify tx confirmed block")
-			return
-		case <-t.C:
-			unTxs := []cmds.TxConfirm{}
-			err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
-				ns := tx.ReadWriteBucket(wtxmgrNamespaceKey)
-				unTxNs := ns.NestedReadWriteBucket(wtxmgr.BucketUnConfirmed)
-				err := unTxNs.ForEach(func(k, v []byte) error {
-					hashTxId, err := hash.NewHash(k)
-					if err != nil {
-						return err
-					}
-					u, err := wtxmgr.UnMarshalUnconfirmTx(v)
-					if err != nil {
-						return err
-					}
-					unTxs = append(unTxs, cmds.TxConfirm{
-						Txid:          hashTxId.String(),
-						Order:         uint64(u.Order),
-						Confirmations: int32(u.Confirmations),
-					})
-					return nil
-				})
-				return err
-			})
-			if err != nil {
-				log.Error(err.Error())
-				continue
-			}
-			log.Info("notify tx count", "txs", len(unTxs))
-			if len(unTxs) > 0 {
-				err := w.notificationRpc.NotifyTxsConfirmed(unTxs)
-				if err != nil {
-					log.Error(err.Error())
-					continue
-				}
-			}
-		}
-	}
-}
-
 func (w *Wallet) setOrder(syncOrder uint32) {
 	w.orderMutex.Lock()
-	defer w.orderMutex.Unlock()
-
 	w.syncOrder = syncOrder
+	w.orderMutex.Unlock()
+
+	w.syncStatus.update(func(s *SyncStatus) {
+		s.CurrentOrder = syncOrder
+	})
 }
 
 func (w *Wallet) setToOrder(toOrder uint32) {
@@ -1630,7 +1802,7 @@ func (w *Wallet) getToOrder() uint32 {
 }
 
 func (w *Wallet) walletAddress() ([]string, error) {
-	manager, err := w.Manager.FetchScopedKeyManager(waddrmgr.KeyScopeBIP0044)
+	manager, err := w.Manager.FetchScopedKeyManager(w.Manager.DefaultScope())
 	if err != nil {
 		return nil, err
 	}
@@ -1659,6 +1831,14 @@ func (w *Wallet) walletAddress() ([]string, error) {
 				addresses = append(addresses, addr.String())
 			}
 		}
+
+		// Watch the key pools as well, their addresses are handed out
+		// without registering them again.
+		pooled, err := w.keyPoolAddresses(addrNs)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, pooled...)
 		return nil
 	})
 	if err != nil {
@@ -1674,7 +1854,7 @@ func (w *Wallet) updateTxConfirm(confirmRs *cmds.TxConfirmResult) error {
 		log.Error("wallet can not find tx", "txid", confirmRs.Tx)
 		return err
 	}
-	status := w.txStatus(uint32(confirmRs.Confirms), confirmRs.IsValid, confirmRs.IsBlue, wtxmgr.TxRawIsCoinBase(tx), false)
+	status := w.txStatus(txConfirmations(tx), uint32(confirmRs.Confirms), confirmRs.IsValid, confirmRs.IsBlue, wtxmgr.TxRawIsCoinBase(tx), false)
 	if status < wtxmgr.TxStatusConfirmed {
 		log.Warn("updateTxConfirm tx status is unconfirmed", "TxConfirmResult", confirmRs)
 		return nil
@@ -1688,7 +1868,7 @@ func (w *Wallet) updateTxStatus(txRaw corejson.TxRawResult, status wtxmgr.TxStat
 		var bucket walletdb.ReadWriteBucket
 		var ok bool
 		ns := tx.ReadWriteBucket(wtxmgrNamespaceKey)
-		unTxNs := ns.NestedReadWriteBucket(wtxmgr.BucketUnConfirmed)
+		balances := w.newBalanceUpdater(tx)
 		txHash, err := hash.NewHashFromStr(txRaw.Txid)
 		if err != nil {
 			return err
@@ -1711,32 +1891,33 @@ func (w *Wallet) updateTxStatus(txRaw corejson.TxRawResult, status wtxmgr.TxStat
 			if err != nil {
 				return err
 			}
+			old := *out
 			out.Status = status
 			err = w.TxStore.UpdateAddrTxOut(bucket, out)
 			if err != nil {
 				return err
 			}
+			err = balances.update(&old, out)
+			if err != nil {
+				return err
+			}
 		}
-		if err := unTxNs.Delete(txHash.Bytes()); err != nil {
+		if err := w.TxStore.DeleteUnconfirmed(ns, txHash); err != nil {
 			return err
 		}
 		return nil
 	})
-	return err
-}
-
-func (w *Wallet) maxBlockOrder() (uint64, error) {
-	var blockCount string
-	var err error
-	blockCount, err = w.HttpClient.getblockCount()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	Order, err := strconv.ParseUint(blockCount, strIntBase, strIntBitSize32)
-	if err != nil {
-		return 0, err
+	if txHash, err := hash.NewHashFromStr(txRaw.Txid); err == nil {
+		w.confirms.remove(*txHash)
 	}
-	return Order, nil
+	return nil
+}
+
+func (w *Wallet) maxBlockOrder() (uint64, error) {
+	return w.HttpClient.GetBlockCount()
 }
 
 // NextAccount creates the next account and returns its account number.  The
@@ -1771,37 +1952,78 @@ func (w *Wallet) NextAccount(scope waddrmgr.KeyScope, name string) (uint32, erro
 	return account, err
 }
 
-// AccountBalances returns all accounts in the wallet and their balances.
-// Balances are determined by excluding transactions that have not met
-// requiredConfs confirmations.
-func (w *Wallet) AccountBalances(scope waddrmgr.KeyScope) ([]AccountBalanceResult, error) {
-	aaaRs, err := w.GetAccountAndAddress(scope)
+// RenameAccount sets the name for an account number to newName.
+func (w *Wallet) RenameAccount(scope waddrmgr.KeyScope, account uint32, newName string) error {
+	manager, err := w.Manager.FetchScopedKeyManager(scope)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	results := make([]AccountBalanceResult, len(aaaRs))
-	for _, token := range w.tokens.tokens {
-		id := types.CoinID(token.CoinId)
-		for index, aaa := range aaaRs {
-			results[index].AccountNumber = aaa.AccountNumber
-			results[index].AccountName = aaa.AccountName
-			balance := NewBalance(id)
-			for _, addr := range aaa.AddrsOutput {
-				balance.UnspentAmount.Value += addr.balanceMap[id].UnspentAmount.Value
-				balance.LockAmount.Value += addr.balanceMap[id].LockAmount.Value
-				balance.SpendAmount.Value += addr.balanceMap[id].SpendAmount.Value
-				balance.TotalAmount.Value += addr.balanceMap[id].TotalAmount.Value
-				balance.UnconfirmedAmount.Value += addr.balanceMap[id].UnconfirmedAmount.Value
 
-				balance.LockAmount.Id = addr.balanceMap[id].LockAmount.Id
-				balance.UnspentAmount.Id = addr.balanceMap[id].UnspentAmount.Id
-				balance.UnconfirmedAmount.Id = addr.balanceMap[id].UnconfirmedAmount.Id
-				balance.TotalAmount.Id = addr.balanceMap[id].TotalAmount.Id
-				balance.SpendAmount.Id = addr.balanceMap[id].SpendAmount.Id
+	return walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		return manager.RenameAccount(addrMgrNs, account, newName)
+	})
+}
+
+// SetAccountAddrType sets the type of the addresses handed out by an account,
+// waddrmgr.PubKeyHash or waddrmgr.SecpPubKey.
+func (w *Wallet) SetAccountAddrType(scope waddrmgr.KeyScope, account uint32, addrType waddrmgr.AddressType) error {
+	manager, err := w.Manager.FetchScopedKeyManager(scope)
+	if err != nil {
+		return err
+	}
 
+	err = walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		return manager.SetAccountAddrType(addrMgrNs, account, addrType)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Account address type changed", "account", account, "type", addrType.String())
+	return nil
+}
+
+// AccountBalances returns all accounts in the wallet and their balances,
+// read from the account balances kept by the transaction store.
+func (w *Wallet) AccountBalances(scope waddrmgr.KeyScope) ([]AccountBalanceResult, error) {
+	manager, err := w.Manager.FetchScopedKeyManager(scope)
+	if err != nil {
+		return nil, err
+	}
+	height := w.Manager.ChainHeight()
+	var results []AccountBalanceResult
+	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
+		addrNs := tx.ReadBucket(waddrmgrNamespaceKey)
+		ns := tx.ReadBucket(wtxmgrNamespaceKey)
+		lastAcct, err := manager.LastAccount(addrNs)
+		if err != nil {
+			return err
+		}
+		results = make([]AccountBalanceResult, lastAcct+2)
+		for i := range results[:len(results)-1] {
+			accountName, err := manager.AccountName(addrNs, uint32(i))
+			if err != nil {
+				return err
 			}
-			results[index].AccountBalanceList = append(results[index].AccountBalanceList, *balance)
+			results[i].AccountNumber = uint32(i)
+			results[i].AccountName = accountName
 		}
+		results[len(results)-1].AccountNumber = waddrmgr.ImportedAddrAccount
+		results[len(results)-1].AccountName = waddrmgr.ImportedAddrAccountName
+		for i := range results {
+			for _, token := range w.tokens.tokens {
+				balance, err := w.accountBalance(ns, results[i].AccountNumber, types.CoinID(token.CoinId), height)
+				if err != nil {
+					return err
+				}
+				results[i].AccountBalanceList = append(results[i].AccountBalanceList, *balance)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return results, nil
 }
@@ -1828,18 +2050,33 @@ func (w *Wallet) AccountNumber(scope waddrmgr.KeyScope, accountName string) (uin
 func (w *Wallet) NewAddress(
 	scope waddrmgr.KeyScope, account uint32) (types.Address, error) {
 	var (
-		addr types.Address
+		addr   types.Address
+		pooled []waddrmgr.ManagedAddress
 	)
 	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
 		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
 		var err error
 		addr, _, err = w.newAddress(addrMgrNs, account, scope)
+		if err != nil {
+			return err
+		}
+
+		// Top the key pool up again, the address handed out was taken
+		// from it.
+		manager, err := w.Manager.FetchScopedKeyManager(scope)
+		if err != nil {
+			return err
+		}
+		pooled, err = manager.FillKeyPool(addrMgrNs, account, KeyPoolSize())
 		return err
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	if err := w.notifyAddrs(pooled); err != nil {
+		log.Warn("notify key pool addresses", "error", err)
+	}
 	return addr, nil
 }
 
@@ -1851,10 +2088,18 @@ func (w *Wallet) newAddress(addrMgrNs walletdb.ReadWriteBucket, account uint32,
 		return nil, nil, err
 	}
 
-	// Get next address from wallet.
-	addr, err := manager.NextExternalAddresses(addrMgrNs, account, defaultNewAddressNumber)
-	if err != nil {
-		return nil, nil, err
+	// Get next address from wallet, skipping key pool addresses which
+	// already received outputs so that no address is handed out twice.
+	var addr []waddrmgr.ManagedAddress
+	for {
+		addr, err = manager.NextExternalAddresses(addrMgrNs, account, defaultNewAddressNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !addr[0].Used(addrMgrNs) {
+			break
+		}
+		log.Debug("Skipping used address", "address", addr[0].Address().Encode())
 	}
 
 	props, err := manager.AccountProperties(addrMgrNs, account)
@@ -1948,6 +2193,69 @@ func (w *Wallet) UnLockManager(passphrase []byte) error {
 	return nil
 }
 
+// ChangePassphrase changes the private passphrase, or the public one when
+// private is false, from old to new.  The change is written in a single
+// database transaction.  Scheduled backups are encrypted with the new private
+// passphrase from then on.
+func (w *Wallet) ChangePassphrase(old, new []byte, private bool) error {
+	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		return w.Manager.ChangePassphrase(addrMgrNs, old, new, private)
+	})
+	if err != nil {
+		return err
+	}
+	if private {
+		w.backupMu.Lock()
+		if w.backupKey != nil {
+			w.backupKey.Zero()
+			w.backupKey = nil
+		}
+		w.backupMu.Unlock()
+		w.setBackupKey(new)
+		log.Info("The private passphrase has been changed")
+	} else {
+		log.Info("The public passphrase has been changed")
+	}
+	return nil
+}
+
+// UpgradeKDF re-wraps the master keys of the private passphrase, and of the
+// public one when pubPass is not nil, under keys derived with kdf.  The
+// wallet must be unlocked and the passphrases are checked again.
+func (w *Wallet) UpgradeKDF(privPass, pubPass []byte, kdf *snacl.KDFParams) error {
+	old := w.Manager.KDFParams(true)
+	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		return w.Manager.UpgradeKDF(addrMgrNs, privPass, pubPass, kdf)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("The key derivation function has been upgraded", "from", old,
+		"to", kdf)
+	return nil
+}
+
+// createPendingScope creates the key scope added by a database upgrade, which
+// waits for the first unlock since it derives a new cointype key.
+func (w *Wallet) createPendingScope() {
+	var scope *waddrmgr.KeyScope
+	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
+		addrMgrNs := tx.ReadWriteBucket(waddrmgrNamespaceKey)
+		var err error
+		scope, err = w.Manager.CreatePendingScope(addrMgrNs)
+		return err
+	})
+	if err != nil {
+		log.Error("Could not create the pending key scope", "err", err.Error())
+		return
+	}
+	if scope != nil {
+		log.Info("Added key scope", "scope", scope.String())
+	}
+}
+
 // walletLocker manages the locked/unlocked state of a wallet.
 func (w *Wallet) walletLocker() {
 	var timeout <-chan time.Time
@@ -1970,6 +2278,8 @@ out:
 			} else {
 				log.Info("The wallet has been temporarily unlocked")
 			}
+			w.setBackupKey(req.passphrase)
+			w.createPendingScope()
 			req.err <- nil
 			continue
 
@@ -1996,24 +2306,23 @@ out:
 	w.wg.Done()
 }
 
-// AccountAddresses returns the addresses for every created address for an
-// account.
+// AccountAddresses returns the pay-to-pubkey-hash and the pay-to-pubkey
+// address of every created address for an account.
 func (w *Wallet) AccountAddresses(account uint32) (addrs []types.Address, err error) {
 	err = walletdb.View(w.db, func(tx walletdb.ReadTx) error {
 		addrMgrNs := tx.ReadBucket(waddrmgrNamespaceKey)
 		return w.Manager.ForEachAccountAddress(addrMgrNs, account, func(mAddr waddrmgr.ManagedAddress) error {
-			addrs = append(addrs, mAddr.Address())
 			// Get private key from wallet if it exists.
 			pka, ok := mAddr.(waddrmgr.ManagedPubKeyAddress)
 			if !ok {
 				return fmt.Errorf("address %s is not a key type", mAddr.Address())
 			}
-			pkaddr, err := address.NewSecpPubKeyAddress(pka.PubKey().SerializeCompressed(), w.chainParams)
+			pkhAddr, pkaddr, err := w.keyAddresses(pka)
 			if err != nil {
 				log.Error("PubKey Create Failed", mAddr.Address())
 				return err
 			}
-			addrs = append(addrs, pkaddr)
+			addrs = append(addrs, pkhAddr, pkaddr)
 			return nil
 		})
 	})
@@ -2093,27 +2402,19 @@ func (w *Wallet) GetUnspentAddrOutput(addr string, coin types.CoinID) ([]*wtxmgr
 	height := w.Manager.ChainHeight()
 	var utxos []*wtxmgr.AddrTxOutput
 	err := walletdb.View(w.db, func(tx walletdb.ReadTx) error {
-		hs := []byte(addr)
 		ns := tx.ReadBucket(wtxmgrNamespaceKey)
 		outns := ns.NestedReadBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, types.CoinID(coin)))
 		if outns == nil {
 			return nil
 		}
-		hsoutns := outns.NestedReadBucket(hs)
-		if hsoutns != nil {
-			_ = hsoutns.ForEach(func(k, v []byte) error {
-				outPut := wtxmgr.NewAddrTxOutput()
-				outPut, err := wtxmgr.DecodeAddrTxOutput(v)
-				if err != nil {
-					log.Error("readAddrTxOutput err", "err", err.Error())
-					return err
-				}
-
-				if outPut.Spend == wtxmgr.SpendStatusUnspent && outPut.Status == wtxmgr.TxStatusConfirmed && outPut.Locked <= height {
-					utxos = append(utxos, outPut)
-				}
-				return nil
-			})
+		err := w.TxStore.ForEachAddrTxOut(outns, addr, func(outPut *wtxmgr.AddrTxOutput) error {
+			if outPut.Spend == wtxmgr.SpendStatusUnspent && outPut.Status == wtxmgr.TxStatusConfirmed && outPut.Locked <= height {
+				utxos = append(utxos, outPut)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Error("readAddrTxOutput err", "err", err.Error())
 		}
 		return nil
 	})
@@ -2137,7 +2438,7 @@ func (w *Wallet) SendOutputs(coin2outputs []*TxOutput, coinId types.CoinID, acco
 	var addrs = make([]types.Address, 0)
 	var err error
 	if account == waddrmgr.AccountMergePayNum {
-		addrs, err = w.GetAccountAddress(waddrmgr.KeyScopeBIP0044)
+		addrs, err = w.GetAccountAddress(w.Manager.DefaultScope())
 	} else {
 		addrs, err = w.AccountAddresses(uint32(account))
 	}
@@ -2297,15 +2598,28 @@ func (w *Wallet) createTx(addrs []types.Address, coin2outputs []*TxOutput, coinI
 func (w *Wallet) updateUTXOSpent(UTXOs []*wtxmgr.AddrTxOutput, spentTx *wtxmgr.SpendTo) error {
 	err := walletdb.Update(w.db, func(tx walletdb.ReadWriteTx) error {
 		ns := tx.ReadWriteBucket(wtxmgrNamespaceKey)
+		balances := w.newBalanceUpdater(tx)
 		for _, txoutput := range UTXOs {
 			outns := ns.NestedAndCreateReadWriteBucket(wtxmgr.CoinBucket(wtxmgr.BucketAddrtxout, txoutput.Amount.Id))
+			old, err := w.TxStore.FetchAddrTxOut(outns, txoutput.Address, types.TxOutPoint{Hash: txoutput.TxId, OutIndex: txoutput.Index})
+			if err != nil {
+				return err
+			}
 			txoutput.Spend = wtxmgr.SpendStatusSpend
 			txoutput.SpendTo = spentTx
-			err := w.TxStore.UpdateAddrTxOut(outns, txoutput)
+			err = w.TxStore.UpdateAddrTxOut(outns, txoutput)
 			if err != nil {
 				log.Error("UpdateAddrTxOut to spend err", "err", err.Error())
 				return err
 			}
+			err = balances.update(old, txoutput)
+			if err != nil {
+				return err
+			}
+			err = w.TxStore.PutHistoryOutput(ns, txoutput, wtxmgr.HistoryUnminedOrder)
+			if err != nil {
+				return err
+			}
 		}
 		log.Trace("UpdateAddrTxOut to spend succ ")
 		return nil
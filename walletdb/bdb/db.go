@@ -62,6 +62,16 @@ func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
 	return tx.ReadWriteBucket(key)
 }
 
+// ForEachBucket invokes the passed function with the key of every top level
+// bucket.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) ForEachBucket(fn func(key []byte) error) error {
+	return convertErr(tx.boltTx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+		return fn(name)
+	}))
+}
+
 func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
 	boltBucket := tx.boltTx.Bucket(key)
 	if boltBucket == nil {
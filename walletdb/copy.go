@@ -0,0 +1,122 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package walletdb
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CopyDB copies every bucket and key/value pair of src into dst, which is
+// usually a newly created database of another driver.  src is read in a
+// single transaction, each top level bucket is written to dst in its own
+// transaction.
+func CopyDB(dst, src DB) error {
+	return View(src, func(srcTx ReadTx) error {
+		return srcTx.ForEachBucket(func(key []byte) error {
+			return Update(dst, func(dstTx ReadWriteTx) error {
+				dstBucket, err := dstTx.CreateTopLevelBucket(key)
+				if err != nil {
+					return fmt.Errorf("create bucket %x: %w", key, err)
+				}
+				return copyBucket(dstBucket, srcTx.ReadBucket(key))
+			})
+		})
+	})
+}
+
+// copyBucket recursively copies the contents of src into dst.
+func copyBucket(dst ReadWriteBucket, src ReadBucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested := src.NestedReadBucket(k)
+		if nested == nil {
+			// A nil value which is not a bucket is an empty value.
+			return dst.Put(k, v)
+		}
+		dstNested, err := dst.CreateBucket(k)
+		if err != nil {
+			return fmt.Errorf("create bucket %x: %w", k, err)
+		}
+		return copyBucket(dstNested, nested)
+	})
+}
+
+// CompareDB returns an error describing the first difference between the
+// buckets and key/value pairs of a and b, or nil if they hold the same data.
+func CompareDB(a, b DB) error {
+	return View(a, func(aTx ReadTx) error {
+		return View(b, func(bTx ReadTx) error {
+			aKeys, err := topLevelBuckets(aTx)
+			if err != nil {
+				return err
+			}
+			bKeys, err := topLevelBuckets(bTx)
+			if err != nil {
+				return err
+			}
+			if len(aKeys) != len(bKeys) {
+				return fmt.Errorf("%d top level buckets, want %d",
+					len(bKeys), len(aKeys))
+			}
+			for i, key := range aKeys {
+				if !bytes.Equal(key, bKeys[i]) {
+					return fmt.Errorf("top level bucket %x, want %x",
+						bKeys[i], key)
+				}
+				err := compareBucket(fmt.Sprintf("%x", key),
+					aTx.ReadBucket(key), bTx.ReadBucket(key))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func topLevelBuckets(tx ReadTx) ([][]byte, error) {
+	var keys [][]byte
+	err := tx.ForEachBucket(func(key []byte) error {
+		keys = append(keys, append([]byte(nil), key...))
+		return nil
+	})
+	return keys, err
+}
+
+// compareBucket recursively compares the buckets a and b found at path.
+func compareBucket(path string, a, b ReadBucket) error {
+	if a == nil || b == nil {
+		return fmt.Errorf("bucket %s: missing", path)
+	}
+	aCursor, bCursor := a.ReadCursor(), b.ReadCursor()
+	ak, av := aCursor.First()
+	bk, bv := bCursor.First()
+	for ak != nil || bk != nil {
+		switch {
+		case ak == nil:
+			return fmt.Errorf("bucket %s: unexpected key %x", path, bk)
+		case !bytes.Equal(ak, bk):
+			return fmt.Errorf("bucket %s: key %x, want %x", path, bk, ak)
+		}
+		aNested, bNested := a.NestedReadBucket(ak), b.NestedReadBucket(bk)
+		switch {
+		case (aNested == nil) != (bNested == nil):
+			return fmt.Errorf("bucket %s: key %x: bucket mismatch", path, ak)
+		case aNested != nil:
+			err := compareBucket(fmt.Sprintf("%s/%x", path, ak), aNested, bNested)
+			if err != nil {
+				return err
+			}
+		case !bytes.Equal(av, bv):
+			return fmt.Errorf("bucket %s: key %x: value mismatch", path, ak)
+		}
+		ak, av = aCursor.Next()
+		bk, bv = bCursor.Next()
+	}
+	return nil
+}
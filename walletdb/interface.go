@@ -16,6 +16,10 @@ type ReadTx interface {
 	// described by the key does not exist, nil is returned.
 	ReadBucket(key []byte) ReadBucket
 
+	// ForEachBucket invokes the passed function with the key of every top
+	// level bucket.
+	ForEachBucket(func(key []byte) error) error
+
 	// Rollback closes the transaction, discarding changes (if any) if the
 	// database was modified by a write transaction.
 	Rollback() error
@@ -0,0 +1,724 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/bdb"
+)
+
+// The nested bucket model is mapped onto key prefixes.  Every bucket has an
+// id, and every key/value pair or nested bucket of a bucket is stored under
+// the 8 byte big endian id of the bucket followed by its key.  The stored
+// value starts with a record type: a key/value pair is followed by the value,
+// a nested bucket by the id of the nested bucket.
+//
+// Bucket id 0 holds the metadata of the database and id 1 is the root bucket
+// holding the top level buckets.
+const (
+	metaBucketID = 0
+	rootBucketID = 1
+
+	recordValue  = 0
+	recordBucket = 1
+
+	// dbVersion is the version of the key layout.
+	dbVersion = 1
+
+	// maxKeySize and maxValueSize match the limits of the bdb driver, so a
+	// database accepted here can be copied into a bolt file.
+	maxKeySize   = 32768
+	maxValueSize = (1 << 31) - 2
+)
+
+var (
+	versionKey      = dataKey(metaBucketID, []byte("version"))
+	nextBucketIDKey = dataKey(metaBucketID, []byte("nextbucketid"))
+)
+
+// dataKey returns the stored key of key in the bucket id.
+func dataKey(id uint64, key []byte) []byte {
+	k := make([]byte, 8+len(key))
+	binary.BigEndian.PutUint64(k, id)
+	copy(k[8:], key)
+	return k
+}
+
+func bucketRecord(id uint64) []byte {
+	record := make([]byte, 9)
+	record[0] = recordBucket
+	binary.BigEndian.PutUint64(record[1:], id)
+	return record
+}
+
+// convertErr converts some leveldb errors to the equivalent walletdb error.
+func convertErr(err error) error {
+	switch {
+	case err == leveldb.ErrClosed:
+		return walletdb.ErrDbNotOpen
+	case errors.IsCorrupted(err):
+		return walletdb.ErrInvalid
+	}
+
+	// Return the original error if none of the above applies.
+	return err
+}
+
+// reader is implemented by leveldb snapshots and transactions.
+type reader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// transaction represents a database transaction.  It can either by read-only or
+// read-write and implements the walletdb Tx interfaces.  A read-only
+// transaction reads a leveldb snapshot, a read-write transaction a leveldb
+// transaction.
+type transaction struct {
+	snap *leveldb.Snapshot
+	ltx  *leveldb.Transaction
+	r    reader
+
+	// writes counts the writes of the transaction.  Iterators only see the
+	// writes made before they were created, cursors use the count to
+	// recreate them.
+	writes uint64
+
+	iters    []iterator.Iterator
+	closed   bool
+	onCommit []func()
+}
+
+// get returns the stored value of key, or nil if it does not exist.
+func (tx *transaction) get(key []byte) []byte {
+	if tx.closed {
+		return nil
+	}
+	record, err := tx.r.Get(key, nil)
+	if err != nil {
+		return nil
+	}
+	return record
+}
+
+func (tx *transaction) put(key, record []byte) error {
+	tx.writes++
+	return convertErr(tx.ltx.Put(key, record, nil))
+}
+
+func (tx *transaction) delete(key []byte) error {
+	tx.writes++
+	return convertErr(tx.ltx.Delete(key, nil))
+}
+
+// newIterator returns an iterator over the keys of the bucket id.  It is
+// released when the transaction is closed.
+func (tx *transaction) newIterator(id uint64) iterator.Iterator {
+	iter := tx.r.NewIterator(util.BytesPrefix(dataKey(id, nil)), nil)
+	tx.iters = append(tx.iters, iter)
+	return iter
+}
+
+// writeErr returns the error of a write attempted in the transaction.
+func (tx *transaction) writeErr() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	if tx.ltx == nil {
+		return walletdb.ErrTxNotWritable
+	}
+	return nil
+}
+
+// nextBucketID allocates the id of a new bucket.
+func (tx *transaction) nextBucketID() (uint64, error) {
+	id := uint64(rootBucketID + 1)
+	if v := tx.get(nextBucketIDKey); len(v) == 8 {
+		id = binary.BigEndian.Uint64(v)
+	}
+	next := make([]byte, 8)
+	binary.BigEndian.PutUint64(next, id+1)
+	return id, tx.put(nextBucketIDKey, next)
+}
+
+func (tx *transaction) rootBucket() *bucket {
+	return &bucket{tx: tx, id: rootBucketID}
+}
+
+func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
+	return tx.ReadWriteBucket(key)
+}
+
+// ForEachBucket invokes the passed function with the key of every top level
+// bucket.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) ForEachBucket(fn func(key []byte) error) error {
+	return tx.rootBucket().ForEach(func(k, _ []byte) error {
+		return fn(k)
+	})
+}
+
+func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	return tx.rootBucket().NestedReadWriteBucket(key)
+}
+
+func (tx *transaction) CreateTopLevelBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	return tx.rootBucket().CreateBucket(key)
+}
+
+func (tx *transaction) DeleteTopLevelBucket(key []byte) error {
+	return tx.rootBucket().DeleteNestedBucket(key)
+}
+
+// Commit commits all changes that have been made through the root bucket and
+// all of its sub-buckets to persistent storage.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) Commit() error {
+	if err := tx.writeErr(); err != nil {
+		return err
+	}
+	tx.close()
+	if err := tx.ltx.Commit(); err != nil {
+		tx.ltx.Discard()
+		return convertErr(err)
+	}
+	for _, f := range tx.onCommit {
+		f()
+	}
+	return nil
+}
+
+// Rollback undoes all changes that have been made to the root bucket and all of
+// its sub-buckets.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) Rollback() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	tx.close()
+	if tx.ltx != nil {
+		tx.ltx.Discard()
+	} else {
+		tx.snap.Release()
+	}
+	return nil
+}
+
+// close releases the iterators of the transaction.
+func (tx *transaction) close() {
+	tx.closed = true
+	for _, iter := range tx.iters {
+		iter.Release()
+	}
+	tx.iters = nil
+}
+
+// OnCommit takes a function closure that will be executed when the transaction
+// successfully gets committed.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) OnCommit(f func()) {
+	tx.onCommit = append(tx.onCommit, f)
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs
+// and implements the walletdb Bucket interfaces.
+type bucket struct {
+	tx *transaction
+	id uint64
+}
+
+// Enforce bucket implements the walletdb Bucket interfaces.
+var _ walletdb.ReadWriteBucket = (*bucket)(nil)
+
+// nestedID returns the id of the nested bucket key.
+func (b *bucket) nestedID(key []byte) (uint64, bool) {
+	record := b.tx.get(dataKey(b.id, key))
+	if len(record) != 9 || record[0] != recordBucket {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(record[1:]), true
+}
+
+// NestedReadWriteBucket retrieves a nested bucket with the given key.  Returns
+// nil if the bucket does not exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) NestedReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	id, ok := b.nestedID(key)
+	// Don't return a non-nil interface to a nil pointer.
+	if !ok {
+		return nil
+	}
+	return &bucket{tx: b.tx, id: id}
+}
+
+func (b *bucket) NestedAndCreateReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	buck, err := b.CreateBucketIfNotExists(key)
+	if err != nil {
+		return nil
+	}
+	return buck
+}
+
+func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
+	return b.NestedReadWriteBucket(key)
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+// Returns ErrBucketExists if the bucket already exists, ErrBucketNameRequired
+// if the key is empty, or ErrIncompatibleValue if the key holds a value.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	if err := b.tx.writeErr(); err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, walletdb.ErrBucketNameRequired
+	}
+	if len(key) > maxKeySize {
+		return nil, walletdb.ErrKeyTooLarge
+	}
+	k := dataKey(b.id, key)
+	if record := b.tx.get(k); record != nil {
+		if record[0] == recordBucket {
+			return nil, walletdb.ErrBucketExists
+		}
+		return nil, walletdb.ErrIncompatibleValue
+	}
+	id, err := b.tx.nextBucketID()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.tx.put(k, bucketRecord(id)); err != nil {
+		return nil, err
+	}
+	return &bucket{tx: b.tx, id: id}, nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the
+// given key if it does not already exist.  Returns ErrBucketNameRequired if the
+// key is empty or ErrIncompatibleValue if the key holds a value.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (walletdb.ReadWriteBucket, error) {
+	if err := b.tx.writeErr(); err != nil {
+		return nil, err
+	}
+	if id, ok := b.nestedID(key); ok {
+		return &bucket{tx: b.tx, id: id}, nil
+	}
+	return b.CreateBucket(key)
+}
+
+// DeleteNestedBucket removes a nested bucket with the given key.  Returns
+// ErrTxNotWritable if attempted against a read-only transaction and
+// ErrBucketNotFound if the specified bucket does not exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) DeleteNestedBucket(key []byte) error {
+	if err := b.tx.writeErr(); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return walletdb.ErrIncompatibleValue
+	}
+	k := dataKey(b.id, key)
+	record := b.tx.get(k)
+	if record == nil {
+		return walletdb.ErrBucketNotFound
+	}
+	if record[0] != recordBucket {
+		return walletdb.ErrIncompatibleValue
+	}
+	if err := b.tx.deleteBucketData(binary.BigEndian.Uint64(record[1:])); err != nil {
+		return err
+	}
+	return b.tx.delete(k)
+}
+
+// deleteBucketData removes the keys of the bucket id and all of its nested
+// buckets.
+func (tx *transaction) deleteBucketData(id uint64) error {
+	iter := tx.r.NewIterator(util.BytesPrefix(dataKey(id, nil)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		record := iter.Value()
+		if len(record) == 9 && record[0] == recordBucket {
+			err := tx.deleteBucketData(binary.BigEndian.Uint64(record[1:]))
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.delete(append([]byte(nil), iter.Key()...)); err != nil {
+			return err
+		}
+	}
+	return convertErr(iter.Error())
+}
+
+// recordValueOf returns the value of a stored record, or nil for a bucket.
+func recordValueOf(record []byte) []byte {
+	if len(record) == 0 || record[0] != recordValue {
+		return nil
+	}
+	return record[1:]
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket.
+// This includes nested buckets, in which case the value is nil, but it does not
+// include the key/value pairs within those nested buckets.
+//
+// NOTE: The values returned by this function are only valid during a
+// transaction.  Attempting to access them after a transaction has ended will
+// likely result in an access violation.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	if b.tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	iter := b.tx.r.NewIterator(util.BytesPrefix(dataKey(b.id, nil)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		k := append([]byte(nil), iter.Key()[8:]...)
+		v := recordValueOf(iter.Value())
+		if v != nil {
+			v = append([]byte{}, v...)
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return convertErr(iter.Error())
+}
+
+// Put saves the specified key/value pair to the bucket.  Keys that do not
+// already exist are added and keys that already exist are overwritten.  Returns
+// ErrTxNotWritable if attempted against a read-only transaction.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Put(key, value []byte) error {
+	if err := b.tx.writeErr(); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return walletdb.ErrKeyRequired
+	}
+	if len(key) > maxKeySize {
+		return walletdb.ErrKeyTooLarge
+	}
+	if int64(len(value)) > maxValueSize {
+		return walletdb.ErrValueTooLarge
+	}
+	k := dataKey(b.id, key)
+	if record := b.tx.get(k); len(record) > 0 && record[0] == recordBucket {
+		return walletdb.ErrIncompatibleValue
+	}
+	record := make([]byte, 1+len(value))
+	record[0] = recordValue
+	copy(record[1:], value)
+	return b.tx.put(k, record)
+}
+
+// Get returns the value for the given key.  Returns nil if the key does
+// not exist in this bucket (or nested buckets).
+//
+// NOTE: The value returned by this function is only valid during a
+// transaction.  Attempting to access it after a transaction has ended
+// will likely result in an access violation.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	return recordValueOf(b.tx.get(dataKey(b.id, key)))
+}
+
+// Delete removes the specified key from the bucket.  Deleting a key that does
+// not exist does not return an error.  Returns ErrTxNotWritable if attempted
+// against a read-only transaction.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Delete(key []byte) error {
+	if err := b.tx.writeErr(); err != nil {
+		return err
+	}
+	k := dataKey(b.id, key)
+	record := b.tx.get(k)
+	if record == nil {
+		return nil
+	}
+	if record[0] == recordBucket {
+		return walletdb.ErrIncompatibleValue
+	}
+	return b.tx.delete(k)
+}
+
+func (b *bucket) ReadCursor() walletdb.ReadCursor {
+	return b.ReadWriteCursor()
+}
+
+// ReadWriteCursor returns a new cursor, allowing for iteration over the bucket's
+// key/value pairs and nested buckets in forward or backward order.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
+	return &cursor{bucket: b}
+}
+
+// Tx returns the bucket's transaction.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Tx() walletdb.ReadWriteTx {
+	return b.tx
+}
+
+// cursor represents a cursor over key/value pairs and nested buckets of a
+// bucket.
+//
+// A leveldb iterator does not see the writes made after it was created, so
+// the cursor recreates its iterator at its current key when the transaction
+// was written to.
+type cursor struct {
+	bucket *bucket
+	iter   iterator.Iterator
+	writes uint64
+
+	// key is the stored key the cursor is at, nil if it is not positioned.
+	key []byte
+}
+
+// iterator returns the iterator of the cursor and whether it was recreated.
+func (c *cursor) iterator() (iterator.Iterator, bool) {
+	tx := c.bucket.tx
+	if c.iter != nil && c.writes == tx.writes {
+		return c.iter, false
+	}
+	c.iter = tx.newIterator(c.bucket.id)
+	c.writes = tx.writes
+	return c.iter, true
+}
+
+// result positions the cursor at the current key of the iterator and returns
+// the pair, ok reports whether the iterator is at a key.
+func (c *cursor) result(ok bool) (key, value []byte) {
+	if !ok || c.bucket.tx.closed {
+		c.key = nil
+		return nil, nil
+	}
+	c.key = append(c.key[:0], c.iter.Key()...)
+	return c.key[8:], recordValueOf(c.iter.Value())
+}
+
+// Delete removes the current key/value pair the cursor is at.  Returns
+// ErrTxNotWritable if attempted on a read-only transaction, or
+// ErrIncompatibleValue if attempted when the cursor points to a nested bucket.
+//
+// This function is part of the walletdb.ReadWriteCursor interface implementation.
+func (c *cursor) Delete() error {
+	if err := c.bucket.tx.writeErr(); err != nil {
+		return err
+	}
+	if c.key == nil {
+		return nil
+	}
+	return c.bucket.Delete(c.key[8:])
+}
+
+// First positions the cursor at the first key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) First() (key, value []byte) {
+	if c.bucket.tx.closed {
+		return nil, nil
+	}
+	iter, _ := c.iterator()
+	return c.result(iter.First())
+}
+
+// Last positions the cursor at the last key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Last() (key, value []byte) {
+	if c.bucket.tx.closed {
+		return nil, nil
+	}
+	iter, _ := c.iterator()
+	return c.result(iter.Last())
+}
+
+// Next moves the cursor one key/value pair forward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Next() (key, value []byte) {
+	if c.key == nil || c.bucket.tx.closed {
+		return nil, nil
+	}
+	iter, renewed := c.iterator()
+	if !renewed {
+		return c.result(iter.Next())
+	}
+	if !iter.Seek(c.key) {
+		return c.result(false)
+	}
+	if bytes.Equal(iter.Key(), c.key) {
+		return c.result(iter.Next())
+	}
+	return c.result(true)
+}
+
+// Prev moves the cursor one key/value pair backward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Prev() (key, value []byte) {
+	if c.key == nil || c.bucket.tx.closed {
+		return nil, nil
+	}
+	iter, renewed := c.iterator()
+	if !renewed {
+		return c.result(iter.Prev())
+	}
+	if iter.Seek(c.key) {
+		return c.result(iter.Prev())
+	}
+	return c.result(iter.Last())
+}
+
+// Seek positions the cursor at the passed seek key. If the key does not exist,
+// the cursor is moved to the next key after seek. Returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Seek(seek []byte) (key, value []byte) {
+	if c.bucket.tx.closed {
+		return nil, nil
+	}
+	iter, _ := c.iterator()
+	return c.result(iter.Seek(dataKey(c.bucket.id, seek)))
+}
+
+// db represents a collection of namespaces which are persisted in a leveldb
+// directory and implements the walletdb.Db interface.
+type db struct {
+	ldb  *leveldb.DB
+	path string
+}
+
+// Enforce db implements the walletdb.Db interface.
+var _ walletdb.DB = (*db)(nil)
+
+func (db *db) BeginReadTx() (walletdb.ReadTx, error) {
+	snap, err := db.ldb.GetSnapshot()
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return &transaction{snap: snap, r: snap}, nil
+}
+
+// BeginReadWriteTx starts a read-write transaction.  The transaction holds
+// the exclusive write lock of the database, so the call blocks until any
+// other read-write transaction is committed or rolled back.  Read-only
+// transactions are not blocked by it.
+func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
+	ltx, err := db.ldb.OpenTransaction()
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	return &transaction{ltx: ltx, r: ltx}, nil
+}
+
+// Copy writes a copy of the database to the provided writer in the bolt file
+// format used by the bdb driver, so a backup can be opened by any wallet.
+// This call will start a read-only transaction to perform all operations.
+//
+// This function is part of the walletdb.Db interface implementation.
+func (db *db) Copy(w io.Writer) error {
+	dir, err := os.MkdirTemp("", "ldb-copy")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "wallet.db")
+	boltDB, err := walletdb.Create("bdb", path)
+	if err != nil {
+		return err
+	}
+	err = walletdb.CopyDB(boltDB, db)
+	if closeErr := boltDB.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Close cleanly shuts down the database and syncs all data.
+//
+// This function is part of the walletdb.Db interface implementation.
+func (db *db) Close() error {
+	return convertErr(db.ldb.Close())
+}
+
+// dirExists reports whether the named directory exists.
+func dirExists(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+// openDB opens the database at the provided path.  walletdb.ErrDbDoesNotExist
+// is returned if the database doesn't exist and the create flag is not set.
+func openDB(dbPath string, create bool) (walletdb.DB, error) {
+	if !create && !dirExists(dbPath) {
+		return nil, walletdb.ErrDbDoesNotExist
+	}
+
+	ldb, err := leveldb.OpenFile(dbPath, &opt.Options{ErrorIfMissing: !create})
+	if err != nil {
+		return nil, convertErr(err)
+	}
+
+	version, err := ldb.Get(versionKey, nil)
+	switch {
+	case err == leveldb.ErrNotFound && !create:
+		err = walletdb.ErrInvalid
+	case err == leveldb.ErrNotFound:
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, dbVersion)
+		err = ldb.Put(versionKey, v, &opt.WriteOptions{Sync: true})
+	case err == nil && (len(version) != 4 ||
+		binary.BigEndian.Uint32(version) != dbVersion):
+		err = walletdb.ErrInvalid
+	}
+	if err != nil {
+		ldb.Close()
+		return nil, convertErr(err)
+	}
+	return &db{ldb: ldb, path: dbPath}, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package ldb implements a walletdb driver backed by goleveldb.
+//
+// Read-write transactions are leveldb transactions, which hold an exclusive
+// write lock on the database until they are committed or rolled back: there
+// is a single writer at a time and BeginReadWriteTx blocks while another
+// read-write transaction is open, so a goroutine must never open a second
+// one before finishing its first.  Read-only transactions work on snapshots
+// and are never blocked by the writer.
+package ldb
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+const (
+	dbType = "ldb"
+)
+
+// parseArgs parses the arguments from the walletdb Open/Create methods.
+func parseArgs(funcName string, args ...interface{}) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("invalid arguments to %s.%s -- "+
+			"expected database path", dbType, funcName)
+	}
+
+	dbPath, ok := args[0].(string)
+	if !ok {
+		return "", fmt.Errorf("first argument to %s.%s is invalid -- "+
+			"expected database path string", dbType, funcName)
+	}
+
+	return dbPath, nil
+}
+
+// openDBDriver is the callback provided during driver registration that opens
+// an existing database for use.
+func openDBDriver(args ...interface{}) (walletdb.DB, error) {
+	dbPath, err := parseArgs("Open", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDB(dbPath, false)
+}
+
+// createDBDriver is the callback provided during driver registration that
+// creates, initializes, and opens a database for use.
+func createDBDriver(args ...interface{}) (walletdb.DB, error) {
+	dbPath, err := parseArgs("Create", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return openDB(dbPath, true)
+}
+
+func init() {
+	// Register the driver.
+	driver := walletdb.Driver{
+		DbType: dbType,
+		Create: createDBDriver,
+		Open:   openDBDriver,
+	}
+	if err := walletdb.RegisterDriver(driver); err != nil {
+		panic(fmt.Sprintf("Failed to regiser database driver '%s': %v",
+			dbType, err))
+	}
+}
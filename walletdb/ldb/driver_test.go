@@ -0,0 +1,241 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ldb_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/ldb"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "ldb"
+
+// TestCreateOpenFail ensures that errors related to creating and opening a
+// database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	dir := t.TempDir()
+
+	// Ensure that attempting to open a database that doesn't exist returns
+	// the expected error.
+	wantErr := walletdb.ErrDbDoesNotExist
+	if _, err := walletdb.Open(dbType, filepath.Join(dir, "noexist.ldb")); err != wantErr {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with the wrong number of
+	// parameters returns the expected error.
+	wantErr = fmt.Errorf("invalid arguments to %s.Open -- expected "+
+		"database path", dbType)
+	if _, err := walletdb.Open(dbType, 1, 2, 3); err.Error() != wantErr.Error() {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with an invalid type for
+	// the first parameter returns the expected error.
+	wantErr = fmt.Errorf("first argument to %s.Open is invalid -- "+
+		"expected database path string", dbType)
+	if _, err := walletdb.Open(dbType, 1); err.Error() != wantErr.Error() {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to create a database with the wrong number of
+	// parameters returns the expected error.
+	wantErr = fmt.Errorf("invalid arguments to %s.Create -- expected "+
+		"database path", dbType)
+	if _, err := walletdb.Create(dbType, 1, 2, 3); err.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with an invalid type for
+	// the first parameter returns the expected error.
+	wantErr = fmt.Errorf("first argument to %s.Create is invalid -- "+
+		"expected database path string", dbType)
+	if _, err := walletdb.Create(dbType, 1); err.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure operations against a closed database return the expected
+	// error.
+	db, err := walletdb.Create(dbType, filepath.Join(dir, "createfail.ldb"))
+	if err != nil {
+		t.Errorf("Create: unexpected error: %v", err)
+		return
+	}
+	db.Close()
+
+	wantErr = walletdb.ErrDbNotOpen
+	if _, err := db.BeginReadTx(); err != wantErr {
+		t.Errorf("BeginReadTx: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+	if _, err := db.BeginReadWriteTx(); err != wantErr {
+		t.Errorf("BeginReadWriteTx: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+}
+
+// TestCursorWrites ensures a cursor sees the writes made to its bucket while
+// it iterates.
+func TestCursorWrites(t *testing.T) {
+	db, err := walletdb.Create(dbType, filepath.Join(t.TempDir(), "cursor.ldb"))
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer db.Close()
+
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns, err := tx.CreateTopLevelBucket([]byte("ns"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "c", "e"} {
+			if err := ns.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+
+		// Delete the current key, insert keys ahead and behind the
+		// cursor, and ensure the iteration follows the writes.
+		var got []string
+		c := ns.ReadWriteCursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			got = append(got, string(k))
+			switch string(k) {
+			case "a":
+				if err := ns.Put([]byte("d"), []byte("d")); err != nil {
+					return err
+				}
+			case "c":
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				if err := ns.Put([]byte("b"), []byte("b")); err != nil {
+					return err
+				}
+			}
+		}
+		want := []string{"a", "c", "d", "e"}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("forward iteration: got %v, want %v", got, want)
+		}
+
+		got = got[:0]
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			got = append(got, string(k))
+		}
+		want = []string{"e", "d", "b", "a"}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("backward iteration: got %v, want %v", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCopy ensures that a wallet database can be migrated between the bdb
+// and ldb drivers, and that the copy of an ldb database can be opened with
+// the bdb driver.
+func TestCopy(t *testing.T) {
+	dir := t.TempDir()
+	boltDB, err := walletdb.Create("bdb", filepath.Join(dir, "wallet.db"))
+	if err != nil {
+		t.Fatalf("Failed to create test database (bdb) %v", err)
+	}
+	defer boltDB.Close()
+
+	err = walletdb.Update(boltDB, func(tx walletdb.ReadWriteTx) error {
+		for _, ns := range []string{"ns1", "ns2"} {
+			bucket, err := tx.CreateTopLevelBucket([]byte(ns))
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 100; i++ {
+				nested, err := bucket.CreateBucket([]byte(fmt.Sprintf("bucket%02d", i)))
+				if err != nil {
+					return err
+				}
+				for j := 0; j < 10; j++ {
+					key := []byte(fmt.Sprintf("key%d", j))
+					value := []byte(fmt.Sprintf("%s-%d-%d", ns, i, j))
+					if err := nested.Put(key, value); err != nil {
+						return err
+					}
+					if err := bucket.Put(append(key, byte(i)), value); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levelDB, err := walletdb.Create(dbType, filepath.Join(dir, "wallet.ldb"))
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer levelDB.Close()
+
+	if err := walletdb.CopyDB(levelDB, boltDB); err != nil {
+		t.Fatalf("CopyDB: unexpected error: %v", err)
+	}
+	if err := walletdb.CompareDB(boltDB, levelDB); err != nil {
+		t.Fatalf("CompareDB: unexpected error: %v", err)
+	}
+
+	// A difference must be reported.
+	err = walletdb.Update(levelDB, func(tx walletdb.ReadWriteTx) error {
+		return tx.ReadWriteBucket([]byte("ns2")).
+			NestedReadWriteBucket([]byte("bucket50")).
+			Put([]byte("key5"), []byte("changed"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := walletdb.CompareDB(boltDB, levelDB); err == nil {
+		t.Fatalf("CompareDB: expected a value mismatch")
+	}
+
+	// Copy writes a bolt file.
+	var buf bytes.Buffer
+	if err := levelDB.Copy(&buf); err != nil {
+		t.Fatalf("Copy: unexpected error: %v", err)
+	}
+	copyPath := filepath.Join(dir, "copy.db")
+	if err := os.WriteFile(copyPath, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	copyDB, err := walletdb.Open("bdb", copyPath)
+	if err != nil {
+		t.Fatalf("Failed to open copied database: %v", err)
+	}
+	defer copyDB.Close()
+	if err := walletdb.CompareDB(levelDB, copyDB); err != nil {
+		t.Fatalf("CompareDB: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ldb_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/walletdbtest"
+)
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "interfacetest.ldb")
+	walletdbtest.TestInterface(t, dbType, dbPath)
+}
@@ -0,0 +1,659 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+)
+
+const (
+	// maxKeySize and maxValueSize match the limits of the bdb driver, so a
+	// database accepted here can be copied into a bolt file.
+	maxKeySize   = bbolt.MaxKeySize
+	maxValueSize = bbolt.MaxValueSize
+)
+
+// entry is a key/value pair or a nested bucket.  Entries are never modified
+// in place, a changed entry is replaced in the map of its bucket.
+type entry struct {
+	value  []byte
+	bucket *bucketData
+}
+
+// bucketData holds the contents of a bucket.  Committed bucket data is shared
+// by all transactions and never modified.  A read-write transaction copies
+// the data of every bucket it opens and is the owner of these copies, which
+// it changes in place.
+type bucketData struct {
+	owner *transaction
+	keys  []string
+	items map[string]entry
+}
+
+func newBucketData(owner *transaction) *bucketData {
+	return &bucketData{owner: owner, items: make(map[string]entry)}
+}
+
+func (d *bucketData) clone(owner *transaction) *bucketData {
+	c := &bucketData{
+		owner: owner,
+		keys:  append([]string(nil), d.keys...),
+		items: make(map[string]entry, len(d.items)),
+	}
+	for k, e := range d.items {
+		c.items[k] = e
+	}
+	return c
+}
+
+// put sets the entry of key, keeping keys sorted.
+func (d *bucketData) put(key string, e entry) {
+	if _, ok := d.items[key]; !ok {
+		i := sort.SearchStrings(d.keys, key)
+		d.keys = append(d.keys, "")
+		copy(d.keys[i+1:], d.keys[i:])
+		d.keys[i] = key
+	}
+	d.items[key] = e
+}
+
+func (d *bucketData) delete(key string) {
+	if _, ok := d.items[key]; !ok {
+		return
+	}
+	delete(d.items, key)
+	i := sort.SearchStrings(d.keys, key)
+	d.keys = append(d.keys[:i], d.keys[i+1:]...)
+}
+
+// transaction represents a database transaction.  It can either by read-only or
+// read-write and implements the walletdb Tx interfaces.  The transaction
+// provides a root bucket against which all read and writes occur.
+type transaction struct {
+	db       *db
+	root     *bucketData
+	writable bool
+	closed   bool
+	onCommit []func()
+}
+
+// rootBucket returns the bucket holding the top level buckets.
+func (tx *transaction) rootBucket() *bucket {
+	return &bucket{tx: tx, data: tx.root}
+}
+
+func (tx *transaction) ReadBucket(key []byte) walletdb.ReadBucket {
+	return tx.ReadWriteBucket(key)
+}
+
+// ForEachBucket invokes the passed function with the key of every top level
+// bucket.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) ForEachBucket(fn func(key []byte) error) error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	return tx.rootBucket().ForEach(func(k, _ []byte) error {
+		return fn(k)
+	})
+}
+
+func (tx *transaction) ReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	return tx.rootBucket().NestedReadWriteBucket(key)
+}
+
+func (tx *transaction) CreateTopLevelBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	return tx.rootBucket().CreateBucket(key)
+}
+
+func (tx *transaction) DeleteTopLevelBucket(key []byte) error {
+	return tx.rootBucket().DeleteNestedBucket(key)
+}
+
+// Commit makes all changes that have been made through the root bucket and
+// all of its sub-buckets visible to transactions started afterwards.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) Commit() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	if !tx.writable {
+		return walletdb.ErrTxNotWritable
+	}
+
+	tx.db.mu.Lock()
+	tx.db.root = tx.root
+	tx.db.mu.Unlock()
+
+	tx.close()
+	for _, f := range tx.onCommit {
+		f()
+	}
+	return nil
+}
+
+// Rollback undoes all changes that have been made to the root bucket and all of
+// its sub-buckets.
+//
+// This function is part of the walletdb.ReadTx interface implementation.
+func (tx *transaction) Rollback() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	tx.close()
+	return nil
+}
+
+func (tx *transaction) close() {
+	tx.closed = true
+	tx.root = nil
+	if tx.writable {
+		tx.db.writer.Unlock()
+	}
+}
+
+// OnCommit takes a function closure that will be executed when the transaction
+// successfully gets committed.
+//
+// This function is part of the walletdb.ReadWriteTx interface implementation.
+func (tx *transaction) OnCommit(f func()) {
+	tx.onCommit = append(tx.onCommit, f)
+}
+
+// writeErr returns the error of a write attempted in the transaction.
+func (tx *transaction) writeErr() error {
+	if tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	if !tx.writable {
+		return walletdb.ErrTxNotWritable
+	}
+	return nil
+}
+
+// bucket is an internal type used to represent a collection of key/value pairs
+// and implements the walletdb Bucket interfaces.
+type bucket struct {
+	tx   *transaction
+	data *bucketData
+}
+
+// Enforce bucket implements the walletdb Bucket interfaces.
+var _ walletdb.ReadWriteBucket = (*bucket)(nil)
+
+// nested returns the data of the nested bucket key, copied for a read-write
+// transaction.
+func (b *bucket) nested(key []byte) *bucketData {
+	if b.tx.closed {
+		return nil
+	}
+	e, ok := b.data.items[string(key)]
+	if !ok || e.bucket == nil {
+		return nil
+	}
+	if b.tx.writable && e.bucket.owner != b.tx {
+		e.bucket = e.bucket.clone(b.tx)
+		b.data.put(string(key), e)
+	}
+	return e.bucket
+}
+
+// NestedReadWriteBucket retrieves a nested bucket with the given key.  Returns
+// nil if the bucket does not exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) NestedReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	data := b.nested(key)
+	// Don't return a non-nil interface to a nil pointer.
+	if data == nil {
+		return nil
+	}
+	return &bucket{tx: b.tx, data: data}
+}
+
+func (b *bucket) NestedAndCreateReadWriteBucket(key []byte) walletdb.ReadWriteBucket {
+	buck, err := b.CreateBucketIfNotExists(key)
+	if err != nil {
+		return nil
+	}
+	return buck
+}
+
+func (b *bucket) NestedReadBucket(key []byte) walletdb.ReadBucket {
+	return b.NestedReadWriteBucket(key)
+}
+
+// CreateBucket creates and returns a new nested bucket with the given key.
+// Returns ErrBucketExists if the bucket already exists, ErrBucketNameRequired
+// if the key is empty, or ErrIncompatibleValue if the key holds a value.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) CreateBucket(key []byte) (walletdb.ReadWriteBucket, error) {
+	if err := b.tx.writeErr(); err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, walletdb.ErrBucketNameRequired
+	}
+	if len(key) > maxKeySize {
+		return nil, walletdb.ErrKeyTooLarge
+	}
+	if e, ok := b.data.items[string(key)]; ok {
+		if e.bucket != nil {
+			return nil, walletdb.ErrBucketExists
+		}
+		return nil, walletdb.ErrIncompatibleValue
+	}
+	data := newBucketData(b.tx)
+	b.data.put(string(key), entry{bucket: data})
+	return &bucket{tx: b.tx, data: data}, nil
+}
+
+// CreateBucketIfNotExists creates and returns a new nested bucket with the
+// given key if it does not already exist.  Returns ErrBucketNameRequired if the
+// key is empty or ErrIncompatibleValue if the key holds a value.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) CreateBucketIfNotExists(key []byte) (walletdb.ReadWriteBucket, error) {
+	if err := b.tx.writeErr(); err != nil {
+		return nil, err
+	}
+	if data := b.nested(key); data != nil {
+		return &bucket{tx: b.tx, data: data}, nil
+	}
+	return b.CreateBucket(key)
+}
+
+// DeleteNestedBucket removes a nested bucket with the given key.  Returns
+// ErrTxNotWritable if attempted against a read-only transaction and
+// ErrBucketNotFound if the specified bucket does not exist.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) DeleteNestedBucket(key []byte) error {
+	if err := b.tx.writeErr(); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return walletdb.ErrIncompatibleValue
+	}
+	e, ok := b.data.items[string(key)]
+	if !ok {
+		return walletdb.ErrBucketNotFound
+	}
+	if e.bucket == nil {
+		return walletdb.ErrIncompatibleValue
+	}
+	b.data.delete(string(key))
+	return nil
+}
+
+// ForEach invokes the passed function with every key/value pair in the bucket.
+// This includes nested buckets, in which case the value is nil, but it does not
+// include the key/value pairs within those nested buckets.
+//
+// NOTE: The values returned by this function must not be modified.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) ForEach(fn func(k, v []byte) error) error {
+	if b.tx.closed {
+		return walletdb.ErrTxClosed
+	}
+	keys := append([]string(nil), b.data.keys...)
+	for _, k := range keys {
+		e, ok := b.data.items[k]
+		if !ok {
+			continue
+		}
+		if err := fn([]byte(k), e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put saves the specified key/value pair to the bucket.  Keys that do not
+// already exist are added and keys that already exist are overwritten.  Returns
+// ErrTxNotWritable if attempted against a read-only transaction.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Put(key, value []byte) error {
+	if err := b.tx.writeErr(); err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return walletdb.ErrKeyRequired
+	}
+	if len(key) > maxKeySize {
+		return walletdb.ErrKeyTooLarge
+	}
+	if int64(len(value)) > maxValueSize {
+		return walletdb.ErrValueTooLarge
+	}
+	if e, ok := b.data.items[string(key)]; ok && e.bucket != nil {
+		return walletdb.ErrIncompatibleValue
+	}
+	b.data.put(string(key), entry{value: append([]byte{}, value...)})
+	return nil
+}
+
+// Get returns the value for the given key.  Returns nil if the key does
+// not exist in this bucket (or nested buckets).
+//
+// NOTE: The value returned by this function must not be modified.
+//
+// This function is part of the walletdb.ReadBucket interface implementation.
+func (b *bucket) Get(key []byte) []byte {
+	if b.tx.closed {
+		return nil
+	}
+	return b.data.items[string(key)].value
+}
+
+// Delete removes the specified key from the bucket.  Deleting a key that does
+// not exist does not return an error.  Returns ErrTxNotWritable if attempted
+// against a read-only transaction.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Delete(key []byte) error {
+	if err := b.tx.writeErr(); err != nil {
+		return err
+	}
+	if e, ok := b.data.items[string(key)]; ok && e.bucket != nil {
+		return walletdb.ErrIncompatibleValue
+	}
+	b.data.delete(string(key))
+	return nil
+}
+
+func (b *bucket) ReadCursor() walletdb.ReadCursor {
+	return b.ReadWriteCursor()
+}
+
+// ReadWriteCursor returns a new cursor, allowing for iteration over the bucket's
+// key/value pairs and nested buckets in forward or backward order.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) ReadWriteCursor() walletdb.ReadWriteCursor {
+	return &cursor{bucket: b}
+}
+
+// Tx returns the bucket's transaction.
+//
+// This function is part of the walletdb.ReadWriteBucket interface implementation.
+func (b *bucket) Tx() walletdb.ReadWriteTx {
+	return b.tx
+}
+
+// cursor represents a cursor over key/value pairs and nested buckets of a
+// bucket.
+//
+// Unlike bolt cursors, a cursor stays valid when the bucket is modified, it
+// continues from its current key.
+type cursor struct {
+	bucket *bucket
+	key    string
+	valid  bool
+}
+
+// at positions the cursor at the i-th key of the bucket and returns the pair.
+func (c *cursor) at(i int) (key, value []byte) {
+	keys := c.bucket.data.keys
+	if c.bucket.tx.closed || i < 0 || i >= len(keys) {
+		c.valid = false
+		return nil, nil
+	}
+	c.key = keys[i]
+	c.valid = true
+	return []byte(c.key), c.bucket.data.items[c.key].value
+}
+
+// Delete removes the current key/value pair the cursor is at.  Returns
+// ErrTxNotWritable if attempted on a read-only transaction, or
+// ErrIncompatibleValue if attempted when the cursor points to a nested bucket.
+//
+// This function is part of the walletdb.ReadWriteCursor interface implementation.
+func (c *cursor) Delete() error {
+	if err := c.bucket.tx.writeErr(); err != nil {
+		return err
+	}
+	if !c.valid {
+		return nil
+	}
+	return c.bucket.Delete([]byte(c.key))
+}
+
+// First positions the cursor at the first key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) First() (key, value []byte) {
+	return c.at(0)
+}
+
+// Last positions the cursor at the last key/value pair and returns the pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Last() (key, value []byte) {
+	return c.at(len(c.bucket.data.keys) - 1)
+}
+
+// Next moves the cursor one key/value pair forward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Next() (key, value []byte) {
+	if !c.valid {
+		return nil, nil
+	}
+	keys := c.bucket.data.keys
+	i := sort.SearchStrings(keys, c.key)
+	if i < len(keys) && keys[i] == c.key {
+		i++
+	}
+	return c.at(i)
+}
+
+// Prev moves the cursor one key/value pair backward and returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Prev() (key, value []byte) {
+	if !c.valid {
+		return nil, nil
+	}
+	return c.at(sort.SearchStrings(c.bucket.data.keys, c.key) - 1)
+}
+
+// Seek positions the cursor at the passed seek key. If the key does not exist,
+// the cursor is moved to the next key after seek. Returns the new pair.
+//
+// This function is part of the walletdb.ReadCursor interface implementation.
+func (c *cursor) Seek(seek []byte) (key, value []byte) {
+	return c.at(sort.SearchStrings(c.bucket.data.keys, string(seek)))
+}
+
+// db represents a collection of namespaces which are kept in memory and
+// implements the walletdb.Db interface.  Read transactions work on the data
+// committed when they began, a single read-write transaction runs at a time.
+type db struct {
+	name string
+
+	// writer is held by the running read-write transaction.
+	writer sync.Mutex
+
+	mu     sync.RWMutex
+	root   *bucketData
+	closed bool
+}
+
+// Enforce db implements the walletdb.Db interface.
+var _ walletdb.DB = (*db)(nil)
+
+func (db *db) BeginReadTx() (walletdb.ReadTx, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, walletdb.ErrDbNotOpen
+	}
+	return &transaction{db: db, root: db.root}, nil
+}
+
+func (db *db) BeginReadWriteTx() (walletdb.ReadWriteTx, error) {
+	db.writer.Lock()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		db.writer.Unlock()
+		return nil, walletdb.ErrDbNotOpen
+	}
+	tx := &transaction{db: db, writable: true}
+	tx.root = db.root.clone(tx)
+	return tx, nil
+}
+
+// Copy writes a copy of the database to the provided writer in the bolt file
+// format, so that it can be opened with the bdb driver.  This call will start
+// a read-only transaction to perform all operations.
+//
+// This function is part of the walletdb.Db interface implementation.
+func (db *db) Copy(w io.Writer) error {
+	dbtx, err := db.BeginReadTx()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+	root := dbtx.(*transaction).root
+
+	f, err := os.CreateTemp("", "memdb-copy-*.db")
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	boltDB, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return err
+	}
+	defer boltDB.Close()
+
+	err = boltDB.Update(func(boltTx *bbolt.Tx) error {
+		for _, k := range root.keys {
+			boltBucket, err := boltTx.CreateBucket([]byte(k))
+			if err != nil {
+				return err
+			}
+			if err := copyBucket(boltBucket, root.items[k].bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return boltDB.View(func(boltTx *bbolt.Tx) error {
+		_, err := boltTx.WriteTo(w)
+		return err
+	})
+}
+
+// copyBucket writes the contents of data into the bolt bucket dst.
+func copyBucket(dst *bbolt.Bucket, data *bucketData) error {
+	for _, k := range data.keys {
+		e := data.items[k]
+		if e.bucket == nil {
+			if err := dst.Put([]byte(k), e.value); err != nil {
+				return err
+			}
+			continue
+		}
+		nested, err := dst.CreateBucket([]byte(k))
+		if err != nil {
+			return err
+		}
+		if err := copyBucket(nested, e.bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database.  The data is kept for the lifetime of the
+// process and the database can be opened again by its name.
+//
+// This function is part of the walletdb.Db interface implementation.
+func (db *db) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.closed = true
+	return nil
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*db)
+)
+
+// openDB opens the database with the provided name.  walletdb.ErrDbDoesNotExist
+// is returned if the database doesn't exist and the create flag is not set,
+// walletdb.ErrDbExists if it exists and the create flag is set.
+func openDB(name string, create bool) (walletdb.DB, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	d, ok := registry[name]
+	switch {
+	case create && ok:
+		return nil, walletdb.ErrDbExists
+	case create:
+		d = &db{name: name, root: newBucketData(nil)}
+		registry[name] = d
+		return d, nil
+	case !ok:
+		return nil, walletdb.ErrDbDoesNotExist
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.closed {
+		return nil, walletdb.ErrDbAlreadyOpen
+	}
+	d.closed = false
+	return d, nil
+}
+
+// Remove drops the database with the provided name, releasing its memory.
+// The database must be closed.
+func Remove(name string) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	d, ok := registry[name]
+	if !ok {
+		return walletdb.ErrDbDoesNotExist
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if !d.closed {
+		return walletdb.ErrDbAlreadyOpen
+	}
+	delete(registry, name)
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/bdb"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/memdb"
+)
+
+// dbType is the database type name for this driver.
+const dbType = "memdb"
+
+// TestCreateOpenFail ensures that errors related to creating and opening a
+// database are handled properly.
+func TestCreateOpenFail(t *testing.T) {
+	// Ensure that attempting to open a database that doesn't exist returns
+	// the expected error.
+	wantErr := walletdb.ErrDbDoesNotExist
+	if _, err := walletdb.Open(dbType, "noexist"); err != wantErr {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with the wrong number of
+	// parameters returns the expected error.
+	wantErr = fmt.Errorf("invalid arguments to %s.Open -- expected "+
+		"database name", dbType)
+	if _, err := walletdb.Open(dbType, 1, 2, 3); err.Error() != wantErr.Error() {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with an invalid type for
+	// the first parameter returns the expected error.
+	wantErr = fmt.Errorf("first argument to %s.Open is invalid -- "+
+		"expected database name string", dbType)
+	if _, err := walletdb.Open(dbType, 1); err.Error() != wantErr.Error() {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to create a database with the wrong number of
+	// parameters returns the expected error.
+	wantErr = fmt.Errorf("invalid arguments to %s.Create -- expected "+
+		"database name", dbType)
+	if _, err := walletdb.Create(dbType, 1, 2, 3); err.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure that attempting to open a database with an invalid type for
+	// the first parameter returns the expected error.
+	wantErr = fmt.Errorf("first argument to %s.Create is invalid -- "+
+		"expected database name string", dbType)
+	if _, err := walletdb.Create(dbType, 1); err.Error() != wantErr.Error() {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+
+	// Ensure a database can neither be created twice nor opened while it
+	// is open.
+	name := "createfail"
+	db, err := walletdb.Create(dbType, name)
+	if err != nil {
+		t.Errorf("Create: unexpected error: %v", err)
+		return
+	}
+	defer memdb.Remove(name)
+	if _, err := walletdb.Create(dbType, name); err != walletdb.ErrDbExists {
+		t.Errorf("Create: did not receive expected error - got %v, "+
+			"want %v", err, walletdb.ErrDbExists)
+		return
+	}
+	if _, err := walletdb.Open(dbType, name); err != walletdb.ErrDbAlreadyOpen {
+		t.Errorf("Open: did not receive expected error - got %v, "+
+			"want %v", err, walletdb.ErrDbAlreadyOpen)
+		return
+	}
+
+	// Ensure operations against a closed database return the expected
+	// error.
+	db.Close()
+
+	wantErr = walletdb.ErrDbNotOpen
+	if _, err := db.BeginReadTx(); err != wantErr {
+		t.Errorf("BeginReadTx: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+	if _, err := db.BeginReadWriteTx(); err != wantErr {
+		t.Errorf("BeginReadWriteTx: did not receive expected error - got %v, "+
+			"want %v", err, wantErr)
+		return
+	}
+}
+
+// TestPersistence ensures that values stored are still valid after closing and
+// reopening the database, and that a copy of the database can be opened with
+// the bdb driver.
+func TestPersistence(t *testing.T) {
+	// Create a new database to run tests against.
+	name := "persistencetest"
+	db, err := walletdb.Create(dbType, name)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer memdb.Remove(name)
+	defer db.Close()
+
+	// Create a namespace with a nested bucket and put some values into
+	// them so they can be tested for existence on re-open.
+	storeValues := map[string]string{
+		"ns1key1": "foo1",
+		"ns1key2": "foo2",
+		"ns1key3": "foo3",
+	}
+	ns1Key := []byte("ns1")
+	nestedKey := []byte("nested")
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns1, err := tx.CreateTopLevelBucket(ns1Key)
+		if err != nil {
+			return err
+		}
+		nested, err := ns1.CreateBucket(nestedKey)
+		if err != nil {
+			return err
+		}
+
+		for k, v := range storeValues {
+			if err := ns1.Put([]byte(k), []byte(v)); err != nil {
+				return fmt.Errorf("Put: unexpected error: %v", err)
+			}
+			if err := nested.Put([]byte(k), []byte(v)); err != nil {
+				return fmt.Errorf("Put: unexpected error: %v", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Errorf("ns1 Update: unexpected error: %v", err)
+		return
+	}
+
+	checkValues := func(db walletdb.DB) error {
+		return walletdb.View(db, func(tx walletdb.ReadTx) error {
+			ns1 := tx.ReadBucket(ns1Key)
+			if ns1 == nil {
+				return fmt.Errorf("ReadTx.ReadBucket: unexpected nil root bucket")
+			}
+			nested := ns1.NestedReadBucket(nestedKey)
+			if nested == nil {
+				return fmt.Errorf("NestedReadBucket: unexpected nil bucket")
+			}
+
+			for k, v := range storeValues {
+				for _, b := range []walletdb.ReadBucket{ns1, nested} {
+					gotVal := b.Get([]byte(k))
+					if !reflect.DeepEqual(gotVal, []byte(v)) {
+						return fmt.Errorf("Get: key '%s' does not "+
+							"match expected value - got %s, want %s",
+							k, gotVal, v)
+					}
+				}
+			}
+
+			return nil
+		})
+	}
+
+	// Close and reopen the database to ensure the values persist.
+	db.Close()
+	db, err = walletdb.Open(dbType, name)
+	if err != nil {
+		t.Errorf("Failed to open test database (%s) %v", dbType, err)
+		return
+	}
+	defer db.Close()
+	if err := checkValues(db); err != nil {
+		t.Errorf("ns1 View: unexpected error: %v", err)
+		return
+	}
+
+	// Copy the database into a bolt file and ensure the values are there.
+	var buf bytes.Buffer
+	if err := db.Copy(&buf); err != nil {
+		t.Errorf("Copy: unexpected error: %v", err)
+		return
+	}
+	dbPath := filepath.Join(t.TempDir(), "copy.db")
+	if err := os.WriteFile(dbPath, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	boltDB, err := walletdb.Open("bdb", dbPath)
+	if err != nil {
+		t.Errorf("Failed to open copied database: %v", err)
+		return
+	}
+	defer boltDB.Close()
+	if err := checkValues(boltDB); err != nil {
+		t.Errorf("copy View: unexpected error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package memdb_test
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb/walletdbtest"
+)
+
+// TestInterface performs all interfaces tests for this database driver.
+func TestInterface(t *testing.T) {
+	walletdbtest.TestInterface(t, dbType, "interfacetest")
+}
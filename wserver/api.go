@@ -1,6 +1,7 @@
 package wserver
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"path/filepath"
@@ -8,11 +9,10 @@ import (
 
 	"github.com/Qitmeer/qitmeer-wallet/config"
 	"github.com/Qitmeer/qitmeer-wallet/utils"
-	waddrmgs "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
+	waddrmgr "github.com/Qitmeer/qitmeer-wallet/waddrmgs"
 	"github.com/Qitmeer/qitmeer-wallet/wallet"
-	"github.com/Qitmeer/qng/crypto/bip32"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/shamir"
 	"github.com/Qitmeer/qng/crypto/bip39"
-	"github.com/Qitmeer/qng/crypto/ecc/secp256k1"
 	"github.com/Qitmeer/qng/crypto/seed"
 	"github.com/Qitmeer/qng/log"
 )
@@ -59,27 +59,53 @@ func (api *API) WalletStatus() (status *ResStatus, err error) {
 	return
 }
 
-//CreateWallet wallet by seed
-func (api *API) CreateWallet(seed string, walletPass string, unlockPass string) error {
+//CreateWallet wallet by seed, firstAddress when given must be the first address of the wallet, mnemonic when given with its optional passphrase must be the mnemonic of seed from MakeSeed and is kept encrypted to be shown again
+func (api *API) CreateWallet(seed string, walletPass string, unlockPass string, firstAddress *string, mnemonic *string, passphrase *string) error {
 	seedBuf, err := hex.DecodeString(seed)
 	if err != nil {
 		return &crateError{Code: -1, Msg: fmt.Sprintf("seed hex err: %s ", err)}
 	}
 
-	err = api.createWallet(seedBuf, walletPass, unlockPass)
+	err = api.confirmFirstAddress(seedBuf, firstAddress)
+	if err != nil {
+		return err
+	}
+	var entropy []byte
+	if mnemonic != nil && *mnemonic != "" {
+		mnemonicSeed, err := bip39.NewSeedWithErrorChecking(*mnemonic, mnemonicPassphrase(passphrase))
+		if err != nil {
+			return &crateError{Code: -1, Msg: fmt.Sprintf("mnemonic err: %s ", err)}
+		}
+		if !bytes.Equal(mnemonicSeed, seedBuf) {
+			return &crateError{Code: -1, Msg: "mnemonic is not the mnemonic of seed"}
+		}
+		entropy, err = bip39.EntropyFromMnemonic(*mnemonic)
+		if err != nil {
+			return &crateError{Code: -1, Msg: fmt.Sprintf("mnemonic entropy err: %s ", err)}
+		}
+	}
+	err = api.createWallet(seedBuf, entropy, walletPass, unlockPass, false)
 	if err != nil {
 		return err
 	}
 	return nil //api.Open(walletPass)
 }
 
-//RecoverWallet wallet by mnemonic
-func (api *API) RecoverWallet(mnemonic string, walletPass string, unlockPass string) error {
-	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+//RecoverWallet wallet by mnemonic and optional mnemonic passphrase, firstAddress when given must be the first address of the wallet, the mnemonic is kept encrypted to be shown again, importMasterKey imports the master key address funded by wallets of older versions to be swept with sweepMasterKey
+func (api *API) RecoverWallet(mnemonic string, walletPass string, unlockPass string, passphrase *string, firstAddress *string, importMasterKey *bool) error {
+	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, mnemonicPassphrase(passphrase))
 	if err != nil {
 		return &crateError{Code: -1, Msg: fmt.Sprintf("seed hex err: %s ", err)}
 	}
-	err = api.createWallet(seedBuf, walletPass, unlockPass)
+	err = api.confirmFirstAddress(seedBuf, firstAddress)
+	if err != nil {
+		return err
+	}
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		return &crateError{Code: -1, Msg: fmt.Sprintf("mnemonic entropy err: %s ", err)}
+	}
+	err = api.createWallet(seedBuf, entropy, walletPass, unlockPass, importMasterKey != nil && *importMasterKey)
 	if err != nil {
 		return err
 	}
@@ -87,13 +113,95 @@ func (api *API) RecoverWallet(mnemonic string, walletPass string, unlockPass str
 	return nil //api.Open(walletPass)
 }
 
+//MnemonicAddress first address of the wallet recovered from mnemonic and optional mnemonic passphrase, to be confirmed before RecoverWallet
+func (api *API) MnemonicAddress(mnemonic string, passphrase *string) (string, error) {
+	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, mnemonicPassphrase(passphrase))
+	if err != nil {
+		return "", &crateError{Code: -1, Msg: fmt.Sprintf("seed hex err: %s ", err)}
+	}
+	return api.firstAddress(seedBuf)
+}
+
+//RecoverWalletFromShares wallet by Shamir seed shares, firstAddress when given must be the first address of the wallet
+func (api *API) RecoverWalletFromShares(shares []string, walletPass string, unlockPass string, firstAddress *string) error {
+	seedBuf, err := shamir.CombineStrings(shares)
+	if err != nil {
+		return &crateError{Code: -1, Msg: fmt.Sprintf("seed shares err: %s ", err)}
+	}
+	err = api.confirmFirstAddress(seedBuf, firstAddress)
+	if err != nil {
+		return err
+	}
+	err = api.createWallet(seedBuf, nil, walletPass, unlockPass, false)
+	if err != nil {
+		return err
+	}
+
+	return nil //api.Open(walletPass)
+}
+
+//SplitSeed split seed hex into Shamir shares of groups like 3of5, all groups are required unless groupThreshold is given
+func (api *API) SplitSeed(seed string, groups []string, groupThreshold *uint8) ([][]string, error) {
+	seedBuf, err := hex.DecodeString(seed)
+	if err != nil {
+		return nil, &crateError{Code: -1, Msg: fmt.Sprintf("seed hex err: %s ", err)}
+	}
+	gs, err := shamir.ParseGroups(groups)
+	if err != nil {
+		return nil, &crateError{Code: -1, Msg: fmt.Sprintf("seed share groups err: %s ", err)}
+	}
+	threshold := uint8(len(gs))
+	if groupThreshold != nil {
+		threshold = *groupThreshold
+	}
+	shares, err := shamir.SplitStrings(seedBuf, threshold, gs)
+	if err != nil {
+		return nil, &crateError{Code: -1, Msg: fmt.Sprintf("split seed err: %s ", err)}
+	}
+	return shares, nil
+}
+
+// firstAddress returns the first address of a wallet created from seed.
+func (api *API) firstAddress(seed []byte) (string, error) {
+	addr, err := waddrmgr.FirstAddress(seed, wallet.ConfigKeyScope(api.cfg), utils.GetNetParams(api.cfg.Network))
+	if err != nil {
+		return "", &crateError{Code: -1, Msg: fmt.Sprintf("first address err: %s ", err)}
+	}
+	return addr.Encode(), nil
+}
+
+// confirmFirstAddress checks that the wallet created from seed has the
+// expected first address, when one is given.  A different address means a
+// mistyped mnemonic or mnemonic passphrase, so no wallet is created.
+func (api *API) confirmFirstAddress(seed []byte, expected *string) error {
+	if expected == nil || *expected == "" {
+		return nil
+	}
+	addr, err := api.firstAddress(seed)
+	if err != nil {
+		return err
+	}
+	if addr != *expected {
+		return &crateError{Code: -2, Msg: fmt.Sprintf("first address %s does not match %s, check the mnemonic and passphrase", addr, *expected)}
+	}
+	return nil
+}
+
+// mnemonicPassphrase returns the optional BIP39 passphrase of a mnemonic.
+func mnemonicPassphrase(passphrase *string) string {
+	if passphrase == nil {
+		return ""
+	}
+	return *passphrase
+}
+
 //OpenWallet load wallet and open
 func (api *API) OpenWallet(pass string) error {
 	return api.wSvr.OpenWallet(pass)
 }
 
-// createWallet by seed and walletPass
-func (api *API) createWallet(seed []byte, walletPass string, unlockPass string) error {
+// createWallet by seed and walletPass, entropy is the BIP39 entropy of the mnemonic of seed, nil without a mnemonic, importMasterKey imports the master key like older versions did so its funds can be swept
+func (api *API) createWallet(seed []byte, entropy []byte, walletPass string, unlockPass string, importMasterKey bool) error {
 	log.Trace("createWallet", "network", api.cfg.Network)
 	log.Trace("createWallet", "seed", seed)
 
@@ -112,44 +220,36 @@ func (api *API) createWallet(seed []byte, walletPass string, unlockPass string)
 		return &crateError{Code: -100, Msg: "wallet exist"}
 	}
 
-	wt, err := loader.CreateNewWallet([]byte(walletPass), []byte(unlockPass), seed, time.Now())
+	wt, err := loader.CreateNewWallet([]byte(walletPass), []byte(unlockPass), seed, entropy, time.Now())
 	if err != nil {
 		log.Error("createWallet loader CreateNewWallet ", "err", err)
 		return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet loader CreateNewWallet err: %s ", err)}
 	}
+	defer func() {
+		wt.Manager.Close()
+		wt.Database().Close()
+	}()
 
-	//import master key addr
-	seedKey, err := bip32.NewMasterKey(seed)
+	//derive the first receive address of the default account, the master key is only imported on request
+	addr, err := wt.UnusedAddress(wt.Manager.DefaultScope(), waddrmgr.DefaultAccountNum)
 	if err != nil {
-		log.Error("createWallet NewMasterKey ", "err", err)
-		return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet NewMasterKey err: %err", err)}
+		log.Error("createWallet first receive address", "err", err)
+		return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet first receive address err: %s", err)}
 	}
-	log.Trace("createWallet import master key", "seedKey.Key", seedKey.Key)
+	log.Info("createWallet", "first receive address", addr.Encode())
 
-	pri, _ := secp256k1.PrivKeyFromBytes(seedKey.Key)
-	wif, err := utils.NewWIF(pri, activeNetParams, true)
-	if err != nil {
-		log.Error("createWallet private key decode failed", "err", err)
-		return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet private key decode failed: %s", err)}
-	}
-	if !wif.IsForNet(activeNetParams) {
-		log.Error("createWallet Key is not intended for", "err", err)
-		return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet Key is not intended for: %s", err)}
-	}
-	err = wt.UnLockManager([]byte(unlockPass))
-	if err != nil {
-		log.Error("createWallet UnLockManager error", "err", err)
+	if importMasterKey {
+		err = wt.UnLockManager([]byte(unlockPass))
+		if err == nil {
+			addr, err = wt.ImportMasterKey()
+		}
+		if err != nil {
+			log.Error("createWallet import master key", "err", err)
+			return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet import master key err: %s", err)}
+		}
+		log.Warn("createWallet imported the master key of older versions, sweep its funds once synced", "address", addr.Encode())
 	}
 
-	_, err = wt.ImportPrivateKey(waddrmgs.KeyScopeBIP0044, wif)
-	if err != nil {
-		log.Error("createWallet ImportPrivateKey", " err", err)
-		return &crateError{Code: -1, Msg: fmt.Sprintf("createWallet ImportPrivateKey err: %s", err)}
-	}
-
-	wt.Manager.Close()
-	wt.Database().Close()
-
 	return nil
 }
 
@@ -158,8 +258,8 @@ type ResStatus struct {
 	Stats string `json:"stats"` //err,nil,closed,lock,unlock
 }
 
-// MakeSeed wallet HD seed and mnemonic
-func (api *API) MakeSeed() (*ResSeed, error) {
+// MakeSeed wallet HD seed and mnemonic, with the optional mnemonic passphrase, and the first address of the wallet to be confirmed
+func (api *API) MakeSeed(passphrase *string) (*ResSeed, error) {
 	entropyBuf, err := seed.GenerateSeed(uint16(32))
 	if err != nil {
 		return nil, fmt.Errorf("Generate entropy err: %s", err)
@@ -170,14 +270,20 @@ func (api *API) MakeSeed() (*ResSeed, error) {
 		return nil, fmt.Errorf("NewMnemonic err: %s", err)
 	}
 
-	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, mnemonicPassphrase(passphrase))
 	if err != nil {
 		return nil, fmt.Errorf("NewSeed err: %s", err)
 	}
 
+	addr, err := api.firstAddress(seedBuf)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ResSeed{
 		Seed:     hex.EncodeToString(seedBuf),
 		Mnemonic: mnemonic,
+		Address:  addr,
 	}, nil
 }
 
@@ -185,6 +291,8 @@ func (api *API) MakeSeed() (*ResSeed, error) {
 type ResSeed struct {
 	Seed     string `json:"seed"`
 	Mnemonic string `json:"mnemonic"`
+	// Address is the first address of the wallet created from Seed
+	Address string `json:"address"`
 }
 
 type crateError struct {
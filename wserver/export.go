@@ -0,0 +1,73 @@
+package wserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Qitmeer/qng/log"
+
+	"github.com/Qitmeer/qitmeer-wallet/wallet"
+	"github.com/Qitmeer/qitmeer-wallet/wallet/export"
+)
+
+// HandleExport downloads the transaction history of the wallet.  The query
+// takes the format (csv, jsonl or ofx), account or address, from_order,
+// to_order, from and to parameters of the exporthistory RPC.
+func (wSvr *WalletServer) HandleExport(ResW http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !wSvr.RPCSvr.Authorize(ResW, r) {
+		return
+	}
+	if wSvr.Wt == nil {
+		http.Error(ResW, "wallet not open", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	formatName := q.Get("format")
+	if formatName == "" {
+		formatName = string(export.FormatCSV)
+	}
+	format, err := export.ParseFormat(formatName)
+	if err != nil {
+		http.Error(ResW, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var orders [2]uint32
+	for i, name := range []string{"from_order", "to_order"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		order, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			http.Error(ResW, fmt.Sprintf("invalid %s %q", name, v), http.StatusBadRequest)
+			return
+		}
+		orders[i] = uint32(order)
+	}
+	filter, err := wallet.NewExportFilter(q.Get("account"), q.Get("address"),
+		orders[0], orders[1], q.Get("from"), q.Get("to"))
+	if err != nil {
+		http.Error(ResW, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The ledger is buffered so that an error is answered as such rather
+	// than as a truncated file.
+	var buf bytes.Buffer
+	if _, err := wSvr.Wt.ExportHistory(&buf, format, filter); err != nil {
+		log.Error("HandleExport", "err", err.Error())
+		http.Error(ResW, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := "history-" + time.Now().UTC().Format("20060102T150405Z") + format.Extension()
+	ResW.Header().Set("Content-Type", format.ContentType())
+	ResW.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	ResW.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, _ = ResW.Write(buf.Bytes())
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -32,6 +34,11 @@ type WalletServer struct {
 
 	exitCh chan bool
 
+	// quit is closed by Stop, wg tracks the goroutines waiting on it.
+	quit     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
 	QitmeerdStatus *qJson.InfoNodeResult
 }
 
@@ -70,6 +77,7 @@ func NewWalletServer(cfg *config.Config) (wSvr *WalletServer, err error) {
 
 		WtLoader: wtLoader,
 		exitCh:   make(chan bool),
+		quit:     make(chan struct{}),
 	}
 
 	RPCSvrCfg := &server.Config{
@@ -80,6 +88,9 @@ func NewWalletServer(cfg *config.Config) (wSvr *WalletServer, err error) {
 		RPCMaxClients: 100,
 		DisableRPC:    false,
 		DisableTLS:    cfg.DisableTLS,
+		// The origins of the UI development server, also allowed by the
+		// CORS headers of /api.
+		RPCAllowedOrigins: []string{"http://127.0.0.1:8080", "http://localhost:8080"},
 	}
 
 	wSvr.RPCSvr, err = server.NewRPCServer(RPCSvrCfg)
@@ -111,6 +122,7 @@ func (wSvr *WalletServer) run() {
 		for {
 			select {
 			case <-wSvr.exitCh:
+				wSvr.Stop()
 				os.Exit(1)
 			}
 		}
@@ -165,6 +177,8 @@ func (wSvr *WalletServer) run() {
 	}
 
 	router.POST("/api", wSvr.HandleAPI)
+	router.GET("/export", wSvr.HandleExport)
+	router.Handler(http.MethodGet, "/ws", wSvr.RPCSvr.WebsocketHandler())
 
 	for _, addr := range wSvr.cfg.Listeners {
 		go func() {
@@ -242,5 +256,49 @@ func (wSvr *WalletServer) OpenWallet(pass string) error {
 	wSvr.RegAPI()
 	log.Trace("OpenWallet ok and reg api")
 
+	if wSvr.cfg.BackupInterval > 0 {
+		wSvr.wg.Add(1)
+		go wSvr.backupLoop(time.Duration(wSvr.cfg.BackupInterval) * time.Minute)
+	}
+
 	return nil
 }
+
+// Stop shuts the server down: it stops the scheduled backups, waiting for a
+// backup being written, the RPC server and the open wallet.
+func (wSvr *WalletServer) Stop() {
+	wSvr.stopOnce.Do(func() {
+		log.Trace("WalletServer stop")
+		close(wSvr.quit)
+		wSvr.wg.Wait()
+		wSvr.RPCSvr.Stop()
+		if wSvr.Wt != nil {
+			wSvr.Wt.Stop()
+		}
+	})
+}
+
+// backupLoop writes a scheduled backup of the open wallet every interval
+// until the server is stopped.
+func (wSvr *WalletServer) backupLoop(interval time.Duration) {
+	defer wSvr.wg.Done()
+	log.Info("Scheduled wallet backups enabled", "interval", interval,
+		"dir", wSvr.cfg.BackupDirPath(), "keep", wSvr.cfg.BackupKeep)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wSvr.quit:
+			log.Info("Scheduled wallet backups stopped")
+			return
+		}
+		info, removed, err := wSvr.Wt.ScheduledBackup()
+		if err != nil {
+			log.Warn("Scheduled wallet backup failed", "err", err.Error())
+			continue
+		}
+		log.Info("Scheduled wallet backup written", "path", info.Path,
+			"sha256", info.SHA256, "removed", len(removed))
+	}
+}
@@ -1,6 +1,7 @@
 package wserver
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"testing"
@@ -80,3 +81,20 @@ func TestGan(t *testing.T) {
 	t.Log(addr)
 
 }
+
+func TestCreateWalletMnemonicMismatch(t *testing.T) {
+	entropy := bytes.Repeat([]byte{0x2a}, 32)
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedBuf, err := bip39.NewSeedWithErrorChecking(mnemonic, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &API{}
+	err = api.CreateWallet(hex.EncodeToString(seedBuf), "public", "private", nil, &mnemonic, nil)
+	if err == nil {
+		t.Fatalf("created a wallet with the mnemonic of another seed")
+	}
+}
@@ -0,0 +1,269 @@
+package wtxmgr
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// Account balances are stored in BucketAccountBalance under the coin ID
+// (2 bytes) followed by the account number (4 bytes), with the following
+// value, encrypted like the other values of the store:
+//
+//   [0]       Record version (1 byte)
+//   Confirmed, unconfirmed, immature and spent amounts (varints)
+//   Number of lock heights (uvarint), then for each lock height:
+//     Lock height (4 bytes), amount (varint)
+//
+// The balances are kept up to date by UpdateAccountBalance in the same
+// database transaction as the outputs they sum.  rootBalancesBuilt is set once
+// they were built from all outputs; wallets migrated from before the balances
+// have no such key until they are rebuilt.
+
+// AccountBalance is the balance of an account in a coin.
+type AccountBalance struct {
+	// Confirmed is the amount of the confirmed unspent outputs without lock
+	// height.
+	Confirmed int64
+	// Unconfirmed is the amount of the unspent outputs of transactions in
+	// the mempool or lacking confirmations.
+	Unconfirmed int64
+	// Immature is the amount of the unspent coinbase outputs lacking
+	// confirmations.
+	Immature int64
+	// Spent is the amount of the spent outputs.
+	Spent int64
+	// Locked is the amount of the confirmed unspent outputs with a lock
+	// height, by lock height.
+	Locked map[uint32]int64
+}
+
+// Spendable returns the amount of the confirmed unspent outputs which are not
+// locked at the chain height.
+func (b *AccountBalance) Spendable(height uint32) int64 {
+	amount := b.Confirmed
+	for lock, v := range b.Locked {
+		if lock <= height {
+			amount += v
+		}
+	}
+	return amount
+}
+
+// LockedAt returns the amount of the confirmed unspent outputs which are still
+// locked at the chain height.
+func (b *AccountBalance) LockedAt(height uint32) int64 {
+	var amount int64
+	for lock, v := range b.Locked {
+		if lock > height {
+			amount += v
+		}
+	}
+	return amount
+}
+
+// add adds amount to the part of the balance out counts in.  Outputs of failed
+// transactions and coinbase outputs of red blocks count in no part.
+func (b *AccountBalance) add(out *AddrTxOutput, coinbase bool, amount int64) {
+	if out.Spend == SpendStatusSpend {
+		b.Spent += amount
+		return
+	}
+	switch out.Status {
+	case TxStatusConfirmed:
+		if out.Locked == 0 {
+			b.Confirmed += amount
+			return
+		}
+		if b.Locked == nil {
+			b.Locked = map[uint32]int64{}
+		}
+		b.Locked[out.Locked] += amount
+		if b.Locked[out.Locked] == 0 {
+			delete(b.Locked, out.Locked)
+		}
+	case TxStatusUnConfirmed:
+		if coinbase {
+			b.Immature += amount
+		} else {
+			b.Unconfirmed += amount
+		}
+	case TxStatusMemPool:
+		b.Unconfirmed += amount
+	}
+}
+
+func accountBalanceKey(account uint32, coin types.CoinID) []byte {
+	k := make([]byte, 6)
+	byteOrder.PutUint16(k, uint16(coin))
+	byteOrder.PutUint32(k[2:], account)
+	return k
+}
+
+func (b *AccountBalance) encode() []byte {
+	w := recordWriter{buf: make([]byte, 0, 32+14*len(b.Locked))}
+	w.byte(recordVersion)
+	w.varint(b.Confirmed)
+	w.varint(b.Unconfirmed)
+	w.varint(b.Immature)
+	w.varint(b.Spent)
+	locks := make([]uint32, 0, len(b.Locked))
+	for lock := range b.Locked {
+		locks = append(locks, lock)
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i] < locks[j] })
+	w.uvarint(uint64(len(locks)))
+	for _, lock := range locks {
+		w.uint32(lock)
+		w.varint(b.Locked[lock])
+	}
+	return w.buf
+}
+
+func decodeAccountBalance(v []byte) (*AccountBalance, error) {
+	r := recordReader{v: v}
+	r.version()
+	b := &AccountBalance{
+		Confirmed:   r.varint(),
+		Unconfirmed: r.varint(),
+		Immature:    r.varint(),
+		Spent:       r.varint(),
+	}
+	if n := r.count(5); n != 0 {
+		b.Locked = make(map[uint32]int64, n)
+		for i := 0; i < n; i++ {
+			lock := r.uint32()
+			b.Locked[lock] = r.varint()
+		}
+	}
+	if err := r.close("account balance"); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// FetchAccountBalance returns the balance of account in coin.  Accounts
+// without outputs in coin have a zero balance.
+func (s *Store) FetchAccountBalance(ns walletdb.ReadBucket, account uint32, coin types.CoinID) (*AccountBalance, error) {
+	b := ns.NestedReadBucket(BucketAccountBalance)
+	if b == nil {
+		return &AccountBalance{}, nil
+	}
+	v := b.Get(accountBalanceKey(account, coin))
+	if v == nil {
+		return &AccountBalance{}, nil
+	}
+	v, err := s.keys.open(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAccountBalance(v)
+}
+
+func (s *Store) putAccountBalance(ns walletdb.ReadWriteBucket, account uint32, coin types.CoinID, balance *AccountBalance) error {
+	b, err := ns.CreateBucketIfNotExists(BucketAccountBalance)
+	if err != nil {
+		str := "failed to create account balance bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	v, err := s.keys.seal(balance.encode())
+	if err != nil {
+		return err
+	}
+	err = b.Put(accountBalanceKey(account, coin), v)
+	if err != nil {
+		str := fmt.Sprintf("failed to put balance of account %d", account)
+		return storeError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// UpdateAccountBalance moves the output from its old state to out in the
+// balance of account.  old is nil for a new output and out is nil for a
+// deleted one.  It must be called in the database transaction changing the
+// output, after its transaction was stored with PutTxJson.
+func (s *Store) UpdateAccountBalance(ns walletdb.ReadWriteBucket, account uint32, old, out *AddrTxOutput) error {
+	if old == nil && out == nil {
+		return nil
+	}
+	var coin types.CoinID
+	if out != nil {
+		coin = out.Amount.Id
+	} else {
+		coin = old.Amount.Id
+	}
+	balance, err := s.FetchAccountBalance(ns, account, coin)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		coinbase, err := s.isImmature(ns, old)
+		if err != nil {
+			return err
+		}
+		balance.add(old, coinbase, -old.Amount.Value)
+	}
+	if out != nil {
+		coinbase, err := s.isImmature(ns, out)
+		if err != nil {
+			return err
+		}
+		balance.add(out, coinbase, out.Amount.Value)
+	}
+	return s.putAccountBalance(ns, account, coin, balance)
+}
+
+// isImmature returns whether out is an unspent coinbase output lacking
+// confirmations.  Only the transactions of such outputs are fetched.
+func (s *Store) isImmature(ns walletdb.ReadBucket, out *AddrTxOutput) (bool, error) {
+	if out.Spend == SpendStatusSpend || out.Status != TxStatusUnConfirmed {
+		return false, nil
+	}
+	return s.isCoinBase(ns, &out.TxId)
+}
+
+func (s *Store) isCoinBase(ns walletdb.ReadBucket, txId *hash.Hash) (bool, error) {
+	tr, err := s.FetchTxJson(ns, txId)
+	if err != nil || tr == nil {
+		return false, err
+	}
+	return len(tr.Vin) > 0 && tr.Vin[0].Coinbase != "", nil
+}
+
+// ClearAccountBalances deletes all account balances before they are rebuilt
+// with UpdateAccountBalance.  SetBalancesBuilt marks them built again.
+func (s *Store) ClearAccountBalances(ns walletdb.ReadWriteBucket) error {
+	if ns.NestedReadBucket(BucketAccountBalance) != nil {
+		if err := ns.DeleteNestedBucket(BucketAccountBalance); err != nil {
+			str := "failed to delete account balance bucket"
+			return storeError(ErrDatabase, str, err)
+		}
+	}
+	if _, err := ns.CreateBucket(BucketAccountBalance); err != nil {
+		str := "failed to create account balance bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	if err := ns.Delete(rootBalancesBuilt); err != nil {
+		str := "failed to delete balances built flag"
+		return storeError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// SetBalancesBuilt records that the account balances sum all outputs.
+func (s *Store) SetBalancesBuilt(ns walletdb.ReadWriteBucket) error {
+	if err := ns.Put(rootBalancesBuilt, []byte{1}); err != nil {
+		str := "failed to put balances built flag"
+		return storeError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// BalancesBuilt returns whether the account balances sum all outputs.  They
+// must be rebuilt otherwise.
+func (s *Store) BalancesBuilt(ns walletdb.ReadBucket) bool {
+	return ns.Get(rootBalancesBuilt) != nil
+}
@@ -0,0 +1,157 @@
+package wtxmgr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+func fetchBalance(t *testing.T, db walletdb.DB, s *Store, account uint32, coin types.CoinID) *AccountBalance {
+	t.Helper()
+	var b *AccountBalance
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		var err error
+		b, err = s.FetchAccountBalance(tx.ReadBucket(namespaceKey), account, coin)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestAccountBalance(t *testing.T) {
+	db, _ := testStore(t)
+	s := &Store{keys: newRecordKeys(newTestCryptoKey(t))}
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	txA, txB, txC := hash.Hash{0xa}, hash.Hash{0xb}, hash.Hash{0xc}
+
+	mempool := testOutput(addr, txA, 10, 100)
+	confirmed := *mempool
+	confirmed.Status = TxStatusConfirmed
+	spent := confirmed
+	spent.Spend = SpendStatusSpend
+	spent.SpendTo = &SpendTo{TxId: txB}
+
+	locked := testOutput(addr, txB, 11, 50)
+	locked.Status = TxStatusConfirmed
+	locked.Locked = 200
+
+	coinbase := testOutput(addr, txC, 12, 30)
+	coinbase.Status = TxStatusUnConfirmed
+	failed := *coinbase
+	failed.Status = TxStatusFailed
+
+	tests := []struct {
+		name     string
+		old, out *AddrTxOutput
+		want     AccountBalance
+	}{
+		{"mempool", nil, mempool, AccountBalance{Unconfirmed: 100}},
+		{"confirmed", mempool, &confirmed, AccountBalance{Confirmed: 100}},
+		{"locked", nil, locked, AccountBalance{Confirmed: 100, Locked: map[uint32]int64{200: 50}}},
+		{"immature", nil, coinbase, AccountBalance{Confirmed: 100, Immature: 30, Locked: map[uint32]int64{200: 50}}},
+		{"failed", coinbase, &failed, AccountBalance{Confirmed: 100, Locked: map[uint32]int64{200: 50}}},
+		{"spent", &confirmed, &spent, AccountBalance{Spent: 100, Locked: map[uint32]int64{200: 50}}},
+		{"deleted", locked, nil, AccountBalance{Spent: 100}},
+	}
+	for _, test := range tests {
+		err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+			ns := tx.ReadWriteBucket(namespaceKey)
+			tr := &corejson.TxRawResult{Txid: txC.String(), Vin: []corejson.Vin{{Coinbase: "03a0860100"}}}
+			if err := s.PutTxJson(ns, tr); err != nil {
+				return err
+			}
+			return s.UpdateAccountBalance(ns, 1, test.old, test.out)
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := fetchBalance(t, db, s, 1, types.MEERA); !reflect.DeepEqual(*got, test.want) {
+			t.Fatalf("%s: balance %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	if b := fetchBalance(t, db, s, 0, types.MEERA); !reflect.DeepEqual(*b, AccountBalance{}) {
+		t.Errorf("balance of another account %+v", b)
+	}
+	if b := fetchBalance(t, db, s, 1, 1); !reflect.DeepEqual(*b, AccountBalance{}) {
+		t.Errorf("balance in another coin %+v", b)
+	}
+}
+
+func TestAccountBalanceLocks(t *testing.T) {
+	b := &AccountBalance{Confirmed: 100, Locked: map[uint32]int64{200: 50, 300: 20}}
+	tests := []struct {
+		height            uint32
+		spendable, locked int64
+	}{
+		{199, 100, 70},
+		{200, 150, 20},
+		{300, 170, 0},
+	}
+	for _, test := range tests {
+		if got := b.Spendable(test.height); got != test.spendable {
+			t.Errorf("spendable at %d: %d, want %d", test.height, got, test.spendable)
+		}
+		if got := b.LockedAt(test.height); got != test.locked {
+			t.Errorf("locked at %d: %d, want %d", test.height, got, test.locked)
+		}
+	}
+
+	got, err := decodeAccountBalance(b.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Fatalf("decoded %+v, want %+v", got, b)
+	}
+}
+
+func TestAddAccountBalancesMigration(t *testing.T) {
+	db, s := testStore(t)
+	builtAfter := func(f func(ns walletdb.ReadWriteBucket) error) bool {
+		var built bool
+		err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+			ns := tx.ReadWriteBucket(namespaceKey)
+			if err := f(ns); err != nil {
+				return err
+			}
+			built = s.BalancesBuilt(ns)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return built
+	}
+
+	// The balances of new stores are built.
+	if !builtAfter(func(walletdb.ReadWriteBucket) error { return nil }) {
+		t.Fatal("balances of a new store not built")
+	}
+	if builtAfter(addAccountBalances) {
+		t.Fatal("balances built after the migration")
+	}
+	if !builtAfter(s.SetBalancesBuilt) {
+		t.Fatal("balances not built after SetBalancesBuilt")
+	}
+
+	out := testOutput("TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5", hash.Hash{0xa}, 10, 100)
+	update := func(ns walletdb.ReadWriteBucket) error {
+		return s.UpdateAccountBalance(ns, 0, nil, out)
+	}
+	if !builtAfter(update) {
+		t.Fatal("balances not built after an update")
+	}
+	if builtAfter(s.ClearAccountBalances) {
+		t.Fatal("balances built after ClearAccountBalances")
+	}
+	if b := fetchBalance(t, db, s, 0, types.MEERA); !reflect.DeepEqual(*b, AccountBalance{}) {
+		t.Fatalf("cleared balance %+v", b)
+	}
+}
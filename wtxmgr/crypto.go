@@ -0,0 +1,144 @@
+package wtxmgr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/Qitmeer/qng/common/hash"
+)
+
+// The values of the store are encrypted with the public crypto key of the
+// address manager, so that copying the wallet database does not reveal the
+// payment history without the public passphrase.  Bucket keys which would
+// reveal addresses or transactions are replaced by an HMAC-SHA256 keyed with a
+// key derived from the public crypto key:
+//
+//   - the nested address buckets of BucketAddrtxout, BucketAddrtxin,
+//     BucketAddrHistory and BucketAddrHistoryTx are keyed by the HMAC of the
+//     address,
+//   - outputs are keyed by the HMAC of their outpoint,
+//   - BucketTxJson, BucketUnConfirmed and the nested buckets of
+//     BucketAddrHistoryTx are keyed by the HMAC of the transaction hash,
+//   - history entries are keyed by the block order followed by the HMAC of
+//     the transaction hash, so that they still sort by block order.
+//
+// Values which were looked up by their key now carry it: unconfirmed
+// transaction values start with the transaction hash and history entry values
+// start with the transaction hash (see sealUnconfirmed and valueAddrHistory).
+
+// CryptoKey encrypts and decrypts the values of the store.  It is the public
+// crypto key of the address manager.
+type CryptoKey interface {
+	Encrypt(in []byte) ([]byte, error)
+	Decrypt(in []byte) ([]byte, error)
+	Bytes() []byte
+}
+
+// keyHMACTag separates the HMAC key of the store from other uses of the
+// public crypto key.
+var keyHMACTag = []byte("wtxmgr bucket keys")
+
+// recordKeys encrypts the values and derives the bucket keys of the store.  A
+// nil *recordKeys leaves values in plaintext and keys unchanged, which is the
+// layout of wallets before the encryptRecords migration.
+type recordKeys struct {
+	crypto CryptoKey
+	mac    []byte
+}
+
+// newRecordKeys returns the record keys derived from the crypto key.
+func newRecordKeys(crypto CryptoKey) *recordKeys {
+	m := hmac.New(sha256.New, crypto.Bytes())
+	m.Write(keyHMACTag)
+	return &recordKeys{crypto: crypto, mac: m.Sum(nil)}
+}
+
+func (r *recordKeys) sum(b []byte) []byte {
+	m := hmac.New(sha256.New, r.mac)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
+// addrKey returns the key of the nested buckets of address.
+func (r *recordKeys) addrKey(address string) []byte {
+	if r == nil {
+		return []byte(address)
+	}
+	return r.sum([]byte(address))
+}
+
+// txKey returns the key of the transaction txId.
+func (r *recordKeys) txKey(txId *hash.Hash) []byte {
+	if r == nil {
+		return txId[:]
+	}
+	return r.sum(txId[:])
+}
+
+// outPointKey returns the key of the output index of the transaction txHash.
+func (r *recordKeys) outPointKey(txHash *hash.Hash, index uint32) []byte {
+	k := canonicalOutPoint(txHash, index)
+	if r == nil {
+		return k
+	}
+	return r.sum(k)
+}
+
+// seal encrypts the value v.
+func (r *recordKeys) seal(v []byte) ([]byte, error) {
+	if r == nil {
+		return v, nil
+	}
+	sealed, err := r.crypto.Encrypt(v)
+	if err != nil {
+		return nil, storeError(ErrCrypto, "failed to encrypt value", err)
+	}
+	return sealed, nil
+}
+
+// open decrypts the value v.
+func (r *recordKeys) open(v []byte) ([]byte, error) {
+	if r == nil {
+		return v, nil
+	}
+	opened, err := r.crypto.Decrypt(v)
+	if err != nil {
+		return nil, storeError(ErrCrypto, "failed to decrypt value", err)
+	}
+	return opened, nil
+}
+
+// sealUnconfirmed returns the value of the unconfirmed transaction txId.  As
+// the key is an HMAC, encrypted values start with the transaction hash.
+func (r *recordKeys) sealUnconfirmed(txId *hash.Hash, u *UnconfirmTx) ([]byte, error) {
+	if r == nil {
+		return u.Marshal(), nil
+	}
+	v := make([]byte, 0, len(txId)+11)
+	v = append(v, txId[:]...)
+	return r.seal(append(v, u.Marshal()...))
+}
+
+// openUnconfirmed reads the unconfirmed transaction with key k and value v.
+func (r *recordKeys) openUnconfirmed(k, v []byte) (*hash.Hash, *UnconfirmTx, error) {
+	if r != nil {
+		var err error
+		v, err = r.open(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(v) < hash.HashSize {
+			return nil, nil, storeError(ErrData, "malformed unconfirmed transaction value", nil)
+		}
+		k, v = v[:hash.HashSize], v[hash.HashSize:]
+	}
+	txId, err := hash.NewHash(k)
+	if err != nil {
+		return nil, nil, storeError(ErrData, "malformed unconfirmed transaction key", err)
+	}
+	u, err := UnMarshalUnconfirmTx(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return txId, u, nil
+}
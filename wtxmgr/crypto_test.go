@@ -0,0 +1,207 @@
+package wtxmgr
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/snacl"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// testCryptoKey is a crypto key like the public crypto key of the address
+// manager.
+type testCryptoKey struct {
+	snacl.CryptoKey
+}
+
+func (ck *testCryptoKey) Bytes() []byte {
+	return ck.CryptoKey[:]
+}
+
+func newTestCryptoKey(t *testing.T) *testCryptoKey {
+	key, err := snacl.GenerateCryptoKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCryptoKey{*key}
+}
+
+// fillStore records an output of addr paid by txA and spent by the unmined
+// txB, with its transactions, in the store.
+func fillStore(t *testing.T, db walletdb.DB, s *Store, addr string, txA, txB hash.Hash) *AddrTxOutput {
+	out := testOutput(addr, txA, 10, 100)
+	out.Spend = SpendStatusSpend
+	out.SpendTo = &SpendTo{TxId: txB}
+	tr := testTx()
+	tr.Txid = txA.String()
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(namespaceKey)
+		outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, types.MEERA))
+		if err := s.InsertAddrTxOut(outNs, out); err != nil {
+			return err
+		}
+		if err := s.PutHistoryOutput(ns, out, HistoryUnminedOrder); err != nil {
+			return err
+		}
+		if err := s.PutTxJson(ns, tr); err != nil {
+			return err
+		}
+		return s.PutUnconfirmed(ns, &txB, &UnconfirmTx{Order: 12, Confirmations: 10})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// checkStore verifies the records of fillStore are read back by s.
+func checkStore(t *testing.T, db walletdb.DB, s *Store, want *AddrTxOutput) {
+	t.Helper()
+	txA, txB := want.TxId, want.SpendTo.TxId
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(namespaceKey)
+		outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, types.MEERA))
+		out, err := s.GetAddrTxOut(outNs, want.Address, types.TxOutPoint{Hash: txA, OutIndex: want.Index})
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("output %+v, want %+v", out, want)
+		}
+		var outs []*AddrTxOutput
+		err = s.ForEachTxOut(outNs, func(out *AddrTxOutput) error {
+			outs = append(outs, out)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(outs) != 1 || outs[0].Address != want.Address {
+			t.Errorf("%d outputs listed, want the output of %s", len(outs), want.Address)
+		}
+
+		tr, err := s.FetchTxJson(ns, &txA)
+		if err != nil {
+			return err
+		}
+		if tr == nil || tr.Txid != txA.String() {
+			t.Errorf("stored transaction %+v, want %v", tr, txA)
+		}
+		if tr, err := s.FetchTxJson(ns, &txB); err != nil || tr != nil {
+			t.Errorf("transaction %v stored: %+v, %v", txB, tr, err)
+		}
+
+		var unconfirmed []hash.Hash
+		err = s.ForEachUnconfirmed(ns, func(txId *hash.Hash, u *UnconfirmTx) error {
+			unconfirmed = append(unconfirmed, *txId)
+			if u.Order != 12 || u.Confirmations != 10 {
+				t.Errorf("unconfirmed %+v", u)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(unconfirmed) != 1 || unconfirmed[0] != txB {
+			t.Errorf("unconfirmed %v, want %v", unconfirmed, txB)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := readHistory(t, db, s, want.Address, nil, 10, nil)
+	checkHistory(t, entries,
+		wantEntry{txB, HistoryUnminedOrder, -100},
+		wantEntry{txA, 10, 100})
+}
+
+// findPlaintext returns the path of the first key or value of the store
+// containing one of needles.
+func findPlaintext(t *testing.T, db walletdb.DB, needles ...[]byte) string {
+	var walk func(b walletdb.ReadBucket, path string) string
+	walk = func(b walletdb.ReadBucket, path string) string {
+		var found string
+		b.ForEach(func(k, v []byte) error {
+			if found != "" {
+				return nil
+			}
+			for _, n := range needles {
+				if bytes.Contains(k, n) || bytes.Contains(v, n) {
+					found = path + "/" + string(k)
+					return nil
+				}
+			}
+			if v == nil {
+				found = walk(b.NestedReadBucket(k), path+"/"+string(k))
+			}
+			return nil
+		})
+		return found
+	}
+	var found string
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		found = walk(tx.ReadBucket(namespaceKey), "")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestEncryptedStore(t *testing.T) {
+	db, _ := testStore(t)
+	s := &Store{keys: newRecordKeys(newTestCryptoKey(t))}
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	txA, txB := hash.Hash{0xa, 0xa, 0xa}, hash.Hash{0xb, 0xb, 0xb}
+
+	out := fillStore(t, db, s, addr, txA, txB)
+	checkStore(t, db, s, out)
+	if path := findPlaintext(t, db, []byte(addr), txA[:], txB[:]); path != "" {
+		t.Fatalf("plaintext address or transaction at %q", path)
+	}
+
+	// Another key neither finds nor decrypts the records.
+	other := &Store{keys: newRecordKeys(newTestCryptoKey(t))}
+	entries, _ := readHistory(t, db, other, addr, nil, 10, nil)
+	if len(entries) != 0 {
+		t.Fatalf("%d history entries found with another key", len(entries))
+	}
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		return other.ForEachUnconfirmed(tx.ReadBucket(namespaceKey), func(*hash.Hash, *UnconfirmTx) error {
+			return nil
+		})
+	})
+	if e, ok := err.(Error); !ok || e.Code != ErrCrypto {
+		t.Fatalf("read with another key: %v, want ErrCrypto", err)
+	}
+}
+
+func TestEncryptRecordsMigration(t *testing.T) {
+	db, plain := testStore(t)
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	txA, txB := hash.Hash{0xa, 0xa, 0xa}, hash.Hash{0xb, 0xb, 0xb}
+
+	// Wallets before the migration have plaintext records.
+	out := fillStore(t, db, plain, addr, txA, txB)
+	if path := findPlaintext(t, db, []byte(addr)); path == "" {
+		t.Fatal("no plaintext address before the migration")
+	}
+
+	key := newTestCryptoKey(t)
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		return encryptRecords(tx.ReadWriteBucket(namespaceKey), key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStore(t, db, &Store{keys: newRecordKeys(key)}, out)
+	if path := findPlaintext(t, db, []byte(addr), txA[:], txB[:]); path != "" {
+		t.Fatalf("plaintext address or transaction at %q", path)
+	}
+}
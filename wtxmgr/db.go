@@ -36,13 +36,17 @@ var (
 	BucketTxJson         = []byte("txjson")
 	BucketSync           = []byte("sync")
 	BucketHeight         = []byte("h")
+	BucketAddrHistory    = []byte("ah")
+	BucketAddrHistoryTx  = []byte("aht")
+	BucketAccountBalance = []byte("ab")
 )
 
 // Root (namespace) bucket keys
 var (
-	rootCreateDate   = []byte("date")
-	rootVersion      = []byte("vers")
-	rootMinedBalance = []byte("bal")
+	rootCreateDate    = []byte("date")
+	rootVersion       = []byte("vers")
+	rootMinedBalance  = []byte("bal")
+	rootBalancesBuilt = []byte("balb")
 )
 
 func rootMinedBalanceKey(coinId types.CoinID) []byte {
@@ -1247,6 +1251,13 @@ func createStore(ns walletdb.ReadWriteBucket) error {
 		return storeError(ErrDatabase, str, err)
 	}
 
+	// The account balances of an empty store are built.
+	err = ns.Put(rootBalancesBuilt, []byte{1})
+	if err != nil {
+		str := "failed to store balances built flag"
+		return storeError(ErrDatabase, str, err)
+	}
+
 	// Finally, create all of our required descendant buckets.
 	return createBuckets(ns)
 }
@@ -1306,6 +1317,18 @@ func createBuckets(ns walletdb.ReadWriteBucket) error {
 		str := "failed to create unconfirmed bucket"
 		return storeError(ErrDatabase, str, err)
 	}
+	if _, err := ns.CreateBucket(BucketAddrHistory); err != nil {
+		str := "failed to create address history bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	if _, err := ns.CreateBucket(BucketAddrHistoryTx); err != nil {
+		str := "failed to create address history tx bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	if _, err := ns.CreateBucket(BucketAccountBalance); err != nil {
+		str := "failed to create account balance bucket"
+		return storeError(ErrDatabase, str, err)
+	}
 	return nil
 }
 
@@ -1330,6 +1353,9 @@ func deleteBuckets(ns walletdb.ReadWriteBucket) error {
 
 	ns.DeleteNestedBucket(BucketTxJson)
 	ns.DeleteNestedBucket(BucketUnConfirmed)
+	ns.DeleteNestedBucket(BucketAddrHistory)
+	ns.DeleteNestedBucket(BucketAddrHistoryTx)
+	ns.DeleteNestedBucket(BucketAccountBalance)
 	return nil
 }
 
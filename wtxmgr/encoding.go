@@ -0,0 +1,551 @@
+package wtxmgr
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	util "github.com/Qitmeer/qitmeer-wallet/utils"
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// recordVersion is the first byte of every address output, unconfirmed
+// transaction and stored transaction value written by the store.  Values of
+// wallets before the compact encoding were gob or JSON encoded and are
+// converted by the compactRecords migration.
+const recordVersion byte = 1
+
+// Address outputs are stored in the address output buckets under the outpoint
+// (see canonicalOutPoint) with the following value:
+//
+//   [0]       Record version (1 byte)
+//   [1:33]    Transaction hash (32 bytes)
+//   [33:37]   Output index (4 bytes)
+//   [37:45]   Amount (8 bytes)
+//   [45:47]   Coin ID (2 bytes)
+//   [47:79]   Block hash (32 bytes)
+//   [79:83]   Block order (4 bytes)
+//   [83:85]   Spend status (2 bytes)
+//   [85:87]   Transaction status (2 bytes)
+//   [87:91]   Lock height (4 bytes)
+//   [91]      Flags (1 byte)
+//     0x01: Blue block
+//     0x02: Spending input follows
+//     0x04: Output script is not hex and stored verbatim
+//   [92:96]   Spending input index (4 bytes, only with flag 0x02)
+//   [96:128]  Spending transaction hash (32 bytes, only with flag 0x02)
+//   Address (varint length prefixed)
+//   Output script (varint length prefixed, hex decoded)
+
+const (
+	outputFlagBlue      = 1 << 0
+	outputFlagSpendTo   = 1 << 1
+	outputFlagRawScript = 1 << 2
+)
+
+// Transactions are stored in BucketTxJson under the transaction hash.  Only
+// the fields of corejson.TxRawResult used by the wallet are kept; the raw
+// transaction, script signatures and the script disassembly are dropped.
+//
+//   [0]       Record version (1 byte)
+//   [1]       Flags (1 byte)
+//     0x01: Transactions of the block are valid
+//     0x02: Duplicate transaction
+//     0x04: Pruned transaction, the fields marked * are not stored
+//   [2:34]    Transaction id (32 bytes)
+//   Transaction hash (optional hash) *
+//   Block hash (optional hash)
+//   Version, lock time (uvarints) *
+//   Timestamp (varint length prefixed)
+//   Block order (uvarint), confirmations (varint)
+//   Number of inputs (uvarint), then for each input:
+//     Coinbase (varint length prefixed)
+//     Previous transaction id (optional hash)
+//     Previous output index (uvarint)
+//     Sequence (uvarint) *
+//   Number of outputs (uvarint), then for each output:
+//     Amount (uvarint), coin ID (2 bytes)
+//     Script type (varint length prefixed) *
+//     Script (varint length prefixed) *
+//     Number of addresses (uvarint), then each address (varint length prefixed)
+//
+// An optional hash is a single 0 byte for an empty string, or a 1 byte
+// followed by the 32 byte hash.
+//
+// A pruned transaction only keeps the summary of the transaction used for
+// bills, balances and exports: the full transaction is fetched from the node
+// when needed.
+
+const (
+	txFlagTxsValid  = 1 << 0
+	txFlagDuplicate = 1 << 1
+	txFlagPruned    = 1 << 2
+)
+
+// recordWriter appends the fields of a record value.
+type recordWriter struct {
+	buf []byte
+	err error
+}
+
+func (w *recordWriter) byte(b byte) {
+	w.buf = append(w.buf, b)
+}
+
+func (w *recordWriter) uint16(v uint16) {
+	var b [2]byte
+	byteOrder.PutUint16(b[:], v)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *recordWriter) uint32(v uint32) {
+	var b [4]byte
+	byteOrder.PutUint32(b[:], v)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *recordWriter) uint64(v uint64) {
+	var b [8]byte
+	byteOrder.PutUint64(b[:], v)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *recordWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *recordWriter) varint(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *recordWriter) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *recordWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *recordWriter) hash(h *hash.Hash) {
+	w.buf = append(w.buf, h[:]...)
+}
+
+// hashStr writes the hash string s, which must be a valid hash.
+func (w *recordWriter) hashStr(s string) {
+	h, err := hash.NewHashFromStr(s)
+	if err != nil {
+		if w.err == nil {
+			w.err = fmt.Errorf("invalid hash %q: %v", s, err)
+		}
+		return
+	}
+	w.hash(h)
+}
+
+// optHashStr writes the hash string s as an optional hash.
+func (w *recordWriter) optHashStr(s string) {
+	if s == "" {
+		w.byte(0)
+		return
+	}
+	w.byte(1)
+	w.hashStr(s)
+}
+
+// hexBytes writes the hex string s as length prefixed bytes.
+func (w *recordWriter) hexBytes(s string) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		if w.err == nil {
+			w.err = fmt.Errorf("invalid hex %q: %v", s, err)
+		}
+		return
+	}
+	w.bytes(b)
+}
+
+// recordReader reads the fields of a record value.  After the first short or
+// malformed field every read returns the zero value and err is set.
+type recordReader struct {
+	v   []byte
+	err error
+}
+
+func (r *recordReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.v) < n {
+		r.err = fmt.Errorf("short value: need %d bytes, have %d", n, len(r.v))
+		return nil
+	}
+	b := r.v[:n]
+	r.v = r.v[n:]
+	return b
+}
+
+func (r *recordReader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *recordReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return byteOrder.Uint16(b)
+}
+
+func (r *recordReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return byteOrder.Uint32(b)
+}
+
+func (r *recordReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return byteOrder.Uint64(b)
+}
+
+func (r *recordReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.v)
+	if n <= 0 {
+		r.err = fmt.Errorf("malformed uvarint")
+		return 0
+	}
+	r.v = r.v[n:]
+	return v
+}
+
+func (r *recordReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.v)
+	if n <= 0 {
+		r.err = fmt.Errorf("malformed varint")
+		return 0
+	}
+	r.v = r.v[n:]
+	return v
+}
+
+// count reads an element count, each element taking at least min bytes.
+func (r *recordReader) count(min int) int {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.v)/min) {
+		r.err = fmt.Errorf("count %d exceeds value size", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *recordReader) bytes() []byte {
+	b := r.next(r.count(1))
+	return append([]byte(nil), b...)
+}
+
+func (r *recordReader) string() string {
+	return string(r.next(r.count(1)))
+}
+
+func (r *recordReader) hash(h *hash.Hash) {
+	copy(h[:], r.next(len(h)))
+}
+
+func (r *recordReader) hashStr() string {
+	var h hash.Hash
+	r.hash(&h)
+	return h.String()
+}
+
+func (r *recordReader) optHashStr() string {
+	if r.byte() == 0 {
+		return ""
+	}
+	return r.hashStr()
+}
+
+func (r *recordReader) hexBytes() string {
+	return hex.EncodeToString(r.bytes())
+}
+
+// version reads and checks the record version of the value.
+func (r *recordReader) version() {
+	if v := r.byte(); r.err == nil && v != recordVersion {
+		r.err = fmt.Errorf("unknown record version %d", v)
+	}
+}
+
+// close returns a storeError for the first read error of a desc value, or
+// for bytes left after the last field.
+func (r *recordReader) close(desc string) error {
+	if r.err == nil && len(r.v) != 0 {
+		r.err = fmt.Errorf("%d unexpected trailing bytes", len(r.v))
+	}
+	if r.err != nil {
+		str := fmt.Sprintf("malformed %s value", desc)
+		return storeError(ErrData, str, r.err)
+	}
+	return nil
+}
+
+// Encode returns the address output value of a.
+func (a *AddrTxOutput) Encode() []byte {
+	w := recordWriter{buf: make([]byte, 0, 128+len(a.Address)+len(a.PkScript)/2+2)}
+	w.byte(recordVersion)
+	w.hash(&a.TxId)
+	w.uint32(a.Index)
+	w.uint64(uint64(a.Amount.Value))
+	w.uint16(uint16(a.Amount.Id))
+	w.hash(&a.Block.Hash)
+	w.uint32(uint32(a.Block.Order))
+	w.uint16(uint16(a.Spend))
+	w.uint16(uint16(a.Status))
+	w.uint32(a.Locked)
+	var flags byte
+	if a.IsBlue {
+		flags |= outputFlagBlue
+	}
+	if a.SpendTo != nil {
+		flags |= outputFlagSpendTo
+	}
+	script, err := hex.DecodeString(a.PkScript)
+	if err != nil {
+		script = []byte(a.PkScript)
+		flags |= outputFlagRawScript
+	}
+	w.byte(flags)
+	if a.SpendTo != nil {
+		w.uint32(a.SpendTo.Index)
+		w.hash(&a.SpendTo.TxId)
+	}
+	w.string(a.Address)
+	w.bytes(script)
+	return w.buf
+}
+
+// DecodeAddrTxOutput decodes an address output value written by Encode.
+func DecodeAddrTxOutput(v []byte) (*AddrTxOutput, error) {
+	r := recordReader{v: v}
+	r.version()
+	a := &AddrTxOutput{}
+	r.hash(&a.TxId)
+	a.Index = r.uint32()
+	a.Amount.Value = int64(r.uint64())
+	a.Amount.Id = types.CoinID(r.uint16())
+	r.hash(&a.Block.Hash)
+	a.Block.Order = int32(r.uint32())
+	a.Spend = SpendStatus(r.uint16())
+	a.Status = TxStatus(r.uint16())
+	a.Locked = r.uint32()
+	flags := r.byte()
+	a.IsBlue = flags&outputFlagBlue != 0
+	if flags&outputFlagSpendTo != 0 {
+		a.SpendTo = &SpendTo{Index: r.uint32()}
+		r.hash(&a.SpendTo.TxId)
+	}
+	a.Address = r.string()
+	if flags&outputFlagRawScript != 0 {
+		a.PkScript = r.string()
+	} else {
+		a.PkScript = r.hexBytes()
+	}
+	if err := r.close("address output"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Marshal returns the unconfirmed transaction value of u.
+func (u *UnconfirmTx) Marshal() []byte {
+	w := recordWriter{buf: make([]byte, 0, 11)}
+	w.byte(recordVersion)
+	w.uvarint(uint64(u.Order))
+	w.uvarint(uint64(u.Confirmations))
+	return w.buf
+}
+
+// UnMarshalUnconfirmTx decodes an unconfirmed transaction value written by
+// Marshal.
+func UnMarshalUnconfirmTx(v []byte) (*UnconfirmTx, error) {
+	r := recordReader{v: v}
+	r.version()
+	u := &UnconfirmTx{
+		Order:         uint32(r.uvarint()),
+		Confirmations: uint32(r.uvarint()),
+	}
+	if err := r.close("unconfirmed transaction"); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// EncodeStoredTx returns the stored transaction value of tr for BucketTxJson.
+func EncodeStoredTx(tr *corejson.TxRawResult) ([]byte, error) {
+	return encodeStoredTx(tr, false)
+}
+
+// EncodePrunedTx returns the pruned transaction value of tr for BucketTxJson.
+func EncodePrunedTx(tr *corejson.TxRawResult) ([]byte, error) {
+	return encodeStoredTx(tr, true)
+}
+
+func encodeStoredTx(tr *corejson.TxRawResult, pruned bool) ([]byte, error) {
+	w := recordWriter{buf: make([]byte, 0, 128+64*len(tr.Vin)+64*len(tr.Vout))}
+	w.byte(recordVersion)
+	var flags byte
+	if tr.Txsvalid {
+		flags |= txFlagTxsValid
+	}
+	if tr.Duplicate {
+		flags |= txFlagDuplicate
+	}
+	if pruned {
+		flags |= txFlagPruned
+	}
+	w.byte(flags)
+	w.hashStr(tr.Txid)
+	if !pruned {
+		w.optHashStr(tr.TxHash)
+	}
+	w.optHashStr(tr.BlockHash)
+	if !pruned {
+		w.uvarint(uint64(tr.Version))
+		w.uvarint(uint64(tr.LockTime))
+	}
+	w.string(tr.Timestamp)
+	w.uvarint(tr.BlockOrder)
+	w.varint(tr.Confirmations)
+	w.uvarint(uint64(len(tr.Vin)))
+	for i := range tr.Vin {
+		vin := &tr.Vin[i]
+		w.string(vin.Coinbase)
+		w.optHashStr(vin.Txid)
+		w.uvarint(uint64(vin.Vout))
+		if !pruned {
+			w.uvarint(uint64(vin.Sequence))
+		}
+	}
+	w.uvarint(uint64(len(tr.Vout)))
+	for i := range tr.Vout {
+		vout := &tr.Vout[i]
+		w.uvarint(uint64(vout.Amount))
+		w.uint16(vout.CoinId)
+		if !pruned {
+			w.string(vout.ScriptPubKey.Type)
+			w.hexBytes(vout.ScriptPubKey.Hex)
+		}
+		w.uvarint(uint64(len(vout.ScriptPubKey.Addresses)))
+		for _, addr := range vout.ScriptPubKey.Addresses {
+			w.string(addr)
+		}
+	}
+	if w.err != nil {
+		str := fmt.Sprintf("cannot encode transaction %s", tr.Txid)
+		return nil, storeError(ErrInput, str, w.err)
+	}
+	return w.buf, nil
+}
+
+// DecodeStoredTx decodes a stored transaction value written by
+// EncodeStoredTx or EncodePrunedTx.  Fields which are not stored are left
+// zero.
+func DecodeStoredTx(v []byte) (*corejson.TxRawResult, error) {
+	tr, _, err := decodeStoredTx(v)
+	return tr, err
+}
+
+// decodeStoredTx decodes a stored transaction value and returns whether it
+// was pruned.
+func decodeStoredTx(v []byte) (*corejson.TxRawResult, bool, error) {
+	r := recordReader{v: v}
+	r.version()
+	tr := &corejson.TxRawResult{}
+	flags := r.byte()
+	pruned := flags&txFlagPruned != 0
+	tr.Txsvalid = flags&txFlagTxsValid != 0
+	tr.Duplicate = flags&txFlagDuplicate != 0
+	tr.Txid = r.hashStr()
+	if !pruned {
+		tr.TxHash = r.optHashStr()
+	}
+	tr.BlockHash = r.optHashStr()
+	if !pruned {
+		tr.Version = uint32(r.uvarint())
+		tr.LockTime = uint32(r.uvarint())
+	}
+	tr.Timestamp = r.string()
+	tr.BlockOrder = r.uvarint()
+	tr.Confirmations = r.varint()
+	// Inputs take at least 3 bytes and outputs 4 bytes each.
+	if n := r.count(3); n > 0 {
+		tr.Vin = make([]corejson.Vin, n)
+		for i := range tr.Vin {
+			vin := &tr.Vin[i]
+			vin.Coinbase = r.string()
+			vin.Txid = r.optHashStr()
+			vin.Vout = uint32(r.uvarint())
+			if !pruned {
+				vin.Sequence = uint32(r.uvarint())
+			}
+		}
+	}
+	if n := r.count(4); n > 0 {
+		tr.Vout = make([]corejson.Vout, n)
+		for i := range tr.Vout {
+			vout := &tr.Vout[i]
+			vout.Amount = r.uvarint()
+			vout.CoinId = r.uint16()
+			if !pruned {
+				vout.ScriptPubKey.Type = r.string()
+				vout.ScriptPubKey.Hex = r.hexBytes()
+			}
+			if n := r.count(1); n > 0 {
+				vout.ScriptPubKey.Addresses = make([]string, n)
+				for j := range vout.ScriptPubKey.Addresses {
+					vout.ScriptPubKey.Addresses[j] = r.string()
+				}
+			}
+		}
+	}
+	if err := r.close("stored transaction"); err != nil {
+		return nil, false, err
+	}
+	return tr, pruned, nil
+}
+
+// Decoders of the values written before the compact encoding, used by the
+// migrations up to compactRecords.
+
+func decodeLegacyAddrTxOutput(v []byte) (*AddrTxOutput, error) {
+	a := &AddrTxOutput{}
+	return a, util.Decode(v, a)
+}
+
+func decodeLegacyUnconfirmTx(v []byte) (*UnconfirmTx, error) {
+	u := &UnconfirmTx{}
+	return u, json.Unmarshal(v, u)
+}
+
+func decodeLegacyTx(v []byte) (*corejson.TxRawResult, error) {
+	tr := &corejson.TxRawResult{}
+	return tr, json.Unmarshal(v, tr)
+}
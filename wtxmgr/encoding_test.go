@@ -0,0 +1,277 @@
+package wtxmgr
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	util "github.com/Qitmeer/qitmeer-wallet/utils"
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// putLegacyOutput stores out gob encoded, as wallets before the compact
+// encoding did.
+func putLegacyOutput(ns walletdb.ReadWriteBucket, out *AddrTxOutput) error {
+	v, err := util.Encode(out)
+	if err != nil {
+		return err
+	}
+	outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, out.Amount.Id))
+	addrNs, err := outNs.CreateBucketIfNotExists([]byte(out.Address))
+	if err != nil {
+		return err
+	}
+	return addrNs.Put(canonicalOutPoint(&out.TxId, out.Index), v)
+}
+
+func testTx() *corejson.TxRawResult {
+	txId, prevId, blockHash := hash.Hash{0xa}, hash.Hash{0xb}, hash.Hash{0xc}
+	tr := &corejson.TxRawResult{
+		Txid:          txId.String(),
+		TxHash:        txId.String(),
+		Version:       1,
+		LockTime:      500,
+		Timestamp:     "2023-03-01T10:00:00+08:00",
+		BlockHash:     blockHash.String(),
+		BlockOrder:    1200,
+		Confirmations: 15,
+		Txsvalid:      true,
+		Vin: []corejson.Vin{
+			{Txid: prevId.String(), Vout: 3, Sequence: 0xffffffff},
+		},
+		Vout: []corejson.Vout{
+			{Amount: 100000000, CoinId: uint16(types.MEERA)},
+			{Amount: 25, CoinId: 1},
+		},
+	}
+	tr.Vout[0].ScriptPubKey.Type = "pubkeyhash"
+	tr.Vout[0].ScriptPubKey.Hex = "76a914c0f0b73c320e1fe38eb1166a57b953e509c8f93e88ac"
+	tr.Vout[0].ScriptPubKey.Addresses = []string{"TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"}
+	tr.Vout[1].ScriptPubKey.Type = "nonstandard"
+	return tr
+}
+
+func TestAddrTxOutputEncoding(t *testing.T) {
+	out := testOutput("TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5", hash.Hash{0xa}, 10, 100)
+	out.Index = 2
+	out.Status = TxStatusConfirmed
+	out.Locked = 300
+	out.IsBlue = true
+	out.PkScript = "76a914c0f0b73c320e1fe38eb1166a57b953e509c8f93e88ac"
+
+	spent := *out
+	spent.Spend = SpendStatusSpend
+	spent.SpendTo = &SpendTo{Index: 1, TxId: hash.Hash{0xb}}
+
+	noSpendTo := *out
+	noSpendTo.SpendTo = nil
+
+	raw := *out
+	raw.PkScript = "not hex"
+
+	for i, want := range []*AddrTxOutput{out, &spent, &noSpendTo, &raw} {
+		v := want.Encode()
+		got, err := DecodeAddrTxOutput(v)
+		if err != nil {
+			t.Fatalf("output %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("output %d: decoded %+v, want %+v", i, got, want)
+		}
+		legacy, err := util.Encode(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v) >= len(legacy) {
+			t.Errorf("output %d: %d bytes, gob encoding has %d", i, len(v), len(legacy))
+		}
+	}
+}
+
+func TestUnconfirmTxEncoding(t *testing.T) {
+	want := &UnconfirmTx{Order: 123456, Confirmations: 10}
+	got, err := UnMarshalUnconfirmTx(want.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *want {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+}
+
+func TestStoredTxEncoding(t *testing.T) {
+	want := testTx()
+	v, err := EncodeStoredTx(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeStoredTx(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+	legacy, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) >= len(legacy)/2 {
+		t.Errorf("%d bytes, JSON encoding has %d", len(v), len(legacy))
+	}
+
+	// Unmined transactions have no block hash.
+	want.BlockHash = ""
+	want.BlockOrder = 0
+	want.Confirmations = 0
+	v, err = EncodeStoredTx(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = DecodeStoredTx(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+
+	want.Txid = "not a hash"
+	if _, err := EncodeStoredTx(want); err == nil {
+		t.Fatal("encoded a transaction with an invalid id")
+	}
+}
+
+func TestMalformedRecords(t *testing.T) {
+	out := testOutput("TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5", hash.Hash{0xa}, 10, 100).Encode()
+	tx, err := EncodeStoredTx(testTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unconfirmed := (&UnconfirmTx{Order: 1, Confirmations: 2}).Marshal()
+
+	legacyOut, err := util.Encode(testOutput("TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5", hash.Hash{0xa}, 10, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyTx, err := json.Marshal(testTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyUnconfirmed, err := json.Marshal(&UnconfirmTx{Order: 1, Confirmations: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		v      []byte
+		decode func([]byte) error
+	}{
+		{"empty output", nil, decodeOutputErr},
+		{"truncated output", out[:len(out)-1], decodeOutputErr},
+		{"trailing output", append(out[:len(out):len(out)], 0), decodeOutputErr},
+		{"legacy output", legacyOut, decodeOutputErr},
+		{"truncated tx", tx[:len(tx)-1], decodeTxErr},
+		{"legacy tx", legacyTx, decodeTxErr},
+		{"truncated unconfirmed", unconfirmed[:1], decodeUnconfirmedErr},
+		{"legacy unconfirmed", legacyUnconfirmed, decodeUnconfirmedErr},
+	}
+	for _, test := range tests {
+		err := test.decode(test.v)
+		if err == nil {
+			t.Errorf("%s: decoded", test.name)
+			continue
+		}
+		if e, ok := err.(Error); !ok || e.Code != ErrData {
+			t.Errorf("%s: error %v, want ErrData", test.name, err)
+		}
+	}
+}
+
+func decodeOutputErr(v []byte) error {
+	_, err := DecodeAddrTxOutput(v)
+	return err
+}
+
+func decodeTxErr(v []byte) error {
+	_, err := DecodeStoredTx(v)
+	return err
+}
+
+func decodeUnconfirmedErr(v []byte) error {
+	_, err := UnMarshalUnconfirmTx(v)
+	return err
+}
+
+func TestCompactRecordsMigration(t *testing.T) {
+	db, s := testStore(t)
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	out := testOutput(addr, hash.Hash{0xa}, 10, 100)
+	out.PkScript = "76a914c0f0b73c320e1fe38eb1166a57b953e509c8f93e88ac"
+	out.Spend = SpendStatusSpend
+	out.SpendTo = &SpendTo{Index: 1, TxId: hash.Hash{0xb}}
+	tr := testTx()
+	unconfirmed := &UnconfirmTx{Order: 1210, Confirmations: 10}
+
+	// Wallets before the migration have gob and JSON encoded records.
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(namespaceKey)
+		if err := putLegacyOutput(ns, out); err != nil {
+			return err
+		}
+		v, err := json.Marshal(tr)
+		if err != nil {
+			return err
+		}
+		if err := ns.NestedReadWriteBucket(BucketTxJson).Put(out.TxId[:], v); err != nil {
+			return err
+		}
+		v, err = json.Marshal(unconfirmed)
+		if err != nil {
+			return err
+		}
+		if err := ns.NestedReadWriteBucket(BucketUnConfirmed).Put(out.TxId[:], v); err != nil {
+			return err
+		}
+		return compactRecords(ns)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(namespaceKey)
+		outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, types.MEERA))
+		gotOut, err := s.GetAddrTxOut(outNs, addr, types.TxOutPoint{Hash: out.TxId, OutIndex: out.Index})
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(gotOut, out) {
+			t.Errorf("output %+v, want %+v", gotOut, out)
+		}
+
+		gotTx, err := DecodeStoredTx(ns.NestedReadBucket(BucketTxJson).Get(out.TxId[:]))
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(gotTx, tr) {
+			t.Errorf("transaction %+v, want %+v", gotTx, tr)
+		}
+
+		gotUnconfirmed, err := UnMarshalUnconfirmTx(ns.NestedReadBucket(BucketUnConfirmed).Get(out.TxId[:]))
+		if err != nil {
+			return err
+		}
+		if *gotUnconfirmed != *unconfirmed {
+			t.Errorf("unconfirmed %+v, want %+v", gotUnconfirmed, unconfirmed)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
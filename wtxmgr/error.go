@@ -49,6 +49,10 @@ const (
 	// but the database version is newer than latest version known to this
 	// software.  This likely indicates an outdated binary.
 	ErrUnknownVersion
+
+	// ErrCrypto describes an error where a value of the store could not be
+	// encrypted or decrypted with the public crypto key.
+	ErrCrypto
 )
 
 var errStr = [...]string{
@@ -59,6 +63,7 @@ var errStr = [...]string{
 	ErrNoExists:       "ErrNoExists",
 	ErrNeedsUpgrade:   "ErrNeedsUpgrade",
 	ErrUnknownVersion: "ErrUnknownVersion",
+	ErrCrypto:         "ErrCrypto",
 }
 
 // String returns the ErrorCode as a human-readable name.
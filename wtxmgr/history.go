@@ -0,0 +1,491 @@
+package wtxmgr
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	corejson "github.com/Qitmeer/qng/core/json"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// The history index lists the transactions affecting each address, so that
+// the history of an address can be paged with cursor scans instead of loading
+// all of its outputs.
+//
+// The BucketAddrHistory bucket holds a nested bucket per address, keyed by
+// the block order and hash of each transaction:
+//
+//   [0:4]   Block order (4 bytes, big endian)
+//   [4:36]  Transaction hash (32 bytes)
+//
+// The value lists the outputs of the address the transaction pays to or
+// spends, so that the net variation of the address can be computed and
+// recording an output twice is harmless:
+//
+//   [0:32]  Output transaction hash (32 bytes)
+//   [32:36] Output index (4 bytes)
+//   [36]    1 when the transaction spends the output, 0 when it pays to it
+//   [37:39] Coin id (2 bytes)
+//   [39:47] Amount (8 bytes)
+//   ...     Following outputs
+//
+// Unmined transactions are keyed by HistoryUnminedOrder, so they come first
+// when paging from the newest transaction.  The BucketAddrHistoryTx bucket
+// maps the hash of each transaction to its block order in a nested bucket per
+// address, so that an entry can be moved once the transaction is mined.
+//
+// In encrypted stores the address and transaction hashes of the keys are
+// replaced by their HMACs (see recordKeys), and the encrypted value starts
+// with the transaction hash followed by the outputs.
+
+// HistoryUnminedOrder is the block order of unmined transactions in the
+// history index.
+const HistoryUnminedOrder = math.MaxUint32
+
+const (
+	historyKeySize  = 36
+	historyPartSize = 47
+)
+
+// HistoryPart is the effect of an output of an address on a transaction of
+// its history.  The transaction either pays to the output or spends it.
+type HistoryPart struct {
+	OutPoint types.TxOutPoint
+	Spent    bool
+	Amount   types.Amount
+}
+
+// AddrHistoryEntry is a transaction in the history of an address.
+type AddrHistoryEntry struct {
+	Order uint32
+	TxId  hash.Hash
+	Parts []HistoryPart
+}
+
+// Variation returns the net variation of the address in the transaction,
+// summed over all coins.
+func (e *AddrHistoryEntry) Variation() int64 {
+	var v int64
+	for _, p := range e.Parts {
+		if p.Spent {
+			v -= p.Amount.Value
+		} else {
+			v += p.Amount.Value
+		}
+	}
+	return v
+}
+
+// CoinVariations returns the net variation of the address in the transaction
+// per coin.
+func (e *AddrHistoryEntry) CoinVariations() map[types.CoinID]int64 {
+	m := make(map[types.CoinID]int64)
+	for _, p := range e.Parts {
+		if p.Spent {
+			m[p.Amount.Id] -= p.Amount.Value
+		} else {
+			m[p.Amount.Id] += p.Amount.Value
+		}
+	}
+	return m
+}
+
+// HistoryOrder returns the history index order of a transaction mined in
+// block, or HistoryUnminedOrder when block is unset.
+func HistoryOrder(block Block) uint32 {
+	if block.Hash == hash.ZeroHash {
+		return HistoryUnminedOrder
+	}
+	return uint32(block.Order)
+}
+
+// TxHistoryOrder returns the history index order of the transaction tr.
+func TxHistoryOrder(tr *corejson.TxRawResult) uint32 {
+	if tr.BlockHash == "" {
+		return HistoryUnminedOrder
+	}
+	return uint32(tr.BlockOrder)
+}
+
+func keyAddrHistory(keys *recordKeys, order uint32, txId *hash.Hash) []byte {
+	k := make([]byte, historyKeySize)
+	byteOrder.PutUint32(k, order)
+	copy(k[4:], keys.txKey(txId))
+	return k
+}
+
+func readAddrHistory(keys *recordKeys, k, v []byte, e *AddrHistoryEntry) error {
+	var txId []byte
+	if keys == nil {
+		if len(k) == historyKeySize {
+			txId = k[4:]
+		}
+	} else {
+		var err error
+		if v, err = keys.open(v); err != nil {
+			return err
+		}
+		if len(v) >= hash.HashSize {
+			txId, v = v[:hash.HashSize], v[hash.HashSize:]
+		}
+	}
+	if len(k) != historyKeySize || len(txId) != hash.HashSize || len(v)%historyPartSize != 0 {
+		str := fmt.Sprintf("history entry: malformed key or value "+
+			"(key %d bytes, value %d bytes)", len(k), len(v))
+		return storeError(ErrData, str, nil)
+	}
+	e.Order = byteOrder.Uint32(k)
+	copy(e.TxId[:], txId)
+	e.Parts = make([]HistoryPart, 0, len(v)/historyPartSize)
+	for ; len(v) > 0; v = v[historyPartSize:] {
+		var p HistoryPart
+		copy(p.OutPoint.Hash[:], v)
+		p.OutPoint.OutIndex = byteOrder.Uint32(v[32:])
+		p.Spent = v[36] == 1
+		p.Amount.Id = types.CoinID(byteOrder.Uint16(v[37:]))
+		p.Amount.Value = int64(byteOrder.Uint64(v[39:]))
+		e.Parts = append(e.Parts, p)
+	}
+	return nil
+}
+
+func valueAddrHistory(keys *recordKeys, txId *hash.Hash, parts []HistoryPart) ([]byte, error) {
+	var v []byte
+	if keys == nil {
+		v = make([]byte, len(parts)*historyPartSize)
+	} else {
+		v = make([]byte, hash.HashSize+len(parts)*historyPartSize)
+		copy(v, txId[:])
+	}
+	head := len(v) - len(parts)*historyPartSize
+	for i, p := range parts {
+		b := v[head+i*historyPartSize:]
+		copy(b, p.OutPoint.Hash[:])
+		byteOrder.PutUint32(b[32:], p.OutPoint.OutIndex)
+		if p.Spent {
+			b[36] = 1
+		}
+		byteOrder.PutUint16(b[37:], uint16(p.Amount.Id))
+		byteOrder.PutUint64(b[39:], uint64(p.Amount.Value))
+	}
+	return keys.seal(v)
+}
+
+// addrHistoryBuckets returns the history and transaction order buckets of
+// address, creating them if needed.
+func addrHistoryBuckets(keys *recordKeys, ns walletdb.ReadWriteBucket, address string) (walletdb.ReadWriteBucket, walletdb.ReadWriteBucket, error) {
+	historyNs, err := ns.CreateBucketIfNotExists(BucketAddrHistory)
+	if err != nil {
+		return nil, nil, storeError(ErrDatabase, "failed to create history bucket", err)
+	}
+	txNs, err := ns.CreateBucketIfNotExists(BucketAddrHistoryTx)
+	if err != nil {
+		return nil, nil, storeError(ErrDatabase, "failed to create history tx bucket", err)
+	}
+	history, err := historyNs.CreateBucketIfNotExists(keys.addrKey(address))
+	if err != nil {
+		return nil, nil, storeError(ErrDatabase, "failed to create address history bucket", err)
+	}
+	orders, err := txNs.CreateBucketIfNotExists(keys.addrKey(address))
+	if err != nil {
+		return nil, nil, storeError(ErrDatabase, "failed to create address history tx bucket", err)
+	}
+	return history, orders, nil
+}
+
+// putHistoryPart records part in the history entry of the transaction txId of
+// address, mined at order.  An entry recorded at another order is moved,
+// unless order is HistoryUnminedOrder: a mined transaction is not moved back.
+func putHistoryPart(keys *recordKeys, ns walletdb.ReadWriteBucket, address string, order uint32, txId *hash.Hash, part HistoryPart) error {
+	history, orders, err := addrHistoryBuckets(keys, ns, address)
+	if err != nil {
+		return err
+	}
+
+	var entry AddrHistoryEntry
+	if v := orders.Get(keys.txKey(txId)); len(v) == 4 {
+		oldOrder := byteOrder.Uint32(v)
+		if order == HistoryUnminedOrder {
+			order = oldOrder
+		}
+		oldKey := keyAddrHistory(keys, oldOrder, txId)
+		if old := history.Get(oldKey); old != nil {
+			if err := readAddrHistory(keys, oldKey, old, &entry); err != nil {
+				return err
+			}
+		}
+		if oldOrder != order {
+			if err := history.Delete(oldKey); err != nil {
+				return storeError(ErrDatabase, "failed to move history entry", err)
+			}
+		}
+	}
+
+	replaced := false
+	for i, p := range entry.Parts {
+		if p.OutPoint == part.OutPoint && p.Spent == part.Spent {
+			entry.Parts[i] = part
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		entry.Parts = append(entry.Parts, part)
+	}
+
+	v, err := valueAddrHistory(keys, txId, entry.Parts)
+	if err != nil {
+		return err
+	}
+	err = history.Put(keyAddrHistory(keys, order, txId), v)
+	if err != nil {
+		return storeError(ErrDatabase, "failed to put history entry", err)
+	}
+	var o [4]byte
+	byteOrder.PutUint32(o[:], order)
+	if err := orders.Put(keys.txKey(txId), o[:]); err != nil {
+		return storeError(ErrDatabase, "failed to put history tx order", err)
+	}
+	return nil
+}
+
+// deleteHistoryPart removes the part of point from the history entry of the
+// transaction txId of address, and the entry once it is empty.
+func deleteHistoryPart(keys *recordKeys, ns walletdb.ReadWriteBucket, address string, txId *hash.Hash, point types.TxOutPoint, spent bool) error {
+	historyNs := ns.NestedReadWriteBucket(BucketAddrHistory)
+	txNs := ns.NestedReadWriteBucket(BucketAddrHistoryTx)
+	if historyNs == nil || txNs == nil {
+		return nil
+	}
+	history := historyNs.NestedReadWriteBucket(keys.addrKey(address))
+	orders := txNs.NestedReadWriteBucket(keys.addrKey(address))
+	if history == nil || orders == nil {
+		return nil
+	}
+	v := orders.Get(keys.txKey(txId))
+	if len(v) != 4 {
+		return nil
+	}
+	k := keyAddrHistory(keys, byteOrder.Uint32(v), txId)
+	var entry AddrHistoryEntry
+	if err := readAddrHistory(keys, k, history.Get(k), &entry); err != nil {
+		return err
+	}
+
+	parts := entry.Parts[:0]
+	for _, p := range entry.Parts {
+		if p.OutPoint != point || p.Spent != spent {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) > 0 {
+		v, err := valueAddrHistory(keys, txId, parts)
+		if err != nil {
+			return err
+		}
+		return history.Put(k, v)
+	}
+	if err := history.Delete(k); err != nil {
+		return storeError(ErrDatabase, "failed to delete history entry", err)
+	}
+	return orders.Delete(keys.txKey(txId))
+}
+
+// PutHistoryOutput records the output out in the history index of its
+// address: as paid to by its transaction and, when it is spent, as spent by
+// out.SpendTo.TxId, mined at spendOrder.
+func (s *Store) PutHistoryOutput(ns walletdb.ReadWriteBucket, out *AddrTxOutput, spendOrder uint32) error {
+	return putHistoryOutput(s.keys, ns, out, spendOrder)
+}
+
+func putHistoryOutput(keys *recordKeys, ns walletdb.ReadWriteBucket, out *AddrTxOutput, spendOrder uint32) error {
+	point := types.TxOutPoint{Hash: out.TxId, OutIndex: out.Index}
+	err := putHistoryPart(keys, ns, out.Address, HistoryOrder(out.Block), &out.TxId,
+		HistoryPart{OutPoint: point, Amount: out.Amount})
+	if err != nil {
+		return err
+	}
+	if out.Spend != SpendStatusSpend || out.SpendTo == nil || out.SpendTo.TxId == hash.ZeroHash {
+		return nil
+	}
+	return putHistoryPart(keys, ns, out.Address, spendOrder, &out.SpendTo.TxId,
+		HistoryPart{OutPoint: point, Spent: true, Amount: out.Amount})
+}
+
+// DeleteHistoryOutput removes the output out from the history index of its
+// address.
+func (s *Store) DeleteHistoryOutput(ns walletdb.ReadWriteBucket, out *AddrTxOutput) error {
+	point := types.TxOutPoint{Hash: out.TxId, OutIndex: out.Index}
+	if err := deleteHistoryPart(s.keys, ns, out.Address, &out.TxId, point, false); err != nil {
+		return err
+	}
+	if out.SpendTo == nil || out.SpendTo.TxId == hash.ZeroHash {
+		return nil
+	}
+	return deleteHistoryPart(s.keys, ns, out.Address, &out.SpendTo.TxId, point, true)
+}
+
+// AddrHistory returns up to limit entries of the history of address matching
+// match, newest first.  A nil match matches all entries.  The scan starts
+// after the entry at cursor, or at the newest entry when cursor is nil.  The
+// returned cursor continues the scan after the last returned entry, it is nil
+// when no other entry matches.
+func (s *Store) AddrHistory(ns walletdb.ReadBucket, address string, cursor []byte, limit int,
+	match func(*AddrHistoryEntry) bool) ([]AddrHistoryEntry, []byte, error) {
+
+	return s.AddrsHistory(ns, []string{address}, cursor, limit, match)
+}
+
+// AddrsHistory is AddrHistory for the merged history of addresses, such as
+// the forms of the same key.  The entries of a transaction affecting several
+// of the addresses are merged into one entry holding all of their parts.
+// Entries are keyed alike in the history of every address, so the returned
+// cursor continues the merged scan.
+func (s *Store) AddrsHistory(ns walletdb.ReadBucket, addresses []string, cursor []byte, limit int,
+	match func(*AddrHistoryEntry) bool) ([]AddrHistoryEntry, []byte, error) {
+
+	if cursor != nil && len(cursor) != historyKeySize {
+		return nil, nil, storeError(ErrInput, "invalid history cursor", nil)
+	}
+	historyNs := ns.NestedReadBucket(BucketAddrHistory)
+	if historyNs == nil {
+		return nil, nil, nil
+	}
+
+	var scans []*historyScan
+	for _, address := range addresses {
+		history := historyNs.NestedReadBucket(s.keys.addrKey(address))
+		if history != nil {
+			scans = append(scans, newHistoryScan(history.ReadCursor(), cursor))
+		}
+	}
+
+	var entries []AddrHistoryEntry
+	var last []byte
+	for {
+		// The newest entry of all addresses.
+		var k []byte
+		for _, scan := range scans {
+			if scan.k != nil && (k == nil || bytes.Compare(scan.k, k) > 0) {
+				k = scan.k
+			}
+		}
+		if k == nil {
+			return entries, nil, nil
+		}
+		k = append([]byte(nil), k...)
+
+		var e AddrHistoryEntry
+		found := false
+		for _, scan := range scans {
+			if !bytes.Equal(scan.k, k) {
+				continue
+			}
+			var part AddrHistoryEntry
+			if err := readAddrHistory(s.keys, scan.k, scan.v, &part); err != nil {
+				return nil, nil, err
+			}
+			if found {
+				e.Parts = append(e.Parts, part.Parts...)
+			} else {
+				e, found = part, true
+			}
+			scan.k, scan.v = scan.c.Prev()
+		}
+		if match != nil && !match(&e) {
+			continue
+		}
+		if len(entries) == limit {
+			return entries, last, nil
+		}
+		entries = append(entries, e)
+		last = k
+	}
+}
+
+// historyScan walks the history of an address from the newest entry.
+type historyScan struct {
+	c    walletdb.ReadCursor
+	k, v []byte
+}
+
+// newHistoryScan positions c at the newest entry before cursor, or at the
+// newest entry when cursor is nil.
+func newHistoryScan(c walletdb.ReadCursor, cursor []byte) *historyScan {
+	scan := &historyScan{c: c}
+	if cursor == nil {
+		scan.k, scan.v = c.Last()
+		return scan
+	}
+	scan.k, scan.v = c.Seek(cursor)
+	if scan.k == nil {
+		scan.k, scan.v = c.Last()
+	}
+	for scan.k != nil && bytes.Compare(scan.k, cursor) >= 0 {
+		scan.k, scan.v = c.Prev()
+	}
+	return scan
+}
+
+// buildAddrHistory fills the history index from the outputs of every address.
+// It runs as part of the addAddrHistory migration, before compactRecords and
+// encryptRecords, and so reads the legacy value encodings and writes the
+// index in plaintext.
+func buildAddrHistory(ns walletdb.ReadWriteBucket) error {
+	txNs := ns.NestedReadBucket(BucketTxJson)
+	spendOrder := func(txId *hash.Hash) (uint32, error) {
+		v := txNs.Get(txId[:])
+		if v == nil {
+			return HistoryUnminedOrder, nil
+		}
+		tr, err := decodeLegacyTx(v)
+		if err != nil {
+			return 0, err
+		}
+		return TxHistoryOrder(tr), nil
+	}
+
+	for _, id := range types.CoinIDList {
+		outNs := ns.NestedReadBucket(CoinBucket(BucketAddrtxout, id))
+		if outNs == nil {
+			continue
+		}
+		var outs []*AddrTxOutput
+		err := outNs.ForEach(func(addr, v []byte) error {
+			addrNs := outNs.NestedReadBucket(addr)
+			if v != nil || addrNs == nil {
+				return nil
+			}
+			return addrNs.ForEach(func(_, v []byte) error {
+				out, err := decodeLegacyAddrTxOutput(v)
+				if err != nil {
+					return err
+				}
+				out.Address = string(addr)
+				outs = append(outs, out)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, out := range outs {
+			order := uint32(HistoryUnminedOrder)
+			if out.Spend == SpendStatusSpend && out.SpendTo != nil {
+				order, err = spendOrder(&out.SpendTo.TxId)
+				if err != nil {
+					return err
+				}
+			}
+			if err := putHistoryOutput(nil, ns, out, order); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
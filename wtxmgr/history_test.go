@@ -0,0 +1,257 @@
+package wtxmgr
+
+import (
+	"encoding/json"
+	"testing"
+
+	corejson "github.com/Qitmeer/qng/core/json"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	_ "github.com/Qitmeer/qitmeer-wallet/walletdb/memdb"
+	"github.com/Qitmeer/qng/common/hash"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+var namespaceKey = []byte("wtxmgr")
+
+func testStore(t *testing.T) (walletdb.DB, *Store) {
+	db, err := walletdb.Create("memdb", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns, err := tx.CreateTopLevelBucket(namespaceKey)
+		if err != nil {
+			return err
+		}
+		return Create(ns)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &Store{}
+}
+
+func testOutput(addr string, txId hash.Hash, order int32, value int64) *AddrTxOutput {
+	return &AddrTxOutput{
+		Address: addr,
+		TxId:    txId,
+		Amount:  types.Amount{Value: value, Id: types.MEERA},
+		Block:   Block{Hash: hash.Hash{byte(order)}, Order: order},
+		SpendTo: &SpendTo{},
+	}
+}
+
+func readHistory(t *testing.T, db walletdb.DB, s *Store, addr string, cursor []byte, limit int,
+	match func(*AddrHistoryEntry) bool) ([]AddrHistoryEntry, []byte) {
+
+	var entries []AddrHistoryEntry
+	var next []byte
+	err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+		var err error
+		entries, next, err = s.AddrHistory(tx.ReadBucket(namespaceKey), addr, cursor, limit, match)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries, next
+}
+
+type wantEntry struct {
+	txId      hash.Hash
+	order     uint32
+	variation int64
+}
+
+func checkHistory(t *testing.T, entries []AddrHistoryEntry, want ...wantEntry) {
+	t.Helper()
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.TxId != want[i].txId || e.Order != want[i].order || e.Variation() != want[i].variation {
+			t.Errorf("entry %d: tx %v order %d variation %d, want tx %v order %d variation %d",
+				i, e.TxId, e.Order, e.Variation(), want[i].txId, want[i].order, want[i].variation)
+		}
+	}
+}
+
+func TestAddrHistory(t *testing.T) {
+	db, s := testStore(t)
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	txA, txB, txC := hash.Hash{0xa}, hash.Hash{0xb}, hash.Hash{0xc}
+
+	received := testOutput(addr, txA, 10, 100)
+	change := testOutput(addr, txB, 12, 30)
+	change.Index = 1
+	put := func(out *AddrTxOutput, spendOrder uint32) {
+		t.Helper()
+		err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+			return s.PutHistoryOutput(tx.ReadWriteBucket(namespaceKey), out, spendOrder)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Received twice, e.g. by a rescan, and spent by the unmined txB.
+	put(received, HistoryUnminedOrder)
+	put(received, HistoryUnminedOrder)
+	received.Spend = SpendStatusSpend
+	received.SpendTo = &SpendTo{TxId: txB}
+	put(received, HistoryUnminedOrder)
+	entries, next := readHistory(t, db, s, addr, nil, 10, nil)
+	checkHistory(t, entries,
+		wantEntry{txB, HistoryUnminedOrder, -100},
+		wantEntry{txA, 10, 100})
+	if next != nil {
+		t.Fatalf("next cursor %x after the last entry", next)
+	}
+
+	// txB is mined at 12 with change to the address, txC at 11.
+	put(received, 12)
+	put(change, HistoryUnminedOrder)
+	put(testOutput(addr, txC, 11, 50), HistoryUnminedOrder)
+	entries, next = readHistory(t, db, s, addr, nil, 2, nil)
+	checkHistory(t, entries,
+		wantEntry{txB, 12, -70},
+		wantEntry{txC, 11, 50})
+	if next == nil {
+		t.Fatal("no next cursor")
+	}
+	entries, next = readHistory(t, db, s, addr, next, 2, nil)
+	checkHistory(t, entries, wantEntry{txA, 10, 100})
+	if next != nil {
+		t.Fatalf("next cursor %x after the last entry", next)
+	}
+
+	// Incoming payments only.
+	in := func(e *AddrHistoryEntry) bool { return e.Variation() > 0 }
+	entries, next = readHistory(t, db, s, addr, nil, 1, in)
+	checkHistory(t, entries, wantEntry{txC, 11, 50})
+	entries, _ = readHistory(t, db, s, addr, next, 1, in)
+	checkHistory(t, entries, wantEntry{txA, 10, 100})
+
+	// Removing the output removes its payment and its spend.
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		return s.DeleteHistoryOutput(tx.ReadWriteBucket(namespaceKey), received)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = readHistory(t, db, s, addr, nil, 10, nil)
+	checkHistory(t, entries,
+		wantEntry{txB, 12, 30},
+		wantEntry{txC, 11, 50})
+}
+
+func TestAddrsHistory(t *testing.T) {
+	db, s := testStore(t)
+	const pkh = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	const pk = "TkQ4ko2pN9j8tqDXNzs6QRNVNaNjdQdAzjvWLHXsvwbGXE5LNxjH2"
+	txA, txB, txC := hash.Hash{0xa}, hash.Hash{0xb}, hash.Hash{0xc}
+
+	// txB spends the output of pkh from txA and pays change to pk.
+	received := testOutput(pkh, txA, 10, 100)
+	received.Spend = SpendStatusSpend
+	received.SpendTo = &SpendTo{TxId: txB}
+	change := testOutput(pk, txB, 12, 30)
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(namespaceKey)
+		if err := s.PutHistoryOutput(ns, received, 12); err != nil {
+			return err
+		}
+		if err := s.PutHistoryOutput(ns, change, HistoryUnminedOrder); err != nil {
+			return err
+		}
+		return s.PutHistoryOutput(ns, testOutput(pk, txC, 11, 50), HistoryUnminedOrder)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(cursor []byte, limit int) ([]AddrHistoryEntry, []byte) {
+		t.Helper()
+		var entries []AddrHistoryEntry
+		var next []byte
+		err := walletdb.View(db, func(tx walletdb.ReadTx) error {
+			var err error
+			entries, next, err = s.AddrsHistory(tx.ReadBucket(namespaceKey),
+				[]string{pkh, pk}, cursor, limit, nil)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries, next
+	}
+
+	entries, next := read(nil, 10)
+	checkHistory(t, entries,
+		wantEntry{txB, 12, -70},
+		wantEntry{txC, 11, 50},
+		wantEntry{txA, 10, 100})
+	if next != nil {
+		t.Fatalf("next cursor %x after the last entry", next)
+	}
+
+	// The merged cursor pages through both addresses.
+	entries, next = read(nil, 1)
+	checkHistory(t, entries, wantEntry{txB, 12, -70})
+	entries, next = read(next, 1)
+	checkHistory(t, entries, wantEntry{txC, 11, 50})
+	entries, next = read(next, 1)
+	checkHistory(t, entries, wantEntry{txA, 10, 100})
+	if next != nil {
+		t.Fatalf("next cursor %x after the last entry", next)
+	}
+}
+
+func TestAddAddrHistoryMigration(t *testing.T) {
+	db, s := testStore(t)
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	txA, txB := hash.Hash{0xa}, hash.Hash{0xb}
+
+	// Wallets before the migration have gob and JSON encoded records.
+
+	err := walletdb.Update(db, func(tx walletdb.ReadWriteTx) error {
+		ns := tx.ReadWriteBucket(namespaceKey)
+		out := testOutput(addr, txA, 10, 100)
+		out.Spend = SpendStatusSpend
+		out.SpendTo = &SpendTo{TxId: txB}
+		if err := putLegacyOutput(ns, out); err != nil {
+			return err
+		}
+		blockHash := hash.Hash{12}
+		v, err := json.Marshal(corejson.TxRawResult{
+			Txid:       txB.String(),
+			BlockHash:  blockHash.String(),
+			BlockOrder: 12,
+		})
+		if err != nil {
+			return err
+		}
+		if err := ns.NestedReadWriteBucket(BucketTxJson).Put(txB[:], v); err != nil {
+			return err
+		}
+
+		// Wallets before the migration have no history index.
+		if err := ns.DeleteNestedBucket(BucketAddrHistory); err != nil {
+			return err
+		}
+		if err := ns.DeleteNestedBucket(BucketAddrHistoryTx); err != nil {
+			return err
+		}
+		return addAddrHistory(ns)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := readHistory(t, db, s, addr, nil, 10, nil)
+	checkHistory(t, entries,
+		wantEntry{txB, 12, -100},
+		wantEntry{txA, 10, 100})
+}
@@ -1,43 +1,75 @@
 package wtxmgr
 
 import (
+	"fmt"
+
 	"github.com/Qitmeer/qitmeer-wallet/walletdb"
 	"github.com/Qitmeer/qitmeer-wallet/walletdb/migration"
+	"github.com/Qitmeer/qng/common/hash"
 	"github.com/Qitmeer/qng/core/types"
 	"github.com/Qitmeer/qng/log"
 )
 
-// versions is a list of the different database versions. The last entry should
-// reflect the latest database state. If the database happens to be at a version
-// number lower than the latest, migrations will be performed in order to catch
-// it up.
-var versions = []migration.Version{
-	{
-		Number:    1,
-		Migration: nil,
-	},
-	{
-		Number:    2,
-		Migration: dropTransactionHistory,
-	},
+// versions returns the list of the different database versions. The last entry
+// should reflect the latest database state. If the database happens to be at a
+// version number lower than the latest, migrations will be performed in order
+// to catch it up.  The encryptRecords migration encrypts with cryptoKey.
+func versions(cryptoKey CryptoKey) []migration.Version {
+	return []migration.Version{
+		{
+			Number:    1,
+			Migration: nil,
+		},
+		{
+			Number:    2,
+			Migration: dropTransactionHistory,
+		},
+		{
+			Number:    3,
+			Migration: addAddrHistory,
+		},
+		{
+			Number:    4,
+			Migration: compactRecords,
+		},
+		{
+			Number: 5,
+			Migration: func(ns walletdb.ReadWriteBucket) error {
+				return encryptRecords(ns, cryptoKey)
+			},
+		},
+		{
+			Number:    6,
+			Migration: addAccountBalances,
+		},
+	}
 }
 
 // getLatestVersion returns the version number of the latest database version.
 func getLatestVersion() uint32 {
-	return versions[len(versions)-1].Number
+	v := versions(nil)
+	return v[len(v)-1].Number
 }
 
 // MigrationManager is an implementation of the migration.Manager interface that
 // will be used to handle migrations for the address manager. It exposes the
 // necessary parameters required to successfully perform migrations.
 type MigrationManager struct {
-	ns walletdb.ReadWriteBucket
+	ns        walletdb.ReadWriteBucket
+	cryptoKey CryptoKey
 }
 
 // A compile-time assertion to ensure that MigrationManager implements the
 // migration.Manager interface.
 var _ migration.Manager = (*MigrationManager)(nil)
 
+// NewMigrationManager returns a MigrationManager for the transaction store in
+// the namespace ns, whose values are encrypted with cryptoKey, the public
+// crypto key of the address manager.
+func NewMigrationManager(ns walletdb.ReadWriteBucket, cryptoKey CryptoKey) *MigrationManager {
+	return &MigrationManager{ns: ns, cryptoKey: cryptoKey}
+}
+
 // Name returns the name of the service we'll be attempting to upgrade.
 // NOTE: This method is part of the migration.Manager interface.
 func (m *MigrationManager) Name() string {
@@ -77,7 +109,7 @@ func (m *MigrationManager) SetVersion(ns walletdb.ReadWriteBucket,
 //
 // NOTE: This method is part of the migration.Manager interface.
 func (m *MigrationManager) Versions() []migration.Version {
-	return versions
+	return versions(m.cryptoKey)
 }
 
 // dropTransactionHistory is a migration that attempts to recreate the
@@ -102,3 +134,295 @@ func dropTransactionHistory(ns walletdb.ReadWriteBucket) error {
 	// Finally, we'll insert a 0 value for our mined balance.
 	return putMinedBalance(ns, types.Amount{})
 }
+
+// addAddrHistory is a migration that builds the address history index from
+// the outputs of every address.
+func addAddrHistory(ns walletdb.ReadWriteBucket) error {
+	log.Info("Building the address history index")
+
+	if _, err := ns.CreateBucketIfNotExists(BucketAddrHistory); err != nil {
+		str := "failed to create address history bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	if _, err := ns.CreateBucketIfNotExists(BucketAddrHistoryTx); err != nil {
+		str := "failed to create address history tx bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	return buildAddrHistory(ns)
+}
+
+// compactRecords is a migration that rewrites the address outputs, the
+// unconfirmed transactions and the stored transactions from their gob and
+// JSON encodings to the compact record encodings.
+func compactRecords(ns walletdb.ReadWriteBucket) error {
+	log.Info("Converting transaction records to the compact encoding")
+
+	for _, id := range types.CoinIDList {
+		outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, id))
+		if outNs == nil {
+			continue
+		}
+		var addrs [][]byte
+		err := outNs.ForEach(func(k, v []byte) error {
+			if v == nil {
+				addrs = append(addrs, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			err := rewriteRecords(outNs.NestedReadWriteBucket(addr), func(v []byte) ([]byte, error) {
+				out, err := decodeLegacyAddrTxOutput(v)
+				if err != nil {
+					return nil, err
+				}
+				out.Address = string(addr)
+				return out.Encode(), nil
+			})
+			if err != nil {
+				str := fmt.Sprintf("failed to convert outputs of %s", addr)
+				return storeError(ErrData, str, err)
+			}
+		}
+	}
+
+	err := rewriteRecords(ns.NestedReadWriteBucket(BucketUnConfirmed), func(v []byte) ([]byte, error) {
+		u, err := decodeLegacyUnconfirmTx(v)
+		if err != nil {
+			return nil, err
+		}
+		return u.Marshal(), nil
+	})
+	if err != nil {
+		str := "failed to convert unconfirmed transactions"
+		return storeError(ErrData, str, err)
+	}
+
+	err = rewriteRecords(ns.NestedReadWriteBucket(BucketTxJson), func(v []byte) ([]byte, error) {
+		tr, err := decodeLegacyTx(v)
+		if err != nil {
+			return nil, err
+		}
+		return EncodeStoredTx(tr)
+	})
+	if err != nil {
+		str := "failed to convert stored transactions"
+		return storeError(ErrData, str, err)
+	}
+	return nil
+}
+
+// rewriteRecords replaces every value of the bucket b by its conversion.
+func rewriteRecords(b walletdb.ReadWriteBucket, convert func(v []byte) ([]byte, error)) error {
+	if b == nil {
+		return nil
+	}
+	type record struct{ k, v []byte }
+	var records []record
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		nv, err := convert(v)
+		if err != nil {
+			return fmt.Errorf("key %x: %v", k, err)
+		}
+		records = append(records, record{append([]byte(nil), k...), nv})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := b.Put(r.k, r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptRecords is a migration that encrypts the values of the store with
+// cryptoKey and replaces the bucket keys revealing addresses and transactions
+// by their HMACs.
+func encryptRecords(ns walletdb.ReadWriteBucket, cryptoKey CryptoKey) error {
+	log.Info("Encrypting wallet transaction history")
+
+	if cryptoKey == nil {
+		str := "no crypto key to encrypt the transaction history"
+		return storeError(ErrCrypto, str, nil)
+	}
+	keys := newRecordKeys(cryptoKey)
+
+	for _, id := range types.CoinIDList {
+		// Outputs are keyed by outpoint in a nested bucket per address.
+		outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, id))
+		for _, addr := range nestedBucketKeys(outNs) {
+			err := rekeyBucket(outNs, addr, keys.addrKey(string(addr)), func(k, v []byte) ([]byte, []byte, error) {
+				out, err := DecodeAddrTxOutput(v)
+				if err != nil {
+					return nil, nil, err
+				}
+				v, err = keys.seal(v)
+				return keys.outPointKey(&out.TxId, out.Index), v, err
+			})
+			if err != nil {
+				str := fmt.Sprintf("failed to encrypt outputs of %s", addr)
+				return storeError(ErrData, str, err)
+			}
+		}
+
+		// Spent outpoints are both the key and the value.
+		inNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxin, id))
+		for _, addr := range nestedBucketKeys(inNs) {
+			err := rekeyBucket(inNs, addr, keys.addrKey(string(addr)), func(k, v []byte) ([]byte, []byte, error) {
+				var op types.TxOutPoint
+				if err := readCanonicalOutPoint(k, &op); err != nil {
+					return nil, nil, err
+				}
+				v, err := keys.seal(v)
+				return keys.outPointKey(&op.Hash, op.OutIndex), v, err
+			})
+			if err != nil {
+				str := fmt.Sprintf("failed to encrypt inputs of %s", addr)
+				return storeError(ErrData, str, err)
+			}
+		}
+	}
+
+	err := rekeyBucket(ns, BucketTxJson, BucketTxJson, func(k, v []byte) ([]byte, []byte, error) {
+		txId, err := hash.NewHash(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err = keys.seal(v)
+		return keys.txKey(txId), v, err
+	})
+	if err != nil {
+		str := "failed to encrypt stored transactions"
+		return storeError(ErrData, str, err)
+	}
+
+	err = rekeyBucket(ns, BucketUnConfirmed, BucketUnConfirmed, func(k, v []byte) ([]byte, []byte, error) {
+		txId, err := hash.NewHash(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		u, err := UnMarshalUnconfirmTx(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err = keys.sealUnconfirmed(txId, u)
+		return keys.txKey(txId), v, err
+	})
+	if err != nil {
+		str := "failed to encrypt unconfirmed transactions"
+		return storeError(ErrData, str, err)
+	}
+
+	historyNs := ns.NestedReadWriteBucket(BucketAddrHistory)
+	for _, addr := range nestedBucketKeys(historyNs) {
+		err := rekeyBucket(historyNs, addr, keys.addrKey(string(addr)), func(k, v []byte) ([]byte, []byte, error) {
+			var e AddrHistoryEntry
+			if err := readAddrHistory(nil, k, v, &e); err != nil {
+				return nil, nil, err
+			}
+			v, err := valueAddrHistory(keys, &e.TxId, e.Parts)
+			return keyAddrHistory(keys, e.Order, &e.TxId), v, err
+		})
+		if err != nil {
+			str := fmt.Sprintf("failed to encrypt history of %s", addr)
+			return storeError(ErrData, str, err)
+		}
+	}
+	historyTxNs := ns.NestedReadWriteBucket(BucketAddrHistoryTx)
+	for _, addr := range nestedBucketKeys(historyTxNs) {
+		err := rekeyBucket(historyTxNs, addr, keys.addrKey(string(addr)), func(k, v []byte) ([]byte, []byte, error) {
+			txId, err := hash.NewHash(k)
+			if err != nil {
+				return nil, nil, err
+			}
+			return keys.txKey(txId), v, nil
+		})
+		if err != nil {
+			str := fmt.Sprintf("failed to encrypt history orders of %s", addr)
+			return storeError(ErrData, str, err)
+		}
+	}
+	return nil
+}
+
+// nestedBucketKeys returns the keys of the nested buckets of b, which may be
+// nil.
+func nestedBucketKeys(b walletdb.ReadWriteBucket) [][]byte {
+	if b == nil {
+		return nil
+	}
+	var keys [][]byte
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	return keys
+}
+
+// rekeyBucket replaces the nested bucket name of parent by the bucket newName
+// holding the records of the old bucket converted by convert.
+func rekeyBucket(parent walletdb.ReadWriteBucket, name, newName []byte,
+	convert func(k, v []byte) ([]byte, []byte, error)) error {
+
+	b := parent.NestedReadWriteBucket(name)
+	if b == nil {
+		return nil
+	}
+	type record struct{ k, v []byte }
+	var records []record
+	err := b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil
+		}
+		nk, nv, err := convert(k, v)
+		if err != nil {
+			return fmt.Errorf("key %x: %v", k, err)
+		}
+		records = append(records, record{nk, nv})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := parent.DeleteNestedBucket(name); err != nil {
+		return err
+	}
+	nb, err := parent.CreateBucket(newName)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := nb.Put(r.k, r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addAccountBalances is a migration that adds the account balances.  The
+// mined balances are kept by the credit store and not for address outputs.
+// Summing the outputs by account needs the address manager, so the migration
+// leaves the balances unbuilt and the wallet rebuilds them when it is opened.
+func addAccountBalances(ns walletdb.ReadWriteBucket) error {
+	log.Info("Adding account balances")
+
+	if _, err := ns.CreateBucketIfNotExists(BucketAccountBalance); err != nil {
+		str := "failed to create account balance bucket"
+		return storeError(ErrDatabase, str, err)
+	}
+	if err := ns.Delete(rootBalancesBuilt); err != nil {
+		str := "failed to delete balances built flag"
+		return storeError(ErrDatabase, str, err)
+	}
+	return nil
+}
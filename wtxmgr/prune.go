@@ -0,0 +1,127 @@
+package wtxmgr
+
+import (
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// FetchStoredTx returns the transaction txId stored in BucketTxJson, or nil
+// when it is not stored, and whether it was pruned by PruneTxJson.  A pruned
+// transaction lacks its scripts, sequences, hash, version and lock time.
+func (s *Store) FetchStoredTx(ns walletdb.ReadBucket, txId *hash.Hash) (*corejson.TxRawResult, bool, error) {
+	v := ns.NestedReadBucket(BucketTxJson).Get(s.keys.txKey(txId))
+	if v == nil {
+		return nil, false, nil
+	}
+	v, err := s.keys.open(v)
+	if err != nil {
+		return nil, false, err
+	}
+	return decodeStoredTx(v)
+}
+
+// ForEachTxJson calls f with every transaction stored in BucketTxJson and
+// whether it was pruned.  f must not modify the bucket.
+func (s *Store) ForEachTxJson(ns walletdb.ReadBucket, f func(tr *corejson.TxRawResult, pruned bool) error) error {
+	return ns.NestedReadBucket(BucketTxJson).ForEach(func(_, v []byte) error {
+		v, err := s.keys.open(v)
+		if err != nil {
+			return err
+		}
+		tr, pruned, err := decodeStoredTx(v)
+		if err != nil {
+			return err
+		}
+		return f(tr, pruned)
+	})
+}
+
+// PruneTxJson replaces the stored transaction tr by its summary.  The wallet
+// must no longer need its scripts, which is the case once all the outputs of
+// the wallet it pays are spent.
+func (s *Store) PruneTxJson(ns walletdb.ReadWriteBucket, tr *corejson.TxRawResult) error {
+	txId, err := hash.NewHashFromStr(tr.Txid)
+	if err != nil {
+		return storeError(ErrInput, "invalid transaction id", err)
+	}
+	v, err := EncodePrunedTx(tr)
+	if err != nil {
+		return err
+	}
+	v, err = s.keys.seal(v)
+	if err != nil {
+		return err
+	}
+	err = ns.NestedReadWriteBucket(BucketTxJson).Put(s.keys.txKey(txId), v)
+	if err != nil {
+		str := "failed to put pruned transaction " + tr.Txid
+		return storeError(ErrDatabase, str, err)
+	}
+	return nil
+}
+
+// PruneSpentTxs prunes the transactions mined before the block order before
+// whose outputs paying the wallet are all spent, and returns the number of
+// pruned transactions.  Transactions waiting for confirmations are kept.
+func (s *Store) PruneSpentTxs(ns walletdb.ReadWriteBucket, before uint32) (int, error) {
+	unconfirmed := map[hash.Hash]bool{}
+	err := s.ForEachUnconfirmed(ns, func(txId *hash.Hash, _ *UnconfirmTx) error {
+		unconfirmed[*txId] = true
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var prunable []*corejson.TxRawResult
+	err = s.ForEachTxJson(ns, func(tr *corejson.TxRawResult, pruned bool) error {
+		if pruned || tr.BlockHash == "" || tr.BlockOrder >= uint64(before) {
+			return nil
+		}
+		txId, err := hash.NewHashFromStr(tr.Txid)
+		if err != nil || unconfirmed[*txId] {
+			return err
+		}
+		spent, err := s.outputsSpent(ns, txId, tr)
+		if err != nil || !spent {
+			return err
+		}
+		prunable = append(prunable, tr)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tr := range prunable {
+		if err := s.PruneTxJson(ns, tr); err != nil {
+			return 0, err
+		}
+	}
+	return len(prunable), nil
+}
+
+// outputsSpent returns whether all the outputs of tr stored for the wallet
+// are spent.
+func (s *Store) outputsSpent(ns walletdb.ReadBucket, txId *hash.Hash, tr *corejson.TxRawResult) (bool, error) {
+	for i, vout := range tr.Vout {
+		if len(vout.ScriptPubKey.Addresses) == 0 {
+			continue
+		}
+		outNs := ns.NestedReadBucket(CoinBucket(BucketAddrtxout, types.CoinID(vout.CoinId)))
+		if outNs == nil {
+			continue
+		}
+		point := types.TxOutPoint{Hash: *txId, OutIndex: uint32(i)}
+		out, err := s.FetchAddrTxOut(outNs, vout.ScriptPubKey.Addresses[0], point)
+		if err != nil {
+			return false, err
+		}
+		if out != nil && out.Spend != SpendStatusSpend {
+			return false, nil
+		}
+	}
+	return true, nil
+}
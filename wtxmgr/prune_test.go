@@ -0,0 +1,138 @@
+package wtxmgr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer-wallet/walletdb"
+	"github.com/Qitmeer/qng/common/hash"
+	corejson "github.com/Qitmeer/qng/core/json"
+	"github.com/Qitmeer/qng/core/types"
+)
+
+// prunedTx returns tr without the fields dropped by pruning.
+func prunedTx(tr *corejson.TxRawResult) *corejson.TxRawResult {
+	p := *tr
+	p.TxHash = ""
+	p.Version = 0
+	p.LockTime = 0
+	p.Vin = append([]corejson.Vin(nil), tr.Vin...)
+	for i := range p.Vin {
+		p.Vin[i].Sequence = 0
+	}
+	p.Vout = append([]corejson.Vout(nil), tr.Vout...)
+	for i := range p.Vout {
+		p.Vout[i].ScriptPubKey.Type = ""
+		p.Vout[i].ScriptPubKey.Hex = ""
+	}
+	return &p
+}
+
+func TestPrunedTxEncoding(t *testing.T) {
+	tr := testTx()
+	full, err := EncodeStoredTx(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := EncodePrunedTx(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, pruned, err := decodeStoredTx(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pruned {
+		t.Fatal("pruned transaction decoded as full")
+	}
+	if want := prunedTx(tr); !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %+v, want %+v", got, want)
+	}
+	if len(v) >= len(full) {
+		t.Errorf("pruned transaction has %d bytes, full one %d", len(v), len(full))
+	}
+	if _, pruned, _ := decodeStoredTx(full); pruned {
+		t.Error("full transaction decoded as pruned")
+	}
+}
+
+func TestPruneSpentTxs(t *testing.T) {
+	db, s := testStore(t)
+	const addr = "TmWMuY9q5dUutUTGikhqTVKrnDMG34dEgb5"
+	spentId, unspentId, recentId, unconfirmedId := hash.Hash{0x1}, hash.Hash{0x2}, hash.Hash{0x3}, hash.Hash{0x4}
+
+	tx := func(txId hash.Hash, order uint64) *corejson.TxRawResult {
+		tr := testTx()
+		tr.Txid = txId.String()
+		tr.BlockOrder = order
+		return tr
+	}
+	txs := []*corejson.TxRawResult{tx(spentId, 100), tx(unspentId, 100), tx(recentId, 900), tx(unconfirmedId, 100)}
+	unmined := tx(hash.Hash{0x5}, 0)
+	unmined.BlockHash = ""
+	txs = append(txs, unmined)
+
+	err := walletdb.Update(db, func(dbtx walletdb.ReadWriteTx) error {
+		ns := dbtx.ReadWriteBucket(namespaceKey)
+		outNs := ns.NestedReadWriteBucket(CoinBucket(BucketAddrtxout, types.MEERA))
+		for _, tr := range txs {
+			if err := s.PutTxJson(ns, tr); err != nil {
+				return err
+			}
+			txId, _ := hash.NewHashFromStr(tr.Txid)
+			out := testOutput(addr, *txId, int32(tr.BlockOrder), 100000000)
+			if *txId != unspentId {
+				out.Spend = SpendStatusSpend
+				out.SpendTo = &SpendTo{TxId: hash.Hash{0xf}}
+			}
+			if err := s.InsertAddrTxOut(outNs, out); err != nil {
+				return err
+			}
+		}
+		return s.PutUnconfirmed(ns, &unconfirmedId, &UnconfirmTx{Order: 100, Confirmations: 10})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prune := func() int {
+		var n int
+		err := walletdb.Update(db, func(dbtx walletdb.ReadWriteTx) error {
+			var err error
+			n, err = s.PruneSpentTxs(dbtx.ReadWriteBucket(namespaceKey), 500)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := prune(); n != 1 {
+		t.Fatalf("pruned %d transactions, want 1", n)
+	}
+	if n := prune(); n != 0 {
+		t.Fatalf("pruned %d transactions again", n)
+	}
+
+	err = walletdb.View(db, func(dbtx walletdb.ReadTx) error {
+		ns := dbtx.ReadBucket(namespaceKey)
+		for _, tr := range txs {
+			txId, _ := hash.NewHashFromStr(tr.Txid)
+			got, pruned, err := s.FetchStoredTx(ns, txId)
+			if err != nil {
+				return err
+			}
+			want := tr
+			if *txId == spentId {
+				want = prunedTx(tr)
+			}
+			if pruned != (*txId == spentId) || !reflect.DeepEqual(got, want) {
+				t.Errorf("tx %s: pruned %v, %+v, want %+v", tr.Txid, pruned, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,9 +1,7 @@
 package wtxmgr
 
 import (
-	"encoding/json"
 	"fmt"
-	util "github.com/Qitmeer/qitmeer-wallet/utils"
 	"github.com/Qitmeer/qng/common/math"
 	corejson "github.com/Qitmeer/qng/core/json"
 	"time"
@@ -67,16 +65,6 @@ func NewAddrTxOutput() *AddrTxOutput {
 	return &AddrTxOutput{SpendTo: &SpendTo{}}
 }
 
-func (a *AddrTxOutput) Encode() []byte {
-	bytes, _ := util.Encode(a)
-	return bytes
-}
-
-func DecodeAddrTxOutput(bytes []byte) (*AddrTxOutput, error) {
-	output := &AddrTxOutput{}
-	return output, util.Decode(bytes, output)
-}
-
 type AddrTxOutputs []AddrTxOutput
 
 func (s AddrTxOutputs) Len() int { return len(s) }
@@ -115,17 +103,6 @@ type UnconfirmTx struct {
 	Confirmations uint32
 }
 
-func (u *UnconfirmTx) Marshal() []byte {
-	bytes, _ := json.Marshal(u)
-	return bytes
-}
-
-func UnMarshalUnconfirmTx(bytes []byte) (*UnconfirmTx, error) {
-	u := &UnconfirmTx{}
-	err := json.Unmarshal(bytes, u)
-	return u, err
-}
-
 type UTxo struct {
 	Address string
 	TxId    string
@@ -182,6 +159,7 @@ type Credit struct {
 // transactions.
 type Store struct {
 	chainParams *params.Params
+	keys        *recordKeys
 
 	// Event callbacks.  These execute in the same goroutine as the wtxmgr
 	// caller.
@@ -189,14 +167,15 @@ type Store struct {
 }
 
 // Open opens the wallet transaction store from a walletdb namespace.  If the
-// store does not exist, ErrNoExist is returned.
-func Open(ns walletdb.ReadBucket, chainParams *params.Params) (*Store, error) {
+// store does not exist, ErrNoExist is returned.  Values are encrypted with
+// cryptoKey, the public crypto key of the address manager.
+func Open(ns walletdb.ReadBucket, chainParams *params.Params, cryptoKey CryptoKey) (*Store, error) {
 	// Open the store.
 	err := openStore(ns)
 	if err != nil {
 		return nil, err
 	}
-	s := &Store{chainParams, nil} // TODO: set callbacks
+	s := &Store{chainParams: chainParams, keys: newRecordKeys(cryptoKey)} // TODO: set callbacks
 	return s, nil
 }
 
@@ -208,67 +187,183 @@ func Create(ns walletdb.ReadWriteBucket) error {
 }
 
 func (s *Store) UpdateAddrTxIn(ns walletdb.ReadWriteBucket, addr string, outPoint *types.TxOutPoint) error {
-	inRw, err := ns.CreateBucketIfNotExists([]byte(addr))
+	inRw, err := ns.CreateBucketIfNotExists(s.keys.addrKey(addr))
 	if err != nil {
 		return err
 	} else {
-		v := canonicalOutPoint(&outPoint.Hash, outPoint.OutIndex)
-		err := inRw.Put(v, v)
-		return err
+		v, err := s.keys.seal(canonicalOutPoint(&outPoint.Hash, outPoint.OutIndex))
+		if err != nil {
+			return err
+		}
+		return inRw.Put(s.keys.outPointKey(&outPoint.Hash, outPoint.OutIndex), v)
 	}
 }
 
 func (s *Store) InsertAddrTxOut(ns walletdb.ReadWriteBucket, txOut *AddrTxOutput) error {
-	outRw, err := ns.CreateBucketIfNotExists([]byte(txOut.Address))
+	outRw, err := ns.CreateBucketIfNotExists(s.keys.addrKey(txOut.Address))
 	if err != nil {
 		return err
 	} else {
-		k := canonicalOutPoint(&txOut.TxId, txOut.Index)
-		v := txOut.Encode()
+		k := s.keys.outPointKey(&txOut.TxId, txOut.Index)
 		oldTxOut := outRw.Get(k)
-		if oldTxOut == nil || len(oldTxOut) == 0 {
-			err := outRw.Put(k, v)
-			return err
-		} else {
-			addTxOutPut := NewAddrTxOutput()
-			addTxOutPut, err := DecodeAddrTxOutput(oldTxOut)
+		if len(oldTxOut) != 0 {
+			addTxOutPut, err := s.readAddrTxOut(oldTxOut)
 			if err != nil {
 				return err
 			}
-			if addTxOutPut.Spend != SpendStatusSpend {
-				err := outRw.Put(k, v)
-				return err
-			} else {
+			if addTxOutPut.Spend == SpendStatusSpend {
 				txOut.SpendTo = addTxOutPut.SpendTo
 				txOut.Spend = addTxOutPut.Spend
-				v := txOut.Encode()
-				err := outRw.Put(k, v)
-				return err
 			}
 		}
+		return s.putAddrTxOut(outRw, k, txOut)
 	}
 }
+
 func (s *Store) UpdateAddrTxOut(ns walletdb.ReadWriteBucket, txOut *AddrTxOutput) error {
-	outRw, err := ns.CreateBucketIfNotExists([]byte(txOut.Address))
+	outRw, err := ns.CreateBucketIfNotExists(s.keys.addrKey(txOut.Address))
 	if err != nil {
 		return err
 	} else {
-		k := canonicalOutPoint(&txOut.TxId, txOut.Index)
-		v := txOut.Encode()
-		err := outRw.Put(k, v)
+		return s.putAddrTxOut(outRw, s.keys.outPointKey(&txOut.TxId, txOut.Index), txOut)
+	}
+}
+
+func (s *Store) putAddrTxOut(outRw walletdb.ReadWriteBucket, k []byte, txOut *AddrTxOutput) error {
+	v, err := s.keys.seal(txOut.Encode())
+	if err != nil {
 		return err
 	}
+	return outRw.Put(k, v)
 }
+
+func (s *Store) readAddrTxOut(v []byte) (*AddrTxOutput, error) {
+	v, err := s.keys.open(v)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeAddrTxOutput(v)
+}
+
+// DeleteAddrTxOut removes the output at point from the outputs of address.
+// Deleting a missing output is not an error.
+func (s *Store) DeleteAddrTxOut(ns walletdb.ReadWriteBucket, address string, point types.TxOutPoint) error {
+	outRw := ns.NestedReadWriteBucket(s.keys.addrKey(address))
+	if outRw == nil {
+		return nil
+	}
+	return outRw.Delete(s.keys.outPointKey(&point.Hash, point.OutIndex))
+}
+
 func (s *Store) GetAddrTxOut(ns walletdb.ReadWriteBucket, address string, point types.TxOutPoint) (*AddrTxOutput, error) {
-	outRw := ns.NestedReadWriteBucket([]byte(address))
-	k := canonicalOutPoint(&point.Hash, point.OutIndex)
-	txOut := outRw.Get(k)
-	addTxOutPut := NewAddrTxOutput()
-	addTxOutPut, err := DecodeAddrTxOutput(txOut)
+	txOut, err := s.FetchAddrTxOut(ns, address, point)
 	if err != nil {
 		return nil, err
 	}
-	return addTxOutPut, nil
+	if txOut == nil {
+		str := fmt.Sprintf("output %v:%d of %s does not exist", point.Hash, point.OutIndex, address)
+		return nil, storeError(ErrData, str, nil)
+	}
+	return txOut, nil
+}
+
+// FetchAddrTxOut returns the output at point of address in the address output
+// bucket ns of a coin, or nil when it is not stored.
+func (s *Store) FetchAddrTxOut(ns walletdb.ReadBucket, address string, point types.TxOutPoint) (*AddrTxOutput, error) {
+	outNs := ns.NestedReadBucket(s.keys.addrKey(address))
+	if outNs == nil {
+		return nil, nil
+	}
+	v := outNs.Get(s.keys.outPointKey(&point.Hash, point.OutIndex))
+	if v == nil {
+		return nil, nil
+	}
+	return s.readAddrTxOut(v)
+}
+
+// ForEachAddrTxOut calls f with every output of address in the address output
+// bucket ns of a coin.
+func (s *Store) ForEachAddrTxOut(ns walletdb.ReadBucket, address string, f func(out *AddrTxOutput) error) error {
+	outNs := ns.NestedReadBucket(s.keys.addrKey(address))
+	if outNs == nil {
+		return nil
+	}
+	return outNs.ForEach(func(_, v []byte) error {
+		out, err := s.readAddrTxOut(v)
+		if err != nil {
+			return err
+		}
+		return f(out)
+	})
+}
+
+// ForEachTxOut calls f with every output of every address in the address
+// output bucket ns of a coin.
+func (s *Store) ForEachTxOut(ns walletdb.ReadBucket, f func(out *AddrTxOutput) error) error {
+	return ns.ForEach(func(addr, v []byte) error {
+		outNs := ns.NestedReadBucket(addr)
+		if v != nil || outNs == nil {
+			return nil
+		}
+		return outNs.ForEach(func(_, v []byte) error {
+			out, err := s.readAddrTxOut(v)
+			if err != nil {
+				return err
+			}
+			return f(out)
+		})
+	})
+}
+
+// PutTxJson stores the transaction tr in BucketTxJson.
+func (s *Store) PutTxJson(ns walletdb.ReadWriteBucket, tr *corejson.TxRawResult) error {
+	txId, err := hash.NewHashFromStr(tr.Txid)
+	if err != nil {
+		return storeError(ErrInput, "invalid transaction id", err)
+	}
+	v, err := EncodeStoredTx(tr)
+	if err != nil {
+		return err
+	}
+	v, err = s.keys.seal(v)
+	if err != nil {
+		return err
+	}
+	return ns.NestedReadWriteBucket(BucketTxJson).Put(s.keys.txKey(txId), v)
+}
+
+// FetchTxJson returns the transaction txId stored in BucketTxJson, or nil
+// when it is not stored.  Only the summary of pruned transactions is
+// returned, see FetchStoredTx.
+func (s *Store) FetchTxJson(ns walletdb.ReadBucket, txId *hash.Hash) (*corejson.TxRawResult, error) {
+	tr, _, err := s.FetchStoredTx(ns, txId)
+	return tr, err
+}
+
+// PutUnconfirmed records the transaction txId as waiting for confirmations.
+func (s *Store) PutUnconfirmed(ns walletdb.ReadWriteBucket, txId *hash.Hash, u *UnconfirmTx) error {
+	v, err := s.keys.sealUnconfirmed(txId, u)
+	if err != nil {
+		return err
+	}
+	return ns.NestedReadWriteBucket(BucketUnConfirmed).Put(s.keys.txKey(txId), v)
+}
+
+// DeleteUnconfirmed removes the transaction txId from the unconfirmed
+// transactions.  Deleting a missing transaction is not an error.
+func (s *Store) DeleteUnconfirmed(ns walletdb.ReadWriteBucket, txId *hash.Hash) error {
+	return ns.NestedReadWriteBucket(BucketUnConfirmed).Delete(s.keys.txKey(txId))
+}
+
+// ForEachUnconfirmed calls f with every unconfirmed transaction.
+func (s *Store) ForEachUnconfirmed(ns walletdb.ReadBucket, f func(txId *hash.Hash, u *UnconfirmTx) error) error {
+	return ns.NestedReadBucket(BucketUnConfirmed).ForEach(func(k, v []byte) error {
+		txId, u, err := s.keys.openUnconfirmed(k, v)
+		if err != nil {
+			return err
+		}
+		return f(txId, u)
+	})
 }
 
 // updateMinedBalance updates the mined balance within the store, if changed,